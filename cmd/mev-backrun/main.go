@@ -0,0 +1,81 @@
+package main
+
+import (
+	"log"
+	"math/big"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/mellis0303/mev-vem/pkg/crocodile-hunter"
+	"github.com/mellis0303/mev-vem/pkg/mev-amm"
+	"github.com/mellis0303/mev-vem/pkg/mev-backrun"
+)
+
+func EthToWei(eth int64) *big.Int {
+	return new(big.Int).Mul(big.NewInt(eth), big.NewInt(1e18))
+}
+
+func main() {
+	// Initialize the backrun strategy and a FlashHunter to submit through
+	strategy := mevbackrun.NewBackrunStrategy("0xSearcher", "WETH", big.NewInt(30e9), big.NewInt(1e15))
+	hunter := crocodilehunter.NewFlashHunter(big.NewInt(50e9), big.NewInt(1e15))
+
+	// Example pools on the same pair
+	strategy.SetPool(mevamm.NewPool("0xUniPool", "WETH", "USDC", EthToWei(1000), EthToWei(2000000), 30))
+	strategy.SetPool(mevamm.NewPool("0xSushiPool", "WETH", "USDC", EthToWei(800), EthToWei(1600000), 30))
+
+	// Example decoded pending events
+	swap := &crocodilehunter.PendingSwap{
+		Hash:         "0xwhale",
+		From:         "0xWhale",
+		Pool:         "0xUniPool",
+		TokenIn:      "WETH",
+		TokenOut:     "USDC",
+		AmountIn:     EthToWei(100),
+		MinAmountOut: big.NewInt(0),
+		GasPrice:     big.NewInt(30e9),
+	}
+	update := &mevbackrun.OracleUpdate{
+		Hash:     "0xoracle",
+		From:     "0xChainlink",
+		Oracle:   "0xEthUsdFeed",
+		Base:     "WETH",
+		Quote:    "USDC",
+		Price:    EthToWei(2100),
+		GasPrice: big.NewInt(30e9),
+	}
+
+	// Set up signal handling for graceful shutdown
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+
+	// Main event loop
+	go func() {
+		for {
+			if op, err := strategy.OnSwap(swap); err == nil {
+				hunter.AddBundle(op.Bundle())
+			} else {
+				log.Printf("Swap %s: %v\n", swap.Hash, err)
+			}
+			if op, err := strategy.OnOracleUpdate(update); err == nil {
+				// profit is marked at the oracle price until the inventory is unwound
+				log.Printf("Oracle update %s: %s wei marked, inventory %v\n", update.Hash, op.GrossProfit, op.Inventory)
+				hunter.AddBundle(op.Bundle())
+			} else {
+				log.Printf("Oracle update %s: %v\n", update.Hash, err)
+			}
+
+			// Submit [target, backrun] bundles
+			hunter.SubmitBundles()
+
+			// Wait before next iteration
+			time.Sleep(time.Second)
+		}
+	}()
+
+	// Wait for shutdown signal
+	<-sigChan
+	log.Println("Shutting down MEV Backrun...")
+}
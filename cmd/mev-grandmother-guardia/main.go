@@ -1,6 +1,9 @@
 package main
 
 import (
+	"errors"
+	"flag"
+	"fmt"
 	"log"
 	"math/big"
 	"os"
@@ -8,16 +11,73 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/mellis0303/mev-vem/pkg/mev-amm"
 	"github.com/mellis0303/mev-vem/pkg/mev-grandmother-guardia"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "report" {
+		report(os.Args[2:])
+		return
+	}
+
+	ledgerPath := flag.String("ledger", "", "journal that keeps rebate balances across restarts")
+	registryPath := flag.String("registry", "", "JSON file of users' signed protection opt-ins")
+	chainID := flag.Uint64("chain-id", 1, "chain ID opt-in signatures are bound to")
+	batchWindow := flag.Duration("batch-window", 0, "hold txs until the window they arrived in closes, then release them first-come-first-served")
+	auditPath := flag.String("audit", "", "file execution reports of approved and rejected bundles are appended to")
+	auctionWindow := flag.Duration("auction-window", mevgrandmothersguardia.DefaultAuctionWindow, "batch protected swaps for this long and clear them at one price, 0 disables")
+	settler := flag.String("settler", "0xSettler", "settlement contract that sends batch auction bundles")
+	flag.Parse()
+
 	// Initialize MEV Guardian Engine
 	guardian := mevgrandmothersguardia.NewMEVGuardianEngine()
+	if err := guardian.SetFairOrdering(mevgrandmothersguardia.FairOrdering{Mode: mevgrandmothersguardia.ModeFCFS, Window: *batchWindow}); err != nil {
+		log.Fatal("Invalid fair ordering: ", err)
+	}
+	if *ledgerPath != "" {
+		ledger, err := mevgrandmothersguardia.OpenLedger(*ledgerPath)
+		if err != nil {
+			log.Fatal("Failed to open rebate ledger: ", err)
+		}
+		defer ledger.Close()
+		guardian.SetLedger(ledger)
+	}
+	if *registryPath != "" {
+		registry, err := mevgrandmothersguardia.OpenRegistry(*registryPath, *chainID)
+		if err != nil {
+			log.Fatal("Failed to open opt-in registry: ", err)
+		}
+		guardian.SetRegistry(registry)
+		log.Printf("Loaded %d opt-ins\n", len(registry.OptIns()))
+	}
+	if *auditPath != "" {
+		audit, err := os.OpenFile(*auditPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			log.Fatal("Failed to open audit log: ", err)
+		}
+		defer audit.Close()
+		guardian.SetAuditLog(audit)
+	}
 
-	// Add protected senders
-	guardian.AddProtectedSender("0xAlice")
-	guardian.AddProtectedSender("0xCarol")
+	// Bundles are simulated against a snapshot of the pool, refreshed from chain
+	// state in production; protected swaps on pools without one are refused
+	pool := mevamm.NewPool("0xPool", "WETH", "USDC",
+		new(big.Int).Mul(big.NewInt(1000), mevamm.WAD), new(big.Int).Mul(big.NewInt(2000000), mevamm.WAD), 30)
+	guardian.SetPool(pool)
+
+	// Protected swaps clear in batch auctions against the same snapshot
+	if *auctionWindow > 0 {
+		auction := mevgrandmothersguardia.NewBatchAuction(*auctionWindow)
+		auction.AddPool(pool)
+		guardian.SetBatchAuction(auction)
+	}
+
+	// Operator-protected senders; users opt in through the registry
+	protected := map[string]bool{"0xAlice": true, "0xCarol": true}
+	for addr := range protected {
+		guardian.AddProtectedSender(addr)
+	}
 
 	// Example transactions
 	txs := []*mevgrandmothersguardia.Tx{
@@ -27,6 +87,10 @@ func main() {
 			Receiver:  "0xDEX",
 			GasPrice:  big.NewInt(100e9),
 			Value:     big.NewInt(5e17),
+			Pool:      "0xPool",
+			TokenIn:   "WETH",
+			TokenOut:  "USDC",
+			AmountIn:  big.NewInt(5e17),
 			Timestamp: time.Now(),
 		},
 		{
@@ -53,10 +117,65 @@ func main() {
 
 	// Main event loop
 	go func() {
+		var block uint64
+		keys := map[string][]byte{} // held by the protected senders' wallets until reveal
 		for {
-			// Submit transactions
+			block++
+
+			// Protected senders release the keys of txs that may now be revealed
+			for hash, key := range keys {
+				var sealed *mevgrandmothersguardia.RevealError
+				if _, err := guardian.RevealKey(hash, key); errors.As(err, &sealed) {
+					continue
+				} else if err != nil {
+					log.Printf("reveal %s: %v", hash, err)
+				}
+				delete(keys, hash)
+			}
+
+			// Submit this block's transactions; protected senders seal theirs before sending
 			for _, tx := range txs {
-				guardian.SubmitTransaction(tx)
+				fresh := *tx
+				fresh.Hash = fmt.Sprintf("%s-%d", tx.Hash, block)
+				submit := &fresh
+				if protected[tx.Sender] {
+					sealed, key, err := mevgrandmothersguardia.SealTx(&fresh)
+					if err != nil {
+						log.Printf("seal %s: %v", fresh.Hash, err)
+						continue
+					}
+					submit = sealed
+					keys[fresh.Hash] = key
+				}
+				if err := guardian.SubmitTransaction(submit); err != nil {
+					log.Printf("submit %s: %v", fresh.Hash, err)
+					delete(keys, fresh.Hash)
+				}
+			}
+
+			// Protected senders' swaps go to the batch auction instead of the public flow
+			if *auctionWindow > 0 {
+				wad := func(n int64) *big.Int { return new(big.Int).Mul(big.NewInt(n), mevamm.WAD) }
+				orders := []*mevgrandmothersguardia.SwapOrder{
+					{Hash: fmt.Sprintf("swap-a-%d", block), Sender: "0xAlice", TokenIn: "WETH", TokenOut: "USDC", AmountIn: wad(1)},
+					{Hash: fmt.Sprintf("swap-c-%d", block), Sender: "0xCarol", TokenIn: "USDC", TokenOut: "WETH", AmountIn: wad(1500)},
+				}
+				for _, order := range orders {
+					if err := guardian.SubmitSwap(order); err != nil {
+						log.Printf("submit swap %s: %v", order.Hash, err)
+					}
+				}
+				settlements, err := guardian.SettleBatches()
+				if err != nil {
+					log.Printf("block %d: settle batches: %v", block, err)
+				}
+				for _, s := range settlements {
+					log.Printf("block %d: batch %s on %s cleared %d orders at %s, %s %s to the pool, %d unfilled",
+						block, s.ID(), s.Pool, len(s.Fills), s.Price, s.AMMIn, s.AMMToken, len(s.Unfilled))
+					for _, tx := range s.Bundle(*settler) {
+						log.Printf("block %d: settlement tx %s -> %s", block, tx.Hash, tx.Receiver)
+					}
+				}
 			}
 
 			// Decrypt transactions at block inclusion
@@ -65,10 +184,33 @@ func main() {
 			// Optimize bundles without harmful front-running
 			bundle := guardian.OptimizeBundles(decryptedTxs)
 
-			// Distribute profits back ethically
-			guardian.DistributeProfits(bundle)
+			// Refuse bundles that cost protected users more than their tolerance
+			if _, err := guardian.ApproveBundle(bundle); err != nil {
+				log.Printf("block %d: bundle rejected: %v", block, err)
+				bundle = nil
+			}
+
+			// Distribute the bundle's realized profit back ethically
+			_, err := guardian.DistributeProfits(&mevgrandmothersguardia.BundleOutcome{
+				ID:     fmt.Sprintf("bundle-%d", time.Now().UnixNano()),
+				Block:  block,
+				Profit: big.NewInt(1e15), // example: measured after gas and builder payment
+				Txs:    bundle,
+			})
+			if err != nil {
+				log.Printf("distribute profits: %v", err)
+			}
 			guardian.ShowProfitDistribution()
 
+			// The bundle lands; confirm it and evict stale txs
+			var included []string
+			for _, tx := range bundle {
+				included = append(included, tx.Hash)
+			}
+			for _, s := range guardian.OnNewBlock(&mevgrandmothersguardia.Block{Number: block, TxHashes: included}) {
+				log.Printf("block %d: %s %s %s", block, s.Hash, s.State, s.Reason)
+			}
+
 			// Wait before next iteration
 			time.Sleep(time.Second)
 		}
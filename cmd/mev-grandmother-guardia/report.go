@@ -0,0 +1,55 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"log"
+	"os"
+
+	"github.com/mellis0303/mev-vem/pkg/mev-grandmother-guardia"
+)
+
+// report exports the rebates accrued over a block range:
+// mev-grandmother-guardia report -ledger <file> (-from n -to m | -epoch e -epoch-blocks n) [-format json|csv] [-out file]
+func report(args []string) {
+	fs := flag.NewFlagSet("report", flag.ExitOnError)
+	ledgerPath := fs.String("ledger", "", "rebate ledger to report on")
+	from := fs.Uint64("from", 0, "first block of the range")
+	to := fs.Uint64("to", 0, "last block of the range, inclusive")
+	epoch := fs.Uint64("epoch", 0, "epoch number recorded in the report")
+	epochBlocks := fs.Uint64("epoch-blocks", 0, "blocks per epoch; if set, the range is taken from -epoch")
+	format := fs.String("format", "json", "json or csv")
+	out := fs.String("out", "-", "output file, - for stdout")
+	fs.Parse(args)
+
+	if *ledgerPath == "" {
+		log.Fatal("report: -ledger is required")
+	}
+	if _, err := os.Stat(*ledgerPath); err != nil {
+		log.Fatal("report: ", err)
+	}
+	if *epochBlocks > 0 {
+		*from, *to = mevgrandmothersguardia.EpochBlocks(*epoch, *epochBlocks)
+	}
+	ledger, err := mevgrandmothersguardia.ReadLedger(*ledgerPath)
+	if err != nil {
+		log.Fatal("report: ", err)
+	}
+	r, err := ledger.Report(*epoch, *from, *to)
+	if err != nil {
+		log.Fatal("report: ", err)
+	}
+
+	var w io.Writer = os.Stdout
+	if *out != "-" {
+		f, err := os.Create(*out)
+		if err != nil {
+			log.Fatal("report: ", err)
+		}
+		defer f.Close()
+		w = f
+	}
+	if err := r.Write(w, *format); err != nil {
+		log.Fatal("report: ", err)
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"crypto/ecdh"
+	"crypto/rand"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/mellis0303/mev-vem/pkg/mev-guard"
+)
+
+// Environment variables read by mev-guard.
+const (
+	envKey        = "MEV_GUARD_KEY"        // hex pool key
+	envPassphrase = "MEV_GUARD_PASSPHRASE" // keystore passphrase
+)
+
+// keyFlags = where the pool key comes from: -key-fd or -keystore, else
+// $MEV_GUARD_KEY.
+type keyFlags struct {
+	keystore       string
+	passphraseFile string
+	keyFD          int
+	light          bool
+}
+
+func (kf *keyFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&kf.keystore, "keystore", "", "encrypted keystore file holding the pool keyring")
+	fs.StringVar(&kf.passphraseFile, "passphrase-file", "", "file with the keystore passphrase (default $"+envPassphrase+")")
+	fs.IntVar(&kf.keyFD, "key-fd", -1, "read the pool key (hex or raw) from this file descriptor")
+	fs.BoolVar(&kf.light, "light", false, "use light scrypt parameters when writing keystores")
+}
+
+func (kf *keyFlags) scrypt() (int, int) {
+	if kf.light {
+		return mevguard.LightScryptN, mevguard.LightScryptP
+	}
+	return mevguard.StandardScryptN, mevguard.StandardScryptP
+}
+
+// passphrase reads the keystore passphrase from -passphrase-file or the environment.
+func (kf *keyFlags) passphrase() (string, error) {
+	if kf.passphraseFile != "" {
+		b, err := os.ReadFile(kf.passphraseFile)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimRight(string(b), "\r\n"), nil
+	}
+	if p, ok := os.LookupEnv(envPassphrase); ok {
+		os.Unsetenv(envPassphrase)
+		return p, nil
+	}
+	return "", fmt.Errorf("no passphrase: set -passphrase-file or $%s", envPassphrase)
+}
+
+// keySource = where open found the pool key.
+type keySource int
+
+const (
+	sourceNone keySource = iota
+	sourceFD
+	sourceKeystore
+	sourceEnv
+)
+
+// open builds the pool for chainID from the configured key source, or returns
+// sourceNone when none was configured. A keystore holds the whole keyring and is kept up
+// to date as keys rotate; -key-fd and $MEV_GUARD_KEY supply a single key that
+// nothing persists, so -key-fd cannot be combined with -keystore.
+func (kf *keyFlags) open(passphrase func() (string, error), chainID uint64) (*mevguard.MEVMempool, keySource, error) {
+	var (
+		key    []byte
+		source keySource
+		err    error
+	)
+	switch {
+	case kf.keyFD >= 0 && kf.keystore != "":
+		return nil, sourceNone, errors.New("-key-fd and -keystore are mutually exclusive")
+	case kf.keyFD >= 0:
+		key, err = mevguard.KeyFromFD(uintptr(kf.keyFD))
+		source = sourceFD
+	case kf.keystore != "":
+		pass, err := passphrase()
+		if err != nil {
+			return nil, sourceNone, err
+		}
+		pool, err := mevguard.LoadKeyring(kf.keystore, pass, chainID)
+		if err != nil {
+			return nil, sourceNone, err
+		}
+		n, p := kf.scrypt()
+		if err := pool.SetKeyring(kf.keystore, pass, n, p); err != nil {
+			pool.Close()
+			return nil, sourceNone, err
+		}
+		return pool, sourceKeystore, nil
+	case os.Getenv(envKey) != "":
+		key, err = mevguard.KeyFromEnv(envKey)
+		source = sourceEnv
+	default:
+		return nil, sourceNone, nil
+	}
+	if err != nil {
+		return nil, sourceNone, err
+	}
+	defer mevguard.Zero(key)
+	pool, err := mevguard.NewMEVMempool(key, chainID)
+	if err != nil {
+		return nil, sourceNone, err
+	}
+	return pool, source, nil
+}
+
+// keygen writes a keystore holding a new key: mev-guard keygen -keystore <file> [-passphrase-file f] [-light]
+// The pool turns it into a keyring the first time it opens it.
+func keygen(args []string) {
+	fs := flag.NewFlagSet("keygen", flag.ExitOnError)
+	var kf keyFlags
+	kf.register(fs)
+	force := fs.Bool("force", false, "overwrite an existing keystore")
+	fs.Parse(args)
+
+	if kf.keystore == "" {
+		log.Fatal("keygen: -keystore is required")
+	}
+	if _, err := os.Stat(kf.keystore); err == nil && !*force {
+		log.Fatalf("keygen: %s exists; use -force to overwrite", kf.keystore)
+	} else if err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Fatal("keygen: ", err)
+	}
+	pass, err := kf.passphrase()
+	if err != nil {
+		log.Fatal("keygen: ", err)
+	}
+	if pass == "" {
+		log.Fatal("keygen: refusing an empty passphrase")
+	}
+
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		log.Fatal("keygen: ", err)
+	}
+	defer mevguard.Zero(key)
+	priv, err := ecdh.X25519().NewPrivateKey(key)
+	if err != nil {
+		log.Fatal("keygen: ", err)
+	}
+	n, p := kf.scrypt()
+	if err := mevguard.WriteKeystore(kf.keystore, key, pass, n, p); err != nil {
+		log.Fatal("keygen: ", err)
+	}
+	fmt.Printf("Key ID:     %s\n", mevguard.KeyID(priv.PublicKey()))
+	fmt.Printf("Public key: %s\n", mevguard.PublicKeyHex(priv.PublicKey()))
+}
@@ -2,6 +2,10 @@ package main
 
 import (
 	"crypto/rand"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
 	"log"
 	"os"
 	"os/signal"
@@ -9,19 +13,70 @@ import (
 	"time"
 
 	"github.com/mellis0303/mev-vem/pkg/mev-guard"
+	"github.com/mellis0303/mev-vem/pkg/mev-wal"
 )
 
 func main() {
-	// Generate encryption key
-	key := make([]byte, 32)
-	if _, err := rand.Read(key); err != nil {
-		log.Fatal("Failed to generate encryption key:", err)
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "encrypt":
+			encrypt(os.Args[2:])
+			return
+		case "keygen":
+			keygen(os.Args[2:])
+			return
+		}
+	}
+
+	fs := flag.NewFlagSet("mev-guard", flag.ExitOnError)
+	var kf keyFlags
+	kf.register(fs)
+	walPath := fs.String("wal", "", "write-ahead log that keeps pending txs across restarts")
+	chainID := fs.Uint64("chain-id", 0, "chain ID envelopes must be bound to (required)")
+	fs.Parse(os.Args[1:])
+	if *chainID == 0 {
+		log.Fatal("-chain-id is required")
 	}
 
-	// Initialize protected MEV mempool
-	pool, err := mevguard.NewMEVMempool(key)
+	// Load the pool key from -key-fd, -keystore or $MEV_GUARD_KEY
+	pool, source, err := kf.open(kf.passphrase, *chainID)
 	if err != nil {
-		log.Fatal("Failed to initialize MEV mempool:", err)
+		log.Fatal("Failed to load pool key: ", err)
+	}
+	if source == sourceNone {
+		log.Println("No pool key configured; using an ephemeral key. Pending txs will not survive a restart.")
+		key := make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			log.Fatal("Failed to generate encryption key:", err)
+		}
+		pool, err = mevguard.NewMEVMempool(key, *chainID)
+		mevguard.Zero(key)
+		if err != nil {
+			log.Fatal("Failed to initialize MEV mempool:", err)
+		}
+	}
+	log.Printf("Pool public key: %s\n", mevguard.PublicKeyHex(pool.PublicKey()))
+
+	// Replay pending txs from the log; they are stored sealed, as submitted
+	if *walPath != "" {
+		if source == sourceNone {
+			log.Println("Warning: -wal with an ephemeral key; recovered txs will be quarantined.")
+		}
+		if err := pool.OpenWAL(*walPath, mevwal.Options{}); err != nil {
+			log.Fatal("Failed to open WAL: ", err)
+		}
+	}
+
+	// Rotate hourly; txs sealed to a retired key are resealed after 10 minutes.
+	// Only a keystore can persist rotated keys, so a key from anywhere else is fixed.
+	rotating := source == sourceKeystore
+	rotateEvery := time.Hour
+	if !rotating {
+		log.Println("Pool not opened from a keystore; key rotation is disabled.")
+		rotateEvery = 0
+	}
+	if err := pool.SetRotation(rotateEvery, 10*time.Minute, mevguard.RetireReencrypt); err != nil {
+		log.Fatal("Failed to configure key rotation:", err)
 	}
 
 	// Example transaction data
@@ -31,21 +86,76 @@ func main() {
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 
+	// SIGHUP rotates the pool key on command
+	hupChan := make(chan os.Signal, 1)
+	signal.Notify(hupChan, syscall.SIGHUP)
+	go func() {
+		for range hupChan {
+			if !rotating {
+				log.Println("Ignoring SIGHUP: key rotation needs a keystore")
+				continue
+			}
+			key := make([]byte, 32)
+			if _, err := rand.Read(key); err != nil {
+				log.Printf("Error generating key: %v\n", err)
+				continue
+			}
+			err := pool.Rotate(key)
+			mevguard.Zero(key)
+			if err != nil {
+				log.Printf("Error rotating key: %v\n", err)
+				continue
+			}
+			log.Printf("Rotated pool key, new public key: %s\n", mevguard.PublicKeyHex(pool.PublicKey()))
+		}
+	}()
+
 	// Main event loop
 	go func() {
+		// A failed log write means acks and expiries may not survive a
+		// restart; checked every round, including rounds that hit an error
+		wait := func() {
+			if err := pool.WALErr(); err != nil {
+				log.Fatal("WAL write failed: ", err)
+			}
+			time.Sleep(time.Second)
+		}
 		nonce := uint64(1)
 		for {
-			// Add encrypted transaction
-			err := pool.AddTransaction(txData, nonce, "0xSender")
+			report, err := pool.MaintainKeys(time.Now())
+			if err != nil {
+				log.Printf("Error maintaining keys: %v\n", err)
+			} else if report.Rotated || len(report.Removed) > 0 {
+				log.Printf("Keys: rotated=%v removed=%v re-encrypted=%d expired=%d\n",
+					report.Rotated, report.Removed, report.Reencrypted, report.Expired)
+			}
+
+			// Clients seal against the current public key; the pool never sees plaintext
+			client := &mevguard.Client{PoolKey: pool.PublicKey(), ChainID: pool.ChainID()}
+			envelope, err := client.Seal(mevguard.TxContext{From: "0xSender", Nonce: nonce}, txData)
+			if err != nil {
+				log.Printf("Error sealing transaction: %v\n", err)
+				wait()
+				continue
+			}
+			err = pool.AddTransaction(envelope, nonce, "0xSender")
 			if err != nil {
 				log.Printf("Error adding transaction: %v\n", err)
+				wait()
 				continue
 			}
 
 			// Retrieve and decrypt transactions
 			txs, err := pool.RetrieveTransactions()
-			if err != nil {
+			var retrievalErr *mevguard.RetrievalError
+			if errors.As(err, &retrievalErr) {
+				// bad entries are quarantined; honest txs still come through
+				for _, f := range retrievalErr.Failed {
+					log.Printf("Quarantined %v\n", f)
+				}
+			} else if err != nil {
 				log.Printf("Error retrieving transactions: %v\n", err)
+				wait()
 				continue
 			}
 
@@ -54,14 +164,61 @@ func main() {
 			for _, tx := range txs {
 				log.Printf("Decrypted Tx: %s, Nonce: %d, From: %s\n",
 					tx.EncryptedData, tx.Nonce, tx.From)
+				// handled; a crash before this point returns it after the lease times out
+				pool.Ack(tx.ID)
+			}
+
+			// Keep the log about the size of the live pool
+			if *walPath != "" && nonce%60 == 0 {
+				if err := pool.CompactWAL(); err != nil {
+					log.Printf("Error compacting WAL: %v\n", err)
+				}
 			}
 
 			nonce++
-			time.Sleep(time.Second)
+			wait()
 		}
 	}()
 
 	// Wait for shutdown signal
 	<-sigChan
 	log.Println("Shutting down MEV Guard...")
-}
\ No newline at end of file
+	pool.Close()
+}
+
+// encrypt seals a transaction for submission:
+// mev-guard encrypt -pubkey <hex> -from <addr> -nonce <n> [-chain-id 1] [-block 0] [-in file]
+func encrypt(args []string) {
+	fs := flag.NewFlagSet("encrypt", flag.ExitOnError)
+	pubKey := fs.String("pubkey", "", "pool X25519 public key (hex)")
+	from := fs.String("from", "", "sender address bound to the envelope")
+	nonce := fs.Uint64("nonce", 0, "sender nonce bound to the envelope")
+	chainID := fs.Uint64("chain-id", 0, "chain ID bound to the envelope (the pool's chain)")
+	block := fs.Uint64("block", 0, "target block, 0 for any")
+	in := fs.String("in", "-", "file with the raw transaction, - for stdin")
+	fs.Parse(args)
+
+	if *pubKey == "" || *from == "" || *chainID == 0 {
+		log.Fatal("encrypt: -pubkey, -from and -chain-id are required")
+	}
+	client, err := mevguard.NewClient(*pubKey, *chainID)
+	if err != nil {
+		log.Fatal("encrypt: ", err)
+	}
+
+	var txData []byte
+	if *in == "-" {
+		txData, err = io.ReadAll(os.Stdin)
+	} else {
+		txData, err = os.ReadFile(*in)
+	}
+	if err != nil {
+		log.Fatal("encrypt: ", err)
+	}
+
+	envelope, err := client.Seal(mevguard.TxContext{From: *from, Nonce: *nonce, TargetBlock: *block}, txData)
+	if err != nil {
+		log.Fatal("encrypt: ", err)
+	}
+	fmt.Println(envelope)
+}
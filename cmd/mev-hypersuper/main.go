@@ -1,10 +1,13 @@
 package main
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"log"
 	"math/big"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
@@ -15,16 +18,52 @@ func EthToWei(eth int64) *big.Int {
 	return new(big.Int).Mul(big.NewInt(eth), big.NewInt(1000000000000000000))
 }
 
+// executorKey reads the signing key from EXECUTOR_KEY or generates a throwaway one.
+func executorKey() ([]byte, error) {
+	if h := os.Getenv("EXECUTOR_KEY"); h != "" {
+		return hex.DecodeString(strings.TrimPrefix(h, "0x"))
+	}
+	log.Println("EXECUTOR_KEY not set, using a random key")
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	return key, err
+}
+
+// executorAddress reads the executor contract address from EXECUTOR_ADDRESS.
+func executorAddress() string {
+	if addr := os.Getenv("EXECUTOR_ADDRESS"); addr != "" {
+		return addr
+	}
+	return "0x00000000000000000000000000000000E0EC0001"
+}
+
 func main() {
 	// Initialize Event Horizon Core
 	eh := mevhypersuper.NewEventHorizon(5, EthToWei(1000)) // 1000 ETH Flashloan limit
 
+	// Flashloan sources
+	eh.AddFlashloanProvider(mevhypersuper.NewBalancerFlashloan("0xBA12222222228d8Ba445958a75a0704d566BF2C8", mevhypersuper.NativeAsset, EthToWei(600)))
+	eh.AddFlashloanProvider(mevhypersuper.NewAaveV3Flashloan("0x87870Bca3F3fD6335C3F4ce8392D69350B4fA4E2", mevhypersuper.NativeAsset, EthToWei(2000)))
+
+	// Executor contract and signing key (hex, via EXECUTOR_KEY)
+	key, err := executorKey()
+	if err != nil {
+		log.Fatal("Failed to load executor key:", err)
+	}
+	executor, err := mevhypersuper.NewExecutor(executorAddress(), big.NewInt(1), key)
+	if err != nil {
+		log.Fatal("Failed to initialize executor:", err)
+	}
+	executor.Tokens[mevhypersuper.NativeAsset] = "0xC02aaA39b223FE8D0A0e5C4F27eAD9083C756Cc2" // WETH
+	eh.SetExecutor(executor)
+	log.Printf("Executor signer: %s\n", executor.From())
+
 	// Example transactions with dependencies
 	txs := []*mevhypersuper.EventTx{
 		{
 			Hash:      "0xa",
 			Sender:    "0xA",
-			Receiver:  "0xUni",
+			Receiver:  "0x7a250d5630B4cF539739dF2C5dAcb4c659F2488D",
 			GasPrice:  big.NewInt(100e9),
 			Value:     EthToWei(400),
 			DependsOn: []string{},
@@ -33,7 +72,7 @@ func main() {
 		{
 			Hash:      "0xb",
 			Sender:    "0xB",
-			Receiver:  "0xSushi",
+			Receiver:  "0xd9e1cE17f2641f24aE83637ab66a2cca9C378B9F",
 			GasPrice:  big.NewInt(150e9),
 			Value:     EthToWei(300),
 			DependsOn: []string{"0xa"},
@@ -42,7 +81,7 @@ func main() {
 		{
 			Hash:      "0xc",
 			Sender:    "0xC",
-			Receiver:  "0xCurve",
+			Receiver:  "0xbEbc44782C7dB0a1A60Cb6fe97d0b483032FF1C7",
 			GasPrice:  big.NewInt(200e9),
 			Value:     EthToWei(500),
 			DependsOn: []string{"0xb"},
@@ -51,7 +90,7 @@ func main() {
 		{
 			Hash:      "0xd",
 			Sender:    "0xD",
-			Receiver:  "0xBalancer",
+			Receiver:  "0xBA12222222228d8Ba445958a75a0704d566BF2C8",
 			GasPrice:  big.NewInt(250e9),
 			Value:     EthToWei(450),
 			DependsOn: []string{},
@@ -60,7 +99,7 @@ func main() {
 		{
 			Hash:      "0xe",
 			Sender:    "0xE",
-			Receiver:  "0x1inch",
+			Receiver:  "0x1111111254EEB25477B68fb85Ed929f73A960582",
 			GasPrice:  big.NewInt(300e9),
 			Value:     EthToWei(600),
 			DependsOn: []string{"0xc", "0xd"},
@@ -80,11 +119,16 @@ func main() {
 	// Main event loop
 	go func() {
 		for {
-			// Generate optimal bundle
-			bundle := eh.GenerateOptimalBundle()
-			
-			// Execute bundle
-			eh.ExecuteBundle(bundle)
+			// Generate optimal bundle and its flashloans
+			plan := eh.GenerateBundlePlan()
+
+			// Compile into one signed executor transaction
+			etx, err := eh.ExecuteBundle(plan)
+			if err != nil {
+				log.Printf("Error executing bundle: %v\n", err)
+			} else {
+				log.Printf("Raw executor tx: 0x%x\n", etx.Raw)
+			}
 			
 			// Wait before next iteration
 			time.Sleep(time.Second)
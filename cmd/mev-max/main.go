@@ -13,7 +13,7 @@ import (
 
 func main() {
 	// Initialize MEV Mempool
-	mempool := mevmax.NewMEVMempool()
+	mempool := mevmax.NewMEVMempool(mevmax.FeePlusProfit{})
 
 	// Example transactions
 	txs := []*mevmax.Transaction{
@@ -62,7 +62,7 @@ func main() {
 			fmt.Println("Optimal Transaction Bundle:")
 			for _, tx := range optimalBundle {
 				fmt.Printf("TxHash: %s, From: %s, To: %s, Profit: %d, Priority: %d\n",
-					tx.Hash, tx.From, tx.To, tx.Profit, tx.priority)
+					tx.Hash, tx.From, tx.To, tx.Profit, tx.Priority())
 			}
 			
 			// Wait before next iteration
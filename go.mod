@@ -1,3 +1,10 @@
 module github.com/mellis0303/mev-vem
 
-go 1.21 
\ No newline at end of file
+go 1.21
+
+require (
+	github.com/decred/dcrd/dcrec/secp256k1/v4 v4.2.0
+	golang.org/x/crypto v0.17.0
+)
+
+require golang.org/x/sys v0.15.0 // indirect
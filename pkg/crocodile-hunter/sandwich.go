@@ -0,0 +1,230 @@
+package crocodilehunter
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/mellis0303/mev-vem/pkg/mev-amm"
+)
+
+// DefaultSwapGas is the gas budgeted per frontrun/backrun leg when none is given.
+const DefaultSwapGas = 120000
+
+// PendingSwap = a decoded swap waiting in the public mempool.
+type PendingSwap struct {
+	Hash         string
+	From         string
+	Pool         string
+	TokenIn      string
+	TokenOut     string
+	AmountIn     *big.Int
+	MinAmountOut *big.Int // victim's slippage limit
+	GasPrice     *big.Int
+	Timestamp    time.Time
+}
+
+// SandwichParams = searcher-side limits for building a sandwich.
+type SandwichParams struct {
+	Searcher   string
+	MaxCapital *big.Int // frontrun budget, denominated in the victim's TokenIn
+	GasPrice   *big.Int // price paid for both searcher legs
+	GasPerLeg  uint64
+	Numeraire  string // token profit is reported in (usually WETH)
+}
+
+// SandwichOpportunity = the optimal frontrun/victim/backrun triple for one swap.
+type SandwichOpportunity struct {
+	Victim      *PendingSwap
+	Pool        string
+	FrontrunIn  *big.Int // TokenIn spent by the frontrun
+	FrontrunOut *big.Int // TokenOut received by the frontrun
+	VictimOut   *big.Int // TokenOut the victim still receives
+	BackrunOut  *big.Int // TokenIn recovered by the backrun
+	GrossProfit *big.Int // in Numeraire
+	GasCost     *big.Int // in wei
+	NetProfit   *big.Int // GrossProfit - GasCost
+	Searcher    string
+	GasPrice    *big.Int
+}
+
+// simulateSandwich runs frontrun x, the victim and the backrun on a copy of the pool.
+// It returns ok=false when the victim's slippage limit would be breached.
+func simulateSandwich(pool *mevamm.Pool, victim *PendingSwap, x *big.Int) (frontOut, victimOut, backOut *big.Int, ok bool) {
+	return runSandwich(pool.Clone(), victim, x)
+}
+
+// runSandwich runs frontrun x, the victim and the backrun on sim, leaving it
+// in its post-backrun state. A nil MinAmountOut is treated as zero.
+func runSandwich(sim *mevamm.Pool, victim *PendingSwap, x *big.Int) (frontOut, victimOut, backOut *big.Int, ok bool) {
+	frontOut, err := sim.Swap(victim.TokenIn, x)
+	if err != nil {
+		return nil, nil, nil, false
+	}
+	victimOut, err = sim.Swap(victim.TokenIn, victim.AmountIn)
+	if err != nil || (victim.MinAmountOut != nil && victimOut.Cmp(victim.MinAmountOut) < 0) {
+		return nil, nil, nil, false
+	}
+	backOut, err = sim.Swap(victim.TokenOut, frontOut)
+	if err != nil {
+		return nil, nil, nil, false
+	}
+	return frontOut, victimOut, backOut, true
+}
+
+// sandwichGross returns backrun proceeds minus frontrun cost, or nil if infeasible.
+func sandwichGross(pool *mevamm.Pool, victim *PendingSwap, x *big.Int) *big.Int {
+	_, _, backOut, ok := simulateSandwich(pool, victim, x)
+	if !ok {
+		return nil
+	}
+	return new(big.Int).Sub(backOut, x)
+}
+
+// maxFrontrun binary-searches the largest frontrun that keeps the victim above MinAmountOut.
+func maxFrontrun(pool *mevamm.Pool, victim *PendingSwap, limit *big.Int) *big.Int {
+	lo, hi := big.NewInt(0), new(big.Int).Set(limit)
+	if _, _, _, ok := simulateSandwich(pool, victim, hi); ok {
+		return hi
+	}
+	one := big.NewInt(1)
+	for new(big.Int).Sub(hi, lo).Cmp(one) > 0 {
+		mid := new(big.Int).Add(lo, hi)
+		mid.Rsh(mid, 1)
+		if _, _, _, ok := simulateSandwich(pool, victim, mid); ok {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+	return lo
+}
+
+// optimalFrontrun ternary-searches the most profitable frontrun within [0, upper].
+func optimalFrontrun(pool *mevamm.Pool, victim *PendingSwap, upper *big.Int) *big.Int {
+	lo, hi := big.NewInt(0), new(big.Int).Set(upper)
+	three := big.NewInt(3)
+	for new(big.Int).Sub(hi, lo).Cmp(three) > 0 {
+		third := new(big.Int).Sub(hi, lo)
+		third.Quo(third, three)
+		m1 := new(big.Int).Add(lo, third)
+		m2 := new(big.Int).Sub(hi, third)
+		if sandwichGross(pool, victim, m1).Cmp(sandwichGross(pool, victim, m2)) < 0 {
+			lo = m1
+		} else {
+			hi = m2
+		}
+	}
+	best, bestProfit := lo, sandwichGross(pool, victim, lo)
+	for x := new(big.Int).Add(lo, big.NewInt(1)); x.Cmp(hi) <= 0; x = new(big.Int).Add(x, big.NewInt(1)) {
+		if p := sandwichGross(pool, victim, x); p.Cmp(bestProfit) > 0 {
+			best, bestProfit = x, p
+		}
+	}
+	return best
+}
+
+// FindSandwich computes the optimal sandwich around victim given the current pool state.
+// The pool itself is never mutated.
+func FindSandwich(pool *mevamm.Pool, victim *PendingSwap, params SandwichParams) (*SandwichOpportunity, error) {
+	if pool.Address != victim.Pool || !pool.Has(victim.TokenIn) || !pool.Has(victim.TokenOut) {
+		return nil, fmt.Errorf("swap %s does not trade on pool %s", victim.Hash, pool.Address)
+	}
+	if params.MaxCapital == nil || params.MaxCapital.Sign() <= 0 {
+		return nil, errors.New("sandwich needs positive capital")
+	}
+	if _, _, _, ok := simulateSandwich(pool, victim, big.NewInt(0)); !ok {
+		return nil, fmt.Errorf("swap %s already fails its slippage limit", victim.Hash)
+	}
+
+	upper := maxFrontrun(pool, victim, params.MaxCapital)
+	if upper.Sign() == 0 {
+		return nil, fmt.Errorf("swap %s leaves no slippage room", victim.Hash)
+	}
+	x := optimalFrontrun(pool, victim, upper)
+	after := pool.Clone()
+	frontOut, victimOut, backOut, _ := runSandwich(after, victim, x)
+
+	gross := new(big.Int).Sub(backOut, x)
+	if params.Numeraire != "" && victim.TokenIn != params.Numeraire {
+		if victim.TokenOut != params.Numeraire {
+			return nil, fmt.Errorf("numeraire %s not in pool %s", params.Numeraire, pool.Address)
+		}
+		// value the TokenIn profit at the price the sandwich leaves the pool
+		// at, where it would be unwound
+		price, err := after.SpotPrice(victim.TokenIn)
+		if err != nil {
+			return nil, err
+		}
+		gross.Mul(gross, price)
+		gross.Quo(gross, mevamm.WAD)
+	}
+
+	gasPerLeg := params.GasPerLeg
+	if gasPerLeg == 0 {
+		gasPerLeg = DefaultSwapGas
+	}
+	gasPrice := params.GasPrice
+	if gasPrice == nil {
+		gasPrice = victim.GasPrice
+	}
+	gasCost := new(big.Int).Mul(gasPrice, new(big.Int).SetUint64(2*gasPerLeg))
+
+	return &SandwichOpportunity{
+		Victim:      victim,
+		Pool:        pool.Address,
+		FrontrunIn:  x,
+		FrontrunOut: frontOut,
+		VictimOut:   victimOut,
+		BackrunOut:  backOut,
+		GrossProfit: gross,
+		GasCost:     gasCost,
+		NetProfit:   new(big.Int).Sub(gross, gasCost),
+		Searcher:    params.Searcher,
+		GasPrice:    gasPrice,
+	}, nil
+}
+
+// Bundle orders the opportunity as [frontrun, victim, backrun].
+func (so *SandwichOpportunity) Bundle() *Bundle {
+	now := time.Now()
+	front := &Tx{
+		Hash:      so.Victim.Hash + "-frontrun",
+		From:      so.Searcher,
+		To:        so.Pool,
+		GasPrice:  so.GasPrice,
+		Profit:    big.NewInt(0),
+		Timestamp: now,
+	}
+	victim := &Tx{
+		Hash:      so.Victim.Hash,
+		From:      so.Victim.From,
+		To:        so.Pool,
+		GasPrice:  so.Victim.GasPrice,
+		Profit:    big.NewInt(0),
+		Timestamp: so.Victim.Timestamp,
+	}
+	back := &Tx{
+		Hash:      so.Victim.Hash + "-backrun",
+		From:      so.Searcher,
+		To:        so.Pool,
+		GasPrice:  so.GasPrice,
+		Profit:    new(big.Int).Set(so.NetProfit),
+		Timestamp: now,
+	}
+	return &Bundle{
+		Transactions: []*Tx{front, victim, back},
+		TotalProfit:  new(big.Int).Set(so.NetProfit),
+	}
+}
+
+// AddBundle queues a pre-built bundle (e.g. a sandwich) for the next submission.
+func (fh *FlashHunter) AddBundle(bundle *Bundle) {
+	fh.mutex.Lock()
+	defer fh.mutex.Unlock()
+
+	if bundle.TotalProfit.Cmp(fh.minProfit) >= 0 {
+		fh.bundles = append(fh.bundles, bundle)
+	}
+}
@@ -0,0 +1,124 @@
+// This file contains tests for sandwich sizing, profit valuation and bundle
+// construction.
+
+package crocodilehunter
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/mellis0303/mev-vem/pkg/mev-amm"
+)
+
+func ether(n int64) *big.Int {
+	return new(big.Int).Mul(big.NewInt(n), big.NewInt(1e18))
+}
+
+func testPool() *mevamm.Pool {
+	return mevamm.NewPool("0xPool", "WETH", "USDC", ether(1000), ether(2_000_000), 30)
+}
+
+func TestFindSandwichRespectsSlippage(t *testing.T) {
+	pool := testPool()
+	quote, _ := pool.Quote("WETH", ether(10))
+	minOut := new(big.Int).Mul(quote, big.NewInt(99))
+	minOut.Quo(minOut, big.NewInt(100)) // 1% slippage
+
+	victim := &PendingSwap{
+		Hash:         "0xvictim",
+		From:         "0xAlice",
+		Pool:         "0xPool",
+		TokenIn:      "WETH",
+		TokenOut:     "USDC",
+		AmountIn:     ether(10),
+		MinAmountOut: minOut,
+		GasPrice:     big.NewInt(30e9),
+		Timestamp:    time.Now(),
+	}
+	opp, err := FindSandwich(pool, victim, SandwichParams{
+		Searcher:   "0xSearcher",
+		MaxCapital: ether(500),
+		GasPrice:   big.NewInt(30e9),
+		Numeraire:  "WETH",
+	})
+	if err != nil {
+		t.Fatalf("FindSandwich: %v", err)
+	}
+	if opp.VictimOut.Cmp(minOut) < 0 {
+		t.Errorf("victim receives %s, below limit %s", opp.VictimOut, minOut)
+	}
+	if opp.NetProfit.Sign() <= 0 {
+		t.Errorf("expected positive net profit, got %s", opp.NetProfit)
+	}
+	if pool.Reserve0.Cmp(ether(1000)) != 0 {
+		t.Errorf("FindSandwich mutated the pool reserves")
+	}
+
+	half := new(big.Int).Rsh(opp.FrontrunIn, 1)
+	if sandwichGross(pool, victim, half).Cmp(opp.GrossProfit) > 0 {
+		t.Errorf("frontrun %s is not optimal", opp.FrontrunIn)
+	}
+
+	bundle := opp.Bundle()
+	if len(bundle.Transactions) != 3 {
+		t.Fatalf("expected 3 transactions, got %d", len(bundle.Transactions))
+	}
+	if bundle.Transactions[1].Hash != "0xvictim" {
+		t.Errorf("victim must sit in the middle, got %s", bundle.Transactions[1].Hash)
+	}
+	if bundle.TotalProfit.Cmp(opp.NetProfit) != 0 {
+		t.Errorf("bundle profit %s != net profit %s", bundle.TotalProfit, opp.NetProfit)
+	}
+}
+
+func TestFindSandwichNoRoom(t *testing.T) {
+	pool := testPool()
+	quote, _ := pool.Quote("WETH", ether(10))
+	victim := &PendingSwap{
+		Hash:         "0xtight",
+		Pool:         "0xPool",
+		TokenIn:      "WETH",
+		TokenOut:     "USDC",
+		AmountIn:     ether(10),
+		MinAmountOut: quote, // zero slippage tolerance
+		GasPrice:     big.NewInt(30e9),
+	}
+	if _, err := FindSandwich(pool, victim, SandwichParams{MaxCapital: ether(500)}); err == nil {
+		t.Errorf("expected no sandwich for a zero-slippage swap")
+	}
+}
+
+func TestFindSandwichValuesProfitAfterBackrun(t *testing.T) {
+	pool := testPool()
+	victim := &PendingSwap{
+		Hash:     "0xnolimit",
+		Pool:     "0xPool",
+		TokenIn:  "USDC",
+		TokenOut: "WETH",
+		AmountIn: ether(20_000),
+		GasPrice: big.NewInt(30e9),
+	}
+	// no MinAmountOut: the frontrun is bounded only by capital
+	opp, err := FindSandwich(pool, victim, SandwichParams{MaxCapital: ether(10_000), Numeraire: "WETH"})
+	if err != nil {
+		t.Fatalf("FindSandwich: %v", err)
+	}
+
+	after := pool.Clone()
+	for _, leg := range []struct {
+		token  string
+		amount *big.Int
+	}{{"USDC", opp.FrontrunIn}, {"USDC", ether(20_000)}, {"WETH", opp.FrontrunOut}} {
+		if _, err := after.Swap(leg.token, leg.amount); err != nil {
+			t.Fatal(err)
+		}
+	}
+	price, _ := after.SpotPrice("USDC")
+	want := new(big.Int).Sub(opp.BackrunOut, opp.FrontrunIn)
+	want.Mul(want, price)
+	want.Quo(want, mevamm.WAD)
+	if opp.GrossProfit.Cmp(want) != 0 {
+		t.Errorf("gross %s, want USDC profit at the post-backrun price %s", opp.GrossProfit, want)
+	}
+}
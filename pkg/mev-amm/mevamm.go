@@ -0,0 +1,129 @@
+package mevamm
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// FeeDenominator is the basis-point denominator used for pool fees.
+const FeeDenominator = 10000
+
+// WAD is the 1e18 fixed-point scale used for prices.
+var WAD = big.NewInt(1e18)
+
+// Pool = a constant-product (Uniswap V2 style) liquidity pool.
+type Pool struct {
+	Address  string
+	Token0   string
+	Token1   string
+	Reserve0 *big.Int
+	Reserve1 *big.Int
+	FeeBps   int64 // 30 = 0.3%
+}
+
+// NewPool initializes a constant-product pool with the given reserves.
+func NewPool(address, token0, token1 string, reserve0, reserve1 *big.Int, feeBps int64) *Pool {
+	return &Pool{
+		Address:  address,
+		Token0:   token0,
+		Token1:   token1,
+		Reserve0: new(big.Int).Set(reserve0),
+		Reserve1: new(big.Int).Set(reserve1),
+		FeeBps:   feeBps,
+	}
+}
+
+// Clone returns a deep copy so simulations never touch the live reserves.
+func (p *Pool) Clone() *Pool {
+	return NewPool(p.Address, p.Token0, p.Token1, p.Reserve0, p.Reserve1, p.FeeBps)
+}
+
+// Has reports whether token is one side of the pool.
+func (p *Pool) Has(token string) bool {
+	return token == p.Token0 || token == p.Token1
+}
+
+// Other returns the opposite token of the pair.
+func (p *Pool) Other(token string) (string, error) {
+	switch token {
+	case p.Token0:
+		return p.Token1, nil
+	case p.Token1:
+		return p.Token0, nil
+	}
+	return "", fmt.Errorf("token %s not in pool %s", token, p.Address)
+}
+
+// Reserves returns (reserveIn, reserveOut) for a swap selling tokenIn.
+func (p *Pool) Reserves(tokenIn string) (*big.Int, *big.Int, error) {
+	switch tokenIn {
+	case p.Token0:
+		return p.Reserve0, p.Reserve1, nil
+	case p.Token1:
+		return p.Reserve1, p.Reserve0, nil
+	}
+	return nil, nil, fmt.Errorf("token %s not in pool %s", tokenIn, p.Address)
+}
+
+// Quote returns the output of selling amountIn of tokenIn without changing reserves.
+func (p *Pool) Quote(tokenIn string, amountIn *big.Int) (*big.Int, error) {
+	reserveIn, reserveOut, err := p.Reserves(tokenIn)
+	if err != nil {
+		return nil, err
+	}
+	return GetAmountOut(amountIn, reserveIn, reserveOut, p.FeeBps), nil
+}
+
+// Swap sells amountIn of tokenIn into the pool and updates reserves.
+func (p *Pool) Swap(tokenIn string, amountIn *big.Int) (*big.Int, error) {
+	reserveIn, reserveOut, err := p.Reserves(tokenIn)
+	if err != nil {
+		return nil, err
+	}
+	amountOut := GetAmountOut(amountIn, reserveIn, reserveOut, p.FeeBps)
+	if amountOut.Cmp(reserveOut) >= 0 {
+		return nil, errors.New("insufficient liquidity")
+	}
+	reserveIn.Add(reserveIn, amountIn)
+	reserveOut.Sub(reserveOut, amountOut)
+	return amountOut, nil
+}
+
+// SpotPrice returns the marginal price of base in quote, scaled by 1e18.
+func (p *Pool) SpotPrice(base string) (*big.Int, error) {
+	reserveBase, reserveQuote, err := p.Reserves(base)
+	if err != nil {
+		return nil, err
+	}
+	if reserveBase.Sign() == 0 {
+		return nil, errors.New("empty pool")
+	}
+	price := new(big.Int).Mul(reserveQuote, WAD)
+	return price.Quo(price, reserveBase), nil
+}
+
+// GetAmountOut mirrors UniswapV2Library.getAmountOut with a configurable fee.
+func GetAmountOut(amountIn, reserveIn, reserveOut *big.Int, feeBps int64) *big.Int {
+	if amountIn.Sign() <= 0 || reserveIn.Sign() <= 0 || reserveOut.Sign() <= 0 {
+		return big.NewInt(0)
+	}
+	amountInWithFee := new(big.Int).Mul(amountIn, big.NewInt(FeeDenominator-feeBps))
+	numerator := new(big.Int).Mul(amountInWithFee, reserveOut)
+	denominator := new(big.Int).Mul(reserveIn, big.NewInt(FeeDenominator))
+	denominator.Add(denominator, amountInWithFee)
+	return numerator.Quo(numerator, denominator)
+}
+
+// GetAmountIn mirrors UniswapV2Library.getAmountIn with a configurable fee.
+func GetAmountIn(amountOut, reserveIn, reserveOut *big.Int, feeBps int64) (*big.Int, error) {
+	if amountOut.Sign() <= 0 || reserveIn.Sign() <= 0 || amountOut.Cmp(reserveOut) >= 0 {
+		return nil, errors.New("insufficient liquidity")
+	}
+	numerator := new(big.Int).Mul(reserveIn, amountOut)
+	numerator.Mul(numerator, big.NewInt(FeeDenominator))
+	denominator := new(big.Int).Sub(reserveOut, amountOut)
+	denominator.Mul(denominator, big.NewInt(FeeDenominator-feeBps))
+	amountIn := numerator.Quo(numerator, denominator)
+	return amountIn.Add(amountIn, big.NewInt(1)), nil
+}
@@ -0,0 +1,382 @@
+package mevbackrun
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/mellis0303/mev-vem/pkg/crocodile-hunter"
+	"github.com/mellis0303/mev-vem/pkg/mev-amm"
+	"github.com/mellis0303/mev-vem/pkg/mev-omega"
+)
+
+// DefaultArbGas is the gas budgeted for a two-hop backrun when none is configured.
+const DefaultArbGas = 240000
+
+// OracleUpdate = a decoded pending price-oracle update.
+type OracleUpdate struct {
+	Hash      string
+	From      string
+	Oracle    string // oracle contract the update is sent to
+	Base      string
+	Quote     string
+	Price     *big.Int // quote per base, 1e18 scaled
+	GasPrice  *big.Int
+	Timestamp time.Time
+}
+
+// Leg = one swap of the backrun.
+type Leg struct {
+	Pool      string
+	TokenIn   string
+	TokenOut  string
+	AmountIn  *big.Int
+	AmountOut *big.Int
+}
+
+// Opportunity = arbitrage left behind by a target tx, captured right after it.
+type Opportunity struct {
+	TargetHash  string
+	TargetFrom  string
+	TargetTo    string
+	TargetGas   *big.Int
+	Legs        []Leg
+	GrossProfit *big.Int // in Numeraire
+	GasCost     *big.Int
+	NetProfit   *big.Int
+	Inventory   map[string]*big.Int // net change in each token over the legs, before gas
+	Marked      bool                // GrossProfit values non-Numeraire inventory at an oracle price
+	Searcher    string
+	GasPrice    *big.Int
+}
+
+// BackrunStrategy watches swaps and oracle updates for non-harmful backruns.
+type BackrunStrategy struct {
+	pools     map[string]*mevamm.Pool
+	searcher  string
+	numeraire string
+	gasPrice  *big.Int
+	arbGas    uint64
+	minProfit *big.Int
+	mutex     sync.RWMutex
+}
+
+// NewBackrunStrategy initializes a backrun-only strategy.
+func NewBackrunStrategy(searcher, numeraire string, gasPrice, minProfit *big.Int) *BackrunStrategy {
+	return &BackrunStrategy{
+		pools:     make(map[string]*mevamm.Pool),
+		searcher:  searcher,
+		numeraire: numeraire,
+		gasPrice:  gasPrice,
+		arbGas:    DefaultArbGas,
+		minProfit: minProfit,
+	}
+}
+
+// SetPool registers or refreshes the state of a pool.
+func (bs *BackrunStrategy) SetPool(pool *mevamm.Pool) {
+	bs.mutex.Lock()
+	defer bs.mutex.Unlock()
+	bs.pools[pool.Address] = pool.Clone()
+}
+
+// snapshot clones every pool trading both tokens.
+func (bs *BackrunStrategy) snapshot(tokenA, tokenB string) []*mevamm.Pool {
+	var pools []*mevamm.Pool
+	for _, pool := range bs.pools {
+		if pool.Has(tokenA) && pool.Has(tokenB) {
+			pools = append(pools, pool.Clone())
+		}
+	}
+	return pools
+}
+
+// maximize ternary-searches the input in [0, hi] that maximizes profit.
+// profit must be concave, which holds for chained constant-product swaps.
+func maximize(profit func(*big.Int) *big.Int, hi *big.Int) (*big.Int, *big.Int) {
+	lo, hi := big.NewInt(0), new(big.Int).Set(hi)
+	three := big.NewInt(3)
+	for new(big.Int).Sub(hi, lo).Cmp(three) > 0 {
+		third := new(big.Int).Sub(hi, lo)
+		third.Quo(third, three)
+		m1 := new(big.Int).Add(lo, third)
+		m2 := new(big.Int).Sub(hi, third)
+		if profit(m1).Cmp(profit(m2)) < 0 {
+			lo = m1
+		} else {
+			hi = m2
+		}
+	}
+	best, bestProfit := lo, profit(lo)
+	for x := new(big.Int).Add(lo, big.NewInt(1)); x.Cmp(hi) <= 0; x = new(big.Int).Add(x, big.NewInt(1)) {
+		if p := profit(x); p.Cmp(bestProfit) > 0 {
+			best, bestProfit = x, p
+		}
+	}
+	return best, bestProfit
+}
+
+// cycle returns the output of start -> other on buy, then other -> start on sell.
+func cycle(buy, sell *mevamm.Pool, start, other string, x *big.Int) (*big.Int, *big.Int) {
+	mid, err := buy.Quote(start, x)
+	if err != nil {
+		return big.NewInt(0), big.NewInt(0)
+	}
+	out, err := sell.Quote(other, mid)
+	if err != nil {
+		return mid, big.NewInt(0)
+	}
+	return mid, out
+}
+
+// bestCycle finds the most profitable two-pool arbitrage starting and ending in start.
+func bestCycle(pools []*mevamm.Pool, start, other string) ([]Leg, *big.Int) {
+	var legs []Leg
+	bestProfit := big.NewInt(0)
+	for _, buy := range pools {
+		for _, sell := range pools {
+			if buy == sell {
+				continue
+			}
+			profit := func(x *big.Int) *big.Int {
+				_, out := cycle(buy, sell, start, other, x)
+				return out.Sub(out, x)
+			}
+			reserveIn, _, _ := buy.Reserves(start)
+			x, p := maximize(profit, reserveIn)
+			if p.Cmp(bestProfit) > 0 {
+				mid, out := cycle(buy, sell, start, other, x)
+				bestProfit = p
+				legs = []Leg{
+					{Pool: buy.Address, TokenIn: start, TokenOut: other, AmountIn: x, AmountOut: mid},
+					{Pool: sell.Address, TokenIn: other, TokenOut: start, AmountIn: mid, AmountOut: out},
+				}
+			}
+		}
+	}
+	return legs, bestProfit
+}
+
+// OnSwap simulates the target swap and looks for arbitrage it leaves across pools.
+func (bs *BackrunStrategy) OnSwap(swap *crocodilehunter.PendingSwap) (*Opportunity, error) {
+	bs.mutex.RLock()
+	pools := bs.snapshot(swap.TokenIn, swap.TokenOut)
+	bs.mutex.RUnlock()
+
+	var target *mevamm.Pool
+	for _, pool := range pools {
+		if pool.Address == swap.Pool {
+			target = pool
+		}
+	}
+	if target == nil {
+		return nil, fmt.Errorf("unknown pool %s for swap %s", swap.Pool, swap.Hash)
+	}
+	out, err := target.Swap(swap.TokenIn, swap.AmountIn)
+	if err != nil {
+		return nil, err
+	}
+	// a target that reverts on its slippage limit leaves nothing to backrun
+	if swap.MinAmountOut != nil && out.Cmp(swap.MinAmountOut) < 0 {
+		return nil, fmt.Errorf("swap %s reverts: output %s below minimum %s", swap.Hash, out.String(), swap.MinAmountOut.String())
+	}
+
+	start, other := bs.numeraire, ""
+	switch bs.numeraire {
+	case swap.TokenIn:
+		other = swap.TokenOut
+	case swap.TokenOut:
+		other = swap.TokenIn
+	default:
+		return nil, fmt.Errorf("swap %s does not touch numeraire %s", swap.Hash, bs.numeraire)
+	}
+
+	legs, gross := bestCycle(pools, start, other)
+	if legs == nil {
+		return nil, errors.New("no arbitrage left after target")
+	}
+	return bs.opportunity(swap.Hash, swap.From, swap.Pool, swap.GasPrice, legs, gross, false)
+}
+
+// OnOracleUpdate trades each pool on the pair back toward the new oracle price.
+// The legs end holding the token bought rather than Numeraire, so the
+// opportunity is Marked: GrossProfit assumes the Inventory can be unwound at
+// the oracle price elsewhere, and nothing of it is realized on-chain until then.
+func (bs *BackrunStrategy) OnOracleUpdate(update *OracleUpdate) (*Opportunity, error) {
+	if update.Price == nil || update.Price.Sign() <= 0 {
+		return nil, fmt.Errorf("oracle update %s has no price", update.Hash)
+	}
+	if update.Oracle == "" {
+		return nil, fmt.Errorf("oracle update %s has no oracle address", update.Hash)
+	}
+	bs.mutex.RLock()
+	pools := bs.snapshot(update.Base, update.Quote)
+	bs.mutex.RUnlock()
+
+	var legs []Leg
+	gross := big.NewInt(0) // in quote
+	for _, pool := range pools {
+		spot, err := pool.SpotPrice(update.Base)
+		if err != nil {
+			continue
+		}
+		tokenIn, tokenOut := update.Quote, update.Base
+		if spot.Cmp(update.Price) > 0 {
+			tokenIn, tokenOut = update.Base, update.Quote
+		}
+		// value an amount of either token in quote at the oracle price
+		inQuote := func(token string, amount *big.Int) *big.Int {
+			if token == update.Quote {
+				return new(big.Int).Set(amount)
+			}
+			v := new(big.Int).Mul(amount, update.Price)
+			return v.Quo(v, mevamm.WAD)
+		}
+		profit := func(x *big.Int) *big.Int {
+			out, err := pool.Quote(tokenIn, x)
+			if err != nil {
+				return big.NewInt(0)
+			}
+			return new(big.Int).Sub(inQuote(tokenOut, out), inQuote(tokenIn, x))
+		}
+		reserveIn, _, _ := pool.Reserves(tokenIn)
+		x, p := maximize(profit, reserveIn)
+		if p.Sign() <= 0 {
+			continue
+		}
+		out, _ := pool.Quote(tokenIn, x)
+		legs = append(legs, Leg{Pool: pool.Address, TokenIn: tokenIn, TokenOut: tokenOut, AmountIn: x, AmountOut: out})
+		gross.Add(gross, p)
+	}
+	if legs == nil {
+		return nil, errors.New("no pool deviates from the oracle price")
+	}
+
+	switch bs.numeraire {
+	case update.Quote:
+	case update.Base:
+		gross.Mul(gross, mevamm.WAD)
+		gross.Quo(gross, update.Price)
+	default:
+		return nil, fmt.Errorf("oracle update %s does not price numeraire %s", update.Hash, bs.numeraire)
+	}
+	return bs.opportunity(update.Hash, update.From, update.Oracle, update.GasPrice, legs, gross, true)
+}
+
+// opportunity nets gas out of gross profit and applies the minimum profit filter.
+func (bs *BackrunStrategy) opportunity(hash, from, to string, targetGas *big.Int, legs []Leg, gross *big.Int, marked bool) (*Opportunity, error) {
+	gasPrice := bs.gasPrice
+	if gasPrice == nil {
+		gasPrice = targetGas
+	}
+	gasCost := new(big.Int).Mul(gasPrice, new(big.Int).SetUint64(bs.arbGas))
+	net := new(big.Int).Sub(gross, gasCost)
+	if net.Cmp(bs.minProfit) < 0 {
+		return nil, fmt.Errorf("backrun of %s nets %s wei, below minimum", hash, net.String())
+	}
+	return &Opportunity{
+		TargetHash:  hash,
+		TargetFrom:  from,
+		TargetTo:    to,
+		TargetGas:   targetGas,
+		Legs:        legs,
+		GrossProfit: gross,
+		GasCost:     gasCost,
+		NetProfit:   net,
+		Inventory:   inventory(legs),
+		Marked:      marked,
+		Searcher:    bs.searcher,
+		GasPrice:    gasPrice,
+	}, nil
+}
+
+// inventory nets what the legs pay out against what they take in, per token.
+func inventory(legs []Leg) map[string]*big.Int {
+	net := map[string]*big.Int{}
+	for _, leg := range legs {
+		for _, token := range []string{leg.TokenIn, leg.TokenOut} {
+			if net[token] == nil {
+				net[token] = big.NewInt(0)
+			}
+		}
+		net[leg.TokenIn].Sub(net[leg.TokenIn], leg.AmountIn)
+		net[leg.TokenOut].Add(net[leg.TokenOut], leg.AmountOut)
+	}
+	return net
+}
+
+// BackrunHash names the backrun tx derived from the target.
+func (op *Opportunity) BackrunHash() string {
+	return op.TargetHash + "-backrun"
+}
+
+// Bundle orders the opportunity as [target, backrun] for FlashHunter.
+func (op *Opportunity) Bundle() *crocodilehunter.Bundle {
+	now := time.Now()
+	return &crocodilehunter.Bundle{
+		Transactions: []*crocodilehunter.Tx{
+			{Hash: op.TargetHash, From: op.TargetFrom, To: op.TargetTo, GasPrice: op.TargetGas, Profit: big.NewInt(0), Timestamp: now},
+			{Hash: op.BackrunHash(), From: op.Searcher, To: op.Legs[0].Pool, GasPrice: op.GasPrice, Profit: new(big.Int).Set(op.NetProfit), Timestamp: now},
+		},
+		TotalProfit: new(big.Int).Set(op.NetProfit),
+	}
+}
+
+// OmegaTxs emits [target, backrun] where the backrun depends on the target hash.
+func (op *Opportunity) OmegaTxs() []*mevomega.OmegaTx {
+	now := time.Now()
+	return []*mevomega.OmegaTx{
+		{
+			Hash:         op.TargetHash,
+			Sender:       op.TargetFrom,
+			Receiver:     op.TargetTo,
+			GasPrice:     op.TargetGas,
+			Value:        big.NewInt(0),
+			Profit:       big.NewInt(0),
+			Dependencies: []string{},
+			Timestamp:    now,
+		},
+		{
+			Hash:         op.BackrunHash(),
+			Sender:       op.Searcher,
+			Receiver:     op.Legs[0].Pool,
+			GasPrice:     op.GasPrice,
+			Value:        new(big.Int).Set(op.Legs[0].AmountIn),
+			Profit:       new(big.Int).Set(op.NetProfit),
+			Dependencies: []string{op.TargetHash},
+			Timestamp:    now,
+		},
+	}
+}
+
+// Example demonstrates backrunning a large swap into OmegaCore.
+func Example() {
+	strategy := NewBackrunStrategy("0xSearcher", "WETH", big.NewInt(30e9), big.NewInt(0))
+	strategy.SetPool(mevamm.NewPool("0xUniPool", "WETH", "USDC", mevomega.EthToWei(1000), mevomega.EthToWei(2000000), 30))
+	strategy.SetPool(mevamm.NewPool("0xSushiPool", "WETH", "USDC", mevomega.EthToWei(800), mevomega.EthToWei(1600000), 30))
+
+	swap := &crocodilehunter.PendingSwap{
+		Hash:         "0xwhale",
+		From:         "0xWhale",
+		Pool:         "0xUniPool",
+		TokenIn:      "WETH",
+		TokenOut:     "USDC",
+		AmountIn:     mevomega.EthToWei(100),
+		MinAmountOut: big.NewInt(0),
+		GasPrice:     big.NewInt(30e9),
+		Timestamp:    time.Now(),
+	}
+	op, err := strategy.OnSwap(swap)
+	if err != nil {
+		fmt.Println("No backrun:", err)
+		return
+	}
+
+	omega := mevomega.NewOmegaCore(5, mevomega.EthToWei(1500), mevomega.EthToWei(1e12))
+	for _, tx := range op.OmegaTxs() {
+		omega.AddTx(tx)
+	}
+	omega.ExecuteStrategicBundle(omega.OptimizeTransactionOrdering())
+}
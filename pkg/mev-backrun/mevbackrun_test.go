@@ -0,0 +1,240 @@
+// This file contains tests for backrun cycle selection and profit math, oracle
+// update backruns, and the [target, backrun] bundles handed downstream.
+
+package mevbackrun
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/mellis0303/mev-vem/pkg/crocodile-hunter"
+	"github.com/mellis0303/mev-vem/pkg/mev-amm"
+	"github.com/mellis0303/mev-vem/pkg/mev-omega"
+)
+
+func eth(n int64) *big.Int {
+	return mevomega.EthToWei(n)
+}
+
+func newTestStrategy() *BackrunStrategy {
+	strategy := NewBackrunStrategy("0xSearcher", "WETH", big.NewInt(30e9), big.NewInt(0))
+	strategy.SetPool(mevamm.NewPool("0xUniPool", "WETH", "USDC", eth(1000), eth(2000000), 30))
+	strategy.SetPool(mevamm.NewPool("0xSushiPool", "WETH", "USDC", eth(800), eth(1600000), 30))
+	return strategy
+}
+
+func whaleSwap() *crocodilehunter.PendingSwap {
+	return &crocodilehunter.PendingSwap{
+		Hash:         "0xwhale",
+		From:         "0xWhale",
+		Pool:         "0xUniPool",
+		TokenIn:      "WETH",
+		TokenOut:     "USDC",
+		AmountIn:     eth(100),
+		MinAmountOut: big.NewInt(0),
+		GasPrice:     big.NewInt(30e9),
+		Timestamp:    time.Now(),
+	}
+}
+
+func TestOnSwapCycle(t *testing.T) {
+	op, err := newTestStrategy().OnSwap(whaleSwap())
+	if err != nil {
+		t.Fatalf("OnSwap: %v", err)
+	}
+	if len(op.Legs) != 2 {
+		t.Fatalf("expected 2 legs, got %d", len(op.Legs))
+	}
+
+	// the whale made WETH cheap on Uni: sell WETH on Sushi, buy it back on Uni
+	sell, buy := op.Legs[0], op.Legs[1]
+	if sell.Pool != "0xSushiPool" || sell.TokenIn != "WETH" || sell.TokenOut != "USDC" {
+		t.Errorf("first leg should sell WETH on Sushi, got %+v", sell)
+	}
+	if buy.Pool != "0xUniPool" || buy.TokenIn != "USDC" || buy.TokenOut != "WETH" {
+		t.Errorf("second leg should buy WETH on Uni, got %+v", buy)
+	}
+	if buy.AmountIn.Cmp(sell.AmountOut) != 0 {
+		t.Errorf("second leg spends %s, first leg paid %s", buy.AmountIn, sell.AmountOut)
+	}
+
+	// the legs replay against the pools as left by the target
+	uni := mevamm.NewPool("0xUniPool", "WETH", "USDC", eth(1000), eth(2000000), 30)
+	sushi := mevamm.NewPool("0xSushiPool", "WETH", "USDC", eth(800), eth(1600000), 30)
+	if _, err := uni.Swap("WETH", eth(100)); err != nil {
+		t.Fatal(err)
+	}
+	mid, _ := sushi.Quote("WETH", sell.AmountIn)
+	out, _ := uni.Quote("USDC", mid)
+	if mid.Cmp(sell.AmountOut) != 0 || out.Cmp(buy.AmountOut) != 0 {
+		t.Errorf("legs quote %s -> %s, replay gives %s -> %s", sell.AmountOut, buy.AmountOut, mid, out)
+	}
+
+	gross := new(big.Int).Sub(buy.AmountOut, sell.AmountIn)
+	if op.GrossProfit.Cmp(gross) != 0 || gross.Sign() <= 0 {
+		t.Errorf("gross profit %s, want %s > 0", op.GrossProfit, gross)
+	}
+	gasCost := new(big.Int).Mul(big.NewInt(30e9), big.NewInt(DefaultArbGas))
+	if op.GasCost.Cmp(gasCost) != 0 || new(big.Int).Add(op.NetProfit, gasCost).Cmp(gross) != 0 {
+		t.Errorf("net %s and gas %s do not add up to gross %s", op.NetProfit, op.GasCost, gross)
+	}
+	if op.Marked || op.Inventory["WETH"].Cmp(gross) != 0 || op.Inventory["USDC"].Sign() != 0 {
+		t.Errorf("a closed cycle should realize its profit in WETH, got marked=%v inventory %v", op.Marked, op.Inventory)
+	}
+
+	// the input maximizes the cycle's profit
+	profit := func(x *big.Int) *big.Int {
+		s := mevamm.NewPool("0xSushiPool", "WETH", "USDC", eth(800), eth(1600000), 30)
+		m, _ := s.Quote("WETH", x)
+		o, _ := uni.Quote("USDC", m)
+		return o.Sub(o, x)
+	}
+	for _, x := range []*big.Int{new(big.Int).Div(sell.AmountIn, big.NewInt(2)), new(big.Int).Mul(sell.AmountIn, big.NewInt(2))} {
+		if p := profit(x); p.Cmp(gross) > 0 {
+			t.Errorf("input %s profits %s, more than the chosen %s", x, p, gross)
+		}
+	}
+}
+
+func TestOnSwapErrors(t *testing.T) {
+	strategy := newTestStrategy()
+
+	swap := whaleSwap()
+	swap.Pool = "0xUnknown"
+	if _, err := strategy.OnSwap(swap); err == nil {
+		t.Error("swap on an unknown pool should fail")
+	}
+
+	swap = whaleSwap()
+	swap.AmountIn = big.NewInt(1)
+	if _, err := strategy.OnSwap(swap); err == nil {
+		t.Error("a dust swap leaves no arbitrage")
+	}
+
+	// 100 WETH into Uni pays about 180k USDC; a 190k limit makes the target revert
+	swap = whaleSwap()
+	swap.MinAmountOut = eth(190000)
+	if _, err := strategy.OnSwap(swap); err == nil {
+		t.Error("a swap that reverts on its slippage limit should not be backrun")
+	}
+	swap = whaleSwap()
+	swap.MinAmountOut = nil
+	if _, err := strategy.OnSwap(swap); err != nil {
+		t.Errorf("a swap with no slippage limit should be backrun: %v", err)
+	}
+
+	strategy = NewBackrunStrategy("0xSearcher", "WETH", big.NewInt(30e9), eth(1000))
+	strategy.SetPool(mevamm.NewPool("0xUniPool", "WETH", "USDC", eth(1000), eth(2000000), 30))
+	strategy.SetPool(mevamm.NewPool("0xSushiPool", "WETH", "USDC", eth(800), eth(1600000), 30))
+	if _, err := strategy.OnSwap(whaleSwap()); err == nil {
+		t.Error("backrun below the minimum profit should fail")
+	}
+}
+
+func TestOnOracleUpdate(t *testing.T) {
+	strategy := newTestStrategy()
+	update := &OracleUpdate{Hash: "0xoracle", From: "0xChainlink", Oracle: "0xEthUsdFeed", Base: "WETH", Quote: "USDC", Price: eth(2100), GasPrice: big.NewInt(30e9)}
+	op, err := strategy.OnOracleUpdate(update)
+	if err != nil {
+		t.Fatalf("OnOracleUpdate: %v", err)
+	}
+
+	// both pools price WETH at 2000, below the oracle: buy WETH with USDC on each
+	if len(op.Legs) != 2 {
+		t.Fatalf("expected a leg per pool, got %d", len(op.Legs))
+	}
+	for _, leg := range op.Legs {
+		if leg.TokenIn != "USDC" || leg.TokenOut != "WETH" {
+			t.Errorf("leg on %s should buy WETH, got %s -> %s", leg.Pool, leg.TokenIn, leg.TokenOut)
+		}
+	}
+
+	// the profit is only marked: the legs hold WETH bought with USDC
+	if !op.Marked {
+		t.Error("oracle backrun profit should be marked")
+	}
+	if op.Inventory["WETH"].Sign() <= 0 || op.Inventory["USDC"].Sign() >= 0 {
+		t.Errorf("expected long WETH, short USDC, got %v", op.Inventory)
+	}
+	marked := new(big.Int).Mul(op.Inventory["USDC"], mevamm.WAD)
+	marked.Quo(marked, eth(2100))
+	marked.Add(marked, op.Inventory["WETH"])
+	if diff := new(big.Int).Sub(marked, op.GrossProfit); diff.CmpAbs(big.NewInt(2)) > 0 {
+		t.Errorf("gross %s should value the inventory at the oracle price, got %s", op.GrossProfit, marked)
+	}
+	if to := op.Bundle().Transactions[0].To; to != "0xEthUsdFeed" {
+		t.Errorf("target should be sent to the oracle, got %s", to)
+	}
+}
+
+func TestOnOracleUpdateErrors(t *testing.T) {
+	strategy := newTestStrategy()
+	for name, update := range map[string]*OracleUpdate{
+		"no price":     {Hash: "0xa", Base: "WETH", Quote: "USDC"},
+		"zero price":   {Hash: "0xb", Base: "WETH", Quote: "USDC", Price: big.NewInt(0)},
+		"at spot":      {Hash: "0xc", Oracle: "0xEthUsdFeed", Base: "WETH", Quote: "USDC", Price: eth(2000), GasPrice: big.NewInt(30e9)},
+		"unknown pair": {Hash: "0xd", Oracle: "0xBtcUsdFeed", Base: "WBTC", Quote: "USDC", Price: eth(60000), GasPrice: big.NewInt(30e9)},
+		"no oracle":    {Hash: "0xf", Base: "WETH", Quote: "USDC", Price: eth(2100), GasPrice: big.NewInt(30e9)},
+	} {
+		if _, err := strategy.OnOracleUpdate(update); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+
+	strategy = NewBackrunStrategy("0xSearcher", "DAI", big.NewInt(30e9), big.NewInt(0))
+	strategy.SetPool(mevamm.NewPool("0xUniPool", "WETH", "USDC", eth(1000), eth(2000000), 30))
+	update := &OracleUpdate{Hash: "0xe", Oracle: "0xEthUsdFeed", Base: "WETH", Quote: "USDC", Price: eth(2100), GasPrice: big.NewInt(30e9)}
+	if _, err := strategy.OnOracleUpdate(update); err == nil {
+		t.Error("an update that does not price the numeraire should fail")
+	}
+}
+
+func TestBundleAndOmegaTxs(t *testing.T) {
+	op, err := newTestStrategy().OnSwap(whaleSwap())
+	if err != nil {
+		t.Fatalf("OnSwap: %v", err)
+	}
+
+	bundle := op.Bundle()
+	if len(bundle.Transactions) != 2 {
+		t.Fatalf("expected [target, backrun], got %d txs", len(bundle.Transactions))
+	}
+	target, backrun := bundle.Transactions[0], bundle.Transactions[1]
+	if target.Hash != "0xwhale" || target.From != "0xWhale" || target.Profit.Sign() != 0 {
+		t.Errorf("first tx should be the untouched target, got %+v", target)
+	}
+	if backrun.Hash != op.BackrunHash() || backrun.From != "0xSearcher" || backrun.Profit.Cmp(op.NetProfit) != 0 {
+		t.Errorf("second tx should be the backrun, got %+v", backrun)
+	}
+	if bundle.TotalProfit.Cmp(op.NetProfit) != 0 {
+		t.Errorf("bundle profit %s, want %s", bundle.TotalProfit, op.NetProfit)
+	}
+	if target.To != "0xUniPool" {
+		t.Errorf("target should be sent to its pool, got %s", target.To)
+	}
+
+	txs := op.OmegaTxs()
+	if len(txs) != 2 || txs[0].Hash != "0xwhale" || txs[1].Hash != op.BackrunHash() {
+		t.Fatalf("expected [target, backrun], got %v", txs)
+	}
+	if len(txs[0].Dependencies) != 0 {
+		t.Errorf("target should not depend on anything, got %v", txs[0].Dependencies)
+	}
+	if len(txs[1].Dependencies) != 1 || txs[1].Dependencies[0] != "0xwhale" {
+		t.Errorf("backrun should depend on the target hash, got %v", txs[1].Dependencies)
+	}
+	if txs[1].Value.Cmp(op.Legs[0].AmountIn) != 0 {
+		t.Errorf("backrun value %s, want first leg input %s", txs[1].Value, op.Legs[0].AmountIn)
+	}
+
+	// OmegaCore keeps the target ahead of its backrun
+	omega := mevomega.NewOmegaCore(5, eth(1500), eth(1e12))
+	for i := len(txs) - 1; i >= 0; i-- {
+		omega.AddTx(txs[i])
+	}
+	ordered := omega.OptimizeTransactionOrdering()
+	if len(ordered) != 2 || ordered[0].Hash != "0xwhale" {
+		t.Errorf("target should be ordered first, got %v", ordered)
+	}
+}
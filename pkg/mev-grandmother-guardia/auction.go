@@ -0,0 +1,425 @@
+package mevgrandmothersguardia
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mellis0303/mev-vem/pkg/mev-amm"
+)
+
+// DefaultAuctionWindow = how long a batch collects orders before it clears.
+const DefaultAuctionWindow = 2 * time.Second
+
+// PriceScale scales clearing prices. It is finer than WAD so that rounding
+// each fill down never owes more than the batch has, for batches below 1e36
+// base units.
+var PriceScale = new(big.Int).Exp(big.NewInt(10), big.NewInt(36), nil)
+
+// SwapOrder = a protected user's swap sent to the batch auction instead of
+// the public order flow.
+type SwapOrder struct {
+	Hash     string
+	Sender   string
+	TokenIn  string
+	TokenOut string
+	AmountIn *big.Int
+	MinOut   *big.Int // nil for no limit
+}
+
+// Fill = what one order gets in a settlement.
+type Fill struct {
+	Order     *SwapOrder
+	AmountOut *big.Int
+}
+
+// Settlement = a cleared batch on one pair, settled in a single bundle: the
+// orders are crossed against each other at one price and only the imbalance
+// trades against the pool.
+type Settlement struct {
+	Pool     string
+	Token0   string
+	Token1   string
+	Price    *big.Int // uniform price of Token0 in Token1, scaled by PriceScale
+	Fills    []Fill
+	Unfilled []*SwapOrder // limits the clearing price did not meet
+	Matched  *big.Int     // amount of AMMToken crossed with the other side
+	AMMToken string       // token sold to the pool, empty if nothing was
+	AMMIn    *big.Int
+	AMMOut   *big.Int
+	Surplus  map[string]*big.Int // rounding dust left with the settlement, by token
+}
+
+// batch = orders on one pair waiting for their window to close.
+type batch struct {
+	opened time.Time
+	orders []*SwapOrder
+}
+
+// BatchAuction collects protected swaps per pair for a fixed window and clears
+// each batch at a uniform price. Pools are snapshots of on-chain reserves.
+// Clearing moves a snapshot by its settlement's AMM leg, as if the settlement
+// landed; refresh it with AddPool when the chain says otherwise.
+type BatchAuction struct {
+	window  time.Duration
+	pools   map[string]*mevamm.Pool // by pair
+	batches map[string]*batch       // by pair
+	hashes  map[string]bool         // orders waiting in any batch
+	mutex   sync.Mutex
+}
+
+// NewBatchAuction returns an auction clearing every window.
+func NewBatchAuction(window time.Duration) *BatchAuction {
+	return &BatchAuction{
+		window:  window,
+		pools:   make(map[string]*mevamm.Pool),
+		batches: make(map[string]*batch),
+		hashes:  make(map[string]bool),
+	}
+}
+
+// pairKey names a pair independent of direction.
+func pairKey(a, b string) string {
+	if a > b {
+		a, b = b, a
+	}
+	return a + "/" + b
+}
+
+// AddPool sets the pool the imbalance of a pair is routed to, replacing any
+// earlier snapshot of it.
+func (a *BatchAuction) AddPool(p *mevamm.Pool) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.pools[pairKey(p.Token0, p.Token1)] = p.Clone()
+}
+
+// Submit adds an order to its pair's batch, opening one at now if needed.
+func (a *BatchAuction) Submit(o *SwapOrder, now time.Time) error {
+	if o.AmountIn == nil || o.AmountIn.Sign() <= 0 {
+		return fmt.Errorf("order %s has no amount", o.Hash)
+	}
+	if o.TokenIn == o.TokenOut {
+		return fmt.Errorf("order %s swaps %s for itself", o.Hash, o.TokenIn)
+	}
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	key := pairKey(o.TokenIn, o.TokenOut)
+	if _, ok := a.pools[key]; !ok {
+		return fmt.Errorf("no pool for %s", key)
+	}
+	if a.hashes[o.Hash] {
+		return fmt.Errorf("order %s already in a batch", o.Hash)
+	}
+	b, ok := a.batches[key]
+	if !ok {
+		b = &batch{opened: now}
+		a.batches[key] = b
+	}
+	b.orders = append(b.orders, o)
+	a.hashes[o.Hash] = true
+	return nil
+}
+
+// Clear settles every batch whose window has closed at now, by pair, and
+// applies each settlement's AMM leg to the pool snapshot. A batch that cannot
+// be cleared is dropped with its orders and reported in the error.
+func (a *BatchAuction) Clear(now time.Time) ([]*Settlement, error) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	var keys []string
+	for key, b := range a.batches {
+		if !now.Before(b.opened.Add(a.window)) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	var settlements []*Settlement
+	var errs []error
+	for _, key := range keys {
+		b := a.batches[key]
+		delete(a.batches, key)
+		for _, o := range b.orders {
+			delete(a.hashes, o.Hash)
+		}
+		s, err := ClearBatch(a.pools[key], b.orders)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", key, err))
+			continue
+		}
+		if s.AMMToken != "" {
+			if _, err := a.pools[key].Swap(s.AMMToken, s.AMMIn); err != nil {
+				errs = append(errs, fmt.Errorf("%s: apply settlement: %w", key, err))
+				continue
+			}
+		}
+		settlements = append(settlements, s)
+	}
+	return settlements, errors.Join(errs...)
+}
+
+// ClearBatch clears orders on pool's pair at one price. Orders selling the
+// same token are summed; whichever side is worth more at the pool's spot
+// price is the surplus side. Opposite orders are crossed first and only the
+// surplus trades against the pool, at the best price for the surplus side
+// that the pool's fill can still pay for. Orders whose limit is not met are
+// left out and the rest cleared again.
+func ClearBatch(pool *mevamm.Pool, orders []*SwapOrder) (*Settlement, error) {
+	var live []*SwapOrder
+	for _, o := range orders {
+		if !pool.Has(o.TokenIn) || !pool.Has(o.TokenOut) || o.TokenIn == o.TokenOut {
+			return nil, fmt.Errorf("order %s is not on pool %s", o.Hash, pool.Address)
+		}
+		live = append(live, o)
+	}
+
+	var unfilled []*SwapOrder
+	for {
+		s, err := settle(pool, live)
+		if err != nil {
+			return nil, err
+		}
+		var kept []*SwapOrder
+		var missed []*SwapOrder
+		for _, f := range s.Fills {
+			if f.Order.MinOut != nil && f.AmountOut.Cmp(f.Order.MinOut) < 0 {
+				missed = append(missed, f.Order)
+			} else {
+				kept = append(kept, f.Order)
+			}
+		}
+		if len(missed) == 0 {
+			s.Unfilled = unfilled
+			return s, nil
+		}
+		unfilled = append(unfilled, missed...)
+		live = kept
+	}
+}
+
+// settle computes one settlement without looking at limits.
+func settle(pool *mevamm.Pool, orders []*SwapOrder) (*Settlement, error) {
+	s := &Settlement{
+		Pool:    pool.Address,
+		Token0:  pool.Token0,
+		Token1:  pool.Token1,
+		Matched: new(big.Int),
+		AMMIn:   new(big.Int),
+		AMMOut:  new(big.Int),
+		Surplus: map[string]*big.Int{pool.Token0: new(big.Int), pool.Token1: new(big.Int)},
+	}
+	sum := map[string]*big.Int{pool.Token0: new(big.Int), pool.Token1: new(big.Int)}
+	for _, o := range orders {
+		sum[o.TokenIn].Add(sum[o.TokenIn], o.AmountIn)
+	}
+	spot, err := spotPrice(pool, pool.Token0)
+	if err != nil {
+		return nil, err
+	}
+	if sum[pool.Token0].Sign() == 0 && sum[pool.Token1].Sign() == 0 {
+		s.Price = spot
+		return s, nil
+	}
+
+	// x = surplus token, y = the other; q = price of x in y
+	x, y := pool.Token0, pool.Token1
+	if new(big.Int).Mul(sum[x], spot).Cmp(new(big.Int).Mul(sum[y], PriceScale)) < 0 {
+		x, y = y, x
+		if spot, err = spotPrice(pool, x); err != nil {
+			return nil, err
+		}
+	}
+	sumX, sumY := sum[x], sum[y]
+
+	// owed returns what sellers of token are owed at q, each rounded down.
+	owed := func(token string, q *big.Int) *big.Int {
+		total := new(big.Int)
+		for _, o := range orders {
+			if o.TokenIn == token {
+				total.Add(total, fill(o, x, q))
+			}
+		}
+		return total
+	}
+	xFor := func(q *big.Int) *big.Int { return owed(y, q) }
+	yOwed := func(q *big.Int) *big.Int { return owed(x, q) }
+	// feasible reports whether q pays every order from the crossed side and
+	// the pool's fill, returning the amount sold to the pool and its output.
+	feasible := func(q *big.Int) (bool, *big.Int, *big.Int) {
+		if q.Sign() <= 0 {
+			return false, nil, nil
+		}
+		toPool := new(big.Int).Sub(sumX, xFor(q))
+		if toPool.Sign() < 0 {
+			return false, nil, nil
+		}
+		out, err := pool.Clone().Swap(x, toPool)
+		if err != nil {
+			return false, nil, nil
+		}
+		return yOwed(q).Cmp(new(big.Int).Add(sumY, out)) <= 0, toPool, out
+	}
+
+	// the lowest price the crossed side alone pays for
+	lo := new(big.Int).Mul(sumY, PriceScale)
+	lo.Add(lo, sumX)
+	lo.Sub(lo, big.NewInt(1))
+	lo.Quo(lo, sumX)
+	if lo.Sign() == 0 {
+		lo.SetInt64(1)
+	}
+	if ok, _, _ := feasible(lo); !ok {
+		return nil, errors.New("batch cannot be cleared")
+	}
+	// above spot the pool's fill can never keep up
+	hi := new(big.Int).Add(spot, big.NewInt(1))
+	for new(big.Int).Sub(hi, lo).Cmp(big.NewInt(1)) > 0 {
+		mid := new(big.Int).Add(lo, hi)
+		mid.Rsh(mid, 1)
+		if ok, _, _ := feasible(mid); ok {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+	q := lo
+	_, toPool, out := feasible(q)
+
+	paidX, paidY := new(big.Int), new(big.Int)
+	for _, o := range orders {
+		amount := fill(o, x, q)
+		if o.TokenIn == x {
+			paidY.Add(paidY, amount)
+		} else {
+			paidX.Add(paidX, amount)
+		}
+		s.Fills = append(s.Fills, Fill{Order: o, AmountOut: amount})
+	}
+	s.Matched.Sub(sumX, toPool)
+	if toPool.Sign() > 0 {
+		s.AMMToken = x
+		s.AMMIn.Set(toPool)
+		s.AMMOut.Set(out)
+	}
+	s.Surplus[x].Sub(s.Matched, paidX)
+	s.Surplus[y].Sub(new(big.Int).Add(sumY, out), paidY)
+
+	if x == pool.Token0 {
+		s.Price = q
+	} else {
+		s.Price = new(big.Int).Quo(new(big.Int).Mul(PriceScale, PriceScale), q)
+	}
+	return s, nil
+}
+
+// ID names a settlement by its pool and the orders it fills.
+func (s *Settlement) ID() string {
+	h := sha256.New()
+	h.Write([]byte(s.Pool))
+	for _, f := range s.Fills {
+		h.Write([]byte{0})
+		h.Write([]byte(f.Order.Hash))
+	}
+	return hex.EncodeToString(h.Sum(nil)[:8])
+}
+
+// Bundle returns the txs that settle s on chain, sent by settler, the
+// contract that holds the filled orders' inputs: the AMM leg selling the
+// imbalance to the pool, if any, then one payout per fill. Unfilled orders
+// are not pulled and need no refund; rounding dust stays with settler.
+func (s *Settlement) Bundle(settler string) []*Tx {
+	id := s.ID()
+	var txs []*Tx
+	if s.AMMToken != "" {
+		out := s.Token1
+		if s.AMMToken == s.Token1 {
+			out = s.Token0
+		}
+		txs = append(txs, &Tx{
+			Hash:     fmt.Sprintf("batch:%s:amm", id),
+			Sender:   settler,
+			Receiver: s.Pool,
+			Pool:     s.Pool,
+			TokenIn:  s.AMMToken,
+			TokenOut: out,
+			AmountIn: new(big.Int).Set(s.AMMIn),
+		})
+	}
+	for _, f := range s.Fills {
+		if f.AmountOut.Sign() == 0 {
+			continue
+		}
+		txs = append(txs, &Tx{
+			Hash:     fmt.Sprintf("batch:%s:pay:%s", id, f.Order.Hash),
+			Sender:   settler,
+			Receiver: f.Order.Sender,
+			Token:    f.Order.TokenOut,
+			Value:    new(big.Int).Set(f.AmountOut),
+		})
+	}
+	return txs
+}
+
+// fill returns what o gets at q, the price of x scaled by PriceScale, rounded down.
+func fill(o *SwapOrder, x string, q *big.Int) *big.Int {
+	if o.TokenIn == x {
+		out := new(big.Int).Mul(o.AmountIn, q)
+		return out.Quo(out, PriceScale)
+	}
+	out := new(big.Int).Mul(o.AmountIn, PriceScale)
+	return out.Quo(out, q)
+}
+
+// spotPrice returns the pool's marginal price of base, scaled by PriceScale.
+func spotPrice(pool *mevamm.Pool, base string) (*big.Int, error) {
+	reserveBase, reserveQuote, err := pool.Reserves(base)
+	if err != nil {
+		return nil, err
+	}
+	if reserveBase.Sign() == 0 {
+		return nil, errors.New("empty pool")
+	}
+	price := new(big.Int).Mul(reserveQuote, PriceScale)
+	return price.Quo(price, reserveBase), nil
+}
+
+// SetBatchAuction routes protected swaps sent with SubmitSwap to a.
+func (mg *MEVGuardianEngine) SetBatchAuction(a *BatchAuction) {
+	mg.mutex.Lock()
+	defer mg.mutex.Unlock()
+	mg.auction = a
+}
+
+// SubmitSwap sends a protected sender's swap to the batch auction.
+func (mg *MEVGuardianEngine) SubmitSwap(o *SwapOrder) error {
+	mg.mutex.Lock()
+	a, protected := mg.auction, mg.level(o.Sender) >= LevelMonitor
+	mg.mutex.Unlock()
+	if a == nil {
+		return errors.New("batch auction not enabled")
+	}
+	if !protected {
+		return fmt.Errorf("sender %s is not protected", o.Sender)
+	}
+	return a.Submit(o, time.Now())
+}
+
+// SettleBatches clears every batch whose window has closed. Send each
+// settlement's Bundle to land it; the auction's pool snapshots already
+// reflect the AMM legs.
+func (mg *MEVGuardianEngine) SettleBatches() ([]*Settlement, error) {
+	mg.mutex.Lock()
+	a := mg.auction
+	mg.mutex.Unlock()
+	if a == nil {
+		return nil, nil
+	}
+	return a.Clear(time.Now())
+}
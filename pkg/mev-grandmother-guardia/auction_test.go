@@ -0,0 +1,172 @@
+// This file contains tests for uniform-price batch auctions, their windows and
+// settlement bundles.
+
+package mevgrandmothersguardia
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/mellis0303/mev-vem/pkg/mev-amm"
+)
+
+// units returns n whole tokens of 18 decimals.
+func units(n int64) *big.Int {
+	return new(big.Int).Mul(big.NewInt(n), mevamm.WAD)
+}
+
+func wethUSDC() *mevamm.Pool {
+	return mevamm.NewPool("0xPool", "WETH", "USDC", units(1000), units(2000000), 30)
+}
+
+func TestBatchAuctionUniformPrice(t *testing.T) {
+	pool := wethUSDC()
+	orders := []*SwapOrder{
+		{Hash: "a", Sender: "0xAlice", TokenIn: "WETH", TokenOut: "USDC", AmountIn: units(10)},
+		{Hash: "b", Sender: "0xBob", TokenIn: "USDC", TokenOut: "WETH", AmountIn: units(8000)},
+		{Hash: "c", Sender: "0xCarol", TokenIn: "WETH", TokenOut: "USDC", AmountIn: units(5)},
+		{Hash: "d", Sender: "0xDave", TokenIn: "WETH", TokenOut: "USDC", AmountIn: units(1), MinOut: units(2000)},
+	}
+	s, err := ClearBatch(pool, orders)
+	if err != nil {
+		t.Fatalf("ClearBatch: %v", err)
+	}
+	if len(s.Unfilled) != 1 || s.Unfilled[0].Hash != "d" {
+		t.Fatalf("expected d's limit to miss, got %v", s.Unfilled)
+	}
+	if len(s.Fills) != 3 {
+		t.Fatalf("expected 3 fills, got %d", len(s.Fills))
+	}
+
+	// everyone trades at the same price
+	paid := new(big.Int)
+	for _, f := range s.Fills {
+		want := new(big.Int)
+		if f.Order.TokenIn == "WETH" {
+			want.Quo(want.Mul(f.Order.AmountIn, s.Price), PriceScale)
+			paid.Add(paid, f.AmountOut)
+		} else {
+			want.Quo(want.Mul(f.Order.AmountIn, PriceScale), s.Price)
+		}
+		if f.AmountOut.Cmp(want) != 0 {
+			t.Errorf("%s got %s, expected %s at the clearing price", f.Order.Hash, f.AmountOut, want)
+		}
+	}
+
+	// Bob's USDC is crossed with the WETH sellers; only the rest hits the pool
+	if s.AMMToken != "WETH" || s.Matched.Sign() <= 0 || new(big.Int).Add(s.Matched, s.AMMIn).Cmp(units(15)) != 0 {
+		t.Errorf("unexpected routing: matched %s, %s %s to the pool", s.Matched, s.AMMIn, s.AMMToken)
+	}
+	if paid.Cmp(new(big.Int).Add(units(8000), s.AMMOut)) > 0 {
+		t.Errorf("paid out %s USDC but only had %s", paid, new(big.Int).Add(units(8000), s.AMMOut))
+	}
+	for token, dust := range s.Surplus {
+		if dust.Sign() < 0 {
+			t.Errorf("negative %s surplus %s", token, dust)
+		}
+	}
+
+	// crossing beats routing the WETH sellers through the pool, and the price is below spot
+	routed, _ := pool.Quote("WETH", units(15))
+	if paid.Cmp(routed) <= 0 {
+		t.Errorf("batch paid WETH sellers %s, the pool pays %s", paid, routed)
+	}
+	spot := new(big.Int).Mul(big.NewInt(2000), PriceScale)
+	if s.Price.Cmp(spot) >= 0 {
+		t.Errorf("clearing price %s not below spot %s", s.Price, spot)
+	}
+	if pool.Reserve0.Cmp(units(1000)) != 0 {
+		t.Errorf("clearing touched the pool's reserves")
+	}
+
+	// a perfectly balanced batch never touches the pool
+	s, err = ClearBatch(pool, []*SwapOrder{
+		{Hash: "e", TokenIn: "WETH", TokenOut: "USDC", AmountIn: units(1)},
+		{Hash: "f", TokenIn: "USDC", TokenOut: "WETH", AmountIn: units(2000)},
+	})
+	if err != nil {
+		t.Fatalf("ClearBatch: %v", err)
+	}
+	if s.AMMToken != "" || s.Price.Cmp(spot) != 0 || s.Fills[0].AmountOut.Cmp(units(2000)) != 0 || s.Fills[1].AmountOut.Cmp(units(1)) != 0 {
+		t.Errorf("expected a pure cross at spot, got price %s via %q", s.Price, s.AMMToken)
+	}
+}
+
+func TestBatchAuctionWindow(t *testing.T) {
+	auction := NewBatchAuction(2 * time.Second)
+	start := time.Unix(1700000000, 0)
+	order := &SwapOrder{Hash: "a", Sender: "0xAlice", TokenIn: "WETH", TokenOut: "USDC", AmountIn: units(1)}
+	if err := auction.Submit(order, start); err == nil {
+		t.Fatalf("expected an order without a pool to be refused")
+	}
+	auction.AddPool(wethUSDC())
+	if err := auction.Submit(order, start); err != nil {
+		t.Fatalf("Submit: %v", err)
+	}
+	if err := auction.Submit(order, start); err == nil {
+		t.Errorf("expected a duplicate order to be refused")
+	}
+	if s, _ := auction.Clear(start.Add(time.Second)); len(s) != 0 {
+		t.Fatalf("batch cleared before its window closed")
+	}
+	s, err := auction.Clear(start.Add(2 * time.Second))
+	if err != nil || len(s) != 1 || len(s[0].Fills) != 1 {
+		t.Fatalf("expected one settlement, got %v, %v", s, err)
+	}
+	if s, _ := auction.Clear(start.Add(time.Hour)); len(s) != 0 {
+		t.Errorf("batch cleared twice")
+	}
+
+	engine := NewMEVGuardianEngine()
+	engine.SetBatchAuction(auction)
+	if err := engine.SubmitSwap(&SwapOrder{Hash: "b", Sender: "0xBob", TokenIn: "WETH", TokenOut: "USDC", AmountIn: units(1)}); err == nil {
+		t.Errorf("expected an unprotected sender to be refused")
+	}
+	engine.AddProtectedSender("0xAlice")
+	if err := engine.SubmitSwap(&SwapOrder{Hash: "c", Sender: "0xAlice", TokenIn: "WETH", TokenOut: "USDC", AmountIn: units(1)}); err != nil {
+		t.Errorf("SubmitSwap: %v", err)
+	}
+}
+
+func TestSettlementBundleMovesPool(t *testing.T) {
+	auction := NewBatchAuction(time.Second)
+	auction.AddPool(wethUSDC())
+	start := time.Unix(1700000000, 0)
+	auction.Submit(&SwapOrder{Hash: "a", Sender: "0xAlice", TokenIn: "WETH", TokenOut: "USDC", AmountIn: units(10)}, start)
+	auction.Submit(&SwapOrder{Hash: "b", Sender: "0xBob", TokenIn: "USDC", TokenOut: "WETH", AmountIn: units(2000)}, start)
+	settlements, err := auction.Clear(start.Add(time.Second))
+	if err != nil || len(settlements) != 1 {
+		t.Fatalf("Clear = %v, %v", settlements, err)
+	}
+	s := settlements[0]
+
+	// the AMM leg sells the WETH imbalance, then each order is paid out
+	bundle := s.Bundle("0xSettler")
+	if len(bundle) != 3 {
+		t.Fatalf("expected an AMM leg and two payouts, got %d txs", len(bundle))
+	}
+	leg := bundle[0]
+	if leg.Sender != "0xSettler" || leg.Pool != "0xPool" || leg.TokenIn != "WETH" || leg.TokenOut != "USDC" || leg.AmountIn.Cmp(s.AMMIn) != 0 {
+		t.Errorf("unexpected AMM leg %+v", leg)
+	}
+	for i, f := range s.Fills {
+		pay := bundle[i+1]
+		if pay.Sender != "0xSettler" || pay.Receiver != f.Order.Sender || pay.Token != f.Order.TokenOut || pay.Value.Cmp(f.AmountOut) != 0 || isSwap(pay) {
+			t.Errorf("unexpected payout %+v for %s", pay, f.Order.Hash)
+		}
+	}
+	if bundle[1].Hash == bundle[2].Hash || bundle[0].Hash == bundle[1].Hash {
+		t.Errorf("bundle hashes collide: %s %s %s", bundle[0].Hash, bundle[1].Hash, bundle[2].Hash)
+	}
+
+	// the stored snapshot moved by the AMM leg, the caller's pool did not
+	moved := wethUSDC()
+	if out, _ := moved.Swap("WETH", s.AMMIn); out.Cmp(s.AMMOut) != 0 {
+		t.Fatalf("AMM leg pays %s, pool gives %s", s.AMMOut, out)
+	}
+	stored := auction.pools[pairKey("WETH", "USDC")]
+	if stored.Reserve0.Cmp(moved.Reserve0) != 0 || stored.Reserve1.Cmp(moved.Reserve1) != 0 {
+		t.Errorf("stored pool %s/%s, want %s/%s", stored.Reserve0, stored.Reserve1, moved.Reserve0, moved.Reserve1)
+	}
+}
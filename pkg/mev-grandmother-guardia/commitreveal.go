@@ -0,0 +1,298 @@
+package mevgrandmothersguardia
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+)
+
+// DefaultRevealDelay is how many blocks a protected tx stays sealed by default.
+const DefaultRevealDelay = 1
+
+// Commit-reveal errors.
+var (
+	// ErrCommitmentMismatch means a revealed body does not hash to its commitment.
+	ErrCommitmentMismatch = errors.New("revealed body does not match commitment")
+	// ErrUnsealed means a sender at LevelSealed submitted a plaintext body.
+	ErrUnsealed = errors.New("protected tx must be sealed by its sender")
+	// ErrKeyNotReleased means a tx may be revealed but its sender has not sent the key yet.
+	ErrKeyNotReleased = errors.New("sender has not released the body key")
+	// ErrHashPooled means a tx reuses the hash of a pooled tx from another
+	// sender, or sealed where the pooled one is plaintext or the reverse.
+	ErrHashPooled = errors.New("hash already pooled")
+)
+
+// RevealError is returned when plaintext is requested before it may be revealed.
+// It carries the commitment so the caller can check the later reveal against it.
+type RevealError struct {
+	Hash        string
+	Commitment  string
+	RevealBlock uint64
+	Height      uint64
+}
+
+func (e *RevealError) Error() string {
+	return fmt.Sprintf("tx %s is sealed until block %d (current %d, commitment %s)", e.Hash, e.RevealBlock, e.Height, e.Commitment)
+}
+
+// txBody = the part of a protected tx hidden until reveal.
+type txBody struct {
+	Receiver string   `json:"receiver"`
+	GasPrice *big.Int `json:"gasPrice"`
+	Value    *big.Int `json:"value"`
+	Pool     string   `json:"pool,omitempty"`
+	TokenIn  string   `json:"tokenIn,omitempty"`
+	TokenOut string   `json:"tokenOut,omitempty"`
+	AmountIn *big.Int `json:"amountIn,omitempty"`
+	Token    string   `json:"token,omitempty"`
+	Salt     []byte   `json:"salt"`
+}
+
+// bodyOf returns the hidden part of tx under salt.
+func bodyOf(tx *Tx, salt []byte) txBody {
+	return txBody{
+		Receiver: tx.Receiver,
+		GasPrice: tx.GasPrice,
+		Value:    tx.Value,
+		Pool:     tx.Pool,
+		TokenIn:  tx.TokenIn,
+		TokenOut: tx.TokenOut,
+		AmountIn: tx.AmountIn,
+		Token:    tx.Token,
+		Salt:     salt,
+	}
+}
+
+// commitment binds hash, sender and body: sha256(hash || sender || body).
+func commitment(hash, sender string, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(hash))
+	h.Write([]byte(sender))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// SealTx commits to and encrypts tx's body under a fresh key, returning the
+// sealed copy to submit and the key. It runs on the sender's side: the pool
+// only ever sees the ciphertext until the sender hands over the key with
+// RevealKey, so nobody can open the body early.
+func SealTx(tx *Tx) (*Tx, []byte, error) {
+	salt := make([]byte, 16)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, nil, err
+	}
+	body, err := json.Marshal(bodyOf(tx, salt))
+	if err != nil {
+		return nil, nil, err
+	}
+	commit := commitment(tx.Hash, tx.Sender, body)
+
+	key := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return nil, nil, err
+	}
+	aesGCM, err := newGCM(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	nonce := make([]byte, aesGCM.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, nil, err
+	}
+	ciphertext := aesGCM.Seal(nonce, nonce, body, []byte(commit))
+
+	return &Tx{
+		Hash:       tx.Hash,
+		Sender:     tx.Sender,
+		Nonce:      tx.Nonce,
+		Encrypted:  true,
+		Timestamp:  tx.Timestamp,
+		Commitment: commit,
+		Ciphertext: ciphertext,
+	}, key, nil
+}
+
+// openTx decrypts a sealed tx with its key and checks the body against the commitment.
+func openTx(sealed *Tx, key []byte) (*Tx, error) {
+	aesGCM, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonceSize := aesGCM.NonceSize()
+	if len(sealed.Ciphertext) < nonceSize {
+		return nil, errors.New("ciphertext too short")
+	}
+	nonce, ciphertext := sealed.Ciphertext[:nonceSize], sealed.Ciphertext[nonceSize:]
+	body, err := aesGCM.Open(nil, nonce, ciphertext, []byte(sealed.Commitment))
+	if err != nil {
+		return nil, err
+	}
+	if commitment(sealed.Hash, sealed.Sender, body) != sealed.Commitment {
+		return nil, ErrCommitmentMismatch
+	}
+	var b txBody
+	if err := json.Unmarshal(body, &b); err != nil {
+		return nil, err
+	}
+	return &Tx{
+		Hash:        sealed.Hash,
+		Sender:      sealed.Sender,
+		Nonce:       sealed.Nonce,
+		Receiver:    b.Receiver,
+		GasPrice:    b.GasPrice,
+		Value:       b.Value,
+		Pool:        b.Pool,
+		TokenIn:     b.TokenIn,
+		TokenOut:    b.TokenOut,
+		AmountIn:    b.AmountIn,
+		Token:       b.Token,
+		Timestamp:   sealed.Timestamp,
+		Commitment:  sealed.Commitment,
+		Salt:        b.Salt,
+		RevealBlock: sealed.RevealBlock,
+		SubmitBlock: sealed.SubmitBlock,
+		ReceivedAt:  sealed.ReceivedAt,
+	}, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// SetRevealDelay sets how many blocks after submission a protected tx stays
+// sealed; keys released before then are refused.
+func (mg *MEVGuardianEngine) SetRevealDelay(blocks uint64) {
+	mg.pool.mutex.Lock()
+	defer mg.pool.mutex.Unlock()
+	mg.pool.revealDelay = blocks
+}
+
+// AdvanceBlock records the current chain height.
+func (mg *MEVGuardianEngine) AdvanceBlock(height uint64) {
+	mg.pool.mutex.Lock()
+	defer mg.pool.mutex.Unlock()
+	if height > mg.pool.height {
+		mg.pool.height = height
+	}
+}
+
+// CommitOrdering fixes the order of sealed txs for a block and returns its root,
+// sha256 over the ordered commitments. Committed txs may be revealed at once.
+// A block is committed once; a second commit for it, or one that includes a
+// tx already committed to another block, is refused.
+func (mg *MEVGuardianEngine) CommitOrdering(block uint64, hashes []string) (string, error) {
+	mg.pool.mutex.Lock()
+	defer mg.pool.mutex.Unlock()
+
+	if root, ok := mg.pool.roots[block]; ok {
+		return "", fmt.Errorf("ordering for block %d is already committed to %s", block, root)
+	}
+	h := sha256.New()
+	seen := make(map[string]bool)
+	for _, hash := range hashes {
+		tx, ok := mg.pool.txs[hash]
+		if !ok {
+			return "", fmt.Errorf("tx %s not in pool", hash)
+		}
+		if b, ok := mg.pool.committed[hash]; ok || seen[hash] {
+			return "", fmt.Errorf("tx %s is already committed to block %d", hash, b)
+		}
+		seen[hash] = true
+		h.Write([]byte(tx.Commitment))
+	}
+	root := hex.EncodeToString(h.Sum(nil))
+	for _, hash := range hashes {
+		mg.pool.committed[hash] = block
+	}
+	mg.pool.roots[block] = root
+	return root, nil
+}
+
+// CommittedRoot returns the ordering root committed for a block, if any.
+func (mg *MEVGuardianEngine) CommittedRoot(block uint64) (string, bool) {
+	mg.pool.mutex.RLock()
+	defer mg.pool.mutex.RUnlock()
+	root, ok := mg.pool.roots[block]
+	return root, ok
+}
+
+// revealable reports whether a sealed tx may be opened. Caller holds the pool lock.
+func (gp *GuardianPool) revealable(tx *Tx) bool {
+	if _, ok := gp.committed[tx.Hash]; ok {
+		return true
+	}
+	return gp.height >= tx.RevealBlock
+}
+
+// RevealKey takes the body key of a sealed tx from its sender once the tx may
+// be revealed, and returns the opened tx. A key sent before the reveal block
+// or a committed ordering is refused with a *RevealError and not kept. Keys
+// are held in memory only; after a restart senders release them again.
+func (mg *MEVGuardianEngine) RevealKey(hash string, key []byte) (*Tx, error) {
+	mg.pool.mutex.Lock()
+	defer mg.pool.mutex.Unlock()
+
+	tx, ok := mg.pool.txs[hash]
+	if !ok {
+		return nil, fmt.Errorf("tx %s not in pool", hash)
+	}
+	if tx.Ciphertext == nil {
+		return nil, fmt.Errorf("tx %s is not sealed", hash)
+	}
+	if !mg.pool.revealable(tx) {
+		return nil, &RevealError{Hash: tx.Hash, Commitment: tx.Commitment, RevealBlock: tx.RevealBlock, Height: mg.pool.height}
+	}
+	revealed, err := openTx(tx, key)
+	if err != nil {
+		return nil, fmt.Errorf("tx %s: %w", hash, err)
+	}
+	mg.pool.keys[hash] = append([]byte{}, key...)
+	return revealed, nil
+}
+
+// Reveal returns the plaintext of a tx, a *RevealError if it is still sealed,
+// or ErrKeyNotReleased if its sender has not released the key.
+func (mg *MEVGuardianEngine) Reveal(hash string) (*Tx, error) {
+	mg.pool.mutex.RLock()
+	defer mg.pool.mutex.RUnlock()
+
+	tx, ok := mg.pool.txs[hash]
+	if !ok {
+		return nil, fmt.Errorf("tx %s not in pool", hash)
+	}
+	if tx.Ciphertext == nil {
+		return tx, nil
+	}
+	if !mg.pool.revealable(tx) {
+		return nil, &RevealError{Hash: tx.Hash, Commitment: tx.Commitment, RevealBlock: tx.RevealBlock, Height: mg.pool.height}
+	}
+	key, ok := mg.pool.keys[hash]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrKeyNotReleased, hash)
+	}
+	return openTx(tx, key)
+}
+
+// VerifyReveal checks that a revealed tx's body matches the commitment made at
+// submission, so anyone holding the commitment can audit the reveal.
+func VerifyReveal(commit string, revealed *Tx) error {
+	body, err := json.Marshal(bodyOf(revealed, revealed.Salt))
+	if err != nil {
+		return err
+	}
+	if commitment(revealed.Hash, revealed.Sender, body) != commit {
+		return ErrCommitmentMismatch
+	}
+	return nil
+}
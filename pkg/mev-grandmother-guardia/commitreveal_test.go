@@ -0,0 +1,130 @@
+// This file contains tests for commit-reveal sealing of protected txs and
+// reveals after a committed ordering.
+
+package mevgrandmothersguardia
+
+import (
+	"bytes"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+)
+
+// seal seals tx on the sender's side, returning what to submit and the key.
+func seal(t *testing.T, tx *Tx) (*Tx, []byte) {
+	t.Helper()
+	sealed, key, err := SealTx(tx)
+	if err != nil {
+		t.Fatalf("SealTx: %v", err)
+	}
+	return sealed, key
+}
+
+func TestProtectedTxSealedUntilRevealBlock(t *testing.T) {
+	engine := NewMEVGuardianEngine()
+	engine.AddProtectedSender("0xAlice")
+	engine.AdvanceBlock(100)
+
+	tx := &Tx{Hash: "tx1", Sender: "0xAlice", Receiver: "0xDEX", GasPrice: big.NewInt(100e9), Value: big.NewInt(5e17), Timestamp: time.Now()}
+	if err := engine.SubmitTransaction(tx); !errors.Is(err, ErrUnsealed) {
+		t.Fatalf("expected a plaintext protected tx to be refused, got %v", err)
+	}
+	sealed, key := seal(t, tx)
+	if err := engine.SubmitTransaction(sealed); err != nil {
+		t.Fatalf("SubmitTransaction: %v", err)
+	}
+
+	stored := engine.pool.txs["tx1"]
+	if stored.Receiver != "" || stored.Value != nil || len(stored.Ciphertext) == 0 {
+		t.Fatalf("protected tx body must only be stored as ciphertext: %+v", stored)
+	}
+	if tx.Encrypted || tx.Receiver != "0xDEX" {
+		t.Errorf("SealTx must not mutate the caller's tx")
+	}
+
+	_, err := engine.Reveal("tx1")
+	var revealErr *RevealError
+	if !errors.As(err, &revealErr) {
+		t.Fatalf("expected *RevealError before the reveal block, got %v", err)
+	}
+	if revealErr.Commitment != stored.Commitment || revealErr.RevealBlock != 101 {
+		t.Errorf("unexpected reveal error %+v", revealErr)
+	}
+	if _, err := engine.RevealKey("tx1", key); !errors.As(err, &revealErr) {
+		t.Errorf("expected an early key to be refused, got %v", err)
+	}
+	if _, ok := engine.pool.keys["tx1"]; ok {
+		t.Errorf("early key kept by the pool")
+	}
+	if txs := engine.DecryptTransactions(); len(txs) != 0 {
+		t.Errorf("sealed tx leaked through DecryptTransactions")
+	}
+
+	// past the reveal block the pool still cannot open the body without the key
+	engine.AdvanceBlock(101)
+	if _, err := engine.Reveal("tx1"); !errors.Is(err, ErrKeyNotReleased) {
+		t.Errorf("expected ErrKeyNotReleased, got %v", err)
+	}
+	if txs := engine.DecryptTransactions(); len(txs) != 0 {
+		t.Errorf("sealed tx decrypted without its key")
+	}
+	if _, err := engine.RevealKey("tx1", bytes.Repeat([]byte{1}, 32)); err == nil {
+		t.Errorf("expected a wrong key to fail")
+	}
+	if _, err := engine.RevealKey("tx1", key); err != nil {
+		t.Fatalf("RevealKey: %v", err)
+	}
+	revealed, err := engine.Reveal("tx1")
+	if err != nil {
+		t.Fatalf("Reveal: %v", err)
+	}
+	if revealed.Receiver != "0xDEX" || revealed.Value.Cmp(big.NewInt(5e17)) != 0 {
+		t.Errorf("revealed body mismatch: %+v", revealed)
+	}
+	if err := VerifyReveal(revealErr.Commitment, revealed); err != nil {
+		t.Errorf("reveal does not match the earlier commitment: %v", err)
+	}
+	revealed.Value = big.NewInt(1)
+	if err := VerifyReveal(revealErr.Commitment, revealed); !errors.Is(err, ErrCommitmentMismatch) {
+		t.Errorf("expected ErrCommitmentMismatch for an altered body, got %v", err)
+	}
+}
+
+func TestCommittedOrderingAllowsReveal(t *testing.T) {
+	engine := NewMEVGuardianEngine()
+	engine.AddProtectedSender("0xAlice")
+	engine.SetRevealDelay(10)
+	sealed, key := seal(t, &Tx{Hash: "tx1", Sender: "0xAlice", Receiver: "0xDEX", GasPrice: big.NewInt(1), Value: big.NewInt(1), Token: "0xUSDC"})
+	engine.SubmitTransaction(sealed)
+
+	if _, err := engine.RevealKey("tx1", key); err == nil {
+		t.Fatalf("expected reveal to fail before ordering is committed")
+	}
+	root, err := engine.CommitOrdering(1, []string{"tx1"})
+	if err != nil {
+		t.Fatalf("CommitOrdering: %v", err)
+	}
+	if got, ok := engine.CommittedRoot(1); !ok || got != root {
+		t.Errorf("CommittedRoot(1) = %s, %v; want %s", got, ok, root)
+	}
+	if _, err := engine.CommitOrdering(1, nil); err == nil {
+		t.Errorf("expected a second commit for block 1 to be refused")
+	}
+	if _, err := engine.CommitOrdering(2, []string{"tx1"}); err == nil {
+		t.Errorf("expected tx1 not to be committed to a second block")
+	}
+	revealed, err := engine.RevealKey("tx1", key)
+	if err != nil {
+		t.Errorf("expected reveal after ordering commitment, got %v", err)
+	}
+	if revealed != nil && revealed.Token != "0xUSDC" {
+		t.Errorf("token not sealed with the body: %+v", revealed)
+	}
+
+	// tampering with the stored ciphertext must be detected
+	engine.pool.txs["tx1"].Ciphertext[len(engine.pool.txs["tx1"].Ciphertext)-1] ^= 1
+	if _, err := engine.Reveal("tx1"); err == nil {
+		t.Errorf("expected tampered ciphertext to fail")
+	}
+}
@@ -0,0 +1,310 @@
+package mevgrandmothersguardia
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// OrderMode = how released txs are ordered.
+type OrderMode int
+
+// Ordering modes.
+const (
+	ModeFCFS     OrderMode = iota // by the time this node received each tx
+	ModeAequitas                  // batch-order fairness over receiving nodes' local orders
+)
+
+// DefaultGamma = the share of nodes that must agree a tx came first.
+const DefaultGamma = 0.75
+
+// FairOrdering configures how DecryptTransactions orders txs.
+type FairOrdering struct {
+	Mode   OrderMode
+	Window time.Duration // txs are released once the window they arrived in closes; 0 releases them at once
+	Gamma  float64       // Aequitas: a before b if at least Gamma of nodes saw a first, in (0.5, 1]
+}
+
+func (f FairOrdering) validate() error {
+	if f.Window < 0 {
+		return errors.New("negative batch window")
+	}
+	switch f.Mode {
+	case ModeFCFS:
+	case ModeAequitas:
+		if f.Gamma <= 0.5 || f.Gamma > 1 {
+			return fmt.Errorf("gamma %v out of range (0.5, 1]", f.Gamma)
+		}
+	default:
+		return fmt.Errorf("unknown ordering mode %d", f.Mode)
+	}
+	return nil
+}
+
+// LocalOrder = the order one receiving node saw txs arrive in.
+type LocalOrder struct {
+	Node   string
+	Hashes []string
+}
+
+// SetFairOrdering sets how txs are batched and ordered.
+func (mg *MEVGuardianEngine) SetFairOrdering(f FairOrdering) error {
+	if err := f.validate(); err != nil {
+		return err
+	}
+	mg.pool.mutex.Lock()
+	defer mg.pool.mutex.Unlock()
+	mg.pool.fair = f
+	return nil
+}
+
+// ReportOrder records txs in the order node received them. Reports add to
+// what the node reported before; hashes it already reported keep their place.
+func (mg *MEVGuardianEngine) ReportOrder(node string, hashes []string) {
+	mg.pool.mutex.Lock()
+	defer mg.pool.mutex.Unlock()
+	seen, ok := mg.pool.reports[node]
+	if !ok {
+		seen = make(map[string]int)
+		mg.pool.reports[node] = seen
+	}
+	for _, hash := range hashes {
+		if _, dup := seen[hash]; !dup {
+			seen[hash] = mg.pool.reportSeq
+			mg.pool.reportSeq++
+		}
+	}
+}
+
+// released reports whether tx's batch window has closed at now. Caller holds the lock.
+func (gp *GuardianPool) released(tx *Tx, now time.Time) bool {
+	w := gp.fair.Window
+	if w <= 0 {
+		return true
+	}
+	return !now.Before(tx.ReceivedAt.Truncate(w).Add(w))
+}
+
+// order sorts released txs by the configured mode. Caller holds the lock.
+func (gp *GuardianPool) order(txs []*Tx) []*Tx {
+	txs = OrderFCFS(txs)
+	if gp.fair.Mode != ModeAequitas || len(gp.reports) == 0 {
+		return txs
+	}
+
+	byHash := make(map[string]*Tx, len(txs))
+	for _, tx := range txs {
+		byHash[tx.Hash] = tx
+	}
+	var orders []LocalOrder
+	for node, seen := range gp.reports {
+		var hashes []string
+		for hash := range seen {
+			if byHash[hash] != nil {
+				hashes = append(hashes, hash)
+			}
+		}
+		sort.Slice(hashes, func(i, j int) bool { return seen[hashes[i]] < seen[hashes[j]] })
+		orders = append(orders, LocalOrder{Node: node, Hashes: hashes})
+	}
+	sort.Slice(orders, func(i, j int) bool { return orders[i].Node < orders[j].Node })
+
+	// txs no node reported go last, in receipt order
+	var ordered []*Tx
+	placed := map[string]bool{}
+	for _, batch := range AequitasOrder(orders, gp.fair.Gamma) {
+		for _, hash := range batch {
+			ordered = append(ordered, byHash[hash])
+			placed[hash] = true
+		}
+	}
+	for _, tx := range txs {
+		if !placed[tx.Hash] {
+			ordered = append(ordered, tx)
+		}
+	}
+	return ordered
+}
+
+// forget drops hash from every node's reports. Caller holds the lock.
+func (gp *GuardianPool) forget(hash string) {
+	for _, seen := range gp.reports {
+		delete(seen, hash)
+	}
+}
+
+// OrderFCFS orders txs by the time they were received, then by hash.
+func OrderFCFS(txs []*Tx) []*Tx {
+	sorted := append([]*Tx(nil), txs...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if !sorted[i].ReceivedAt.Equal(sorted[j].ReceivedAt) {
+			return sorted[i].ReceivedAt.Before(sorted[j].ReceivedAt)
+		}
+		return sorted[i].Hash < sorted[j].Hash
+	})
+	return sorted
+}
+
+// AequitasOrder orders txs from several nodes' local orders with batch-order
+// fairness: if at least gamma of the nodes received a before b, a is not
+// ordered after b. Preferences can be cyclic, so txs that cannot be ordered
+// fairly against each other share a batch. A node that never saw a tx counts
+// as having received it after every tx it did see. Batches are returned in
+// order; within a batch and between unrelated txs, the lower average position
+// goes first, then the lower hash.
+func AequitasOrder(orders []LocalOrder, gamma float64) [][]string {
+	pos := make([]map[string]int, len(orders))
+	rank := map[string]float64{}
+	var hashes []string
+	for i, o := range orders {
+		pos[i] = make(map[string]int, len(o.Hashes))
+		for j, hash := range o.Hashes {
+			if _, dup := pos[i][hash]; dup {
+				continue
+			}
+			pos[i][hash] = j
+			if _, ok := rank[hash]; !ok {
+				rank[hash] = 0
+				hashes = append(hashes, hash)
+			}
+		}
+	}
+	if len(hashes) == 0 {
+		return nil
+	}
+	for _, hash := range hashes {
+		for i, o := range orders {
+			p, ok := pos[i][hash]
+			if !ok {
+				p = len(o.Hashes)
+			}
+			rank[hash] += float64(p)
+		}
+		rank[hash] /= float64(len(orders))
+	}
+	less := func(a, b string) bool {
+		if rank[a] != rank[b] {
+			return rank[a] < rank[b]
+		}
+		return a < b
+	}
+	sort.Slice(hashes, func(i, j int) bool { return less(hashes[i], hashes[j]) })
+
+	// edge a -> b when enough nodes received a first
+	quorum := int(math.Ceil(gamma * float64(len(orders))))
+	before := func(a, b string) bool {
+		n := 0
+		for i := range orders {
+			pa, okA := pos[i][a]
+			pb, okB := pos[i][b]
+			if okA && (!okB || pa < pb) {
+				n++
+			}
+		}
+		return n >= quorum
+	}
+	edges := make(map[string][]string, len(hashes))
+	for _, a := range hashes {
+		for _, b := range hashes {
+			if a != b && before(a, b) {
+				edges[a] = append(edges[a], b)
+			}
+		}
+	}
+
+	batches := stronglyConnected(hashes, edges)
+	for _, b := range batches {
+		sort.Slice(b, func(i, j int) bool { return less(b[i], b[j]) })
+	}
+
+	// topological order of the batches, earliest ready batch first
+	batchOf := map[string]int{}
+	for i, b := range batches {
+		for _, hash := range b {
+			batchOf[hash] = i
+		}
+	}
+	indegree := make([]int, len(batches))
+	next := make([]map[int]bool, len(batches))
+	for i := range next {
+		next[i] = map[int]bool{}
+	}
+	for a, bs := range edges {
+		for _, b := range bs {
+			from, to := batchOf[a], batchOf[b]
+			if from != to && !next[from][to] {
+				next[from][to] = true
+				indegree[to]++
+			}
+		}
+	}
+	var ready []int
+	for i, d := range indegree {
+		if d == 0 {
+			ready = append(ready, i)
+		}
+	}
+	var ordered [][]string
+	for len(ready) > 0 {
+		sort.Slice(ready, func(i, j int) bool { return less(batches[ready[i]][0], batches[ready[j]][0]) })
+		i := ready[0]
+		ready = ready[1:]
+		ordered = append(ordered, batches[i])
+		for j := range next[i] {
+			indegree[j]--
+			if indegree[j] == 0 {
+				ready = append(ready, j)
+			}
+		}
+	}
+	return ordered
+}
+
+// stronglyConnected returns the strongly connected components of the graph
+// (Tarjan's algorithm).
+func stronglyConnected(nodes []string, edges map[string][]string) [][]string {
+	index := map[string]int{}
+	low := map[string]int{}
+	onStack := map[string]bool{}
+	var stack []string
+	var components [][]string
+
+	var visit func(v string)
+	visit = func(v string) {
+		index[v] = len(index)
+		low[v] = index[v]
+		stack = append(stack, v)
+		onStack[v] = true
+		for _, w := range edges[v] {
+			if _, seen := index[w]; !seen {
+				visit(w)
+				if low[w] < low[v] {
+					low[v] = low[w]
+				}
+			} else if onStack[w] && index[w] < low[v] {
+				low[v] = index[w]
+			}
+		}
+		if low[v] == index[v] {
+			var c []string
+			for {
+				w := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				onStack[w] = false
+				c = append(c, w)
+				if w == v {
+					break
+				}
+			}
+			components = append(components, c)
+		}
+	}
+	for _, v := range nodes {
+		if _, seen := index[v]; !seen {
+			visit(v)
+		}
+	}
+	return components
+}
@@ -0,0 +1,192 @@
+// This file contains tests for FCFS batch windows and Aequitas fair ordering,
+// including ordering under network jitter.
+
+package mevgrandmothersguardia
+
+import (
+	"fmt"
+	"math/big"
+	"math/rand"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// sent = a tx as its sender broadcast it.
+type sent struct {
+	hash string
+	at   time.Time
+}
+
+// simulateJitter delivers sends to each node after a random delay of up to
+// jitter, returning every node's receive times and local order.
+func simulateJitter(rng *rand.Rand, sends []sent, nodes int, jitter time.Duration) ([]map[string]time.Time, []LocalOrder) {
+	received := make([]map[string]time.Time, nodes)
+	orders := make([]LocalOrder, nodes)
+	for n := 0; n < nodes; n++ {
+		received[n] = make(map[string]time.Time)
+		var hashes []string
+		for _, s := range sends {
+			received[n][s.hash] = s.at.Add(time.Duration(rng.Int63n(int64(jitter))))
+			hashes = append(hashes, s.hash)
+		}
+		sort.Slice(hashes, func(i, j int) bool { return received[n][hashes[i]].Before(received[n][hashes[j]]) })
+		orders[n] = LocalOrder{Node: fmt.Sprintf("node%d", n), Hashes: hashes}
+	}
+	return received, orders
+}
+
+// broadcast returns count sends spaced apart by gap.
+func broadcast(start time.Time, count int, gap time.Duration) []sent {
+	sends := make([]sent, count)
+	for i := range sends {
+		sends[i] = sent{hash: fmt.Sprintf("tx%02d", i), at: start.Add(time.Duration(i) * gap)}
+	}
+	return sends
+}
+
+// checkFair fails if two txs sent further apart than jitter came out in the wrong order.
+func checkFair(t *testing.T, sends []sent, order []string, jitter time.Duration) {
+	t.Helper()
+	at := map[string]int{}
+	for i, hash := range order {
+		at[hash] = i
+	}
+	if len(at) != len(sends) {
+		t.Fatalf("expected %d txs ordered, got %d", len(sends), len(at))
+	}
+	for _, a := range sends {
+		for _, b := range sends {
+			if b.at.Sub(a.at) > jitter && at[a.hash] > at[b.hash] {
+				t.Errorf("%s was sent %v before %s but ordered after it", a.hash, b.at.Sub(a.at), b.hash)
+			}
+		}
+	}
+}
+
+func TestFCFSBatchWindow(t *testing.T) {
+	engine := NewMEVGuardianEngine()
+	engine.AddProtectedSender("0xAlice")
+	if err := engine.SetFairOrdering(FairOrdering{Mode: ModeFCFS, Window: 100 * time.Millisecond}); err != nil {
+		t.Fatalf("SetFairOrdering: %v", err)
+	}
+	engine.SetRevealDelay(0)
+	base := time.Unix(1700000000, 0)
+	sealed, keys := map[string]*Tx{}, map[string][]byte{}
+	submit := func(hash, sender string, after time.Duration) {
+		t.Helper()
+		tx := &Tx{Hash: hash, Sender: sender, Receiver: "0xDEX", GasPrice: big.NewInt(1e9), Value: big.NewInt(1e17)}
+		if sender == "0xAlice" {
+			// a resubmission resends the same sealed tx
+			if sealed[hash] == nil {
+				sealed[hash], keys[hash] = seal(t, tx)
+			}
+			tx = sealed[hash]
+		}
+		if err := engine.SubmitTransactionAt(tx, base.Add(after)); err != nil {
+			t.Fatalf("SubmitTransactionAt(%s): %v", hash, err)
+		}
+	}
+	submit("c", "0xBob", 30*time.Millisecond)
+	submit("a", "0xAlice", 10*time.Millisecond)
+	submit("b", "0xBob", 20*time.Millisecond)
+	submit("d", "0xBob", 150*time.Millisecond)
+	// a resubmission keeps its place in line
+	submit("a", "0xAlice", 120*time.Millisecond)
+	if _, err := engine.RevealKey("a", keys["a"]); err != nil {
+		t.Fatalf("RevealKey: %v", err)
+	}
+
+	if txs := engine.decryptAt(base.Add(90 * time.Millisecond)); len(txs) != 0 {
+		t.Fatalf("released %d txs before the window closed", len(txs))
+	}
+	var got []string
+	for _, tx := range engine.decryptAt(base.Add(100 * time.Millisecond)) {
+		got = append(got, tx.Hash)
+	}
+	if strings.Join(got, ",") != "a,b,c" {
+		t.Fatalf("expected a,b,c in receipt order, got %v", got)
+	}
+	if s, _ := engine.Status("d"); s.State != StatePending {
+		t.Errorf("d released early: %s", s.State)
+	}
+
+	// receipt order under network jitter: spacing above the jitter survives
+	engine = NewMEVGuardianEngine()
+	rng := rand.New(rand.NewSource(1))
+	sends := broadcast(base, 30, 5*time.Millisecond)
+	received, _ := simulateJitter(rng, sends, 1, 20*time.Millisecond)
+	for _, i := range rng.Perm(len(sends)) {
+		tx := &Tx{Hash: sends[i].hash, Sender: "0xBob", Receiver: "0xDEX", GasPrice: big.NewInt(1e9), Value: big.NewInt(1e17)}
+		engine.SubmitTransactionAt(tx, received[0][sends[i].hash])
+	}
+	got = nil
+	for _, tx := range engine.DecryptTransactions() {
+		got = append(got, tx.Hash)
+	}
+	for i := 1; i < len(got); i++ {
+		if received[0][got[i]].Before(received[0][got[i-1]]) {
+			t.Errorf("%s received before %s but ordered after it", got[i], got[i-1])
+		}
+	}
+	checkFair(t, sends, got, 20*time.Millisecond)
+}
+
+func TestAequitasCondorcetBatch(t *testing.T) {
+	orders := []LocalOrder{
+		{Node: "n1", Hashes: []string{"a", "b", "c", "d"}},
+		{Node: "n2", Hashes: []string{"b", "c", "a", "d"}},
+		{Node: "n3", Hashes: []string{"c", "a", "b"}},
+	}
+	batches := AequitasOrder(orders, 0.6)
+	if len(batches) != 2 || strings.Join(batches[0], ",") != "a,b,c" || strings.Join(batches[1], ",") != "d" {
+		t.Fatalf("expected [a b c] [d], got %v", batches)
+	}
+
+	engine := NewMEVGuardianEngine()
+	if err := engine.SetFairOrdering(FairOrdering{Mode: ModeAequitas, Gamma: 0.5}); err == nil {
+		t.Errorf("expected gamma 0.5 to be refused")
+	}
+}
+
+func TestAequitasOrderUnderJitter(t *testing.T) {
+	base := time.Unix(1700000000, 0)
+	rng := rand.New(rand.NewSource(7))
+
+	// jitter below the spacing: every node agrees, so the order is exact
+	sends := broadcast(base, 20, 10*time.Millisecond)
+	_, orders := simulateJitter(rng, sends, 5, 8*time.Millisecond)
+	batches := AequitasOrder(orders, DefaultGamma)
+	if len(batches) != len(sends) {
+		t.Fatalf("expected %d singleton batches, got %v", len(sends), batches)
+	}
+	for i, b := range batches {
+		if b[0] != sends[i].hash {
+			t.Fatalf("batch %d is %v, expected %s", i, b, sends[i].hash)
+		}
+	}
+
+	// heavy jitter: close txs may share batches, far ones keep their order
+	for trial := 0; trial < 20; trial++ {
+		sends := broadcast(base, 25, 3*time.Millisecond)
+		received, orders := simulateJitter(rng, sends, 7, 25*time.Millisecond)
+
+		engine := NewMEVGuardianEngine()
+		if err := engine.SetFairOrdering(FairOrdering{Mode: ModeAequitas, Gamma: DefaultGamma}); err != nil {
+			t.Fatalf("SetFairOrdering: %v", err)
+		}
+		for _, s := range sends {
+			tx := &Tx{Hash: s.hash, Sender: "0xBob", Receiver: "0xDEX", GasPrice: big.NewInt(1e9), Value: big.NewInt(1e17)}
+			engine.SubmitTransactionAt(tx, received[0][s.hash])
+		}
+		for _, o := range orders {
+			engine.ReportOrder(o.Node, o.Hashes)
+		}
+		var got []string
+		for _, tx := range engine.DecryptTransactions() {
+			got = append(got, tx.Hash)
+		}
+		checkFair(t, sends, got, 25*time.Millisecond)
+	}
+}
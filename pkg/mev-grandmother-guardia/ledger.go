@@ -0,0 +1,297 @@
+package mevgrandmothersguardia
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mellis0303/mev-vem/pkg/mev-wal"
+)
+
+// Ledger entry kinds.
+const (
+	EntryAccrual = "accrual"
+	EntryClaim   = "claim"
+)
+
+// Ledger journal record types.
+const (
+	ledgerAccount byte = 1 // an account as of the last compaction
+	ledgerEntries byte = 2 // the entries made by one Accrue or Claim
+)
+
+// ErrInsufficientPending is returned when a claim exceeds what is pending.
+var ErrInsufficientPending = errors.New("claim exceeds pending rebate")
+
+// LedgerEntry = one accrual or claim on an address.
+type LedgerEntry struct {
+	Kind   string    `json:"kind"`
+	Amount *big.Int  `json:"amount"`
+	Bundle string    `json:"bundle,omitempty"`
+	Block  uint64    `json:"block,omitempty"`
+	TxHash string    `json:"txHash,omitempty"`
+	Time   time.Time `json:"time"`
+}
+
+// Account = an address's rebate balances. Pending is Accrued - Claimed.
+type Account struct {
+	Accrued *big.Int      `json:"accrued"`
+	Claimed *big.Int      `json:"claimed"`
+	History []LedgerEntry `json:"history"`
+}
+
+// Pending returns what the address may still claim.
+func (a *Account) Pending() *big.Int {
+	return new(big.Int).Sub(a.Accrued, a.Claimed)
+}
+
+func (a *Account) clone() *Account {
+	return &Account{
+		Accrued: new(big.Int).Set(a.Accrued),
+		Claimed: new(big.Int).Set(a.Claimed),
+		History: append([]LedgerEntry(nil), a.History...),
+	}
+}
+
+// ledgerRecord = an address with its account or with one entry made on it.
+type ledgerRecord struct {
+	Address string       `json:"address"`
+	Account *Account     `json:"account,omitempty"`
+	Entry   *LedgerEntry `json:"entry,omitempty"`
+}
+
+// Ledger = per-address rebate balances, journaled to a log if opened from one.
+type Ledger struct {
+	wal      *mevwal.WAL // nil for an in-memory ledger
+	accounts map[string]*Account
+	bundles  map[string]bool // bundles already accrued, rebuilt from history
+	mutex    sync.Mutex
+}
+
+// NewLedger returns an in-memory ledger.
+func NewLedger() *Ledger {
+	return &Ledger{accounts: make(map[string]*Account), bundles: make(map[string]bool)}
+}
+
+// OpenLedger loads the ledger journaled at path, or starts an empty one
+// there. Every change is appended to the journal and synced before it
+// returns; on open the journal is compacted to one record per account.
+func OpenLedger(path string) (*Ledger, error) {
+	w, records, err := mevwal.Open(path, mevwal.Options{})
+	if err != nil {
+		return nil, err
+	}
+	l := NewLedger()
+	if err := l.replay(records); err != nil {
+		w.Close()
+		return nil, fmt.Errorf("ledger %s: %w", path, err)
+	}
+	l.wal = w
+	if err := l.compact(); err != nil {
+		w.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+// ReadLedger loads the ledger journaled at path without opening it for
+// writing, e.g. to report on a ledger a running engine appends to. The
+// result is in memory; changes to it are not journaled.
+func ReadLedger(path string) (*Ledger, error) {
+	records, err := mevwal.Read(path)
+	if err != nil {
+		return nil, err
+	}
+	l := NewLedger()
+	if err := l.replay(records); err != nil {
+		return nil, fmt.Errorf("ledger %s: %w", path, err)
+	}
+	return l, nil
+}
+
+// Close syncs and closes the journal, if there is one.
+func (l *Ledger) Close() error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.wal == nil {
+		return nil
+	}
+	return l.wal.Close()
+}
+
+// replay rebuilds the accounts from journal records.
+func (l *Ledger) replay(records []mevwal.Record) error {
+	for i, rec := range records {
+		switch rec.Type {
+		case ledgerAccount:
+			var r ledgerRecord
+			if err := json.Unmarshal(rec.Data, &r); err != nil {
+				return fmt.Errorf("record %d: %w", i, err)
+			}
+			if r.Account == nil || r.Account.Accrued == nil || r.Account.Claimed == nil {
+				return fmt.Errorf("record %d: account %s has no balances", i, r.Address)
+			}
+			l.accounts[r.Address] = r.Account
+		case ledgerEntries:
+			var rs []ledgerRecord
+			if err := json.Unmarshal(rec.Data, &rs); err != nil {
+				return fmt.Errorf("record %d: %w", i, err)
+			}
+			for _, r := range rs {
+				if r.Entry == nil || r.Entry.Amount == nil || (r.Entry.Kind != EntryAccrual && r.Entry.Kind != EntryClaim) {
+					return fmt.Errorf("record %d: bad entry for %s", i, r.Address)
+				}
+				l.apply(r.Address, *r.Entry)
+			}
+		default:
+			return fmt.Errorf("record %d has unknown type %d", i, rec.Type)
+		}
+	}
+	for _, a := range l.accounts {
+		for _, e := range a.History {
+			if e.Bundle != "" {
+				l.bundles[e.Bundle] = true
+			}
+		}
+	}
+	return nil
+}
+
+// account returns addr's account, creating it. Caller holds the lock.
+func (l *Ledger) account(addr string) *Account {
+	a, ok := l.accounts[addr]
+	if !ok {
+		a = &Account{Accrued: new(big.Int), Claimed: new(big.Int)}
+		l.accounts[addr] = a
+	}
+	return a
+}
+
+// Accrue credits rebates. All of them are recorded or none are, and a bundle
+// that was already accrued is refused so a retried distribution cannot pay twice.
+func (l *Ledger) Accrue(rebates []Rebate) error {
+	if len(rebates) == 0 {
+		return nil
+	}
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	for _, r := range rebates {
+		if r.Bundle != "" && l.bundles[r.Bundle] {
+			return fmt.Errorf("bundle %s was already accrued", r.Bundle)
+		}
+		if r.Amount.Sign() < 0 {
+			return fmt.Errorf("negative rebate for %s", r.Address)
+		}
+	}
+
+	now := time.Now()
+	records := make([]ledgerRecord, len(rebates))
+	for i, r := range rebates {
+		records[i] = ledgerRecord{Address: r.Address, Entry: &LedgerEntry{Kind: EntryAccrual, Amount: new(big.Int).Set(r.Amount), Bundle: r.Bundle, Block: r.Block, TxHash: r.TxHash, Time: now}}
+	}
+	if err := l.log(records); err != nil {
+		return err
+	}
+	for _, r := range records {
+		l.apply(r.Address, *r.Entry)
+		if r.Entry.Bundle != "" {
+			l.bundles[r.Entry.Bundle] = true
+		}
+	}
+	return nil
+}
+
+// Claim marks amount of addr's pending rebate as paid out.
+func (l *Ledger) Claim(addr string, amount *big.Int) error {
+	if amount.Sign() <= 0 {
+		return errors.New("claim amount must be positive")
+	}
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	a, ok := l.accounts[addr]
+	if !ok || a.Pending().Cmp(amount) < 0 {
+		return fmt.Errorf("%w: %s claims %s", ErrInsufficientPending, addr, amount)
+	}
+	r := ledgerRecord{Address: addr, Entry: &LedgerEntry{Kind: EntryClaim, Amount: new(big.Int).Set(amount), Time: time.Now()}}
+	if err := l.log([]ledgerRecord{r}); err != nil {
+		return err
+	}
+	l.apply(addr, *r.Entry)
+	return nil
+}
+
+// Account returns a copy of addr's balances and history.
+func (l *Ledger) Account(addr string) Account {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	a, ok := l.accounts[addr]
+	if !ok {
+		return Account{Accrued: new(big.Int), Claimed: new(big.Int)}
+	}
+	return *a.clone()
+}
+
+// Addresses lists every address with an account, sorted.
+func (l *Ledger) Addresses() []string {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.addresses()
+}
+
+// addresses lists account addresses, sorted. Caller holds the lock.
+func (l *Ledger) addresses() []string {
+	addrs := make([]string, 0, len(l.accounts))
+	for addr := range l.accounts {
+		addrs = append(addrs, addr)
+	}
+	sort.Strings(addrs)
+	return addrs
+}
+
+// apply adds an entry to addr's balances and history. Caller holds the lock.
+func (l *Ledger) apply(addr string, e LedgerEntry) {
+	a := l.account(addr)
+	switch e.Kind {
+	case EntryAccrual:
+		a.Accrued.Add(a.Accrued, e.Amount)
+	case EntryClaim:
+		a.Claimed.Add(a.Claimed, e.Amount)
+	}
+	a.History = append(a.History, e)
+}
+
+// log appends the entries of one change to the journal as a single record
+// and syncs it, so a change is replayed whole or not at all. Caller holds
+// the lock.
+func (l *Ledger) log(records []ledgerRecord) error {
+	if l.wal == nil {
+		return nil
+	}
+	data, err := json.Marshal(records)
+	if err != nil {
+		return err
+	}
+	if err := l.wal.Append(mevwal.Record{Type: ledgerEntries, Data: data}); err != nil {
+		return err
+	}
+	return l.wal.Sync()
+}
+
+// compact rewrites the journal as one record per account. Caller holds the lock.
+func (l *Ledger) compact() error {
+	var live []mevwal.Record
+	for _, addr := range l.addresses() {
+		data, err := json.Marshal(ledgerRecord{Address: addr, Account: l.accounts[addr]})
+		if err != nil {
+			return err
+		}
+		live = append(live, mevwal.Record{Type: ledgerAccount, Data: data})
+	}
+	return l.wal.Compact(live)
+}
@@ -0,0 +1,96 @@
+// This file contains tests for the rebate ledger journal: persisted claims,
+// appended changes, read-only loading and compaction.
+
+package mevgrandmothersguardia
+
+import (
+	"errors"
+	"math/big"
+	"path/filepath"
+	"testing"
+
+	"github.com/mellis0303/mev-vem/pkg/mev-wal"
+)
+
+func TestLedgerPersistsClaims(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ledger.wal")
+	ledger, err := OpenLedger(path)
+	if err != nil {
+		t.Fatalf("OpenLedger: %v", err)
+	}
+	ledger.Accrue([]Rebate{{Address: "0xAlice", TxHash: "t1", Bundle: "b1", Block: 1, Amount: big.NewInt(100)}})
+	if err := ledger.Claim("0xAlice", big.NewInt(150)); !errors.Is(err, ErrInsufficientPending) {
+		t.Errorf("expected ErrInsufficientPending, got %v", err)
+	}
+	if err := ledger.Claim("0xAlice", big.NewInt(40)); err != nil {
+		t.Fatalf("Claim: %v", err)
+	}
+	ledger.Close()
+
+	reopened, err := OpenLedger(path)
+	if err != nil {
+		t.Fatalf("OpenLedger after restart: %v", err)
+	}
+	a := reopened.Account("0xAlice")
+	if a.Accrued.Int64() != 100 || a.Claimed.Int64() != 40 || a.Pending().Int64() != 60 {
+		t.Errorf("unexpected balances after reopen: accrued %s claimed %s", a.Accrued, a.Claimed)
+	}
+	if err := reopened.Accrue([]Rebate{{Address: "0xAlice", Bundle: "b1", Amount: big.NewInt(1)}}); err == nil {
+		t.Errorf("expected bundle b1 to be remembered across restarts")
+	}
+}
+
+func TestLedgerAppendsChanges(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ledger.wal")
+	ledger, err := OpenLedger(path)
+	if err != nil {
+		t.Fatalf("OpenLedger: %v", err)
+	}
+	defer ledger.Close()
+	rebates := []Rebate{
+		{Address: "0xAlice", Bundle: "b1", Block: 1, Amount: big.NewInt(100)},
+		{Address: "0xBob", Bundle: "b1", Block: 1, Amount: big.NewInt(50)},
+	}
+	if err := ledger.Accrue(rebates); err != nil {
+		t.Fatalf("Accrue: %v", err)
+	}
+	if err := ledger.Claim("0xBob", big.NewInt(20)); err != nil {
+		t.Fatalf("Claim: %v", err)
+	}
+
+	// one appended record per change, none rewritten
+	records, err := mevwal.Read(path)
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	if len(records) != 2 || records[0].Type != ledgerEntries || records[1].Type != ledgerEntries {
+		t.Errorf("expected two appended entry records, got %+v", records)
+	}
+
+	// a reader sees the balances without taking the journal over
+	snapshot, err := ReadLedger(path)
+	if err != nil {
+		t.Fatalf("ReadLedger: %v", err)
+	}
+	if a, b := snapshot.Account("0xAlice"), snapshot.Account("0xBob"); a.Accrued.Int64() != 100 || b.Pending().Int64() != 30 {
+		t.Errorf("unexpected balances: alice %s accrued, bob %s pending", a.Accrued, b.Pending())
+	}
+	if err := ledger.Claim("0xAlice", big.NewInt(10)); err != nil {
+		t.Errorf("Claim after ReadLedger: %v", err)
+	}
+	ledger.Close()
+
+	// reopening compacts the journal to one record per account
+	reopened, err := OpenLedger(path)
+	if err != nil {
+		t.Fatalf("OpenLedger: %v", err)
+	}
+	defer reopened.Close()
+	records, _ = mevwal.Read(path)
+	if len(records) != 2 || records[0].Type != ledgerAccount || records[1].Type != ledgerAccount {
+		t.Errorf("expected one account record per address, got %+v", records)
+	}
+	if a := reopened.Account("0xAlice"); a.Claimed.Int64() != 10 || len(a.History) != 2 {
+		t.Errorf("unexpected account after compaction: %+v", a)
+	}
+}
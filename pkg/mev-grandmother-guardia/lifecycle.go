@@ -0,0 +1,138 @@
+package mevgrandmothersguardia
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// TxState = where a tx is in its life in the pool.
+type TxState int
+
+// Lifecycle states. Included and dropped txs leave the pool; their status is
+// kept for a while so resubmissions can be refused.
+const (
+	StatePending  TxState = iota // submitted, body possibly sealed
+	StateRevealed                // handed out by DecryptTransactions
+	StateIncluded                // seen in a block
+	StateDropped                 // evicted by age or a used nonce
+)
+
+func (s TxState) String() string {
+	switch s {
+	case StatePending:
+		return "pending"
+	case StateRevealed:
+		return "revealed"
+	case StateIncluded:
+		return "included"
+	case StateDropped:
+		return "dropped"
+	}
+	return fmt.Sprintf("TxState(%d)", int(s))
+}
+
+// Defaults for eviction.
+const (
+	DefaultMaxPendingBlocks = 25  // about 5 minutes
+	DefaultStatusRetention  = 256 // blocks a finished tx's status is kept
+)
+
+// ErrTxFinished is returned when a tx that was included or dropped is
+// submitted again.
+var ErrTxFinished = errors.New("tx already included or dropped")
+
+// TxStatus = a tx's lifecycle state.
+type TxStatus struct {
+	Hash   string
+	State  TxState
+	Block  uint64 // block of the last transition
+	Reason string // why a tx was dropped
+}
+
+// Block = a new chain block as reported by a node.
+type Block struct {
+	Number   uint64
+	TxHashes []string          // txs in the block, in order
+	Nonces   map[string]uint64 // next nonce of senders after the block, where known
+}
+
+// SetMaxPendingBlocks sets how many blocks a tx may wait before it is dropped.
+// 0 keeps txs until they are included or their nonce is used.
+func (mg *MEVGuardianEngine) SetMaxPendingBlocks(blocks uint64) {
+	mg.pool.mutex.Lock()
+	defer mg.pool.mutex.Unlock()
+	mg.pool.maxPending = blocks
+}
+
+// Status returns a tx's lifecycle state.
+func (mg *MEVGuardianEngine) Status(hash string) (TxStatus, bool) {
+	mg.pool.mutex.RLock()
+	defer mg.pool.mutex.RUnlock()
+	s, ok := mg.pool.status[hash]
+	if !ok {
+		return TxStatus{}, false
+	}
+	return *s, true
+}
+
+// OnNewBlock moves the pool to a new block: txs in it are confirmed as
+// included, txs whose nonce the block used up or that waited too long are
+// dropped, and both leave the pool. It returns the transitions, included txs
+// first in block order.
+func (mg *MEVGuardianEngine) OnNewBlock(b *Block) []TxStatus {
+	mg.pool.mutex.Lock()
+	defer mg.pool.mutex.Unlock()
+	gp := mg.pool
+	if b.Number > gp.height {
+		gp.height = b.Number
+	}
+
+	var changes []TxStatus
+	for _, hash := range b.TxHashes {
+		if _, ok := gp.txs[hash]; !ok {
+			continue
+		}
+		changes = append(changes, gp.finish(hash, StateIncluded, b.Number, ""))
+	}
+
+	var dropped []TxStatus
+	for hash, tx := range gp.txs {
+		switch next, known := b.Nonces[tx.Sender]; {
+		case known && tx.Nonce < next:
+			dropped = append(dropped, gp.finish(hash, StateDropped, b.Number, fmt.Sprintf("nonce %d used, sender is at %d", tx.Nonce, next)))
+		case gp.maxPending > 0 && b.Number >= tx.SubmitBlock+gp.maxPending:
+			dropped = append(dropped, gp.finish(hash, StateDropped, b.Number, fmt.Sprintf("pending since block %d", tx.SubmitBlock)))
+		}
+	}
+	sort.Slice(dropped, func(i, j int) bool { return dropped[i].Hash < dropped[j].Hash })
+	changes = append(changes, dropped...)
+
+	for hash, s := range gp.status {
+		if (s.State == StateIncluded || s.State == StateDropped) && b.Number >= s.Block+DefaultStatusRetention {
+			delete(gp.status, hash)
+		}
+	}
+	return changes
+}
+
+// finish moves a pooled tx to a final state and removes it. Caller holds the lock.
+func (gp *GuardianPool) finish(hash string, state TxState, block uint64, reason string) TxStatus {
+	gp.remove(hash)
+	s := &TxStatus{Hash: hash, State: state, Block: block, Reason: reason}
+	gp.status[hash] = s
+	return *s
+}
+
+// setState records a transition of a pooled tx. Caller holds the lock.
+func (gp *GuardianPool) setState(hash string, state TxState) {
+	s, ok := gp.status[hash]
+	if !ok {
+		s = &TxStatus{Hash: hash}
+		gp.status[hash] = s
+	}
+	if s.State != state {
+		s.State = state
+		s.Block = gp.height
+	}
+}
@@ -0,0 +1,104 @@
+// This file contains tests for the tx lifecycle of plain and sealed txs.
+
+package mevgrandmothersguardia
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+)
+
+func TestTxLifecycle(t *testing.T) {
+	engine := NewMEVGuardianEngine()
+	engine.SetMaxPendingBlocks(3)
+	engine.AdvanceBlock(10)
+
+	submit := func(hash, sender string, nonce uint64) {
+		t.Helper()
+		tx := &Tx{Hash: hash, Sender: sender, Nonce: nonce, Receiver: "0xDEX", GasPrice: big.NewInt(1e9), Value: big.NewInt(1e17), Timestamp: time.Now()}
+		if err := engine.SubmitTransaction(tx); err != nil {
+			t.Fatalf("SubmitTransaction(%s): %v", hash, err)
+		}
+	}
+	submit("a", "0xBob", 5)
+	submit("b", "0xBob", 6)
+	submit("c", "0xDave", 1)
+
+	if s, _ := engine.Status("a"); s.State != StatePending {
+		t.Fatalf("expected a pending, got %s", s.State)
+	}
+	if got := len(engine.DecryptTransactions()); got != 3 {
+		t.Fatalf("expected 3 txs revealed, got %d", got)
+	}
+	if s, _ := engine.Status("a"); s.State != StateRevealed {
+		t.Errorf("expected a revealed, got %s", s.State)
+	}
+
+	// a lands; Bob's nonce 6 is used by a tx we never saw, so b is dead
+	changes := engine.OnNewBlock(&Block{Number: 11, TxHashes: []string{"0xother", "a"}, Nonces: map[string]uint64{"0xBob": 7}})
+	if len(changes) != 2 || changes[0].Hash != "a" || changes[0].State != StateIncluded || changes[1].Hash != "b" || changes[1].State != StateDropped {
+		t.Fatalf("unexpected transitions: %+v", changes)
+	}
+	if s, _ := engine.Status("a"); s.State != StateIncluded || s.Block != 11 {
+		t.Errorf("unexpected status of a: %+v", s)
+	}
+	txs := engine.DecryptTransactions()
+	if len(txs) != 1 || txs[0].Hash != "c" {
+		t.Fatalf("expected only c left, got %d txs", len(txs))
+	}
+
+	// resubmitting a finished tx is refused
+	err := engine.SubmitTransaction(&Tx{Hash: "a", Sender: "0xBob", Nonce: 5, Timestamp: time.Now()})
+	if !errors.Is(err, ErrTxFinished) {
+		t.Errorf("expected ErrTxFinished, got %v", err)
+	}
+
+	// c ages out after 3 blocks; resubmitting it in between does not reset its age
+	submit("c", "0xDave", 1)
+	if changes := engine.OnNewBlock(&Block{Number: 12}); len(changes) != 0 {
+		t.Errorf("c dropped early: %+v", changes)
+	}
+	changes = engine.OnNewBlock(&Block{Number: 13})
+	if len(changes) != 1 || changes[0].Hash != "c" || changes[0].State != StateDropped {
+		t.Fatalf("expected c to age out, got %+v", changes)
+	}
+	if len(engine.DecryptTransactions()) != 0 {
+		t.Errorf("expected an empty pool")
+	}
+
+	// finished statuses are forgotten after the retention window
+	engine.OnNewBlock(&Block{Number: 13 + DefaultStatusRetention})
+	if _, ok := engine.Status("c"); ok {
+		t.Errorf("expected c's status to be pruned")
+	}
+}
+
+func TestSealedTxLifecycle(t *testing.T) {
+	engine := NewMEVGuardianEngine()
+	engine.AddProtectedSender("0xAlice")
+	engine.AdvanceBlock(100)
+
+	tx, key := seal(t, &Tx{Hash: "s1", Sender: "0xAlice", Nonce: 3, Receiver: "0xDEX", GasPrice: big.NewInt(1e9), Value: big.NewInt(1e17), Timestamp: time.Now()})
+	if err := engine.SubmitTransaction(tx); err != nil {
+		t.Fatalf("SubmitTransaction: %v", err)
+	}
+	if engine.pool.txs["s1"].Nonce != 3 || engine.pool.txs["s1"].SubmitBlock != 100 {
+		t.Errorf("sealed tx lost its nonce or submit block")
+	}
+	// still sealed, so nothing to reveal, but the nonce is still known
+	if len(engine.DecryptTransactions()) != 0 {
+		t.Fatalf("sealed tx revealed early")
+	}
+	engine.AdvanceBlock(101)
+	if _, err := engine.RevealKey("s1", key); err != nil {
+		t.Fatalf("RevealKey: %v", err)
+	}
+	changes := engine.OnNewBlock(&Block{Number: 102, Nonces: map[string]uint64{"0xAlice": 4}})
+	if len(changes) != 1 || changes[0].State != StateDropped {
+		t.Fatalf("expected the sealed tx to be dropped by nonce, got %+v", changes)
+	}
+	if _, ok := engine.pool.keys["s1"]; ok {
+		t.Errorf("released key kept after drop")
+	}
+}
@@ -0,0 +1,212 @@
+package mevgrandmothersguardia
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"sort"
+	"strings"
+
+	"golang.org/x/crypto/sha3"
+)
+
+// Distribution = one epoch's rebate Merkle tree, in the shape cumulative
+// MerkleDistributor contracts consume: leaves are
+// keccak256(abi.encodePacked(address account, uint256 cumulativeAmount)) and
+// pairs are hashed sorted, as OpenZeppelin's MerkleProof expects. Amounts are
+// cumulative, so the contract pays out the difference to what was claimed.
+type Distribution struct {
+	Epoch  uint64                  `json:"epoch"`
+	Root   string                  `json:"merkleRoot"`
+	Total  string                  `json:"total"`
+	Claims map[string]*MerkleClaim `json:"claims"` // by lowercase address
+}
+
+// MerkleClaim = what one address submits to claim.
+type MerkleClaim struct {
+	Amount string   `json:"amount"` // cumulative, decimal wei
+	Leaf   string   `json:"leaf"`
+	Proof  []string `json:"proof"`
+}
+
+func keccak256(data ...[]byte) []byte {
+	h := sha3.NewLegacyKeccak256()
+	for _, d := range data {
+		h.Write(d)
+	}
+	return h.Sum(nil)
+}
+
+// parseAddress decodes a 0x-prefixed 20-byte hex address.
+func parseAddress(addr string) ([]byte, error) {
+	s := strings.TrimPrefix(strings.TrimPrefix(addr, "0x"), "0X")
+	if len(s) != 40 {
+		return nil, fmt.Errorf("invalid address %q", addr)
+	}
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid address %q", addr)
+	}
+	return b, nil
+}
+
+// MerkleLeaf returns keccak256(abi.encodePacked(address, uint256 amount)).
+func MerkleLeaf(addr string, amount *big.Int) ([]byte, error) {
+	a, err := parseAddress(addr)
+	if err != nil {
+		return nil, err
+	}
+	if amount.Sign() < 0 || amount.BitLen() > 256 {
+		return nil, fmt.Errorf("amount %s does not fit a uint256", amount)
+	}
+	word := make([]byte, 32)
+	amount.FillBytes(word)
+	return keccak256(a, word), nil
+}
+
+// hashPair hashes two nodes in sorted order.
+func hashPair(a, b []byte) []byte {
+	if bytes.Compare(a, b) > 0 {
+		a, b = b, a
+	}
+	return keccak256(a, b)
+}
+
+// BuildDistribution builds the tree over cumulative amounts by address.
+// Zero amounts are left out. Leaves are sorted so the root does not depend
+// on map order; a node without a sibling moves up a level unchanged.
+func BuildDistribution(epoch uint64, amounts map[string]*big.Int) (*Distribution, error) {
+	type leaf struct {
+		addr string
+		hash []byte
+	}
+	var leaves []leaf
+	total := new(big.Int)
+	claims := make(map[string]*MerkleClaim)
+	for addr, amount := range amounts {
+		if amount == nil || amount.Sign() == 0 {
+			continue
+		}
+		key := strings.ToLower(addr)
+		if _, dup := claims[key]; dup {
+			return nil, fmt.Errorf("address %s appears twice", key)
+		}
+		h, err := MerkleLeaf(addr, amount)
+		if err != nil {
+			return nil, err
+		}
+		leaves = append(leaves, leaf{key, h})
+		claims[key] = &MerkleClaim{Amount: amount.String(), Leaf: "0x" + hex.EncodeToString(h), Proof: []string{}}
+		total.Add(total, amount)
+	}
+	if len(leaves) == 0 {
+		return nil, errors.New("nothing to distribute")
+	}
+	sort.Slice(leaves, func(i, j int) bool { return bytes.Compare(leaves[i].hash, leaves[j].hash) < 0 })
+
+	// pos[i] = index of leaf i's ancestor in the current level
+	level := make([][]byte, len(leaves))
+	pos := make([]int, len(leaves))
+	for i, l := range leaves {
+		level[i] = l.hash
+		pos[i] = i
+	}
+	for len(level) > 1 {
+		for i, l := range leaves {
+			sibling := pos[i] ^ 1
+			if sibling < len(level) {
+				c := claims[l.addr]
+				c.Proof = append(c.Proof, "0x"+hex.EncodeToString(level[sibling]))
+			}
+			pos[i] /= 2
+		}
+		next := make([][]byte, 0, (len(level)+1)/2)
+		for i := 0; i < len(level); i += 2 {
+			if i+1 < len(level) {
+				next = append(next, hashPair(level[i], level[i+1]))
+			} else {
+				next = append(next, level[i])
+			}
+		}
+		level = next
+	}
+
+	return &Distribution{
+		Epoch:  epoch,
+		Root:   "0x" + hex.EncodeToString(level[0]),
+		Total:  total.String(),
+		Claims: claims,
+	}, nil
+}
+
+// VerifyClaim checks a proof against a root, as the contract would.
+func VerifyClaim(root, addr string, amount *big.Int, proof []string) (bool, error) {
+	node, err := MerkleLeaf(addr, amount)
+	if err != nil {
+		return false, err
+	}
+	for _, p := range proof {
+		sibling, err := hex.DecodeString(strings.TrimPrefix(p, "0x"))
+		if err != nil || len(sibling) != 32 {
+			return false, fmt.Errorf("invalid proof node %q", p)
+		}
+		node = hashPair(node, sibling)
+	}
+	return "0x"+hex.EncodeToString(node) == strings.ToLower(root), nil
+}
+
+// Verify checks every claim in the distribution against its root.
+func (d *Distribution) Verify() error {
+	for addr, c := range d.Claims {
+		amount, ok := new(big.Int).SetString(c.Amount, 10)
+		if !ok {
+			return fmt.Errorf("claim for %s has invalid amount %q", addr, c.Amount)
+		}
+		valid, err := VerifyClaim(d.Root, addr, amount, c.Proof)
+		if err != nil {
+			return err
+		}
+		if !valid {
+			return fmt.Errorf("proof for %s does not match root %s", addr, d.Root)
+		}
+	}
+	return nil
+}
+
+// WriteFile publishes the distribution as JSON.
+func (d *Distribution) WriteFile(path string) error {
+	data, err := json.MarshalIndent(d, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// BuildEpochDistribution builds an epoch's tree from every address's accrued
+// rebates and checks its proofs. Ledger accounts that are not on-chain
+// addresses could never claim, so they fail the build rather than being
+// silently left out.
+func (mg *MEVGuardianEngine) BuildEpochDistribution(epoch uint64) (*Distribution, error) {
+	ledger := mg.Ledger()
+	amounts := make(map[string]*big.Int)
+	var bad []string
+	for _, addr := range ledger.Addresses() {
+		if _, err := parseAddress(addr); err != nil {
+			bad = append(bad, addr)
+			continue
+		}
+		amounts[addr] = ledger.Account(addr).Accrued
+	}
+	if len(bad) > 0 {
+		return nil, fmt.Errorf("ledger has non-address accounts: %s", strings.Join(bad, ", "))
+	}
+	d, err := BuildDistribution(epoch, amounts)
+	if err != nil {
+		return nil, err
+	}
+	return d, d.Verify()
+}
@@ -0,0 +1,93 @@
+// This file contains tests for Merkle rebate distributions and claim proofs.
+
+package mevgrandmothersguardia
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Reference vectors computed with an independent Keccak-256 implementation.
+func TestMerkleDistributionVectors(t *testing.T) {
+	leaf, err := MerkleLeaf("0x1111111111111111111111111111111111111111", big.NewInt(100))
+	if err != nil {
+		t.Fatalf("MerkleLeaf: %v", err)
+	}
+	if got := hex.EncodeToString(leaf); got != "4f2aefca2998f6aa2ab6799857a78dad717148458baa694d613c74251a29f216" {
+		t.Errorf("leaf = %s", got)
+	}
+
+	amounts := map[string]*big.Int{
+		"0x1111111111111111111111111111111111111111": big.NewInt(100),
+		"0x2222222222222222222222222222222222222222": big.NewInt(250),
+	}
+	d, err := BuildDistribution(1, amounts)
+	if err != nil {
+		t.Fatalf("BuildDistribution: %v", err)
+	}
+	if d.Root != "0x51276427b75869d6fb2f58724ac3f1a1f6514b71c4a50fb78b6b4f26ed558762" {
+		t.Errorf("two-leaf root = %s", d.Root)
+	}
+
+	amounts["0x3333333333333333333333333333333333333333"] = big.NewInt(1e18)
+	d, err = BuildDistribution(2, amounts)
+	if err != nil {
+		t.Fatalf("BuildDistribution: %v", err)
+	}
+	if d.Root != "0x24e157c7b1a5cf13aebfa43eaf38e400fed7bb964ae6bc45b2d80ea7bc66430a" {
+		t.Errorf("three-leaf root = %s", d.Root)
+	}
+	if d.Total != "1000000000000000350" {
+		t.Errorf("total = %s", d.Total)
+	}
+	if err := d.Verify(); err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+
+	claim := d.Claims["0x2222222222222222222222222222222222222222"]
+	if ok, _ := VerifyClaim(d.Root, "0x2222222222222222222222222222222222222222", big.NewInt(251), claim.Proof); ok {
+		t.Errorf("proof must not verify for a different amount")
+	}
+	if ok, _ := VerifyClaim(d.Root, "0x1111111111111111111111111111111111111111", big.NewInt(250), claim.Proof); ok {
+		t.Errorf("proof must not verify for a different address")
+	}
+}
+
+func TestEpochDistributionFromLedger(t *testing.T) {
+	engine := NewMEVGuardianEngine()
+	alice := "0xAAAA000000000000000000000000000000000001"
+	engine.DistributeProfits(&BundleOutcome{ID: "b1", Profit: big.NewInt(1000), Txs: []*Tx{{Hash: "t1", Sender: alice, Value: big.NewInt(1)}}})
+	engine.DistributeProfits(&BundleOutcome{ID: "b2", Profit: big.NewInt(1000), Txs: []*Tx{{Hash: "t2", Sender: alice, Value: big.NewInt(1)}}})
+
+	d, err := engine.BuildEpochDistribution(7)
+	if err != nil {
+		t.Fatalf("BuildEpochDistribution: %v", err)
+	}
+	claim := d.Claims[strings.ToLower(alice)]
+	if claim == nil || claim.Amount != "1800" || len(claim.Proof) != 0 {
+		t.Fatalf("expected a cumulative single-leaf claim of 1800, got %+v", claim)
+	}
+
+	path := filepath.Join(t.TempDir(), "epoch-7.json")
+	if err := d.WriteFile(path); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	data, _ := os.ReadFile(path)
+	var published Distribution
+	if err := json.Unmarshal(data, &published); err != nil || published.Root != d.Root {
+		t.Fatalf("published JSON does not round-trip: %v", err)
+	}
+	if err := published.Verify(); err != nil {
+		t.Errorf("published proofs do not verify: %v", err)
+	}
+
+	engine.DistributeProfits(&BundleOutcome{ID: "b3", Profit: big.NewInt(10), Txs: []*Tx{{Hash: "t3", Sender: "0xBob", Value: big.NewInt(1)}}})
+	if _, err := engine.BuildEpochDistribution(8); err == nil {
+		t.Errorf("expected non-address ledger accounts to be reported")
+	}
+}
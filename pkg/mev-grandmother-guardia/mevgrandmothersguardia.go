@@ -1,35 +1,71 @@
 package mevgrandmothersguardia
 
 import (
-	"crypto/sha256"
 	"fmt"
+	"io"
 	"math/big"
 	"sync"
 	"time"
+
+	"github.com/mellis0303/mev-vem/pkg/mev-amm"
+	"github.com/mellis0303/mev-vem/pkg/mev-wal"
 )
 
 // Tx = ETH transactions with advanced MEV protection.
 type Tx struct {
 	Hash        string
 	Sender      string
+	Nonce       uint64
 	Receiver    string
 	GasPrice    *big.Int
 	Value       *big.Int
+	Pool        string   // AMM pool a swap trades against, if known
+	TokenIn     string   // token sold by a swap
+	TokenOut    string   // token bought by a swap
+	AmountIn    *big.Int // amount of TokenIn a swap sells
+	Token       string   // token a transfer pays out in Value units, empty for ETH
 	Encrypted   bool
 	Timestamp   time.Time
+	Commitment  string    // sha256 commitment to the sealed body
+	Ciphertext  []byte    // AES-GCM sealed body while Encrypted
+	Salt        []byte    // commitment salt, set once revealed
+	RevealBlock uint64    // first block the body may be revealed at
+	SubmitBlock uint64    // height when the tx entered the pool
+	ReceivedAt  time.Time // when this node first received the tx
 }
 
 // GuardianPool = an encrypted transaction pool protecting users.
 type GuardianPool struct {
-	txs   map[string]*Tx
-	mutex sync.RWMutex
+	txs         map[string]*Tx
+	keys        map[string][]byte // body keys senders released at reveal, never persisted
+	committed   map[string]uint64 // tx hash -> block whose ordering includes it
+	roots       map[uint64]string // block -> committed ordering root
+	height      uint64
+	revealDelay uint64
+	status      map[string]*TxStatus // lifecycle, including recently finished txs
+	maxPending  uint64
+	fair        FairOrdering
+	reports     map[string]map[string]int // node -> tx hash -> report sequence
+	reportSeq   int
+	wal         *mevwal.WAL // nil unless OpenWAL was called
+	storageKey  []byte      // seals WAL records
+	walErr      error       // first failed log write, see WALErr
+	mutex       sync.RWMutex
 }
 
 // MEVGuardianEngine optimizes MEV "ethically" while protecting users (lol)
 type MEVGuardianEngine struct {
 	pool              *GuardianPool
 	protectedSenders  map[string]bool
-	profitDistribution map[string]*big.Int
+	registry          *Registry // signed opt-ins, nil if not set
+	policy            RebatePolicy
+	ledger            *Ledger
+	links             map[string]string       // linked addresses, see LinkAddresses
+	flagged           []Sandwich              // sandwiches seen in observed blocks
+	auction           *BatchAuction           // nil unless batch auctions are enabled
+	pools             map[string]*mevamm.Pool // snapshots bundles are simulated against, by address
+	tolerances        map[string]int64        // max execution loss in bps, by sender
+	audit             io.Writer               // execution reports, one JSON line each
 	mutex             sync.Mutex
 }
 
@@ -37,79 +73,225 @@ type MEVGuardianEngine struct {
 func NewMEVGuardianEngine() *MEVGuardianEngine {
 	return &MEVGuardianEngine{
 		pool: &GuardianPool{
-			txs: make(map[string]*Tx),
+			txs:         make(map[string]*Tx),
+			keys:        make(map[string][]byte),
+			committed:   make(map[string]uint64),
+			roots:       make(map[uint64]string),
+			revealDelay: DefaultRevealDelay,
+			status:      make(map[string]*TxStatus),
+			maxPending:  DefaultMaxPendingBlocks,
+			fair:        FairOrdering{Mode: ModeFCFS, Gamma: DefaultGamma},
+			reports:     make(map[string]map[string]int),
 		},
 		protectedSenders:  make(map[string]bool),
-		profitDistribution: make(map[string]*big.Int),
+		policy:            DefaultRebatePolicy,
+		ledger:            NewLedger(),
+		links:             make(map[string]string),
+		pools:             make(map[string]*mevamm.Pool),
+		tolerances:        make(map[string]int64),
 	}
 }
 
-// AddProtectedSender protects an address from predatory MEV.
+// AddProtectedSender protects an address from predatory MEV at LevelSealed.
+// It is an operator override and is not persisted; users opt in themselves
+// through the registry.
 func (mg *MEVGuardianEngine) AddProtectedSender(addr string) {
 	mg.mutex.Lock()
 	defer mg.mutex.Unlock()
 	mg.protectedSenders[addr] = true
 }
 
-// SubmitTransaction intelligently encrypts and adds tx to the pool (so smart)
-func (mg *MEVGuardianEngine) SubmitTransaction(tx *Tx) {
+// SetRegistry sets the registry of signed opt-ins consulted for each sender.
+func (mg *MEVGuardianEngine) SetRegistry(r *Registry) {
+	mg.mutex.Lock()
+	defer mg.mutex.Unlock()
+	mg.registry = r
+}
+
+// level returns a sender's protection level. Caller holds mg.mutex.
+func (mg *MEVGuardianEngine) level(sender string) uint8 {
+	if mg.protectedSenders[sender] {
+		return LevelSealed
+	}
+	if mg.registry != nil {
+		return mg.registry.Level(sender, time.Now())
+	}
+	return LevelNone
+}
+
+// SubmitTransaction adds tx to the pool. Senders at LevelSealed must submit
+// txs sealed with SealTx, or ErrUnsealed is returned; a sealed tx stays sealed
+// until its sender calls RevealKey after the reveal block or a committed
+// ordering. Txs that were already included or dropped are refused, as is a tx
+// reusing a pooled hash unless it is from the same sender and sealed or
+// plaintext like the pooled one.
+func (mg *MEVGuardianEngine) SubmitTransaction(tx *Tx) error {
+	return mg.SubmitTransactionAt(tx, time.Now())
+}
+
+// SubmitTransactionAt is SubmitTransaction for a tx received at the given
+// time, which fair ordering goes by.
+func (mg *MEVGuardianEngine) SubmitTransactionAt(tx *Tx, received time.Time) error {
+	mg.mutex.Lock()
+	protected := mg.level(tx.Sender) >= LevelSealed
+	mg.mutex.Unlock()
+
 	mg.pool.mutex.Lock()
 	defer mg.pool.mutex.Unlock()
 
-	if mg.protectedSenders[tx.Sender] {
-		tx.Encrypted = true
+	if s, ok := mg.pool.status[tx.Hash]; ok && (s.State == StateIncluded || s.State == StateDropped) {
+		return fmt.Errorf("%w: %s is %s", ErrTxFinished, tx.Hash, s.State)
+	}
+	existing, pooled := mg.pool.txs[tx.Hash]
+	if pooled && (existing.Sender != tx.Sender || (existing.Ciphertext == nil) != (tx.Ciphertext == nil)) {
+		return fmt.Errorf("%w: %s", ErrHashPooled, tx.Hash)
+	}
+	submitBlock := mg.pool.height
+	if pooled {
+		// resubmitting does not reset a tx's age or its place in line
+		submitBlock = existing.SubmitBlock
+		received = existing.ReceivedAt
+	}
+
+	if tx.Ciphertext == nil && protected {
+		return ErrUnsealed
+	}
+	if tx.Ciphertext == nil {
+		stored := *tx
+		stored.SubmitBlock = submitBlock
+		stored.ReceivedAt = received
+		if err := mg.pool.logAdd(&stored); err != nil {
+			return err
+		}
+		mg.pool.txs[tx.Hash] = &stored
+		mg.pool.setState(tx.Hash, StatePending)
+		return nil
+	}
+	if pooled && existing.Ciphertext != nil {
+		// already committed; resealing would push the reveal block back
+		return nil
+	}
+	if tx.Commitment == "" {
+		return fmt.Errorf("sealed tx %s has no commitment", tx.Hash)
+	}
+	// only the sealed fields are kept; the pool sets the reveal block
+	sealed := &Tx{
+		Hash:        tx.Hash,
+		Sender:      tx.Sender,
+		Nonce:       tx.Nonce,
+		Encrypted:   true,
+		Timestamp:   tx.Timestamp,
+		Commitment:  tx.Commitment,
+		Ciphertext:  append([]byte{}, tx.Ciphertext...),
+		RevealBlock: mg.pool.height + mg.pool.revealDelay,
+		SubmitBlock: submitBlock,
+		ReceivedAt:  received,
 	}
-	mg.pool.txs[tx.Hash] = tx
+	if err := mg.pool.logAdd(sealed); err != nil {
+		return err
+	}
+	mg.pool.txs[tx.Hash] = sealed
+	mg.pool.setState(tx.Hash, StatePending)
+	return nil
 }
 
-// DecryptTransactions simulates safe decryption at block inclusion.
+// DecryptTransactions returns every pending tx that may be read at the current
+// height and whose batch window has closed, in fair order, and marks them
+// revealed. Sealed txs whose reveal block has not arrived, or whose sender has
+// not released the key, stay in the pool untouched.
 func (mg *MEVGuardianEngine) DecryptTransactions() []*Tx {
+	return mg.decryptAt(time.Now())
+}
+
+func (mg *MEVGuardianEngine) decryptAt(now time.Time) []*Tx {
 	mg.pool.mutex.Lock()
 	defer mg.pool.mutex.Unlock()
 
 	var decrypted []*Tx
-	for _, tx := range mg.pool.txs {
-		if tx.Encrypted {
+	for hash, tx := range mg.pool.txs {
+		if !mg.pool.released(tx, now) {
+			continue
+		}
+		if tx.Ciphertext == nil {
 			tx.Encrypted = false
+			decrypted = append(decrypted, tx)
+			mg.pool.setState(hash, StateRevealed)
+			continue
+		}
+		key, ok := mg.pool.keys[hash]
+		if !ok || !mg.pool.revealable(tx) {
+			continue
+		}
+		revealed, err := openTx(tx, key)
+		if err != nil {
+			continue
 		}
-		decrypted = append(decrypted, tx)
+		decrypted = append(decrypted, revealed)
+		mg.pool.setState(hash, StateRevealed)
 	}
-	return decrypted
+	return mg.pool.order(decrypted)
 }
 
-// OptimizeBundles ethically maximizes profits avoiding sandwich attacks.
+// OptimizeBundles ethically maximizes profits avoiding sandwich attacks: it
+// drops duplicate txs and the front and back legs of any sandwich around a
+// protected sender, keeping the victim.
 func (mg *MEVGuardianEngine) OptimizeBundles(txs []*Tx) []*Tx {
-	var bundle []*Tx
+	var unique []*Tx
 	seen := map[string]bool{}
 	for _, tx := range txs {
-		hash := sha256.Sum256([]byte(tx.Sender + tx.Receiver))
-		key := fmt.Sprintf("%x", hash)
-		if !seen[key] {
-			bundle = append(bundle, tx)
-			seen[key] = true
+		if !seen[tx.Hash] {
+			unique = append(unique, tx)
+			seen[tx.Hash] = true
+		}
+	}
+
+	// removing one sandwich can expose another pair of legs around the same victim
+	bundle := unique
+	for {
+		found := mg.DetectSandwiches(bundle)
+		if len(found) == 0 {
+			return bundle
+		}
+		excluded := map[*Tx]bool{}
+		for _, s := range found {
+			excluded[s.Front] = true
+			excluded[s.Back] = true
+		}
+		var kept []*Tx
+		for _, tx := range bundle {
+			if !excluded[tx] {
+				kept = append(kept, tx)
+			}
 		}
+		bundle = kept
 	}
-	return bundle
 }
 
-// DistributeProfits fairly distributes MEV profits back to affected users.
-func (mg *MEVGuardianEngine) DistributeProfits(bundle []*Tx) {
+// DistributeProfits fairly distributes a landed bundle's realized profit back
+// to the users whose txs created it, per the rebate policy, and credits the
+// rebates to the ledger.
+func (mg *MEVGuardianEngine) DistributeProfits(outcome *BundleOutcome) ([]Rebate, error) {
 	mg.mutex.Lock()
-	defer mg.mutex.Unlock()
+	policy, ledger := mg.policy, mg.ledger
+	mg.mutex.Unlock()
 
-	profitPerTx := big.NewInt(1e15) // Example: 0.001 ETH per tx
-	for _, tx := range bundle {
-		mg.profitDistribution[tx.Sender] = profitPerTx
+	rebates, err := policy.Rebates(outcome)
+	if err != nil {
+		return nil, err
+	}
+	if err := ledger.Accrue(rebates); err != nil {
+		return nil, err
 	}
+	return rebates, nil
 }
 
 // ShowProfitDistribution transparently displays MEV profit redistribution.
 func (mg *MEVGuardianEngine) ShowProfitDistribution() {
-	mg.mutex.Lock()
-	defer mg.mutex.Unlock()
+	ledger := mg.Ledger()
 	fmt.Println("MEV Profit Redistribution:")
-	for addr, profit := range mg.profitDistribution {
-		fmt.Printf("Address: %s, Profit Returned: %s wei\n", addr, profit.String())
+	for _, addr := range ledger.Addresses() {
+		a := ledger.Account(addr)
+		fmt.Printf("Address: %s, Accrued: %s wei, Claimed: %s wei, Pending: %s wei\n", addr, a.Accrued, a.Claimed, a.Pending())
 	}
 }
 
@@ -120,17 +302,53 @@ func Example() {
 	// Protect sensitive senders from MEV predation
 	guardian.AddProtectedSender("0xAlice")
 
-	// Submit transactions
-	guardian.SubmitTransaction(&Tx{"0x111", "0xAlice", "0xDEX", big.NewInt(100e9), big.NewInt(5e17), false, time.Now()})
-	guardian.SubmitTransaction(&Tx{"0x222", "0xBob", "0xDEX", big.NewInt(120e9), big.NewInt(3e17), false, time.Now()})
+	// Submit transactions; Alice seals her body herself and keeps the key
+	guardian.AdvanceBlock(19000000)
+	sealed, key, err := SealTx(&Tx{Hash: "0x111", Sender: "0xAlice", Receiver: "0xDEX", GasPrice: big.NewInt(100e9), Value: big.NewInt(5e17), Timestamp: time.Now()})
+	if err != nil {
+		fmt.Println("Sealing failed:", err)
+		return
+	}
+	guardian.SubmitTransaction(sealed)
+	guardian.SubmitTransaction(&Tx{Hash: "0x222", Sender: "0xBob", Receiver: "0xDEX", GasPrice: big.NewInt(120e9), Value: big.NewInt(3e17), Timestamp: time.Now()})
 
-	// Decrypt at block inclusion
+	if _, err := guardian.RevealKey("0x111", key); err != nil {
+		fmt.Println("Early reveal refused:", err)
+	}
+
+	// Alice releases her key at block inclusion
+	guardian.AdvanceBlock(19000001)
+	if _, err := guardian.RevealKey("0x111", key); err != nil {
+		fmt.Println("Reveal failed:", err)
+	}
 	decryptedTxs := guardian.DecryptTransactions()
 
 	// Optimize without harmful front-running
 	bundle := guardian.OptimizeBundles(decryptedTxs)
 
-	// Distribute profits back ethically (syke)
-	guardian.DistributeProfits(bundle)
+	// A searcher bundle wrapping Alice's swap is refused
+	alice := &Tx{Hash: "0x333", Sender: "0xAlice", Pool: "0xWETHUSDC", TokenIn: "WETH", TokenOut: "USDC"}
+	_, flagged := guardian.FilterBundles([][]*Tx{{
+		{Hash: "0x444", Sender: "0xBot", Pool: "0xWETHUSDC", TokenIn: "WETH", TokenOut: "USDC"},
+		alice,
+		{Hash: "0x555", Sender: "0xBot", Pool: "0xWETHUSDC", TokenIn: "USDC", TokenOut: "WETH"},
+	}})
+	for _, s := range flagged {
+		fmt.Println("Refused:", s)
+	}
+
+	// Distribute profits back ethically (syke): the bundle's realized profit
+	// is split by the backrun value each user tx created
+	_, err = guardian.DistributeProfits(&BundleOutcome{
+		ID:           "bundle-1",
+		Block:        19000001,
+		Profit:       big.NewInt(2e15),
+		Txs:          bundle,
+		BackrunValue: map[string]*big.Int{"0x111": big.NewInt(3e15), "0x222": big.NewInt(1e15)},
+	})
+	if err != nil {
+		fmt.Println("Error distributing profits:", err)
+		return
+	}
 	guardian.ShowProfitDistribution()
 }
@@ -0,0 +1,70 @@
+// This file contains tests for submission, decryption and hash reuse in the
+// MEVGuardianEngine pool.
+
+package mevgrandmothersguardia
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+)
+
+func TestSubmitAndDecryptTransactions(t *testing.T) {
+	engine := NewMEVGuardianEngine()
+
+	tx1 := &Tx{
+		Hash:      "tx1",
+		Sender:    "0xAlice",
+		Receiver:  "0xDEX",
+		GasPrice:  big.NewInt(100_000_000_000), // 100 Gwei
+		Value:     big.NewInt(500_000_000_000_000_000),
+		Encrypted: true,
+		Timestamp: time.Now(),
+	}
+
+	tx2 := &Tx{
+		Hash:      "tx2",
+		Sender:    "0xBob",
+		Receiver:  "0xDEX",
+		GasPrice:  big.NewInt(120_000_000_000),
+		Value:     big.NewInt(300_000_000_000_000_000),
+		Encrypted: false,
+		Timestamp: time.Now(),
+	}
+
+	engine.SubmitTransaction(tx1)
+	engine.SubmitTransaction(tx2)
+
+	decrypted := engine.DecryptTransactions()
+	for _, tx := range decrypted {
+		if tx.Encrypted {
+			t.Errorf("Expected transaction %s to be decrypted", tx.Hash)
+		}
+	}
+}
+
+func TestPooledHashCannotBeReused(t *testing.T) {
+	engine := NewMEVGuardianEngine()
+	engine.AddProtectedSender("0xAlice")
+	sealed, _ := seal(t, &Tx{Hash: "tx1", Sender: "0xAlice", Receiver: "0xDEX", GasPrice: big.NewInt(1), Value: big.NewInt(1)})
+	if err := engine.SubmitTransaction(sealed); err != nil {
+		t.Fatalf("SubmitTransaction: %v", err)
+	}
+
+	// an unprotected sender cannot overwrite alice's sealed tx in plaintext
+	err := engine.SubmitTransaction(&Tx{Hash: "tx1", Sender: "0xMallory", Receiver: "0xMallory", GasPrice: big.NewInt(1), Value: big.NewInt(1)})
+	if !errors.Is(err, ErrHashPooled) {
+		t.Errorf("plaintext reuse of a sealed hash: expected ErrHashPooled, got %v", err)
+	}
+	other, _ := seal(t, &Tx{Hash: "tx1", Sender: "0xMallory", Receiver: "0xMallory", GasPrice: big.NewInt(1), Value: big.NewInt(1)})
+	if err := engine.SubmitTransaction(other); !errors.Is(err, ErrHashPooled) {
+		t.Errorf("sealed reuse by another sender: expected ErrHashPooled, got %v", err)
+	}
+	if err := engine.SubmitTransaction(sealed); err != nil {
+		t.Errorf("same sender resubmitting: %v", err)
+	}
+	if got := engine.pool.txs["tx1"]; got.Sender != "0xAlice" || got.Ciphertext == nil {
+		t.Errorf("alice's sealed tx was overwritten: %+v", got)
+	}
+}
@@ -0,0 +1,354 @@
+package mevgrandmothersguardia
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	"github.com/decred/dcrd/dcrec/secp256k1/v4/ecdsa"
+	"github.com/mellis0303/mev-vem/pkg/mev-wal"
+)
+
+// Protection levels a user can opt into.
+const (
+	LevelNone    uint8 = 0 // no protection
+	LevelMonitor uint8 = 1 // sandwiches around the user's swaps are detected and refused
+	LevelSealed  uint8 = 2 // as LevelMonitor, and bodies are sealed until reveal
+)
+
+// EIP-712 names of the registry's signed messages.
+const (
+	RegistryName    = "MEV Guardian"
+	RegistryVersion = "1"
+	optInType       = "OptIn(address user,uint8 level,uint64 expiry,uint64 nonce)"
+	revokeType      = "Revoke(address user,uint64 nonce)"
+)
+
+// ErrBadSignature is returned when a message was not signed by its user.
+var ErrBadSignature = errors.New("signature does not match user")
+
+// OptIn = a user's signed request for protection until Expiry (unix seconds).
+// Nonces must increase per user, so an old opt-in cannot be replayed after a
+// revocation.
+type OptIn struct {
+	User      string `json:"user"`
+	Level     uint8  `json:"level"`
+	Expiry    uint64 `json:"expiry"`
+	Nonce     uint64 `json:"nonce"`
+	Signature string `json:"signature"` // 0x r || s || v
+}
+
+// Revocation = a user's signed request to drop their opt-in.
+type Revocation struct {
+	User      string `json:"user"`
+	Nonce     uint64 `json:"nonce"`
+	Signature string `json:"signature"`
+}
+
+// Registry = verified opt-ins by user, kept in a JSON file if it has a path.
+type Registry struct {
+	domain []byte // EIP-712 domain separator
+	path   string
+	optIns map[string]*OptIn // by lowercase user
+	nonces map[string]uint64 // last nonce used by each user, including revocations
+	mutex  sync.RWMutex
+}
+
+// registryFile = the registry's on-disk form.
+type registryFile struct {
+	OptIns []*OptIn          `json:"optIns"`
+	Nonces map[string]uint64 `json:"nonces"`
+}
+
+func word(v *big.Int) []byte {
+	w := make([]byte, 32)
+	v.FillBytes(w)
+	return w
+}
+
+func addressWord(addr []byte) []byte {
+	w := make([]byte, 32)
+	copy(w[12:], addr)
+	return w
+}
+
+// DomainSeparator returns the EIP-712 domain separator. verifyingContract may
+// be empty, in which case it is left out of the domain type.
+func DomainSeparator(name, version string, chainID uint64, verifyingContract string) ([]byte, error) {
+	if verifyingContract == "" {
+		typeHash := keccak256([]byte("EIP712Domain(string name,string version,uint256 chainId)"))
+		return keccak256(typeHash, keccak256([]byte(name)), keccak256([]byte(version)), word(new(big.Int).SetUint64(chainID))), nil
+	}
+	contract, err := parseAddress(verifyingContract)
+	if err != nil {
+		return nil, err
+	}
+	typeHash := keccak256([]byte("EIP712Domain(string name,string version,uint256 chainId,address verifyingContract)"))
+	return keccak256(typeHash, keccak256([]byte(name)), keccak256([]byte(version)), word(new(big.Int).SetUint64(chainID)), addressWord(contract)), nil
+}
+
+// typedDataHash = keccak256(0x19 0x01 || domainSeparator || structHash).
+func typedDataHash(domain, structHash []byte) []byte {
+	return keccak256([]byte{0x19, 0x01}, domain, structHash)
+}
+
+func (o *OptIn) structHash() ([]byte, error) {
+	user, err := parseAddress(o.User)
+	if err != nil {
+		return nil, err
+	}
+	return keccak256(keccak256([]byte(optInType)), addressWord(user),
+		word(big.NewInt(int64(o.Level))),
+		word(new(big.Int).SetUint64(o.Expiry)),
+		word(new(big.Int).SetUint64(o.Nonce))), nil
+}
+
+func (rv *Revocation) structHash() ([]byte, error) {
+	user, err := parseAddress(rv.User)
+	if err != nil {
+		return nil, err
+	}
+	return keccak256(keccak256([]byte(revokeType)), addressWord(user), word(new(big.Int).SetUint64(rv.Nonce))), nil
+}
+
+// pubkeyAddress = the last 20 bytes of keccak256 of the uncompressed key.
+func pubkeyAddress(pub *secp256k1.PublicKey) []byte {
+	return keccak256(pub.SerializeUncompressed()[1:])[12:]
+}
+
+// recoverAddress returns the address that signed digest. Signatures are
+// r || s || v with v in {0, 1, 27, 28}; high-s signatures are refused.
+func recoverAddress(digest []byte, signature string) ([]byte, error) {
+	sig, err := hex.DecodeString(strings.TrimPrefix(signature, "0x"))
+	if err != nil || len(sig) != 65 {
+		return nil, errors.New("signature must be 65 bytes of hex")
+	}
+	v := sig[64]
+	if v >= 27 {
+		v -= 27
+	}
+	if v > 1 {
+		return nil, fmt.Errorf("invalid signature v %d", sig[64])
+	}
+	var s secp256k1.ModNScalar
+	if overflow := s.SetByteSlice(sig[32:64]); overflow || s.IsOverHalfOrder() {
+		return nil, errors.New("signature s is not in the lower half order")
+	}
+	compact := make([]byte, 65)
+	compact[0] = 27 + v
+	copy(compact[1:], sig[:64])
+	pub, _, err := ecdsa.RecoverCompact(compact, digest)
+	if err != nil {
+		return nil, err
+	}
+	return pubkeyAddress(pub), nil
+}
+
+// sign produces an r || s || v signature (v = 27 or 28) over digest.
+func sign(key []byte, digest []byte) (string, error) {
+	if len(key) != 32 {
+		return "", errors.New("signing key must be 32 bytes long")
+	}
+	compact := ecdsa.SignCompact(secp256k1.PrivKeyFromBytes(key), digest, false)
+	sig := append(append([]byte{}, compact[1:]...), compact[0])
+	return "0x" + hex.EncodeToString(sig), nil
+}
+
+// NewRegistry returns an in-memory registry for chainID.
+func NewRegistry(chainID uint64) *Registry {
+	domain, _ := DomainSeparator(RegistryName, RegistryVersion, chainID, "")
+	return &Registry{domain: domain, optIns: make(map[string]*OptIn), nonces: make(map[string]uint64)}
+}
+
+// OpenRegistry loads the registry at path, or starts an empty one there.
+// Stored signatures are checked again, so an edited file is refused.
+func OpenRegistry(path string, chainID uint64) (*Registry, error) {
+	r := NewRegistry(chainID)
+	r.path = path
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return r, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var f registryFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("registry %s: %w", path, err)
+	}
+	for user, nonce := range f.Nonces {
+		r.nonces[strings.ToLower(user)] = nonce
+	}
+	for _, o := range f.OptIns {
+		if err := r.verifyOptIn(o); err != nil {
+			return nil, fmt.Errorf("registry %s: opt-in for %s: %w", path, o.User, err)
+		}
+		if o.Nonce > r.nonces[strings.ToLower(o.User)] {
+			return nil, fmt.Errorf("registry %s: opt-in for %s is newer than its recorded nonce", path, o.User)
+		}
+		r.optIns[strings.ToLower(o.User)] = o
+	}
+	return r, nil
+}
+
+// SignOptIn fills in o's signature with the user's key, for clients and tests.
+func (r *Registry) SignOptIn(key []byte, o *OptIn) error {
+	h, err := o.structHash()
+	if err != nil {
+		return err
+	}
+	o.Signature, err = sign(key, typedDataHash(r.domain, h))
+	return err
+}
+
+// SignRevocation fills in rv's signature with the user's key.
+func (r *Registry) SignRevocation(key []byte, rv *Revocation) error {
+	h, err := rv.structHash()
+	if err != nil {
+		return err
+	}
+	rv.Signature, err = sign(key, typedDataHash(r.domain, h))
+	return err
+}
+
+func (r *Registry) verifyOptIn(o *OptIn) error {
+	if o.Level > LevelSealed {
+		return fmt.Errorf("unknown protection level %d", o.Level)
+	}
+	h, err := o.structHash()
+	if err != nil {
+		return err
+	}
+	return r.verify(o.User, typedDataHash(r.domain, h), o.Signature)
+}
+
+func (r *Registry) verify(user string, digest []byte, signature string) error {
+	want, err := parseAddress(user)
+	if err != nil {
+		return err
+	}
+	got, err := recoverAddress(digest, signature)
+	if err != nil {
+		return err
+	}
+	if hex.EncodeToString(got) != hex.EncodeToString(want) {
+		return fmt.Errorf("%w: signed by 0x%x", ErrBadSignature, got)
+	}
+	return nil
+}
+
+// Register verifies and stores a signed opt-in, replacing the user's previous one.
+func (r *Registry) Register(o *OptIn, now time.Time) error {
+	if err := r.verifyOptIn(o); err != nil {
+		return err
+	}
+	if o.Expiry <= uint64(now.Unix()) {
+		return errors.New("opt-in has expired")
+	}
+	user := strings.ToLower(o.User)
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if last, ok := r.nonces[user]; ok && o.Nonce <= last {
+		return fmt.Errorf("nonce %d already used (last %d)", o.Nonce, last)
+	}
+	prevOptIn, hadOptIn := r.optIns[user]
+	prevNonce, hadNonce := r.nonces[user]
+	stored := *o
+	r.optIns[user] = &stored
+	r.nonces[user] = o.Nonce
+	if err := r.save(); err != nil {
+		r.restore(user, prevOptIn, hadOptIn, prevNonce, hadNonce)
+		return err
+	}
+	return nil
+}
+
+// Revoke verifies a signed revocation and drops the user's opt-in.
+func (r *Registry) Revoke(rv *Revocation) error {
+	h, err := rv.structHash()
+	if err != nil {
+		return err
+	}
+	if err := r.verify(rv.User, typedDataHash(r.domain, h), rv.Signature); err != nil {
+		return err
+	}
+	user := strings.ToLower(rv.User)
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if last, ok := r.nonces[user]; ok && rv.Nonce <= last {
+		return fmt.Errorf("nonce %d already used (last %d)", rv.Nonce, last)
+	}
+	prevOptIn, hadOptIn := r.optIns[user]
+	prevNonce, hadNonce := r.nonces[user]
+	delete(r.optIns, user)
+	r.nonces[user] = rv.Nonce
+	if err := r.save(); err != nil {
+		r.restore(user, prevOptIn, hadOptIn, prevNonce, hadNonce)
+		return err
+	}
+	return nil
+}
+
+// restore undoes a change that could not be saved. Caller holds the lock.
+func (r *Registry) restore(user string, o *OptIn, hadOptIn bool, nonce uint64, hadNonce bool) {
+	if hadOptIn {
+		r.optIns[user] = o
+	} else {
+		delete(r.optIns, user)
+	}
+	if hadNonce {
+		r.nonces[user] = nonce
+	} else {
+		delete(r.nonces, user)
+	}
+}
+
+// Level returns a user's protection level at now; expired opt-ins count as none.
+func (r *Registry) Level(user string, now time.Time) uint8 {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	o, ok := r.optIns[strings.ToLower(user)]
+	if !ok || o.Expiry <= uint64(now.Unix()) {
+		return LevelNone
+	}
+	return o.Level
+}
+
+// OptIns lists the stored opt-ins, expired ones included, by user.
+func (r *Registry) OptIns() []OptIn {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	var list []OptIn
+	for _, o := range r.optIns {
+		list = append(list, *o)
+	}
+	sort.Slice(list, func(i, j int) bool { return strings.ToLower(list[i].User) < strings.ToLower(list[j].User) })
+	return list
+}
+
+// save writes the registry atomically. Caller holds the lock.
+func (r *Registry) save() error {
+	if r.path == "" {
+		return nil
+	}
+	f := registryFile{Nonces: r.nonces}
+	for _, o := range r.optIns {
+		f.OptIns = append(f.OptIns, o)
+	}
+	sort.Slice(f.OptIns, func(i, j int) bool { return strings.ToLower(f.OptIns[i].User) < strings.ToLower(f.OptIns[j].User) })
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+	return mevwal.WriteFileAtomic(r.path, data)
+}
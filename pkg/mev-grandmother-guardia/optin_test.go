@@ -0,0 +1,125 @@
+// This file contains tests for EIP-712 hashing and the signed opt-in registry.
+
+package mevgrandmothersguardia
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// The "Ether Mail" example from EIP-712.
+func TestEIP712ReferenceVector(t *testing.T) {
+	domain, err := DomainSeparator("Ether Mail", "1", 1, "0xCcCCccccCCCCcCCCCCCcCcCccCcCCCcCcccccccC")
+	if err != nil {
+		t.Fatalf("DomainSeparator: %v", err)
+	}
+	if got := hex.EncodeToString(domain); got != "f2cee375fa42b42143804025fc449deafd50cc031ca257e0b194a650a912090f" {
+		t.Fatalf("domain separator = %s", got)
+	}
+
+	person := func(name, wallet string) []byte {
+		addr, _ := parseAddress(wallet)
+		return keccak256(keccak256([]byte("Person(string name,address wallet)")), keccak256([]byte(name)), addressWord(addr))
+	}
+	mail := keccak256(keccak256([]byte("Mail(Person from,Person to,string contents)Person(string name,address wallet)")),
+		person("Cow", "0xCD2a3d9F938E13CD947Ec05AbC7FE734Df8DD826"),
+		person("Bob", "0xbBbBBBBbbBBBbbbBbbBbbbbBBbBbbbbBbBbbBBbB"),
+		keccak256([]byte("Hello, Bob!")))
+	digest := typedDataHash(domain, mail)
+	if got := hex.EncodeToString(digest); got != "be609aee343fb3c4b28e1df9e632fca64fcfaede20f02e86244efddf30957bd2" {
+		t.Fatalf("digest = %s", got)
+	}
+
+	sig := "0x4355c47d63924e8a72e509b65029052eb6c299d53a04e167c5775fd466751c9d" +
+		"07299936d304c153f6443dfa05f40ff007d72911b6f72307f996231605b91562" + "1c"
+	signer, err := recoverAddress(digest, sig)
+	if err != nil {
+		t.Fatalf("recoverAddress: %v", err)
+	}
+	if got := hex.EncodeToString(signer); got != "cd2a3d9f938e13cd947ec05abc7fe734df8dd826" {
+		t.Errorf("signer = 0x%s", got)
+	}
+}
+
+func TestOptInRegistry(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "registry.json")
+	registry, err := OpenRegistry(path, 1)
+	if err != nil {
+		t.Fatalf("OpenRegistry: %v", err)
+	}
+	key := keccak256([]byte("cow"))
+	user := "0xCD2a3d9F938E13CD947Ec05AbC7FE734Df8DD826"
+	now := time.Now()
+
+	o := &OptIn{User: user, Level: LevelSealed, Expiry: uint64(now.Add(time.Hour).Unix()), Nonce: 1}
+	registry.SignOptIn(key, o)
+	forged := *o
+	forged.User = "0xbBbBBBBbbBBBbbbBbbBbbbbBBbBbbbbBbBbbBBbB"
+	if err := registry.Register(&forged, now); !errors.Is(err, ErrBadSignature) {
+		t.Errorf("expected ErrBadSignature for another user, got %v", err)
+	}
+	raised := *o
+	raised.Expiry += 3600
+	if err := registry.Register(&raised, now); !errors.Is(err, ErrBadSignature) {
+		t.Errorf("expected a changed expiry to break the signature, got %v", err)
+	}
+	if err := registry.Register(o, now); err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	if err := registry.Register(o, now); err == nil {
+		t.Errorf("expected a replayed opt-in to be refused")
+	}
+
+	engine := NewMEVGuardianEngine()
+	engine.SetRegistry(registry)
+	plain := &Tx{Hash: "tx1", Sender: user, Receiver: "0xDEX", GasPrice: big.NewInt(1), Value: big.NewInt(1)}
+	if err := engine.SubmitTransaction(plain); !errors.Is(err, ErrUnsealed) {
+		t.Errorf("LevelSealed opt-in must require a sealed body, got %v", err)
+	}
+	sealed, _ := seal(t, plain)
+	if err := engine.SubmitTransaction(sealed); err != nil || engine.pool.txs["tx1"].Ciphertext == nil {
+		t.Errorf("expected the sealed body to be accepted, got %v", err)
+	}
+	if registry.Level(user, now.Add(2*time.Hour)) != LevelNone {
+		t.Errorf("expired opt-in must not protect")
+	}
+
+	// survives a restart; the revocation then sticks across another one
+	registry, err = OpenRegistry(path, 1)
+	if err != nil {
+		t.Fatalf("OpenRegistry after restart: %v", err)
+	}
+	if registry.Level(user, now) != LevelSealed {
+		t.Fatalf("opt-in lost across restart")
+	}
+	rv := &Revocation{User: user, Nonce: 2}
+	registry.SignRevocation(key, rv)
+	if err := registry.Revoke(rv); err != nil {
+		t.Fatalf("Revoke: %v", err)
+	}
+	registry, _ = OpenRegistry(path, 1)
+	if registry.Level(user, now) != LevelNone {
+		t.Errorf("revoked user still protected")
+	}
+	if err := registry.Register(o, now); err == nil {
+		t.Errorf("expected the pre-revocation opt-in to be refused")
+	}
+
+	// an edited file is refused
+	monitor := &OptIn{User: user, Level: LevelMonitor, Expiry: o.Expiry, Nonce: 3}
+	registry.SignOptIn(key, monitor)
+	if err := registry.Register(monitor, now); err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	data, _ := os.ReadFile(path)
+	os.WriteFile(path, bytes.Replace(data, []byte(`"level": 1`), []byte(`"level": 2`), 1), 0600)
+	if _, err := OpenRegistry(path, 1); !errors.Is(err, ErrBadSignature) {
+		t.Errorf("expected a tampered level to be refused, got %v", err)
+	}
+}
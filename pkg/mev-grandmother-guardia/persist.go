@@ -0,0 +1,213 @@
+package mevgrandmothersguardia
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/mellis0303/mev-vem/pkg/mev-wal"
+)
+
+// WAL record types.
+const (
+	walAdd    byte = 1
+	walRemove byte = 2
+)
+
+// walEntry = a pooled tx as logged. Sealed txs are logged as ciphertext only;
+// released body keys are never written.
+type walEntry struct {
+	Tx   *Tx    `json:"tx,omitempty"`
+	Hash string `json:"hash,omitempty"` // removals
+}
+
+// OpenWAL makes the pool durable. Every record is sealed with AES-GCM under
+// storageKey (32 bytes), since unprotected txs are logged in the clear. The
+// log at path is replayed into the pool first; sealed txs come back without
+// their keys, which senders release again with RevealKey. A write that fails
+// is kept for WALErr; once the log has failed, new submissions are refused.
+func (mg *MEVGuardianEngine) OpenWAL(path string, storageKey []byte, opts mevwal.Options) error {
+	if len(storageKey) != 32 {
+		return errors.New("storage key must be 32 bytes long")
+	}
+	w, records, err := mevwal.Open(path, opts)
+	if err != nil {
+		return err
+	}
+
+	mg.pool.mutex.Lock()
+	defer mg.pool.mutex.Unlock()
+	if mg.pool.wal != nil {
+		w.Close()
+		return errors.New("pool already has a WAL")
+	}
+	mg.pool.storageKey = append([]byte{}, storageKey...)
+
+	for i, rec := range records {
+		entry, err := mg.pool.openRecord(rec)
+		if err != nil {
+			w.Close()
+			return fmt.Errorf("wal record %d: %w", i, err)
+		}
+		switch rec.Type {
+		case walAdd:
+			mg.pool.txs[entry.Tx.Hash] = entry.Tx
+			mg.pool.setState(entry.Tx.Hash, StatePending)
+		case walRemove:
+			delete(mg.pool.txs, entry.Hash)
+			delete(mg.pool.status, entry.Hash)
+		}
+	}
+	mg.pool.wal = w
+	return mg.pool.compactWAL()
+}
+
+// RemoveTransactions drops txs that were included or abandoned.
+func (mg *MEVGuardianEngine) RemoveTransactions(hashes ...string) int {
+	mg.pool.mutex.Lock()
+	defer mg.pool.mutex.Unlock()
+	n := 0
+	for _, hash := range hashes {
+		if _, ok := mg.pool.txs[hash]; ok {
+			mg.pool.remove(hash)
+			delete(mg.pool.status, hash)
+			n++
+		}
+	}
+	return n
+}
+
+// CompactWAL rewrites the log with only the txs still in the pool.
+func (mg *MEVGuardianEngine) CompactWAL() error {
+	mg.pool.mutex.Lock()
+	defer mg.pool.mutex.Unlock()
+	return mg.pool.compactWAL()
+}
+
+// CloseWAL syncs and closes the log.
+func (mg *MEVGuardianEngine) CloseWAL() error {
+	mg.pool.mutex.Lock()
+	defer mg.pool.mutex.Unlock()
+	if mg.pool.wal == nil {
+		return nil
+	}
+	err := mg.pool.wal.Close()
+	mg.pool.wal = nil
+	for i := range mg.pool.storageKey {
+		mg.pool.storageKey[i] = 0
+	}
+	return err
+}
+
+// WALErr returns the first failure to seal or write a log record, including
+// removals by calls that cannot return an error, or nil. Txs whose removal
+// was lost come back after a restart.
+func (mg *MEVGuardianEngine) WALErr() error {
+	mg.pool.mutex.RLock()
+	defer mg.pool.mutex.RUnlock()
+	if mg.pool.walErr == nil && mg.pool.wal != nil {
+		return mg.pool.wal.Err()
+	}
+	return mg.pool.walErr
+}
+
+// remove drops a tx and logs it. Callers that cannot return an error may
+// ignore the result; walFailed keeps it for WALErr. Caller holds the lock.
+func (gp *GuardianPool) remove(hash string) error {
+	delete(gp.txs, hash)
+	delete(gp.keys, hash)
+	delete(gp.committed, hash)
+	gp.forget(hash)
+	if gp.wal == nil {
+		return nil
+	}
+	rec, err := gp.sealRecord(walRemove, &walEntry{Hash: hash})
+	if err != nil {
+		return gp.walFailed(err)
+	}
+	return gp.walFailed(gp.wal.Append(rec))
+}
+
+// logAdd records a tx, refusing it once the log has failed. Caller holds the lock.
+func (gp *GuardianPool) logAdd(tx *Tx) error {
+	if gp.wal == nil {
+		return nil
+	}
+	if gp.walErr != nil {
+		return gp.walErr
+	}
+	rec, err := gp.sealRecord(walAdd, &walEntry{Tx: tx})
+	if err != nil {
+		return gp.walFailed(err)
+	}
+	return gp.walFailed(gp.wal.Append(rec))
+}
+
+// walFailed keeps the first log failure for WALErr and returns err. Caller
+// holds the lock.
+func (gp *GuardianPool) walFailed(err error) error {
+	if err != nil && gp.walErr == nil {
+		gp.walErr = fmt.Errorf("wal: %w", err)
+	}
+	return err
+}
+
+// compactWAL drops removed txs from the log. Caller holds the lock.
+func (gp *GuardianPool) compactWAL() error {
+	if gp.wal == nil {
+		return errors.New("pool has no WAL")
+	}
+	var live []mevwal.Record
+	for _, tx := range gp.txs {
+		rec, err := gp.sealRecord(walAdd, &walEntry{Tx: tx})
+		if err != nil {
+			return err
+		}
+		live = append(live, rec)
+	}
+	return gp.wal.Compact(live)
+}
+
+// sealRecord encrypts an entry as nonce || AES-GCM(json), with the record
+// type as associated data.
+func (gp *GuardianPool) sealRecord(typ byte, entry *walEntry) (mevwal.Record, error) {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return mevwal.Record{}, err
+	}
+	aesGCM, err := newGCM(gp.storageKey)
+	if err != nil {
+		return mevwal.Record{}, err
+	}
+	nonce := make([]byte, aesGCM.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return mevwal.Record{}, err
+	}
+	return mevwal.Record{Type: typ, Data: aesGCM.Seal(nonce, nonce, data, []byte{typ})}, nil
+}
+
+// openRecord decrypts a record written by sealRecord.
+func (gp *GuardianPool) openRecord(rec mevwal.Record) (*walEntry, error) {
+	aesGCM, err := newGCM(gp.storageKey)
+	if err != nil {
+		return nil, err
+	}
+	if len(rec.Data) < aesGCM.NonceSize() {
+		return nil, errors.New("record too short")
+	}
+	nonce, ciphertext := rec.Data[:aesGCM.NonceSize()], rec.Data[aesGCM.NonceSize():]
+	data, err := aesGCM.Open(nil, nonce, ciphertext, []byte{rec.Type})
+	if err != nil {
+		return nil, errors.New("cannot decrypt record; wrong storage key?")
+	}
+	var entry walEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, err
+	}
+	if rec.Type == walAdd && entry.Tx == nil {
+		return nil, errors.New("add record without a tx")
+	}
+	return &entry, nil
+}
@@ -0,0 +1,87 @@
+// This file contains tests for WAL recovery of the sealed pool and refusing
+// submissions after a WAL failure.
+
+package mevgrandmothersguardia
+
+import (
+	"bytes"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mellis0303/mev-vem/pkg/mev-wal"
+)
+
+func TestWALRecoversSealedPool(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "guardia.wal")
+	storageKey := bytes.Repeat([]byte{7}, 32)
+
+	engine := NewMEVGuardianEngine()
+	engine.AddProtectedSender("0xAlice")
+	if err := engine.OpenWAL(path, storageKey, mevwal.Options{}); err != nil {
+		t.Fatalf("OpenWAL: %v", err)
+	}
+	sealed, key := seal(t, &Tx{Hash: "tx1", Sender: "0xAlice", Receiver: "0xSecretDEX", GasPrice: big.NewInt(1), Value: big.NewInt(1)})
+	engine.SubmitTransaction(sealed)
+	engine.SubmitTransaction(&Tx{Hash: "tx2", Sender: "0xBob", Receiver: "0xDEX", GasPrice: big.NewInt(1), Value: big.NewInt(1)})
+	engine.SubmitTransaction(&Tx{Hash: "tx3", Sender: "0xBob", Receiver: "0xDEX", GasPrice: big.NewInt(1), Value: big.NewInt(1)})
+	if n := engine.RemoveTransactions("tx3"); n != 1 {
+		t.Errorf("RemoveTransactions = %d", n)
+	}
+	engine.CloseWAL()
+
+	data, _ := os.ReadFile(path)
+	if bytes.Contains(data, []byte("0xSecretDEX")) || bytes.Contains(data, []byte("0xBob")) {
+		t.Errorf("log must be encrypted at rest")
+	}
+
+	if err := NewMEVGuardianEngine().OpenWAL(path, bytes.Repeat([]byte{8}, 32), mevwal.Options{}); err == nil {
+		t.Errorf("expected OpenWAL to fail with the wrong storage key")
+	}
+
+	recovered := NewMEVGuardianEngine()
+	if err := recovered.OpenWAL(path, storageKey, mevwal.Options{}); err != nil {
+		t.Fatalf("OpenWAL after restart: %v", err)
+	}
+	defer recovered.CloseWAL()
+	if len(recovered.pool.txs) != 2 || recovered.pool.txs["tx3"] != nil {
+		t.Fatalf("recovered %d txs, want tx1 and tx2", len(recovered.pool.txs))
+	}
+	// the key was never logged, so Alice releases it again
+	recovered.AdvanceBlock(recovered.pool.txs["tx1"].RevealBlock)
+	if _, err := recovered.Reveal("tx1"); !errors.Is(err, ErrKeyNotReleased) {
+		t.Fatalf("expected the key to be lost across a restart, got %v", err)
+	}
+	tx, err := recovered.RevealKey("tx1", key)
+	if err != nil {
+		t.Fatalf("RevealKey after restart: %v", err)
+	}
+	if tx.Receiver != "0xSecretDEX" {
+		t.Errorf("revealed receiver = %q", tx.Receiver)
+	}
+}
+
+func TestWALFailureRefusesSubmissions(t *testing.T) {
+	engine := NewMEVGuardianEngine()
+	if err := engine.OpenWAL(filepath.Join(t.TempDir(), "guardia.wal"), bytes.Repeat([]byte{7}, 32), mevwal.Options{}); err != nil {
+		t.Fatalf("OpenWAL: %v", err)
+	}
+	engine.SubmitTransaction(&Tx{Hash: "tx1", Sender: "0xBob", Receiver: "0xDEX", GasPrice: big.NewInt(1), Value: big.NewInt(1)})
+	if err := engine.WALErr(); err != nil {
+		t.Fatalf("WALErr = %v on a healthy log", err)
+	}
+
+	// the removal cannot be logged; it is kept for WALErr
+	engine.pool.wal.Close()
+	if n := engine.RemoveTransactions("tx1"); n != 1 {
+		t.Fatalf("RemoveTransactions = %d", n)
+	}
+	if err := engine.WALErr(); !errors.Is(err, mevwal.ErrClosed) {
+		t.Errorf("WALErr = %v, want ErrClosed", err)
+	}
+	if err := engine.SubmitTransaction(&Tx{Hash: "tx2", Sender: "0xBob", Receiver: "0xDEX", GasPrice: big.NewInt(1), Value: big.NewInt(1)}); err == nil {
+		t.Errorf("expected submissions to be refused once the log has failed")
+	}
+}
@@ -0,0 +1,143 @@
+package mevgrandmothersguardia
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// RebateTier = the share paid back once a tx's backrun value reaches MinValue.
+type RebateTier struct {
+	MinValue *big.Int
+	ShareBps int64
+}
+
+// RebatePolicy decides how much of a bundle's realized profit goes back to
+// the users whose txs created it. Shares are in basis points of each tx's
+// part of the profit.
+type RebatePolicy struct {
+	ShareBps int64        // base share
+	Tiers    []RebateTier // larger backruns may earn more; the highest tier reached wins
+}
+
+// DefaultRebatePolicy pays back 90% of what each user tx earned.
+var DefaultRebatePolicy = RebatePolicy{ShareBps: 9000}
+
+func (p RebatePolicy) validate() error {
+	if p.ShareBps < 0 || p.ShareBps > 10000 {
+		return fmt.Errorf("rebate share %d bps out of range", p.ShareBps)
+	}
+	for _, t := range p.Tiers {
+		if t.MinValue == nil || t.MinValue.Sign() < 0 {
+			return errors.New("rebate tier needs a non-negative minimum value")
+		}
+		if t.ShareBps < 0 || t.ShareBps > 10000 {
+			return fmt.Errorf("rebate tier share %d bps out of range", t.ShareBps)
+		}
+	}
+	return nil
+}
+
+// share returns the basis points paid back for a tx worth value.
+func (p RebatePolicy) share(value *big.Int) int64 {
+	bps := p.ShareBps
+	var best *big.Int
+	for _, t := range p.Tiers {
+		if value.Cmp(t.MinValue) >= 0 && (best == nil || t.MinValue.Cmp(best) > 0) {
+			best, bps = t.MinValue, t.ShareBps
+		}
+	}
+	return bps
+}
+
+// BundleOutcome = what a landed bundle actually earned and the user txs it
+// was built around.
+type BundleOutcome struct {
+	ID           string
+	Block        uint64
+	Profit       *big.Int            // realized, after gas and builder payment
+	Txs          []*Tx               // user txs the bundle backran
+	BackrunValue map[string]*big.Int // by tx hash; txs without one are weighted by Value
+}
+
+// Rebate = a user's credited part of one bundle's profit.
+type Rebate struct {
+	Address string
+	TxHash  string
+	Bundle  string
+	Block   uint64
+	Amount  *big.Int
+}
+
+// Rebates splits a bundle's profit across its user txs by the value each
+// created, then pays back the policy's share of each part. Rounding dust
+// stays with the bundle.
+func (p RebatePolicy) Rebates(outcome *BundleOutcome) ([]Rebate, error) {
+	if err := p.validate(); err != nil {
+		return nil, err
+	}
+	if outcome.Profit == nil || outcome.Profit.Sign() <= 0 || len(outcome.Txs) == 0 {
+		return nil, nil
+	}
+
+	weights := make([]*big.Int, len(outcome.Txs))
+	total := new(big.Int)
+	for i, tx := range outcome.Txs {
+		w := outcome.BackrunValue[tx.Hash]
+		if w == nil {
+			w = tx.Value
+		}
+		if w == nil {
+			w = new(big.Int)
+		}
+		if w.Sign() < 0 {
+			return nil, fmt.Errorf("tx %s has a negative backrun value", tx.Hash)
+		}
+		weights[i] = w
+		total.Add(total, w)
+	}
+	if total.Sign() == 0 {
+		// nothing measured: split evenly
+		for i := range weights {
+			weights[i] = big.NewInt(1)
+		}
+		total.SetInt64(int64(len(weights)))
+	}
+
+	var rebates []Rebate
+	for i, tx := range outcome.Txs {
+		amount := new(big.Int).Mul(outcome.Profit, weights[i])
+		amount.Mul(amount, big.NewInt(p.share(weights[i])))
+		amount.Quo(amount, new(big.Int).Mul(total, big.NewInt(10000)))
+		if amount.Sign() == 0 {
+			continue
+		}
+		rebates = append(rebates, Rebate{Address: tx.Sender, TxHash: tx.Hash, Bundle: outcome.ID, Block: outcome.Block, Amount: amount})
+	}
+	return rebates, nil
+}
+
+// SetRebatePolicy sets the policy used by DistributeProfits.
+func (mg *MEVGuardianEngine) SetRebatePolicy(p RebatePolicy) error {
+	if err := p.validate(); err != nil {
+		return err
+	}
+	mg.mutex.Lock()
+	defer mg.mutex.Unlock()
+	mg.policy = p
+	return nil
+}
+
+// SetLedger replaces the in-memory ledger, e.g. with one from OpenLedger.
+func (mg *MEVGuardianEngine) SetLedger(l *Ledger) {
+	mg.mutex.Lock()
+	defer mg.mutex.Unlock()
+	mg.ledger = l
+}
+
+// Ledger returns the rebate ledger.
+func (mg *MEVGuardianEngine) Ledger() *Ledger {
+	mg.mutex.Lock()
+	defer mg.mutex.Unlock()
+	return mg.ledger
+}
@@ -0,0 +1,47 @@
+// This file contains tests for rebate policies and their accrual per address.
+
+package mevgrandmothersguardia
+
+import (
+	"math/big"
+	"testing"
+)
+
+func TestRebatesFollowBackrunValue(t *testing.T) {
+	engine := NewMEVGuardianEngine()
+	err := engine.SetRebatePolicy(RebatePolicy{
+		ShareBps: 5000,
+		Tiers:    []RebateTier{{MinValue: big.NewInt(500), ShareBps: 8000}},
+	})
+	if err != nil {
+		t.Fatalf("SetRebatePolicy: %v", err)
+	}
+
+	outcome := &BundleOutcome{
+		ID:     "b1",
+		Block:  10,
+		Profit: big.NewInt(1000),
+		Txs:    []*Tx{{Hash: "t1", Sender: "0xAlice"}, {Hash: "t2", Sender: "0xBob"}},
+		BackrunValue: map[string]*big.Int{
+			"t1": big.NewInt(600), // 600/1000 of the profit, 80% tier
+			"t2": big.NewInt(400), // 400/1000 of the profit, 50% base
+		},
+	}
+	rebates, err := engine.DistributeProfits(outcome)
+	if err != nil {
+		t.Fatalf("DistributeProfits: %v", err)
+	}
+	if len(rebates) != 2 || rebates[0].Amount.Int64() != 480 || rebates[1].Amount.Int64() != 200 {
+		t.Fatalf("unexpected rebates %+v", rebates)
+	}
+	if _, err := engine.DistributeProfits(outcome); err == nil {
+		t.Errorf("expected a repeated bundle to be refused")
+	}
+
+	outcome.ID = "b2"
+	engine.DistributeProfits(outcome)
+	alice := engine.Ledger().Account("0xAlice")
+	if alice.Accrued.Int64() != 960 || len(alice.History) != 2 || alice.History[1].Bundle != "b2" {
+		t.Errorf("rebates must accumulate per address: %+v", alice)
+	}
+}
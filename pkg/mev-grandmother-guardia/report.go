@@ -0,0 +1,120 @@
+package mevgrandmothersguardia
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"strconv"
+	"time"
+)
+
+// ReportLine = one rebate credited to an address.
+type ReportLine struct {
+	Bundle string   `json:"bundle"`
+	Block  uint64   `json:"block"`
+	TxHash string   `json:"txHash,omitempty"`
+	Amount *big.Int `json:"amount"`
+}
+
+// AddressReport = an address's rebates in a report's block range.
+type AddressReport struct {
+	Address string       `json:"address"`
+	Rebates []ReportLine `json:"rebates"`
+	Total   *big.Int     `json:"total"`
+	Pending *big.Int     `json:"pending"` // unclaimed across all time, as of Generated
+}
+
+// Report = the rebates accrued over a range of blocks.
+type Report struct {
+	Epoch     uint64          `json:"epoch"`
+	FromBlock uint64          `json:"fromBlock"`
+	ToBlock   uint64          `json:"toBlock"` // inclusive
+	Generated time.Time       `json:"generated"`
+	Addresses []AddressReport `json:"addresses"`
+	Bundles   int             `json:"bundles"`
+	Total     *big.Int        `json:"total"`
+}
+
+// EpochBlocks returns the block range of an epoch of the given length.
+func EpochBlocks(epoch, length uint64) (from, to uint64) {
+	return epoch * length, (epoch+1)*length - 1
+}
+
+// Report lists every rebate accrued in blocks from through to, by address.
+// Addresses without rebates in the range are left out.
+func (l *Ledger) Report(epoch, from, to uint64) (*Report, error) {
+	if from > to {
+		return nil, fmt.Errorf("block range %d-%d is empty", from, to)
+	}
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	r := &Report{Epoch: epoch, FromBlock: from, ToBlock: to, Generated: time.Now(), Addresses: []AddressReport{}, Total: new(big.Int)}
+	bundles := map[string]bool{}
+	for _, addr := range l.addresses() {
+		a := l.accounts[addr]
+		ar := AddressReport{Address: addr, Total: new(big.Int), Pending: a.Pending()}
+		for _, e := range a.History {
+			if e.Kind != EntryAccrual || e.Block < from || e.Block > to {
+				continue
+			}
+			ar.Rebates = append(ar.Rebates, ReportLine{Bundle: e.Bundle, Block: e.Block, TxHash: e.TxHash, Amount: new(big.Int).Set(e.Amount)})
+			ar.Total.Add(ar.Total, e.Amount)
+			bundles[e.Bundle] = true
+		}
+		if len(ar.Rebates) == 0 {
+			continue
+		}
+		r.Addresses = append(r.Addresses, ar)
+		r.Total.Add(r.Total, ar.Total)
+	}
+	r.Bundles = len(bundles)
+	return r, nil
+}
+
+// WriteJSON writes the report as indented JSON.
+func (r *Report) WriteJSON(w io.Writer) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+// WriteCSV writes one row per rebate, followed by a total row per address and
+// a grand total row. Amounts are decimal wei.
+func (r *Report) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	epoch := strconv.FormatUint(r.Epoch, 10)
+	from := strconv.FormatUint(r.FromBlock, 10)
+	to := strconv.FormatUint(r.ToBlock, 10)
+	rows := [][]string{{"epoch", "from_block", "to_block", "kind", "address", "bundle", "block", "tx_hash", "amount"}}
+	for _, a := range r.Addresses {
+		for _, line := range a.Rebates {
+			rows = append(rows, []string{epoch, from, to, "rebate", a.Address, line.Bundle, strconv.FormatUint(line.Block, 10), line.TxHash, line.Amount.String()})
+		}
+	}
+	for _, a := range r.Addresses {
+		rows = append(rows, []string{epoch, from, to, "address_total", a.Address, "", "", "", a.Total.String()})
+	}
+	rows = append(rows, []string{epoch, from, to, "total", "", "", "", "", r.Total.String()})
+	if err := cw.WriteAll(rows); err != nil {
+		return err
+	}
+	return cw.Error()
+}
+
+// Write writes the report in format, "json" or "csv".
+func (r *Report) Write(w io.Writer, format string) error {
+	switch format {
+	case "json":
+		return r.WriteJSON(w)
+	case "csv":
+		return r.WriteCSV(w)
+	}
+	return errors.New("report format must be json or csv")
+}
@@ -0,0 +1,88 @@
+// This file contains tests for epoch rebate reports and their JSON and CSV export.
+
+package mevgrandmothersguardia
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"math/big"
+	"strings"
+	"testing"
+)
+
+func TestEpochReport(t *testing.T) {
+	ledger := NewLedger()
+	accrue := func(bundle string, block uint64, rebates ...Rebate) {
+		t.Helper()
+		for i := range rebates {
+			rebates[i].Bundle, rebates[i].Block = bundle, block
+		}
+		if err := ledger.Accrue(rebates); err != nil {
+			t.Fatalf("Accrue: %v", err)
+		}
+	}
+	accrue("b1", 100, Rebate{Address: "0xAlice", TxHash: "t1", Amount: big.NewInt(300)}, Rebate{Address: "0xBob", TxHash: "t2", Amount: big.NewInt(200)})
+	accrue("b2", 199, Rebate{Address: "0xAlice", TxHash: "t3", Amount: big.NewInt(50)})
+	accrue("b3", 200, Rebate{Address: "0xCarol", TxHash: "t4", Amount: big.NewInt(999)})
+	if err := ledger.Claim("0xAlice", big.NewInt(100)); err != nil {
+		t.Fatalf("Claim: %v", err)
+	}
+
+	from, to := EpochBlocks(1, 100)
+	if from != 100 || to != 199 {
+		t.Fatalf("epoch 1 spans %d-%d", from, to)
+	}
+	r, err := ledger.Report(1, from, to)
+	if err != nil {
+		t.Fatalf("Report: %v", err)
+	}
+	if len(r.Addresses) != 2 || r.Bundles != 2 || r.Total.Cmp(big.NewInt(550)) != 0 {
+		t.Fatalf("unexpected report: %d addresses, %d bundles, total %s", len(r.Addresses), r.Bundles, r.Total)
+	}
+	alice := r.Addresses[0]
+	if alice.Address != "0xAlice" || len(alice.Rebates) != 2 || alice.Total.Cmp(big.NewInt(350)) != 0 || alice.Pending.Cmp(big.NewInt(250)) != 0 {
+		t.Errorf("unexpected line for Alice: %+v", alice)
+	}
+	if alice.Rebates[1].Bundle != "b2" || alice.Rebates[1].Block != 199 || alice.Rebates[1].TxHash != "t3" {
+		t.Errorf("rebate lost its source: %+v", alice.Rebates[1])
+	}
+
+	var buf bytes.Buffer
+	if err := r.Write(&buf, "json"); err != nil {
+		t.Fatalf("WriteJSON: %v", err)
+	}
+	var decoded Report
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatalf("report JSON: %v", err)
+	}
+	if decoded.Total.Cmp(r.Total) != 0 || decoded.FromBlock != 100 || decoded.ToBlock != 199 || len(decoded.Addresses) != 2 {
+		t.Errorf("report JSON does not round-trip: %s", buf.String())
+	}
+
+	buf.Reset()
+	if err := r.Write(&buf, "csv"); err != nil {
+		t.Fatalf("WriteCSV: %v", err)
+	}
+	rows, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatalf("report CSV: %v", err)
+	}
+	// header, 3 rebates, 2 address totals, grand total
+	if len(rows) != 7 {
+		t.Fatalf("expected 7 CSV rows, got %d", len(rows))
+	}
+	if strings.Join(rows[1], ",") != "1,100,199,rebate,0xAlice,b1,100,t1,300" {
+		t.Errorf("unexpected rebate row %v", rows[1])
+	}
+	if last := rows[len(rows)-1]; last[3] != "total" || last[8] != "550" {
+		t.Errorf("unexpected total row %v", last)
+	}
+
+	if err := r.Write(&buf, "xml"); err == nil {
+		t.Errorf("expected an unknown format to be refused")
+	}
+	if _, err := ledger.Report(0, 10, 5); err == nil {
+		t.Errorf("expected an empty range to be refused")
+	}
+}
@@ -0,0 +1,166 @@
+package mevgrandmothersguardia
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Sandwich = two attacker swaps around a protected sender's swap: the front
+// trades in the victim's direction to push the price, the back unwinds it.
+type Sandwich struct {
+	Front   *Tx
+	Victim  *Tx
+	Back    *Tx
+	Block   uint64   // observed block, 0 for a candidate bundle
+	Reasons []string // what matched
+}
+
+func (s Sandwich) String() string {
+	return fmt.Sprintf("sandwich of %s (%s) by %s/%s: %s", s.Victim.Hash, s.Victim.Sender, s.Front.Sender, s.Back.Sender, strings.Join(s.Reasons, ", "))
+}
+
+// LinkAddresses records that addrs are controlled by the same party, e.g. bot
+// EOAs funded from one wallet. A front and back from linked addresses count
+// as one attacker.
+func (mg *MEVGuardianEngine) LinkAddresses(addrs ...string) {
+	mg.mutex.Lock()
+	defer mg.mutex.Unlock()
+	mg.link(addrs...)
+}
+
+// link joins addrs into one group. Caller holds mg.mutex.
+func (mg *MEVGuardianEngine) link(addrs ...string) {
+	if len(addrs) == 0 {
+		return
+	}
+	root := mg.root(addrs[0])
+	for _, addr := range addrs[1:] {
+		if r := mg.root(addr); r != root {
+			mg.links[r] = root
+		}
+	}
+}
+
+// root returns the representative of addr's group. Caller holds mg.mutex.
+func (mg *MEVGuardianEngine) root(addr string) string {
+	for {
+		parent, ok := mg.links[addr]
+		if !ok || parent == addr {
+			return addr
+		}
+		// path halving keeps later lookups short
+		if grand, ok := mg.links[parent]; ok {
+			mg.links[addr] = grand
+		}
+		addr = parent
+	}
+}
+
+func isSwap(tx *Tx) bool {
+	return tx.TokenIn != "" && tx.TokenOut != ""
+}
+
+// sameMarket compares pools when both are known, token pairs otherwise.
+func sameMarket(a, b *Tx) bool {
+	if a.Pool != "" && b.Pool != "" {
+		return a.Pool == b.Pool
+	}
+	return (a.TokenIn == b.TokenIn && a.TokenOut == b.TokenOut) ||
+		(a.TokenIn == b.TokenOut && a.TokenOut == b.TokenIn)
+}
+
+func sameDirection(a, b *Tx) bool {
+	return a.TokenIn == b.TokenIn && a.TokenOut == b.TokenOut
+}
+
+func oppositeDirection(a, b *Tx) bool {
+	return a.TokenIn == b.TokenOut && a.TokenOut == b.TokenIn
+}
+
+// DetectSandwiches finds attacker-victim-attacker patterns around protected
+// senders' swaps in an ordered list of txs. For each victim it reports the
+// closest front and back that trade the same market in opposite directions
+// from the same or linked addresses.
+func (mg *MEVGuardianEngine) DetectSandwiches(txs []*Tx) []Sandwich {
+	mg.mutex.Lock()
+	defer mg.mutex.Unlock()
+	return mg.detect(txs)
+}
+
+// detect implements DetectSandwiches. Caller holds mg.mutex.
+func (mg *MEVGuardianEngine) detect(txs []*Tx) []Sandwich {
+	var found []Sandwich
+	for v, victim := range txs {
+		if mg.level(victim.Sender) < LevelMonitor || !isSwap(victim) {
+			continue
+		}
+	search:
+		for i := v - 1; i >= 0; i-- {
+			front := txs[i]
+			if !isSwap(front) || !sameMarket(front, victim) || !sameDirection(front, victim) {
+				continue
+			}
+			if mg.root(front.Sender) == mg.root(victim.Sender) {
+				continue
+			}
+			for j := v + 1; j < len(txs); j++ {
+				back := txs[j]
+				if !isSwap(back) || !sameMarket(back, victim) || !oppositeDirection(back, front) {
+					continue
+				}
+				if mg.root(back.Sender) != mg.root(front.Sender) {
+					continue
+				}
+				reasons := []string{"same token pair", "opposite directions"}
+				if front.Pool != "" && front.Pool == victim.Pool && back.Pool == victim.Pool {
+					reasons[0] = "same pool"
+				}
+				if front.Sender == back.Sender {
+					reasons = append(reasons, "same attacker")
+				} else {
+					reasons = append(reasons, "linked attacker")
+				}
+				found = append(found, Sandwich{Front: front, Victim: victim, Back: back, Reasons: reasons})
+				break search
+			}
+		}
+	}
+	return found
+}
+
+// FilterBundles drops candidate bundles that sandwich a protected sender and
+// returns the rest with what was found in the dropped ones.
+func (mg *MEVGuardianEngine) FilterBundles(bundles [][]*Tx) ([][]*Tx, []Sandwich) {
+	mg.mutex.Lock()
+	defer mg.mutex.Unlock()
+	var safe [][]*Tx
+	var flagged []Sandwich
+	for _, bundle := range bundles {
+		if found := mg.detect(bundle); len(found) > 0 {
+			flagged = append(flagged, found...)
+			continue
+		}
+		safe = append(safe, bundle)
+	}
+	return safe, flagged
+}
+
+// ObserveBlock checks a mined block's txs, in block order, for sandwiches of
+// protected senders. Findings are kept for Flagged.
+func (mg *MEVGuardianEngine) ObserveBlock(block uint64, txs []*Tx) []Sandwich {
+	mg.mutex.Lock()
+	defer mg.mutex.Unlock()
+	found := mg.detect(txs)
+	for i := range found {
+		found[i].Block = block
+	}
+	mg.flagged = append(mg.flagged, found...)
+	return found
+}
+
+// Flagged returns the sandwiches seen in observed blocks, oldest first.
+func (mg *MEVGuardianEngine) Flagged() []Sandwich {
+	mg.mutex.Lock()
+	defer mg.mutex.Unlock()
+	return append([]Sandwich(nil), mg.flagged...)
+}
@@ -0,0 +1,79 @@
+// This file contains tests for sandwich detection in bundles and observed blocks,
+// including linked attacker addresses.
+
+package mevgrandmothersguardia
+
+import (
+	"math/big"
+	"testing"
+)
+
+func swap(hash, sender, pool, in, out string) *Tx {
+	return &Tx{Hash: hash, Sender: sender, Receiver: "0xRouter", Pool: pool, TokenIn: in, TokenOut: out, GasPrice: big.NewInt(1), Value: big.NewInt(1)}
+}
+
+func TestOptimizeBundlesDropsSandwichLegs(t *testing.T) {
+	engine := NewMEVGuardianEngine()
+	engine.AddProtectedSender("0xAlice")
+
+	txs := []*Tx{
+		swap("front", "0xBot", "0xPool", "WETH", "USDC"),
+		swap("victim", "0xAlice", "0xPool", "WETH", "USDC"),
+		swap("other", "0xBob", "0xPool", "USDC", "WETH"),
+		swap("back", "0xBot", "0xPool", "USDC", "WETH"),
+		swap("victim", "0xAlice", "0xPool", "WETH", "USDC"), // duplicate
+	}
+	bundle := engine.OptimizeBundles(txs)
+	var got []string
+	for _, tx := range bundle {
+		got = append(got, tx.Hash)
+	}
+	if len(got) != 2 || got[0] != "victim" || got[1] != "other" {
+		t.Fatalf("OptimizeBundles = %v, want [victim other]", got)
+	}
+
+	// Bob's txs share a receiver with Alice's; that alone is not an attack
+	plain := []*Tx{
+		swap("b1", "0xBob", "0xPool", "WETH", "USDC"),
+		swap("a1", "0xAlice", "0xPool", "WETH", "USDC"),
+		swap("b2", "0xBob", "0xOtherPool", "USDC", "WETH"),
+	}
+	if len(engine.OptimizeBundles(plain)) != 3 {
+		t.Errorf("unrelated txs must not be removed")
+	}
+}
+
+func TestLinkedAttackersAndObservedBlocks(t *testing.T) {
+	engine := NewMEVGuardianEngine()
+	engine.AddProtectedSender("0xAlice")
+
+	bundle := []*Tx{
+		swap("front", "0xBot1", "", "WETH", "USDC"),
+		swap("victim", "0xAlice", "", "WETH", "USDC"),
+		swap("back", "0xBot2", "", "USDC", "WETH"),
+	}
+	if safe, flagged := engine.FilterBundles([][]*Tx{bundle}); len(safe) != 1 || len(flagged) != 0 {
+		t.Fatalf("unlinked senders should not be flagged")
+	}
+
+	engine.LinkAddresses("0xBot1", "0xFunder")
+	engine.LinkAddresses("0xBot2", "0xFunder")
+	safe, flagged := engine.FilterBundles([][]*Tx{bundle, {swap("ok", "0xBob", "", "WETH", "USDC")}})
+	if len(safe) != 1 || len(flagged) != 1 || flagged[0].Victim.Hash != "victim" {
+		t.Fatalf("expected the linked sandwich bundle to be dropped (safe %d, flagged %d)", len(safe), len(flagged))
+	}
+
+	block := []*Tx{
+		swap("f", "0xEve", "0xPool", "DAI", "WETH"),
+		swap("v", "0xAlice", "0xPool", "DAI", "WETH"),
+		swap("b", "0xEve2", "0xPool", "WETH", "DAI"),
+	}
+	if found := engine.ObserveBlock(100, block); len(found) != 0 {
+		t.Fatalf("unlinked block should not be flagged yet")
+	}
+	engine.LinkAddresses("0xEve", "0xEve2")
+	found := engine.ObserveBlock(101, block)
+	if len(found) != 1 || found[0].Block != 101 || len(engine.Flagged()) != 1 {
+		t.Fatalf("expected one flagged sandwich in block 101, got %v", found)
+	}
+}
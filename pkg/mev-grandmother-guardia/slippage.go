@@ -0,0 +1,183 @@
+package mevgrandmothersguardia
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"time"
+
+	"github.com/mellis0303/mev-vem/pkg/mev-amm"
+)
+
+// DefaultToleranceBps = the execution loss a protected sender accepts unless
+// they registered their own.
+const DefaultToleranceBps = 50
+
+// ErrExecutionLoss is returned when a bundle costs a protected sender more
+// than their tolerance.
+var ErrExecutionLoss = errors.New("bundle worsens a protected sender's execution")
+
+// ErrUnsimulated is returned when a bundle holds a protected swap that cannot
+// be simulated, e.g. on a pool with no snapshot; its execution is unchecked.
+var ErrUnsimulated = errors.New("bundle holds a protected swap that cannot be simulated")
+
+// ExecutionCheck = one protected swap simulated alone and inside a bundle.
+type ExecutionCheck struct {
+	TxHash       string   `json:"txHash"`
+	Sender       string   `json:"sender"`
+	Pool         string   `json:"pool"`
+	Expected     *big.Int `json:"expected"` // output alone against the current reserves
+	Bundled      *big.Int `json:"bundled"`  // output at its place in the bundle, 0 if it fails there
+	LossBps      int64    `json:"lossBps"`  // negative when the bundle improves it
+	ToleranceBps int64    `json:"toleranceBps"`
+	Passed       bool     `json:"passed"`
+}
+
+// ExecutionReport = the audit record of one bundle approval.
+type ExecutionReport struct {
+	Time     time.Time        `json:"time"`
+	Bundle   []string         `json:"bundle"` // tx hashes in order
+	Checks   []ExecutionCheck `json:"checks"`
+	Skipped  []string         `json:"skipped,omitempty"` // protected swaps that could not be simulated
+	Approved bool             `json:"approved"`
+}
+
+// SetPool sets the reserves bundles are simulated against for a pool,
+// replacing any earlier snapshot of it.
+func (mg *MEVGuardianEngine) SetPool(p *mevamm.Pool) {
+	mg.mutex.Lock()
+	defer mg.mutex.Unlock()
+	mg.pools[p.Address] = p.Clone()
+}
+
+// SetTolerance registers the largest execution loss, in basis points, sender
+// accepts from a bundle.
+func (mg *MEVGuardianEngine) SetTolerance(sender string, bps int64) error {
+	if bps < 0 || bps > 10000 {
+		return fmt.Errorf("tolerance %d bps out of range", bps)
+	}
+	mg.mutex.Lock()
+	defer mg.mutex.Unlock()
+	mg.tolerances[sender] = bps
+	return nil
+}
+
+// SetAuditLog writes every execution report to w as a line of JSON.
+func (mg *MEVGuardianEngine) SetAuditLog(w io.Writer) {
+	mg.mutex.Lock()
+	defer mg.mutex.Unlock()
+	mg.audit = w
+}
+
+// simulable reports whether tx is a swap on a known pool.
+func simulable(tx *Tx, pools map[string]*mevamm.Pool) bool {
+	p, ok := pools[tx.Pool]
+	return ok && isSwap(tx) && tx.AmountIn != nil && tx.AmountIn.Sign() > 0 && p.Has(tx.TokenIn) && p.Has(tx.TokenOut)
+}
+
+// ApproveBundle simulates each protected sender's swap alone and at its place
+// in the bundle, against the pool snapshots from SetPool. The bundle is
+// rejected with ErrExecutionLoss if any of them loses more than its sender's
+// tolerance, and with ErrUnsimulated if any of them cannot be simulated.
+// Every report is written to the audit log, approved or not.
+func (mg *MEVGuardianEngine) ApproveBundle(bundle []*Tx) (*ExecutionReport, error) {
+	mg.mutex.Lock()
+	pools := make(map[string]*mevamm.Pool, len(mg.pools))
+	for addr, p := range mg.pools {
+		pools[addr] = p.Clone()
+	}
+	protected := map[string]bool{}
+	tolerance := map[string]int64{}
+	for _, tx := range bundle {
+		if mg.level(tx.Sender) >= LevelMonitor {
+			protected[tx.Hash] = true
+			bps, ok := mg.tolerances[tx.Sender]
+			if !ok {
+				bps = DefaultToleranceBps
+			}
+			tolerance[tx.Hash] = bps
+		}
+	}
+	mg.mutex.Unlock()
+
+	report := &ExecutionReport{Time: time.Now(), Approved: true}
+	for _, tx := range bundle {
+		report.Bundle = append(report.Bundle, tx.Hash)
+	}
+
+	// state moves through the bundle; expected outputs are quoted from the start
+	state := make(map[string]*mevamm.Pool, len(pools))
+	for addr, p := range pools {
+		state[addr] = p.Clone()
+	}
+	for _, tx := range bundle {
+		if !simulable(tx, pools) {
+			if protected[tx.Hash] && isSwap(tx) {
+				report.Skipped = append(report.Skipped, tx.Hash)
+				report.Approved = false
+			}
+			continue
+		}
+		bundled, err := state[tx.Pool].Swap(tx.TokenIn, tx.AmountIn)
+		if err != nil {
+			// the tx reverts and leaves the pool alone
+			bundled = new(big.Int)
+		}
+		if !protected[tx.Hash] {
+			continue
+		}
+		expected, err := pools[tx.Pool].Quote(tx.TokenIn, tx.AmountIn)
+		if err != nil || expected.Sign() == 0 {
+			report.Skipped = append(report.Skipped, tx.Hash)
+			report.Approved = false
+			continue
+		}
+		loss := new(big.Int).Sub(expected, bundled)
+		loss.Mul(loss, big.NewInt(10000))
+		loss.Quo(loss, expected)
+		c := ExecutionCheck{
+			TxHash:       tx.Hash,
+			Sender:       tx.Sender,
+			Pool:         tx.Pool,
+			Expected:     expected,
+			Bundled:      bundled,
+			LossBps:      loss.Int64(),
+			ToleranceBps: tolerance[tx.Hash],
+		}
+		c.Passed = c.LossBps <= c.ToleranceBps
+		if !c.Passed {
+			report.Approved = false
+		}
+		report.Checks = append(report.Checks, c)
+	}
+
+	if err := mg.logReport(report); err != nil {
+		return report, err
+	}
+	if len(report.Skipped) > 0 {
+		return report, ErrUnsimulated
+	}
+	if !report.Approved {
+		return report, ErrExecutionLoss
+	}
+	return report, nil
+}
+
+// logReport appends report to the audit log, if there is one.
+func (mg *MEVGuardianEngine) logReport(report *ExecutionReport) error {
+	mg.mutex.Lock()
+	defer mg.mutex.Unlock()
+	if mg.audit == nil {
+		return nil
+	}
+	line, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+	if _, err := mg.audit.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("audit log: %w", err)
+	}
+	return nil
+}
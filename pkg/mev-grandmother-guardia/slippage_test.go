@@ -0,0 +1,92 @@
+// This file contains tests for the slippage guard on bundle execution.
+
+package mevgrandmothersguardia
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestApproveBundleExecutionLoss(t *testing.T) {
+	engine := NewMEVGuardianEngine()
+	engine.AddProtectedSender("0xAlice")
+	engine.SetPool(wethUSDC())
+	if err := engine.SetTolerance("0xAlice", 100); err != nil {
+		t.Fatalf("SetTolerance: %v", err)
+	}
+	if err := engine.SetTolerance("0xAlice", 10001); err == nil {
+		t.Errorf("expected a tolerance above 100%% to be refused")
+	}
+	var audit bytes.Buffer
+	engine.SetAuditLog(&audit)
+
+	swapTx := func(hash, sender, in, out string, amount int64) *Tx {
+		return &Tx{Hash: hash, Sender: sender, Pool: "0xPool", TokenIn: in, TokenOut: out, AmountIn: units(amount)}
+	}
+	alice := swapTx("alice", "0xAlice", "USDC", "WETH", 20000)
+
+	// a large buy ahead of Alice costs her far more than 1%
+	report, err := engine.ApproveBundle([]*Tx{swapTx("front", "0xBot", "USDC", "WETH", 200000), alice})
+	if !errors.Is(err, ErrExecutionLoss) || report.Approved {
+		t.Fatalf("expected the bundle to be rejected, got %v", err)
+	}
+	c := report.Checks[0]
+	if c.TxHash != "alice" || c.Passed || c.LossBps <= 100 || c.Bundled.Cmp(c.Expected) >= 0 {
+		t.Errorf("unexpected check: %+v", c)
+	}
+
+	// trading after her, or against her direction ahead of her, is fine
+	report, err = engine.ApproveBundle([]*Tx{alice, swapTx("back", "0xBot", "WETH", "USDC", 100)})
+	if err != nil || report.Checks[0].LossBps != 0 {
+		t.Fatalf("expected a backrun to pass untouched, got %v %+v", err, report.Checks)
+	}
+	report, err = engine.ApproveBundle([]*Tx{swapTx("sell", "0xBob", "WETH", "USDC", 10), alice})
+	if err != nil || report.Checks[0].LossBps >= 0 {
+		t.Fatalf("expected an opposite trade to improve Alice's output, got %v %+v", err, report.Checks)
+	}
+
+	// a protected swap on an unknown pool cannot be checked, so the bundle is refused
+	unknown := swapTx("other", "0xAlice", "USDC", "WETH", 1)
+	unknown.Pool = "0xElsewhere"
+	report, err = engine.ApproveBundle([]*Tx{unknown, swapTx("back", "0xBot", "WETH", "USDC", 100)})
+	if !errors.Is(err, ErrUnsimulated) || report.Approved || len(report.Skipped) != 1 || report.Skipped[0] != "other" {
+		t.Errorf("expected the bundle to be rejected over the skipped swap, got %v %+v", err, report)
+	}
+
+	// a protected transfer is not a swap and needs no simulation
+	transfer := &Tx{Hash: "pay", Sender: "0xAlice", Receiver: "0xBob", Value: units(1)}
+	if report, err = engine.ApproveBundle([]*Tx{transfer}); err != nil || len(report.Skipped) != 0 {
+		t.Errorf("expected a plain transfer to pass, got %v %+v", err, report)
+	}
+
+	// every report is audited, rejected or not
+	lines := strings.Split(strings.TrimSpace(audit.String()), "\n")
+	if len(lines) != 5 {
+		t.Fatalf("expected 5 audit lines, got %d", len(lines))
+	}
+	var first ExecutionReport
+	if err := json.Unmarshal([]byte(lines[0]), &first); err != nil {
+		t.Fatalf("audit line: %v", err)
+	}
+	if first.Approved || len(first.Checks) != 1 || first.Checks[0].Expected.Cmp(c.Expected) != 0 || strings.Join(first.Bundle, ",") != "front,alice" {
+		t.Errorf("unexpected audit record: %s", lines[0])
+	}
+
+	// the swap amount travels inside the sealed body
+	engine.AdvanceBlock(1)
+	sealed, key := seal(t, alice)
+	if err := engine.SubmitTransaction(sealed); err != nil {
+		t.Fatalf("SubmitTransaction: %v", err)
+	}
+	engine.AdvanceBlock(2)
+	revealed, err := engine.RevealKey("alice", key)
+	if err != nil {
+		t.Fatalf("RevealKey: %v", err)
+	}
+	if revealed.AmountIn.Cmp(units(20000)) != 0 {
+		t.Errorf("AmountIn lost in the sealed body: %v", revealed.AmountIn)
+	}
+}
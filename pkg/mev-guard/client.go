@@ -0,0 +1,62 @@
+package mevguard
+
+import (
+	"crypto/ecdh"
+	"encoding/hex"
+	"errors"
+)
+
+// ErrNoChainID is returned when an envelope would be sealed without a chain
+// ID; the pool only opens envelopes bound to its own chain.
+var ErrNoChainID = errors.New("chain ID is required")
+
+// Client seals transactions for a protected pool, so the operator never
+// receives plaintext orders.
+type Client struct {
+	PoolKey *ecdh.PublicKey
+	ChainID uint64
+}
+
+// NewClient initializes a client from the pool's hex X25519 public key and
+// the chain ID the pool binds envelopes to (see MEVMempool.ChainID).
+func NewClient(poolKey string, chainID uint64) (*Client, error) {
+	if chainID == 0 {
+		return nil, ErrNoChainID
+	}
+	pub, err := ParsePublicKey(poolKey)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{PoolKey: pub, ChainID: chainID}, nil
+}
+
+// Seal encrypts txData to the pool key (X25519 + HKDF-SHA256 + AES-GCM),
+// binding the sender, nonce, chain and target block, and returns the envelope
+// to pass to AddTransaction. ctx.ChainID defaults to the client's.
+func (c *Client) Seal(ctx TxContext, txData []byte) (string, error) {
+	if ctx.ChainID == 0 {
+		ctx.ChainID = c.ChainID
+	}
+	if ctx.ChainID == 0 {
+		return "", ErrNoChainID
+	}
+	return sealEnvelope(c.PoolKey, txData, ctx)
+}
+
+// SealForBlock encrypts txData to a committee's key for ctx.TargetBlock, for
+// submission with AddTransactionForBlock. ctx.ChainID must be set.
+func SealForBlock(committee *Committee, ctx TxContext, txData []byte) (string, error) {
+	if ctx.ChainID == 0 {
+		return "", ErrNoChainID
+	}
+	pub, err := committee.BlockKey(ctx.TargetBlock)
+	if err != nil {
+		return "", err
+	}
+	return sealEnvelope(pub, txData, ctx)
+}
+
+// PublicKeyHex formats a public key the way NewClient expects it.
+func PublicKeyHex(pub *ecdh.PublicKey) string {
+	return hex.EncodeToString(pub.Bytes())
+}
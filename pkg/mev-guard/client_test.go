@@ -0,0 +1,110 @@
+// This file contains tests for client-side sealing of transactions to the
+// pool's X25519 public key and the chain ID that clients and pools must both
+// be given.
+
+package mevguard
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"testing"
+)
+
+// testChainID is the chain test pools and clients bind envelopes to.
+const testChainID = 1
+
+func newTestPool(t *testing.T) *MEVMempool {
+	t.Helper()
+	key := make([]byte, 32)
+	rand.Read(key)
+	pool, err := NewMEVMempool(key, testChainID)
+	if err != nil {
+		t.Fatalf("NewMEVMempool: %v", err)
+	}
+	return pool
+}
+
+func TestClientSealRoundTrip(t *testing.T) {
+	pool := newTestPool(t)
+	client, err := NewClient(PublicKeyHex(pool.PublicKey()), testChainID)
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+
+	envelope, err := client.Seal(TxContext{From: "0xSender", Nonce: 1}, []byte(`{"to":"0xReceiver"}`))
+	if err != nil {
+		t.Fatalf("Seal: %v", err)
+	}
+	if err := pool.AddTransaction(envelope, 1, "0xSender"); err != nil {
+		t.Fatalf("AddTransaction: %v", err)
+	}
+	txs, err := pool.RetrieveTransactions()
+	if err != nil {
+		t.Fatalf("RetrieveTransactions: %v", err)
+	}
+	if len(txs) != 1 || txs[0].EncryptedData != `{"to":"0xReceiver"}` {
+		t.Errorf("unexpected txs %+v", txs)
+	}
+}
+
+func TestAddTransactionRejectsPlaintext(t *testing.T) {
+	pool := newTestPool(t)
+	for _, bad := range []string{
+		`{"to":"0xReceiver"}`,
+		base64.StdEncoding.EncodeToString([]byte(`{"to":"0xReceiver"}`)),
+		base64.StdEncoding.EncodeToString(make([]byte, 80)), // wrong version byte
+	} {
+		if err := pool.AddTransaction(bad, 1, "0xSender"); err == nil {
+			t.Errorf("expected %q to be rejected", bad)
+		}
+	}
+}
+
+func TestEnvelopeOnlyOpensWithPoolKey(t *testing.T) {
+	pool, other := newTestPool(t), newTestPool(t)
+	client, _ := NewClient(PublicKeyHex(pool.PublicKey()), testChainID)
+	ctx := TxContext{From: "0xSender", Nonce: 1}
+	envelope, _ := client.Seal(ctx, []byte("secret order"))
+	tx := &Transaction{EncryptedData: envelope, From: ctx.From, Nonce: ctx.Nonce, ChainID: testChainID}
+
+	if _, err := other.Decrypt(tx); err == nil {
+		t.Errorf("envelope opened with the wrong pool key")
+	}
+	if got, err := pool.Decrypt(tx); err != nil || string(got) != "secret order" {
+		t.Errorf("Decrypt = %q, %v", got, err)
+	}
+}
+
+func TestSealRequiresChainID(t *testing.T) {
+	pool := newTestPool(t)
+	if _, err := NewClient(PublicKeyHex(pool.PublicKey()), 0); err != ErrNoChainID {
+		t.Errorf("NewClient without a chain ID = %v, want ErrNoChainID", err)
+	}
+	if _, err := (&Client{PoolKey: pool.PublicKey()}).Seal(TxContext{From: "0xSender", Nonce: 1}, []byte("order")); err != ErrNoChainID {
+		t.Errorf("Seal without a chain ID = %v, want ErrNoChainID", err)
+	}
+	committee, _ := NewCommittee(2, 3)
+	if _, err := SealForBlock(committee, TxContext{From: "0xSender", Nonce: 1, TargetBlock: 1}, []byte("order")); err != ErrNoChainID {
+		t.Errorf("SealForBlock without a chain ID = %v, want ErrNoChainID", err)
+	}
+
+	if _, err := NewMEVMempool(randomKey(), 0); err != ErrNoChainID {
+		t.Errorf("NewMEVMempool without a chain ID = %v, want ErrNoChainID", err)
+	}
+	if _, err := NewThresholdMEVMempool(committee, 0); err != ErrNoChainID {
+		t.Errorf("NewThresholdMEVMempool without a chain ID = %v, want ErrNoChainID", err)
+	}
+
+	pool, err := NewMEVMempool(randomKey(), 10)
+	if err != nil {
+		t.Fatalf("NewMEVMempool: %v", err)
+	}
+	client, err := NewClient(PublicKeyHex(pool.PublicKey()), pool.ChainID())
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	envelope, _ := client.Seal(TxContext{From: "0xSender", Nonce: 1}, []byte("order"))
+	if err := pool.AddTransaction(envelope, 1, "0xSender"); err != nil {
+		t.Errorf("envelope sealed for the pool's chain rejected: %v", err)
+	}
+}
@@ -0,0 +1,339 @@
+package mevguard
+
+import (
+	"crypto/ecdh"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Pool key states.
+const (
+	KeyActive   = "active"   // new submissions are sealed to it
+	KeyRetiring = "retiring" // still decrypts pending txs until its grace period ends
+)
+
+// What happens to txs sealed to a retiring key once its grace period ends.
+const (
+	RetireReencrypt = "reencrypt" // reseal them to the active key
+	RetireExpire    = "expire"    // drop them
+)
+
+// poolKey = one X25519 key in the pool's keyring.
+type poolKey struct {
+	id        string
+	raw       []byte // our copy of the private key, zeroed on Close
+	priv      *ecdh.PrivateKey
+	state     string
+	created   time.Time
+	retiredAt time.Time
+}
+
+// KeyInfo describes a keyring entry without exposing the private key.
+type KeyInfo struct {
+	ID        string
+	State     string
+	Created   time.Time
+	RetiredAt time.Time
+}
+
+// KeyMaintenance reports what MaintainKeys did.
+type KeyMaintenance struct {
+	Rotated     bool
+	Removed     []string // key IDs dropped from the keyring
+	Reencrypted int
+	Expired     int
+}
+
+func newPoolKey(key []byte, now time.Time) (*poolKey, error) {
+	if len(key) != 32 {
+		return nil, errors.New("encryption key must be 32 bytes long")
+	}
+	priv, err := ecdh.X25519().NewPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	raw := append([]byte{}, key...)
+	return &poolKey{id: KeyID(priv.PublicKey()), raw: raw, priv: priv, state: KeyActive, created: now}, nil
+}
+
+// wipe zeroes the key copy and drops the parsed key. crypto/ecdh keeps its
+// own copy that cannot be wiped; dropping the reference lets it be collected.
+func (k *poolKey) wipe() {
+	Zero(k.raw)
+	k.priv = nil
+}
+
+// wipeKeys wipes every key in keys.
+func wipeKeys(keys []*poolKey) {
+	for _, k := range keys {
+		k.wipe()
+	}
+}
+
+// activeKey returns the key new submissions use. Caller holds the lock.
+func (mp *MEVMempool) activeKey() *poolKey {
+	for _, k := range mp.keys {
+		if k.state == KeyActive {
+			return k
+		}
+	}
+	return nil
+}
+
+// keyByID looks up a keyring entry. Caller holds the lock.
+func (mp *MEVMempool) keyByID(id string) *poolKey {
+	for _, k := range mp.keys {
+		if k.id == id {
+			return k
+		}
+	}
+	return nil
+}
+
+// Keys lists the keyring, active key first.
+func (mp *MEVMempool) Keys() []KeyInfo {
+	mp.mutex.RLock()
+	defer mp.mutex.RUnlock()
+	infos := make([]KeyInfo, 0, len(mp.keys))
+	for _, k := range mp.keys {
+		infos = append(infos, KeyInfo{ID: k.id, State: k.state, Created: k.created, RetiredAt: k.retiredAt})
+	}
+	return infos
+}
+
+// SetRotation configures scheduled rotation: a new key every interval (0
+// disables it), with retiring keys kept for grace before policy applies.
+func (mp *MEVMempool) SetRotation(interval, grace time.Duration, policy string) error {
+	if policy != RetireReencrypt && policy != RetireExpire {
+		return fmt.Errorf("unknown retire policy %q", policy)
+	}
+	mp.mutex.Lock()
+	defer mp.mutex.Unlock()
+	mp.rotateEvery = interval
+	mp.retireGrace = grace
+	mp.retirePolicy = policy
+	return nil
+}
+
+// SetKeySource sets how MaintainKeys generates keys for scheduled rotation.
+// The default is crypto/rand; use SetKeyring to persist them.
+func (mp *MEVMempool) SetKeySource(source func() ([]byte, error)) {
+	mp.mutex.Lock()
+	defer mp.mutex.Unlock()
+	mp.keySource = source
+}
+
+// newKey returns a fresh key from the key source. Caller holds the lock.
+func (mp *MEVMempool) newKey() ([]byte, error) {
+	if mp.keySource != nil {
+		return mp.keySource()
+	}
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// Close zeroes every key in the keyring and syncs and closes the WAL, if any.
+// The pool cannot decrypt afterwards.
+func (mp *MEVMempool) Close() {
+	mp.mutex.Lock()
+	defer mp.mutex.Unlock()
+	wipeKeys(mp.keys)
+	mp.keys = nil
+	if mp.wal != nil {
+		mp.wal.Close()
+		mp.wal = nil
+	}
+}
+
+// Rotate makes key the active pool key and moves the current one to retiring.
+func (mp *MEVMempool) Rotate(key []byte) error {
+	if mp.committee != nil {
+		return errors.New("threshold pool keys are managed by the committee")
+	}
+	mp.mutex.Lock()
+	defer mp.mutex.Unlock()
+	return mp.rotate(key, time.Now())
+}
+
+// rotate installs a new active key, persisting the keyring first if it has a
+// store; a key that cannot be persisted is not installed. Caller holds the lock.
+func (mp *MEVMempool) rotate(key []byte, now time.Time) error {
+	k, err := newPoolKey(key, now)
+	if err != nil {
+		return err
+	}
+	if mp.keyByID(k.id) != nil {
+		k.wipe()
+		return fmt.Errorf("key %s is already in the keyring", k.id)
+	}
+	prev := mp.activeKey()
+	if prev != nil {
+		prev.state = KeyRetiring
+		prev.retiredAt = now
+	}
+	keys := append([]*poolKey{k}, mp.keys...)
+	if mp.keyring != nil {
+		if err := mp.keyring.save(keys); err != nil {
+			if prev != nil {
+				prev.state = KeyActive
+				prev.retiredAt = time.Time{}
+			}
+			k.wipe()
+			return fmt.Errorf("persist keyring: %w", err)
+		}
+	}
+	mp.keys = keys
+	return nil
+}
+
+// MaintainKeys rotates the active key when it is due and retires keys whose
+// grace period has ended, re-encrypting or expiring the txs sealed to them.
+func (mp *MEVMempool) MaintainKeys(now time.Time) (*KeyMaintenance, error) {
+	mp.mutex.Lock()
+	defer mp.mutex.Unlock()
+
+	report := &KeyMaintenance{}
+	if active := mp.activeKey(); active != nil && mp.rotateEvery > 0 && now.Sub(active.created) >= mp.rotateEvery {
+		key, err := mp.newKey()
+		if err != nil {
+			return nil, err
+		}
+		err = mp.rotate(key, now)
+		Zero(key)
+		if err != nil {
+			return nil, err
+		}
+		report.Rotated = true
+	}
+
+	// keys are only dropped and wiped once every retirement and the keyring
+	// write succeed; a key left behind is retired again on the next call
+	var kept, removed []*poolKey
+	for _, k := range mp.keys {
+		if k.state == KeyRetiring && now.Sub(k.retiredAt) >= mp.retireGrace {
+			if err := mp.retireKey(k, report); err != nil {
+				return nil, err
+			}
+			removed = append(removed, k)
+			continue
+		}
+		kept = append(kept, k)
+	}
+	if len(removed) == 0 {
+		return report, nil
+	}
+	if mp.keyring != nil {
+		if err := mp.keyring.save(kept); err != nil {
+			return nil, fmt.Errorf("persist keyring: %w", err)
+		}
+	}
+	mp.keys = kept
+	for _, k := range removed {
+		report.Removed = append(report.Removed, k.id)
+	}
+	wipeKeys(removed)
+	return report, nil
+}
+
+// retireKey re-encrypts or drops every tx sealed to k, pooled or in flight.
+// Every reseal is prepared before any tx changes, so a failure to seal leaves
+// the pool as it was; a failure to log is returned once all changes are
+// applied. Caller holds the lock.
+func (mp *MEVMempool) retireKey(k *poolKey, report *KeyMaintenance) error {
+	changes := make(map[*Transaction]string) // resealed envelope, "" to drop
+	plan := func(tx *Transaction) error {
+		envelope, ok, err := mp.resealFor(k, tx)
+		if ok {
+			changes[tx] = envelope
+		}
+		return err
+	}
+	for _, tx := range mp.transactions {
+		if err := plan(tx); err != nil {
+			return err
+		}
+	}
+	for _, l := range mp.inflight {
+		if err := plan(l.tx); err != nil {
+			return err
+		}
+	}
+
+	var logErr error
+	apply := func(tx *Transaction) bool {
+		envelope, ok := changes[tx]
+		if !ok {
+			return true
+		}
+		var err error
+		if envelope == "" {
+			report.Expired++
+			err = mp.logRemove(tx.ID)
+		} else {
+			tx.EncryptedData = envelope
+			report.Reencrypted++
+			err = mp.logAdd(tx)
+		}
+		if logErr == nil {
+			logErr = err
+		}
+		return envelope != ""
+	}
+	var kept []*Transaction
+	for _, tx := range mp.transactions {
+		if apply(tx) {
+			kept = append(kept, tx)
+		}
+	}
+	mp.transactions = kept
+	for id, l := range mp.inflight {
+		if !apply(l.tx) {
+			delete(mp.inflight, id)
+		}
+	}
+	return logErr
+}
+
+// resealFor returns tx's envelope resealed from k to the active key. ok is
+// false if tx is not sealed to k; an empty envelope means tx is to be dropped.
+// Caller holds the lock.
+func (mp *MEVMempool) resealFor(k *poolKey, tx *Transaction) (envelope string, ok bool, err error) {
+	env, err := parseEnvelope(tx.EncryptedData)
+	if err != nil || mp.envelopeKey(env, tx.Context()) != k {
+		return "", false, nil
+	}
+	active := mp.activeKey()
+	if mp.retirePolicy == RetireExpire || active == nil {
+		return "", true, nil
+	}
+	data, err := env.open(k.priv, tx.Context())
+	if err != nil {
+		// unreadable under its own key; nothing to carry over
+		return "", true, nil
+	}
+	resealed, err := sealEnvelope(active.priv.PublicKey(), data, tx.Context())
+	Zero(data)
+	if err != nil {
+		return "", false, err
+	}
+	return resealed, true, nil
+}
+
+// envelopeKey finds the key an envelope was sealed to. v1 envelopes carry no
+// key ID and are attributed to the first key that opens them. Caller holds the lock.
+func (mp *MEVMempool) envelopeKey(env *envelope, ctx TxContext) *poolKey {
+	if env.keyID != "" {
+		return mp.keyByID(env.keyID)
+	}
+	for _, k := range mp.keys {
+		if _, err := env.open(k.priv, ctx); err == nil {
+			return k
+		}
+	}
+	return nil
+}
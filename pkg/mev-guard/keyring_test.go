@@ -0,0 +1,108 @@
+// This file contains tests for pool key rotation, key IDs in envelopes and
+// retiring old keys.
+
+package mevguard
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"testing"
+	"time"
+)
+
+func randomKey() []byte {
+	key := make([]byte, 32)
+	rand.Read(key)
+	return key
+}
+
+func TestRotateKeepsPendingTxsReadable(t *testing.T) {
+	pool := newTestPool(t)
+	oldID := KeyID(pool.PublicKey())
+	old := &Client{PoolKey: pool.PublicKey(), ChainID: testChainID}
+	envelope, _ := old.Seal(TxContext{From: "0xA", Nonce: 1}, []byte("before rotation"))
+	if err := pool.AddTransaction(envelope, 1, "0xA"); err != nil {
+		t.Fatalf("AddTransaction: %v", err)
+	}
+
+	if err := pool.Rotate(randomKey()); err != nil {
+		t.Fatalf("Rotate: %v", err)
+	}
+	keys := pool.Keys()
+	if len(keys) != 2 || keys[0].State != KeyActive || keys[1].ID != oldID || keys[1].State != KeyRetiring {
+		t.Fatalf("unexpected keyring %+v", keys)
+	}
+
+	// retiring keys still accept and decrypt
+	late, _ := old.Seal(TxContext{From: "0xA", Nonce: 2}, []byte("sealed to retiring key"))
+	if err := pool.AddTransaction(late, 2, "0xA"); err != nil {
+		t.Errorf("retiring key should still accept submissions: %v", err)
+	}
+	fresh, _ := (&Client{PoolKey: pool.PublicKey(), ChainID: testChainID}).Seal(TxContext{From: "0xA", Nonce: 3}, []byte("after rotation"))
+	pool.AddTransaction(fresh, 3, "0xA")
+
+	txs, err := pool.RetrieveTransactions()
+	if err != nil || len(txs) != 3 {
+		t.Fatalf("RetrieveTransactions = %d txs, %v", len(txs), err)
+	}
+}
+
+func TestMaintainKeysReencryptsOrExpires(t *testing.T) {
+	for _, policy := range []string{RetireReencrypt, RetireExpire} {
+		pool := newTestPool(t)
+		oldID := KeyID(pool.PublicKey())
+		envelope, _ := (&Client{PoolKey: pool.PublicKey(), ChainID: testChainID}).Seal(TxContext{From: "0xA", Nonce: 1}, []byte("pending"))
+		pool.AddTransaction(envelope, 1, "0xA")
+
+		pool.SetRotation(time.Hour, 10*time.Minute, policy)
+		now := time.Now()
+
+		report, err := pool.MaintainKeys(now.Add(30 * time.Minute))
+		if err != nil || report.Rotated {
+			t.Fatalf("%s: rotated too early (%+v, %v)", policy, report, err)
+		}
+		report, _ = pool.MaintainKeys(now.Add(time.Hour))
+		if !report.Rotated || len(pool.Keys()) != 2 {
+			t.Fatalf("%s: expected scheduled rotation, got %+v", policy, report)
+		}
+		report, _ = pool.MaintainKeys(now.Add(time.Hour + 10*time.Minute))
+		if len(report.Removed) != 1 || report.Removed[0] != oldID || len(pool.Keys()) != 1 {
+			t.Fatalf("%s: expected old key removed, got %+v", policy, report)
+		}
+
+		txs, err := pool.RetrieveTransactions()
+		if err != nil {
+			t.Fatalf("%s: RetrieveTransactions: %v", policy, err)
+		}
+		switch policy {
+		case RetireReencrypt:
+			if report.Reencrypted != 1 || len(txs) != 1 || txs[0].EncryptedData != "pending" {
+				t.Errorf("reencrypt: report %+v, txs %+v", report, txs)
+			}
+		case RetireExpire:
+			if report.Expired != 1 || len(txs) != 0 {
+				t.Errorf("expire: report %+v, txs %+v", report, txs)
+			}
+		}
+
+		if err := pool.AddTransaction(envelope, 2, "0xA"); err == nil {
+			t.Errorf("%s: envelope for a removed key should be rejected", policy)
+		}
+	}
+}
+
+func TestV1EnvelopeAcceptedOnOptIn(t *testing.T) {
+	pool := newTestPool(t)
+	pool.SetAcceptLegacy(true)
+	sealed, err := sealTo(pool.PublicKey(), []byte("legacy"), nil)
+	if err != nil {
+		t.Fatalf("sealTo: %v", err)
+	}
+	v1 := base64.StdEncoding.EncodeToString(append([]byte{envelopeV1}, sealed...))
+	if err := pool.AddTransaction(v1, 1, "0xA"); err != nil {
+		t.Fatalf("AddTransaction(v1): %v", err)
+	}
+	if got, err := pool.Decrypt(&Transaction{EncryptedData: v1, From: "0xA", Nonce: 1}); err != nil || string(got) != "legacy" {
+		t.Errorf("Decrypt(v1) = %q, %v", got, err)
+	}
+}
@@ -0,0 +1,368 @@
+package mevguard
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/mellis0303/mev-vem/pkg/mev-wal"
+	"golang.org/x/crypto/scrypt"
+	"golang.org/x/crypto/sha3"
+)
+
+// scrypt cost parameters. Standard matches geth's keystore defaults (256MB);
+// light is for tests and constrained hosts.
+const (
+	StandardScryptN = 1 << 18
+	StandardScryptP = 1
+	LightScryptN    = 1 << 12
+	LightScryptP    = 6
+	scryptR         = 8
+	scryptDKLen     = 32
+)
+
+// ErrDecrypt means the keystore passphrase is wrong or the file was altered.
+var ErrDecrypt = errors.New("could not decrypt key with given passphrase")
+
+// Keystore = a Web3 Secret Storage (v3) style file holding a pool key.
+type Keystore struct {
+	Version   int            `json:"version"`
+	KeyID     string         `json:"keyId"`
+	PublicKey string         `json:"publicKey"`
+	Crypto    keystoreCrypto `json:"crypto"`
+}
+
+type keystoreCrypto struct {
+	Cipher       string         `json:"cipher"`
+	CipherText   string         `json:"ciphertext"`
+	CipherParams cipherParams   `json:"cipherparams"`
+	KDF          string         `json:"kdf"`
+	KDFParams    scryptKDFParam `json:"kdfparams"`
+	MAC          string         `json:"mac"`
+}
+
+type cipherParams struct {
+	IV string `json:"iv"`
+}
+
+type scryptKDFParam struct {
+	N     int    `json:"n"`
+	R     int    `json:"r"`
+	P     int    `json:"p"`
+	DKLen int    `json:"dklen"`
+	Salt  string `json:"salt"`
+}
+
+// EncryptKey seals a 32-byte pool key under passphrase: scrypt derives a key,
+// the first half encrypts with AES-128-CTR and the second half feeds the
+// keccak256 MAC over the ciphertext.
+func EncryptKey(key []byte, passphrase string, scryptN, scryptP int) ([]byte, error) {
+	priv, err := ecdh.X25519().NewPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	salt := make([]byte, 32)
+	iv := make([]byte, aes.BlockSize)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, err
+	}
+	if _, err := io.ReadFull(rand.Reader, iv); err != nil {
+		return nil, err
+	}
+	derived, err := scrypt.Key([]byte(passphrase), salt, scryptN, scryptR, scryptP, scryptDKLen)
+	if err != nil {
+		return nil, err
+	}
+	defer Zero(derived)
+
+	ciphertext, err := aesCTR(derived[:16], iv, key)
+	if err != nil {
+		return nil, err
+	}
+	mac := keccak256(derived[16:32], ciphertext)
+
+	return json.MarshalIndent(Keystore{
+		Version:   3,
+		KeyID:     KeyID(priv.PublicKey()),
+		PublicKey: PublicKeyHex(priv.PublicKey()),
+		Crypto: keystoreCrypto{
+			Cipher:       "aes-128-ctr",
+			CipherText:   hex.EncodeToString(ciphertext),
+			CipherParams: cipherParams{IV: hex.EncodeToString(iv)},
+			KDF:          "scrypt",
+			KDFParams:    scryptKDFParam{N: scryptN, R: scryptR, P: scryptP, DKLen: scryptDKLen, Salt: hex.EncodeToString(salt)},
+			MAC:          hex.EncodeToString(mac),
+		},
+	}, "", "  ")
+}
+
+// DecryptKey opens keystore JSON with passphrase and returns the 32-byte key.
+// The caller should Zero it once the pool has been built.
+func DecryptKey(keyJSON []byte, passphrase string) ([]byte, error) {
+	var ks Keystore
+	if err := json.Unmarshal(keyJSON, &ks); err != nil {
+		return nil, err
+	}
+	if ks.Version != 3 {
+		return nil, fmt.Errorf("unsupported keystore version %d", ks.Version)
+	}
+	if ks.Crypto.Cipher != "aes-128-ctr" || ks.Crypto.KDF != "scrypt" {
+		return nil, fmt.Errorf("unsupported keystore cipher %q / kdf %q", ks.Crypto.Cipher, ks.Crypto.KDF)
+	}
+	params := ks.Crypto.KDFParams
+	salt, err := hex.DecodeString(params.Salt)
+	if err != nil {
+		return nil, err
+	}
+	iv, err := hex.DecodeString(ks.Crypto.CipherParams.IV)
+	if err != nil {
+		return nil, err
+	}
+	if len(iv) != aes.BlockSize {
+		return nil, fmt.Errorf("keystore iv must be %d bytes, got %d", aes.BlockSize, len(iv))
+	}
+	ciphertext, err := hex.DecodeString(ks.Crypto.CipherText)
+	if err != nil {
+		return nil, err
+	}
+	mac, err := hex.DecodeString(ks.Crypto.MAC)
+	if err != nil {
+		return nil, err
+	}
+	if params.DKLen != scryptDKLen {
+		return nil, fmt.Errorf("unsupported dklen %d", params.DKLen)
+	}
+
+	derived, err := scrypt.Key([]byte(passphrase), salt, params.N, params.R, params.P, params.DKLen)
+	if err != nil {
+		return nil, err
+	}
+	defer Zero(derived)
+	if subtle.ConstantTimeCompare(keccak256(derived[16:32], ciphertext), mac) != 1 {
+		return nil, ErrDecrypt
+	}
+	key, err := aesCTR(derived[:16], iv, ciphertext)
+	if err != nil {
+		return nil, err
+	}
+	if len(key) != 32 {
+		Zero(key)
+		return nil, errors.New("keystore does not hold a 32-byte key")
+	}
+	return key, nil
+}
+
+// ReadKeystore loads and decrypts a keystore file.
+func ReadKeystore(path, passphrase string) ([]byte, error) {
+	keyJSON, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return DecryptKey(keyJSON, passphrase)
+}
+
+// WriteKeystore encrypts key to path with 0600 permissions, replacing any
+// existing file atomically.
+func WriteKeystore(path string, key []byte, passphrase string, scryptN, scryptP int) error {
+	keyJSON, err := EncryptKey(key, passphrase, scryptN, scryptP)
+	if err != nil {
+		return err
+	}
+	return mevwal.WriteFileAtomic(path, keyJSON)
+}
+
+// keyringFile = the whole pool keyring on disk, one keystore per key ID, with
+// the state MaintainKeys needs to carry on after a restart.
+type keyringFile struct {
+	Version int            `json:"version"`
+	Keys    []keyringEntry `json:"keys"`
+}
+
+type keyringEntry struct {
+	ID        string          `json:"id"`
+	State     string          `json:"state"`
+	Created   time.Time       `json:"created"`
+	RetiredAt time.Time       `json:"retiredAt"`
+	Keystore  json.RawMessage `json:"keystore"`
+}
+
+// keyringStore = where a pool persists its keyring (see SetKeyring).
+type keyringStore struct {
+	path       string
+	passphrase string
+	scryptN    int
+	scryptP    int
+}
+
+// LoadKeyring builds a pool for chainID from a keyring file written by
+// SetKeyring, restoring every key with its state. A single-key keystore, as
+// written by WriteKeystore, loads as the active key.
+func LoadKeyring(path, passphrase string, chainID uint64) (*MEVMempool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file keyringFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, err
+	}
+	if file.Keys == nil {
+		key, err := DecryptKey(data, passphrase)
+		if err != nil {
+			return nil, err
+		}
+		defer Zero(key)
+		return NewMEVMempool(key, chainID)
+	}
+	if file.Version != 1 {
+		return nil, fmt.Errorf("unsupported keyring version %d", file.Version)
+	}
+
+	var keys []*poolKey
+	active := 0
+	for _, e := range file.Keys {
+		key, err := DecryptKey(e.Keystore, passphrase)
+		if err != nil {
+			wipeKeys(keys)
+			return nil, fmt.Errorf("keyring entry %s: %w", e.ID, err)
+		}
+		k, err := newPoolKey(key, e.Created)
+		Zero(key)
+		if err != nil || k.id != e.ID {
+			wipeKeys(keys)
+			return nil, fmt.Errorf("keyring entry %s does not hold its key", e.ID)
+		}
+		switch e.State {
+		case KeyActive:
+			active++
+		case KeyRetiring:
+		default:
+			wipeKeys(keys)
+			return nil, fmt.Errorf("keyring entry %s has unknown state %q", e.ID, e.State)
+		}
+		k.state, k.retiredAt = e.State, e.RetiredAt
+		keys = append(keys, k)
+	}
+	if active != 1 || keys[0].state != KeyActive {
+		wipeKeys(keys)
+		return nil, errors.New("keyring must list exactly one active key, first")
+	}
+
+	mp, err := NewMEVMempool(keys[0].raw, chainID)
+	if err != nil {
+		wipeKeys(keys)
+		return nil, err
+	}
+	mp.keys[0].wipe()
+	mp.keys = keys
+	return mp, nil
+}
+
+// SetKeyring persists the keyring to path, one keystore entry per key ID, and
+// keeps it there: every rotation is written before the new key is handed out,
+// and every retired key is dropped from the file once it leaves the keyring.
+func (mp *MEVMempool) SetKeyring(path, passphrase string, scryptN, scryptP int) error {
+	mp.mutex.Lock()
+	defer mp.mutex.Unlock()
+	store := &keyringStore{path: path, passphrase: passphrase, scryptN: scryptN, scryptP: scryptP}
+	if err := store.save(mp.keys); err != nil {
+		return err
+	}
+	mp.keyring = store
+	return nil
+}
+
+// save writes keys to the store, replacing the file atomically.
+func (ks *keyringStore) save(keys []*poolKey) error {
+	file := keyringFile{Version: 1, Keys: make([]keyringEntry, 0, len(keys))}
+	for _, k := range keys {
+		keyJSON, err := EncryptKey(k.raw, ks.passphrase, ks.scryptN, ks.scryptP)
+		if err != nil {
+			return err
+		}
+		file.Keys = append(file.Keys, keyringEntry{ID: k.id, State: k.state, Created: k.created, RetiredAt: k.retiredAt, Keystore: keyJSON})
+	}
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return err
+	}
+	return mevwal.WriteFileAtomic(ks.path, data)
+}
+
+// KeyFromEnv reads a hex key from an environment variable and unsets it so it
+// does not leak to child processes.
+func KeyFromEnv(name string) ([]byte, error) {
+	v, ok := os.LookupEnv(name)
+	if !ok {
+		return nil, fmt.Errorf("%s is not set", name)
+	}
+	os.Unsetenv(name)
+	return parseKeyMaterial([]byte(v))
+}
+
+// KeyFromFD reads a key (hex or 32 raw bytes) from an inherited file
+// descriptor, e.g. a pipe set up by a secrets manager, and closes it.
+func KeyFromFD(fd uintptr) ([]byte, error) {
+	f := os.NewFile(fd, fmt.Sprintf("fd%d", fd))
+	if f == nil {
+		return nil, fmt.Errorf("invalid file descriptor %d", fd)
+	}
+	defer f.Close()
+	b, err := io.ReadAll(io.LimitReader(f, 1024))
+	if err != nil {
+		return nil, err
+	}
+	defer Zero(b)
+	return parseKeyMaterial(b)
+}
+
+// parseKeyMaterial accepts 32 raw bytes or 64 hex characters, 0x optional.
+func parseKeyMaterial(b []byte) ([]byte, error) {
+	if len(b) == 32 {
+		return append([]byte{}, b...), nil
+	}
+	trimmed := bytes.TrimPrefix(bytes.TrimSpace(b), []byte("0x"))
+	if len(trimmed) != 64 {
+		return nil, errors.New("key must be 32 bytes or 64 hex characters")
+	}
+	key := make([]byte, 32)
+	if _, err := hex.Decode(key, trimmed); err != nil {
+		return nil, fmt.Errorf("invalid hex key: %w", err)
+	}
+	return key, nil
+}
+
+// Zero overwrites b with zeros.
+func Zero(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
+
+func aesCTR(key, iv, in []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]byte, len(in))
+	cipher.NewCTR(block, iv).XORKeyStream(out, in)
+	return out, nil
+}
+
+func keccak256(data ...[]byte) []byte {
+	h := sha3.NewLegacyKeccak256()
+	for _, d := range data {
+		h.Write(d)
+	}
+	return h.Sum(nil)
+}
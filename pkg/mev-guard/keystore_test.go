@@ -0,0 +1,211 @@
+// This file contains tests for keystore encryption, keyring persistence
+// across restarts and failed writes, and loading pool keys from the
+// environment.
+
+package mevguard
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestKeystoreRoundTrip(t *testing.T) {
+	key := randomKey()
+	path := filepath.Join(t.TempDir(), "pool.json")
+	if err := WriteKeystore(path, key, "hunter2", LightScryptN, LightScryptP); err != nil {
+		t.Fatalf("WriteKeystore: %v", err)
+	}
+	if info, _ := os.Stat(path); info.Mode().Perm() != 0600 {
+		t.Errorf("keystore mode = %v, want 0600", info.Mode().Perm())
+	}
+
+	got, err := ReadKeystore(path, "hunter2")
+	if err != nil {
+		t.Fatalf("ReadKeystore: %v", err)
+	}
+	if !bytes.Equal(got, key) {
+		t.Errorf("ReadKeystore returned a different key")
+	}
+	if _, err := ReadKeystore(path, "wrong"); !errors.Is(err, ErrDecrypt) {
+		t.Errorf("wrong passphrase: expected ErrDecrypt, got %v", err)
+	}
+
+	// the recorded key ID matches the pool built from the key
+	keyJSON, _ := os.ReadFile(path)
+	var ks Keystore
+	json.Unmarshal(keyJSON, &ks)
+	pool, _ := NewMEVMempool(got, testChainID)
+	if ks.KeyID != KeyID(pool.PublicKey()) {
+		t.Errorf("keystore key ID %s, pool key ID %s", ks.KeyID, KeyID(pool.PublicKey()))
+	}
+
+	// flipping a ciphertext nibble breaks the MAC
+	first := "0"
+	if ks.Crypto.CipherText[0] == '0' {
+		first = "1"
+	}
+	ks.Crypto.CipherText = first + ks.Crypto.CipherText[1:]
+	tampered, _ := json.Marshal(ks)
+	if _, err := DecryptKey(tampered, "hunter2"); !errors.Is(err, ErrDecrypt) {
+		t.Errorf("tampered keystore: expected ErrDecrypt, got %v", err)
+	}
+
+	// the IV is outside the MAC; a short one is an error, not a panic
+	json.Unmarshal(keyJSON, &ks)
+	ks.Crypto.CipherParams.IV = ks.Crypto.CipherParams.IV[:8]
+	tampered, _ = json.Marshal(ks)
+	if _, err := DecryptKey(tampered, "hunter2"); err == nil {
+		t.Errorf("expected a short IV to be refused")
+	}
+}
+
+func TestKeyringSurvivesRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keyring.json")
+	key := randomKey()
+	if err := WriteKeystore(path, key, "hunter2", LightScryptN, LightScryptP); err != nil {
+		t.Fatalf("WriteKeystore: %v", err)
+	}
+
+	// a single-key keystore loads as the active key and is rewritten as a keyring
+	pool, err := LoadKeyring(path, "hunter2", testChainID)
+	if err != nil {
+		t.Fatalf("LoadKeyring(keystore): %v", err)
+	}
+	oldID := KeyID(pool.PublicKey())
+	if err := pool.SetKeyring(path, "hunter2", LightScryptN, LightScryptP); err != nil {
+		t.Fatalf("SetKeyring: %v", err)
+	}
+	client := &Client{PoolKey: pool.PublicKey(), ChainID: testChainID}
+	envelope, _ := client.Seal(TxContext{From: "0xA", Nonce: 1}, []byte("sealed to the old key"))
+	if err := pool.AddTransaction(envelope, 1, "0xA"); err != nil {
+		t.Fatalf("AddTransaction: %v", err)
+	}
+
+	// a rotation is on disk before the new key is used
+	if err := pool.Rotate(randomKey()); err != nil {
+		t.Fatalf("Rotate: %v", err)
+	}
+	newID := KeyID(pool.PublicKey())
+	pool.Close()
+
+	restored, err := LoadKeyring(path, "hunter2", testChainID)
+	if err != nil {
+		t.Fatalf("LoadKeyring: %v", err)
+	}
+	keys := restored.Keys()
+	if len(keys) != 2 || keys[0].ID != newID || keys[0].State != KeyActive || keys[1].ID != oldID || keys[1].State != KeyRetiring {
+		t.Fatalf("restored keyring %+v, want %s active and %s retiring", keys, newID, oldID)
+	}
+	if got, err := restored.Decrypt(&Transaction{EncryptedData: envelope, From: "0xA", Nonce: 1, ChainID: testChainID}); err != nil || string(got) != "sealed to the old key" {
+		t.Errorf("restored keyring lost the retiring key: %q, %v", got, err)
+	}
+	if _, err := LoadKeyring(path, "wrong", testChainID); !errors.Is(err, ErrDecrypt) {
+		t.Errorf("wrong passphrase: expected ErrDecrypt, got %v", err)
+	}
+
+	// retired keys leave the file with the keyring
+	if err := restored.SetKeyring(path, "hunter2", LightScryptN, LightScryptP); err != nil {
+		t.Fatalf("SetKeyring: %v", err)
+	}
+	restored.SetRotation(0, 0, RetireExpire)
+	if _, err := restored.MaintainKeys(keys[1].RetiredAt); err != nil {
+		t.Fatalf("MaintainKeys: %v", err)
+	}
+	restored.Close()
+	again, err := LoadKeyring(path, "hunter2", testChainID)
+	if err != nil {
+		t.Fatalf("LoadKeyring: %v", err)
+	}
+	if keys := again.Keys(); len(keys) != 1 || keys[0].ID != newID {
+		t.Errorf("expected only %s after retirement, got %+v", newID, keys)
+	}
+}
+
+func TestRotateFailsWhenKeyringCannotBeWritten(t *testing.T) {
+	dir := t.TempDir()
+	pool := newTestPool(t)
+	if err := pool.SetKeyring(filepath.Join(dir, "keyring.json"), "hunter2", LightScryptN, LightScryptP); err != nil {
+		t.Fatalf("SetKeyring: %v", err)
+	}
+	active := KeyID(pool.PublicKey())
+	pool.keyring.path = filepath.Join(dir, "missing", "keyring.json")
+	if err := pool.Rotate(randomKey()); err == nil {
+		t.Fatalf("expected rotation to fail when the keyring cannot be persisted")
+	}
+	if keys := pool.Keys(); len(keys) != 1 || keys[0].ID != active || keys[0].State != KeyActive {
+		t.Errorf("failed rotation changed the keyring: %+v", keys)
+	}
+}
+
+func TestRetirementKeepsKeysWhenKeyringCannotBeWritten(t *testing.T) {
+	dir := t.TempDir()
+	pool := newTestPool(t)
+	if err := pool.SetKeyring(filepath.Join(dir, "keyring.json"), "hunter2", LightScryptN, LightScryptP); err != nil {
+		t.Fatalf("SetKeyring: %v", err)
+	}
+	pool.SetRotation(0, time.Minute, RetireReencrypt)
+	oldID := KeyID(pool.PublicKey())
+	if err := pool.Rotate(randomKey()); err != nil {
+		t.Fatalf("Rotate: %v", err)
+	}
+
+	pool.keyring.path = filepath.Join(dir, "missing", "keyring.json")
+	if _, err := pool.MaintainKeys(time.Now().Add(time.Hour)); err == nil {
+		t.Fatalf("expected retirement to fail when the keyring cannot be persisted")
+	}
+	keys := pool.Keys()
+	if len(keys) != 2 || keys[1].ID != oldID {
+		t.Fatalf("failed retirement changed the keyring: %+v", keys)
+	}
+	pool.mutex.RLock()
+	wiped := pool.keys[1].priv == nil
+	pool.mutex.RUnlock()
+	if wiped {
+		t.Fatalf("failed retirement wiped a key still in the keyring")
+	}
+
+	pool.keyring.path = filepath.Join(dir, "keyring.json")
+	report, err := pool.MaintainKeys(time.Now().Add(time.Hour))
+	if err != nil || len(report.Removed) != 1 || report.Removed[0] != oldID {
+		t.Errorf("retry: report %+v, %v", report, err)
+	}
+}
+
+func TestKeyFromEnv(t *testing.T) {
+	t.Setenv("MEV_GUARD_TEST_KEY", "0x"+strings.Repeat("ab", 32))
+	key, err := KeyFromEnv("MEV_GUARD_TEST_KEY")
+	if err != nil {
+		t.Fatalf("KeyFromEnv: %v", err)
+	}
+	if !bytes.Equal(key, bytes.Repeat([]byte{0xab}, 32)) {
+		t.Errorf("unexpected key %x", key)
+	}
+	if _, ok := os.LookupEnv("MEV_GUARD_TEST_KEY"); ok {
+		t.Errorf("KeyFromEnv should unset the variable")
+	}
+	if _, err := parseKeyMaterial([]byte("abcd")); err == nil {
+		t.Errorf("expected short key material to be rejected")
+	}
+}
+
+func TestCloseZeroesKeys(t *testing.T) {
+	pool := newTestPool(t)
+	client := &Client{PoolKey: pool.PublicKey(), ChainID: testChainID}
+	envelope, _ := client.Seal(TxContext{From: "0xA", Nonce: 1}, []byte("order"))
+	pool.AddTransaction(envelope, 1, "0xA")
+
+	k := pool.keys[0]
+	pool.Close()
+	if !bytes.Equal(k.raw, make([]byte, 32)) || k.priv != nil {
+		t.Errorf("Close left key material behind")
+	}
+	if _, err := pool.RetrieveTransactions(); err == nil {
+		t.Errorf("closed pool should not decrypt")
+	}
+}
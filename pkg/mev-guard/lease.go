@@ -0,0 +1,173 @@
+package mevguard
+
+import (
+	"sort"
+	"time"
+)
+
+// Defaults for consumption and expiry.
+const (
+	DefaultLeaseTimeout = 30 * time.Second
+	DefaultTTL          = 5 * time.Minute // about 25 blocks
+)
+
+// leasedTx = an entry handed out by a retrieval and not yet acked.
+type leasedTx struct {
+	tx    *Transaction
+	until time.Time
+}
+
+// SetLeaseTimeout sets how long retrieved txs stay in flight before they
+// return to the pool unacked.
+func (mp *MEVMempool) SetLeaseTimeout(d time.Duration) {
+	mp.mutex.Lock()
+	defer mp.mutex.Unlock()
+	mp.leaseTimeout = d
+}
+
+// SetTTL sets how long an entry may wait in the pool. 0 keeps entries until
+// they are acked or their target block passes.
+func (mp *MEVMempool) SetTTL(d time.Duration) {
+	mp.mutex.Lock()
+	defer mp.mutex.Unlock()
+	mp.ttl = d
+}
+
+// AdvanceBlock records the chain height. Entries whose target block is below
+// it can no longer be included and expire.
+func (mp *MEVMempool) AdvanceBlock(height uint64) {
+	mp.mutex.Lock()
+	defer mp.mutex.Unlock()
+	if height > mp.height {
+		mp.height = height
+	}
+	for block := range mp.committed {
+		if block < mp.height {
+			delete(mp.committed, block)
+		}
+	}
+}
+
+// Ack removes retrieved txs for good and returns how many were in flight.
+// The sender's next nonce moves past each acked tx.
+func (mp *MEVMempool) Ack(ids ...string) int {
+	mp.mutex.Lock()
+	defer mp.mutex.Unlock()
+	now := time.Now()
+	n := 0
+	for _, id := range ids {
+		if l, ok := mp.inflight[id]; ok {
+			delete(mp.inflight, id)
+			mp.ackNonce(l.tx, now)
+			mp.logRemove(id)
+			n++
+		}
+	}
+	return n
+}
+
+// Nack returns retrieved txs to the pool so the next retrieval sees them again.
+func (mp *MEVMempool) Nack(ids ...string) int {
+	mp.mutex.Lock()
+	defer mp.mutex.Unlock()
+	n := 0
+	for _, id := range ids {
+		if l, ok := mp.inflight[id]; ok {
+			delete(mp.inflight, id)
+			mp.transactions = append(mp.transactions, l.tx)
+			n++
+		}
+	}
+	if n > 0 {
+		mp.restoreOrder()
+	}
+	return n
+}
+
+// InFlight returns how many txs are leased and not yet acked.
+func (mp *MEVMempool) InFlight() int {
+	mp.mutex.RLock()
+	defer mp.mutex.RUnlock()
+	return len(mp.inflight)
+}
+
+// Expire drops entries past their TTL or target block, in the pool and in
+// flight, and returns how many were dropped. Retrieval calls it as well.
+func (mp *MEVMempool) Expire(now time.Time) int {
+	mp.mutex.Lock()
+	defer mp.mutex.Unlock()
+	return mp.expire(now)
+}
+
+// expired reports whether tx can no longer be served. Caller holds the lock.
+func (mp *MEVMempool) expired(tx *Transaction, now time.Time) bool {
+	if mp.ttl > 0 && now.Sub(tx.AddedAt) >= mp.ttl {
+		return true
+	}
+	return tx.TargetBlock != 0 && tx.TargetBlock < mp.height
+}
+
+// expire drops expired entries and returns timed-out leases to the pool.
+// Caller holds the lock.
+func (mp *MEVMempool) expire(now time.Time) int {
+	dropped := 0
+	returned := false
+	for id, l := range mp.inflight {
+		switch {
+		case mp.expired(l.tx, now):
+			delete(mp.inflight, id)
+			mp.logRemove(id)
+			dropped++
+		case !now.Before(l.until):
+			delete(mp.inflight, id)
+			mp.transactions = append(mp.transactions, l.tx)
+			returned = true
+		}
+	}
+
+	var kept []*Transaction
+	for _, tx := range mp.transactions {
+		if mp.expired(tx, now) {
+			mp.logRemove(tx.ID)
+			dropped++
+			continue
+		}
+		kept = append(kept, tx)
+	}
+	mp.transactions = kept
+	if returned {
+		mp.restoreOrder()
+	}
+
+	window := mp.ttl
+	if window == 0 {
+		window = DefaultTTL
+	}
+	mp.pruneNonces(now.Add(-window))
+	return dropped
+}
+
+// restoreOrder keeps the pool in submission order after leases come back.
+// Caller holds the lock.
+func (mp *MEVMempool) restoreOrder() {
+	sort.SliceStable(mp.transactions, func(i, j int) bool {
+		return mp.transactions[i].AddedAt.Before(mp.transactions[j].AddedAt)
+	})
+}
+
+// lease moves the retrieved entries in flight. Caller holds the lock.
+func (mp *MEVMempool) lease(retrieved []*Transaction, now time.Time) {
+	ids := make(map[string]bool, len(retrieved))
+	for _, tx := range retrieved {
+		ids[tx.ID] = true
+	}
+	var kept []*Transaction
+	for _, tx := range mp.transactions {
+		if ids[tx.ID] {
+			mp.inflight[tx.ID] = &leasedTx{tx: tx, until: now.Add(mp.leaseTimeout)}
+			continue
+		}
+		kept = append(kept, tx)
+	}
+	mp.transactions = kept
+}
@@ -0,0 +1,100 @@
+// This file contains tests for leased retrieval, ack/nack and expiry of pool
+// entries.
+
+package mevguard
+
+import (
+	"testing"
+	"time"
+)
+
+func addSealed(t *testing.T, pool *MEVMempool, from string, nonce, block uint64) string {
+	t.Helper()
+	client := &Client{PoolKey: pool.PublicKey(), ChainID: testChainID}
+	envelope, _ := client.Seal(TxContext{From: from, Nonce: nonce, TargetBlock: block}, []byte(from))
+	if err := pool.AddTransactionForBlock(envelope, nonce, from, block); err != nil {
+		t.Fatalf("AddTransactionForBlock: %v", err)
+	}
+	return envelope
+}
+
+func TestLeaseAckNack(t *testing.T) {
+	pool := newTestPool(t)
+	addSealed(t, pool, "0xA", 1, 0)
+	addSealed(t, pool, "0xB", 1, 0)
+
+	txs, err := pool.RetrieveTransactions()
+	if err != nil || len(txs) != 2 {
+		t.Fatalf("RetrieveTransactions = %d, %v", len(txs), err)
+	}
+	if again, _ := pool.RetrieveTransactions(); len(again) != 0 || pool.InFlight() != 2 {
+		t.Fatalf("leased txs must not be returned twice (got %d, in flight %d)", len(again), pool.InFlight())
+	}
+
+	if n := pool.Ack(txs[0].ID); n != 1 {
+		t.Errorf("Ack = %d", n)
+	}
+	if n := pool.Nack(txs[1].ID, "unknown"); n != 1 {
+		t.Errorf("Nack = %d", n)
+	}
+	again, _ := pool.RetrieveTransactions()
+	if len(again) != 1 || again[0].From != "0xB" {
+		t.Errorf("expected only the nacked tx back, got %+v", again)
+	}
+}
+
+func TestLeaseTimeoutReturnsTx(t *testing.T) {
+	pool := newTestPool(t)
+	pool.SetLeaseTimeout(time.Second)
+	addSealed(t, pool, "0xA", 1, 0)
+	addSealed(t, pool, "0xB", 1, 0)
+
+	txs, _ := pool.RetrieveTransactions()
+	pool.Ack(txs[1].ID)
+	if n := pool.Expire(time.Now().Add(2 * time.Second)); n != 0 {
+		t.Errorf("lease timeout should not drop entries, dropped %d", n)
+	}
+	if pool.InFlight() != 0 {
+		t.Errorf("timed-out lease still in flight")
+	}
+	again, _ := pool.RetrieveTransactions()
+	if len(again) != 1 || again[0].ID != txs[0].ID {
+		t.Errorf("expected the unacked tx back, got %+v", again)
+	}
+}
+
+func TestExpiry(t *testing.T) {
+	pool := newTestPool(t)
+	pool.SetTTL(time.Minute)
+	addSealed(t, pool, "0xOld", 1, 0)
+	addSealed(t, pool, "0xBlock", 1, 10)
+	addSealed(t, pool, "0xFresh", 1, 0)
+	pool.transactions[0].AddedAt = time.Now().Add(-2 * time.Minute)
+
+	pool.AdvanceBlock(11)
+	if n := pool.Expire(time.Now()); n != 2 {
+		t.Errorf("Expire = %d, want 2", n)
+	}
+	txs, _ := pool.RetrieveTransactions()
+	if len(txs) != 1 || txs[0].From != "0xFresh" {
+		t.Errorf("unexpected survivors %+v", txs)
+	}
+
+	client := &Client{PoolKey: pool.PublicKey(), ChainID: testChainID}
+	late, _ := client.Seal(TxContext{From: "0xLate", Nonce: 1, TargetBlock: 10}, []byte("late"))
+	if err := pool.AddTransactionForBlock(late, 1, "0xLate", 10); err == nil {
+		t.Errorf("expected a passed target block to be rejected")
+	}
+}
+
+func TestDuplicateEnvelopeRejected(t *testing.T) {
+	pool := newTestPool(t)
+	envelope := addSealed(t, pool, "0xA", 1, 0)
+	if err := pool.AddTransaction(envelope, 1, "0xA"); err == nil {
+		t.Errorf("expected a replayed envelope to be rejected")
+	}
+	pool.RetrieveTransactions()
+	if err := pool.AddTransaction(envelope, 1, "0xA"); err == nil {
+		t.Errorf("expected a replay of an in-flight envelope to be rejected")
+	}
+}
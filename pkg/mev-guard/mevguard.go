@@ -1,122 +1,286 @@
 package mevguard
 
 import (
-	"crypto/aes"
-	"crypto/cipher"
+	"crypto/ecdh"
 	"crypto/rand"
-	"encoding/base64"
 	"errors"
 	"fmt"
-	"io"
+	"math/big"
 	"sync"
+	"time"
+
+	"github.com/mellis0303/mev-vem/pkg/mev-wal"
 )
 
 // ETH transaction
 type Transaction struct {
+	ID            string
 	EncryptedData string
 	Nonce         uint64
 	From          string
+	ChainID       uint64
+	TargetBlock   uint64   // 0 unless the tx is only valid for one block
+	Fee           *big.Int // signed by the sender; only used to rank replacements
+	AddedAt       time.Time
+}
+
+// Context returns the metadata a v3 envelope must be bound to.
+func (tx *Transaction) Context() TxContext {
+	return TxContext{From: tx.From, Nonce: tx.Nonce, ChainID: tx.ChainID, TargetBlock: tx.TargetBlock}
 }
 
 // protected + encrypted transactional pool
 type MEVMempool struct {
 	transactions []*Transaction
 	mutex        sync.RWMutex
-	key          []byte
+	keys         []*poolKey // keyring, active key first
+	rotateEvery  time.Duration
+	retireGrace  time.Duration
+	retirePolicy string
+	keySource    func() ([]byte, error)
+	keyring      *keyringStore // nil unless SetKeyring was called
+	chainID      uint64
+	acceptLegacy bool                       // accept v1/v2 envelopes without bound context
+	committee    *Committee                 // nil unless built by NewThresholdMEVMempool
+	committed    map[uint64]*committedBlock // threshold pool orderings by block
+	quarantine   []*QuarantinedTx
+	inflight     map[string]*leasedTx // retrieved, waiting for Ack or Nack
+	leaseTimeout time.Duration
+	ttl          time.Duration
+	height       uint64
+	nonces       map[string]*senderNonce // next nonce per sender, once known
+	gapTimeout   time.Duration
+	wal          *mevwal.WAL // nil unless OpenWAL was called
+	walErr       error       // first failed log write, see WALErr
 }
 
-// NewMEVMempool initializes a new MEV-protected mempool
-func NewMEVMempool(key []byte) (*MEVMempool, error) {
-	if len(key) != 32 {
-		return nil, errors.New("encryption key must be 32 bytes long")
+// NewMEVMempool initializes a new MEV-protected mempool. key is the pool's
+// X25519 private key; clients seal to the matching PublicKey. chainID is the
+// chain envelopes must be bound to and may not be zero.
+func NewMEVMempool(key []byte, chainID uint64) (*MEVMempool, error) {
+	if chainID == 0 {
+		return nil, ErrNoChainID
+	}
+	k, err := newPoolKey(key, time.Now())
+	if err != nil {
+		return nil, err
 	}
 	return &MEVMempool{
 		transactions: []*Transaction{},
-		key:          key,
+		keys:         []*poolKey{k},
+		retirePolicy: RetireReencrypt,
+		chainID:      chainID,
+		inflight:     make(map[string]*leasedTx),
+		leaseTimeout: DefaultLeaseTimeout,
+		ttl:          DefaultTTL,
+		nonces:       make(map[string]*senderNonce),
+		gapTimeout:   DefaultGapTimeout,
 	}, nil
 }
 
-// Encrypt encrypts transaction data using AES-GCM 
-func (mp *MEVMempool) Encrypt(txData []byte) (string, error) {
-	block, err := aes.NewCipher(mp.key)
-	if err != nil {
-		return "", err
-	}
-	aesGCM, err := cipher.NewGCM(block)
-	if err != nil {
-		return "", err
-	}
-	nonce := make([]byte, aesGCM.NonceSize())
-	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
-		return "", err
+// ChainID returns the chain ID new txs are bound to, for clients to seal with.
+func (mp *MEVMempool) ChainID() uint64 {
+	mp.mutex.RLock()
+	defer mp.mutex.RUnlock()
+	return mp.chainID
+}
+
+// SetAcceptLegacy controls whether v1/v2 envelopes, which do not bind sender
+// and nonce, are still accepted. They are refused by default; a pool migrating
+// old senders opts in here and moves what it holds to v3 with UpgradeEnvelopes.
+func (mp *MEVMempool) SetAcceptLegacy(accept bool) {
+	mp.mutex.Lock()
+	defer mp.mutex.Unlock()
+	mp.acceptLegacy = accept
+}
+
+// PublicKey returns the active key clients seal transactions to.
+func (mp *MEVMempool) PublicKey() *ecdh.PublicKey {
+	mp.mutex.RLock()
+	defer mp.mutex.RUnlock()
+	if k := mp.activeKey(); k != nil {
+		return k.priv.PublicKey()
 	}
-	ciphertext := aesGCM.Seal(nonce, nonce, txData, nil)
-	return base64.StdEncoding.EncodeToString(ciphertext), nil
+	return nil
 }
 
+// Decrypt opens a pooled tx's envelope. A v3 envelope that does not match
+// the tx's sender, nonce, chain or target block fails with *IntegrityError.
+func (mp *MEVMempool) Decrypt(tx *Transaction) ([]byte, error) {
+	mp.mutex.RLock()
+	defer mp.mutex.RUnlock()
+	return mp.decrypt(tx)
+}
 
-func (mp *MEVMempool) Decrypt(encodedCipher string) ([]byte, error) {
-	ciphertext, err := base64.StdEncoding.DecodeString(encodedCipher)
-	if err != nil {
-		return nil, err
+// decrypt picks the key by envelope key ID. Caller holds the lock.
+func (mp *MEVMempool) decrypt(tx *Transaction) ([]byte, error) {
+	if mp.committee != nil {
+		return nil, errors.New("threshold pool has no local key; use RetrieveBlock")
 	}
-	block, err := aes.NewCipher(mp.key)
+	env, err := parseEnvelope(tx.EncryptedData)
 	if err != nil {
 		return nil, err
 	}
-	aesGCM, err := cipher.NewGCM(block)
-	if err != nil {
-		return nil, err
+	k := mp.envelopeKey(env, tx.Context())
+	if k == nil {
+		if env.keyID != "" {
+			return nil, fmt.Errorf("unknown or retired key %s", env.keyID)
+		}
+		return nil, &IntegrityError{From: tx.From, Nonce: tx.Nonce, Version: env.version}
 	}
+	return env.open(k.priv, tx.Context())
+}
 
-	nonceSize := aesGCM.NonceSize()
-	if len(ciphertext) < nonceSize {
-		return nil, errors.New("ciphertext too short")
-	}
+// add a client-sealed transaction to the protected pool. Plaintext is never
+// accepted; the envelope is checked for shape and key but not opened.
+func (mp *MEVMempool) AddTransaction(envelope string, nonce uint64, from string) error {
+	return mp.AddTransactionForBlock(envelope, nonce, from, 0)
+}
 
-	nonce, ciphertext := ciphertext[:nonceSize], ciphertext[nonceSize:]
-	return aesGCM.Open(nil, nonce, ciphertext, nil)
+// AddTransactionForBlock adds an envelope bound to a target block. On a
+// threshold pool it must be sealed with SealForBlock.
+func (mp *MEVMempool) AddTransactionForBlock(envelope string, nonce uint64, from string, block uint64) error {
+	return mp.addTransaction(envelope, nonce, from, block, nil, "")
 }
 
-// encrypt + add transaction to protected pool
-func (mp *MEVMempool) AddTransaction(txData []byte, nonce uint64, from string) error {
-	mp.mutex.Lock()
-	defer mp.mutex.Unlock()
+// AddTransactionWithFee adds an envelope with a fee signed by the sender:
+// signature is a SignFee signature by from over the envelope, nonce, fee and
+// pool chain ID. The pool cannot see inside the envelope, so only a signed fee
+// ranks a tx; txs added without one count as paying nothing. A tx with the
+// same sender and nonce as a pooled one replaces it if it pays more.
+func (mp *MEVMempool) AddTransactionWithFee(envelope string, nonce uint64, from string, block uint64, fee *big.Int, signature string) error {
+	return mp.addTransaction(envelope, nonce, from, block, fee, signature)
+}
 
-	encTx, err := mp.Encrypt(txData)
+// addTransaction admits an envelope. A fee is only accepted with the sender's
+// signature over it.
+func (mp *MEVMempool) addTransaction(envelope string, nonce uint64, from string, block uint64, fee *big.Int, signature string) error {
+	env, err := parseEnvelope(envelope)
 	if err != nil {
 		return err
 	}
 
+	mp.mutex.Lock()
+	defer mp.mutex.Unlock()
+
+	if env.legacy() && (!mp.acceptLegacy || mp.committee != nil) {
+		return fmt.Errorf("v%d envelopes are not accepted; seal with sender and nonce bound", env.version)
+	}
+	if mp.committee == nil && env.keyID != "" && mp.keyByID(env.keyID) == nil {
+		return fmt.Errorf("envelope sealed to unknown or retired key %s", env.keyID)
+	}
+	if mp.committee != nil && block == 0 {
+		return errors.New("threshold pool txs need a target block")
+	}
+	if _, ok := mp.committed[block]; ok && mp.committee != nil {
+		return fmt.Errorf("ordering for block %d is already committed", block)
+	}
+
+	if block != 0 && block < mp.height {
+		return fmt.Errorf("target block %d has passed", block)
+	}
+	id := txID(envelope)
+	if _, ok := mp.inflight[id]; ok || mp.findTx(id) != nil {
+		return fmt.Errorf("envelope %s is already in the pool", id)
+	}
+
 	tx := &Transaction{
-		EncryptedData: encTx,
+		ID:            id,
+		EncryptedData: envelope,
 		Nonce:         nonce,
 		From:          from,
+		ChainID:       mp.chainID,
+		TargetBlock:   block,
+		Fee:           fee,
+		AddedAt:       time.Now(),
+	}
+	if fee != nil || signature != "" {
+		if err := verifyFee(tx, signature); err != nil {
+			return err
+		}
+	}
+	old, err := mp.admit(tx)
+	if err != nil {
+		return err
+	}
+	if err := mp.logAdd(tx); err != nil {
+		return err
 	}
 
+	if old != nil {
+		return mp.replace(old, tx)
+	}
 	mp.transactions = append(mp.transactions, tx)
 	return nil
 }
 
-// decrypt + retrieves transaction 
-func (mp *MEVMempool) RetrieveTransactions() ([]*Transaction, error) {
-	mp.mutex.RLock()
-	defer mp.mutex.RUnlock()
+// UpgradeEnvelopes reseals pending v1/v2 envelopes as v3, bound to the sender
+// and nonce they were submitted with. Entries that fail to open are left as
+// they are and reported in the returned error.
+func (mp *MEVMempool) UpgradeEnvelopes() (int, error) {
+	mp.mutex.Lock()
+	defer mp.mutex.Unlock()
 
-	decryptedTxs := make([]*Transaction, len(mp.transactions))
-	for i, tx := range mp.transactions {
-		decData, err := mp.Decrypt(tx.EncryptedData)
+	upgraded := 0
+	var errs []error
+	for _, tx := range mp.transactions {
+		env, err := parseEnvelope(tx.EncryptedData)
+		if err != nil || !env.legacy() {
+			continue
+		}
+		k := mp.envelopeKey(env, tx.Context())
+		if k == nil {
+			errs = append(errs, &IntegrityError{From: tx.From, Nonce: tx.Nonce, KeyID: env.keyID, Version: env.version})
+			continue
+		}
+		data, err := env.open(k.priv, tx.Context())
 		if err != nil {
-			return nil, err
+			errs = append(errs, err)
+			continue
 		}
-		decryptedTxs[i] = &Transaction{
-			EncryptedData: string(decData),
-			Nonce:         tx.Nonce,
-			From:          tx.From,
+		resealed, err := sealEnvelope(k.priv.PublicKey(), data, tx.Context())
+		if err != nil {
+			return upgraded, err
+		}
+		tx.EncryptedData = resealed
+		if err := mp.logAdd(tx); err != nil {
+			return upgraded, err
 		}
+		upgraded++
 	}
+	return upgraded, errors.Join(errs...)
+}
 
-	return decryptedTxs, nil
+// decrypt + retrieves transactions, each sender's in nonce order. Txs behind a
+// nonce gap are held back until it fills. Retrieved txs are leased: they stay out of
+// later retrievals until acked (removed) or nacked or timed out (returned).
+// Entries that fail to decrypt do not block the rest: they are quarantined and
+// reported in a *RetrievalError returned alongside the txs that did decrypt.
+func (mp *MEVMempool) RetrieveTransactions() ([]*Transaction, error) {
+	mp.mutex.Lock()
+	defer mp.mutex.Unlock()
+
+	if mp.committee != nil {
+		return nil, errors.New("threshold pool has no local key; use RetrieveBlock")
+	}
+	if len(mp.keys) == 0 {
+		return nil, errors.New("pool is closed")
+	}
+	now := time.Now()
+	mp.expire(now)
+	txs, err := mp.openEach(mp.sequence(now), mp.decrypt)
+	mp.lease(txs, now)
+	return txs, err
+}
+
+// findTx returns the pooled entry with id. Caller holds the lock.
+func (mp *MEVMempool) findTx(id string) *Transaction {
+	for _, tx := range mp.transactions {
+		if tx.ID == id {
+			return tx
+		}
+	}
+	return nil
 }
 
 // Example usage
@@ -125,20 +289,38 @@ func Example() {
 	if _, err := rand.Read(key); err != nil {
 		panic(err)
 	}
-	pool, err := NewMEVMempool(key)
+	pool, err := NewMEVMempool(key, 1)
 	if err != nil {
 		panic(err)
 	}
 
+	// the client only ever sees the pool's public key and chain ID
+	client, err := NewClient(PublicKeyHex(pool.PublicKey()), pool.ChainID())
+	if err != nil {
+		panic(err)
+	}
 	txData := []byte(`{"to":"0xReceiver","value":"100ETH"}`)
-	err = pool.AddTransaction(txData, 1, "0xSender")
+	envelope, err := client.Seal(TxContext{From: "0xSender", Nonce: 1}, txData)
+	if err != nil {
+		panic(err)
+	}
+
+	// replaying the envelope under another sender does not decrypt
+	if _, err := pool.Decrypt(&Transaction{EncryptedData: envelope, From: "0xMallory", Nonce: 1, ChainID: pool.ChainID()}); err != nil {
+		fmt.Println("Swapped sender:", err)
+	}
+
+	err = pool.AddTransaction(envelope, 1, "0xSender")
 	if err != nil {
 		fmt.Println("Error adding transaction:", err)
 		return
 	}
 
 	txs, err := pool.RetrieveTransactions()
-	if err != nil {
+	var retrievalErr *RetrievalError
+	if errors.As(err, &retrievalErr) {
+		fmt.Println("Quarantined:", err)
+	} else if err != nil {
 		fmt.Println("Error retrieving transactions:", err)
 		return
 	}
@@ -146,4 +328,56 @@ func Example() {
 	for _, tx := range txs {
 		fmt.Printf("Decrypted Tx: %s, Nonce: %d, From: %s\n", tx.EncryptedData, tx.Nonce, tx.From)
 	}
+	// not processed yet: return it to the pool instead of acking it
+	pool.Nack(txs[0].ID)
+
+	// rotate: the old key keeps decrypting pending txs until it is retired,
+	// then they are resealed to the new key
+	newKey := make([]byte, 32)
+	if _, err := rand.Read(newKey); err != nil {
+		panic(err)
+	}
+	if err := pool.Rotate(newKey); err != nil {
+		panic(err)
+	}
+	pool.SetRotation(0, 0, RetireReencrypt)
+	report, err := pool.MaintainKeys(time.Now())
+	if err != nil {
+		panic(err)
+	}
+	fmt.Printf("Rotated to key %s, re-encrypted %d pending txs\n", KeyID(pool.PublicKey()), report.Reencrypted)
+
+	// 3-of-5 committee: nothing decrypts until block 100's ordering is committed
+	committee, err := NewCommittee(3, 5)
+	if err != nil {
+		panic(err)
+	}
+	tpool, err := NewThresholdMEVMempool(committee, 1)
+	if err != nil {
+		panic(err)
+	}
+	blockEnvelope, err := SealForBlock(committee, TxContext{From: "0xSender", Nonce: 2, ChainID: tpool.ChainID(), TargetBlock: 100}, txData)
+	if err != nil {
+		panic(err)
+	}
+	if err := tpool.AddTransactionForBlock(blockEnvelope, 2, "0xSender", 100); err != nil {
+		fmt.Println("Error adding transaction:", err)
+		return
+	}
+	if _, err := tpool.RetrieveBlock(100); err != nil {
+		fmt.Println("Before commit:", err)
+	}
+	root, err := tpool.CommitOrdering(100)
+	if err != nil {
+		fmt.Println("Error committing ordering:", err)
+		return
+	}
+	btxs, err := tpool.RetrieveBlock(100)
+	if err != nil {
+		fmt.Println("Error retrieving block:", err)
+		return
+	}
+	for _, tx := range btxs {
+		fmt.Printf("Block 100 (root %s) Tx: %s, Nonce: %d, From: %s\n", root[:8], tx.EncryptedData, tx.Nonce, tx.From)
+	}
 }
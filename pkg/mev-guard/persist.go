@@ -0,0 +1,149 @@
+package mevguard
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/mellis0303/mev-vem/pkg/mev-wal"
+)
+
+// WAL record types. Entries are logged as submitted, still sealed; a later
+// add with the same ID (after a reseal) replaces the earlier one.
+const (
+	walAdd    byte = 1
+	walRemove byte = 2
+)
+
+// OpenWAL makes the pool durable: it replays the log at path into the pool and
+// logs every later change. Txs that were in flight at a crash come back as
+// pending, so consumers see them at least once. A removal that cannot be
+// logged is returned by calls that return errors and kept for WALErr
+// otherwise; once the log has failed, AddTransaction refuses new txs.
+// Threshold pools are refused: their committed orderings and block keys live
+// with the committee and are not logged.
+func (mp *MEVMempool) OpenWAL(path string, opts mevwal.Options) error {
+	if mp.committee != nil {
+		return errors.New("threshold pools do not support a WAL")
+	}
+	w, records, err := mevwal.Open(path, opts)
+	if err != nil {
+		return err
+	}
+
+	mp.mutex.Lock()
+	defer mp.mutex.Unlock()
+	if mp.wal != nil {
+		w.Close()
+		return errors.New("pool already has a WAL")
+	}
+
+	live := make(map[string]*Transaction)
+	var order []string
+	for _, rec := range records {
+		switch rec.Type {
+		case walAdd:
+			var tx Transaction
+			if err := json.Unmarshal(rec.Data, &tx); err != nil {
+				w.Close()
+				return err
+			}
+			if _, ok := live[tx.ID]; !ok {
+				order = append(order, tx.ID)
+			}
+			live[tx.ID] = &tx
+		case walRemove:
+			delete(live, string(rec.Data))
+		}
+	}
+	for _, id := range order {
+		if tx, ok := live[id]; ok && mp.findTx(id) == nil {
+			mp.transactions = append(mp.transactions, tx)
+		}
+	}
+	mp.restoreOrder()
+	mp.wal = w
+
+	// start from a compact log so replay cost tracks the live pool
+	return mp.compactWAL()
+}
+
+// CompactWAL rewrites the log with only pooled and in-flight entries.
+func (mp *MEVMempool) CompactWAL() error {
+	mp.mutex.Lock()
+	defer mp.mutex.Unlock()
+	return mp.compactWAL()
+}
+
+// compactWAL drops consumed and expired entries from the log. Caller holds the lock.
+func (mp *MEVMempool) compactWAL() error {
+	if mp.wal == nil {
+		return errors.New("pool has no WAL")
+	}
+	var live []mevwal.Record
+	add := func(tx *Transaction) error {
+		data, err := json.Marshal(tx)
+		if err != nil {
+			return err
+		}
+		live = append(live, mevwal.Record{Type: walAdd, Data: data})
+		return nil
+	}
+	for _, tx := range mp.transactions {
+		if err := add(tx); err != nil {
+			return err
+		}
+	}
+	for _, l := range mp.inflight {
+		if err := add(l.tx); err != nil {
+			return err
+		}
+	}
+	return mp.wal.Compact(live)
+}
+
+// WALErr returns the first failure to write the log, including removals by
+// calls that cannot return an error (Ack, Expire, SetSenderNonce, retrieval),
+// or nil. Entries whose removal was lost are served again after a restart.
+func (mp *MEVMempool) WALErr() error {
+	mp.mutex.RLock()
+	defer mp.mutex.RUnlock()
+	if mp.walErr == nil && mp.wal != nil {
+		return mp.wal.Err()
+	}
+	return mp.walErr
+}
+
+// logAdd records a new or resealed entry. Caller holds the lock.
+func (mp *MEVMempool) logAdd(tx *Transaction) error {
+	if mp.wal == nil {
+		return nil
+	}
+	if mp.walErr != nil {
+		return mp.walErr
+	}
+	data, err := json.Marshal(tx)
+	if err != nil {
+		return err
+	}
+	return mp.walFailed(mp.wal.Append(mevwal.Record{Type: walAdd, Data: data}))
+}
+
+// logRemove records that an entry left the pool. Callers that cannot return
+// an error may ignore the result; walFailed keeps it for WALErr. Caller holds
+// the lock.
+func (mp *MEVMempool) logRemove(id string) error {
+	if mp.wal == nil {
+		return nil
+	}
+	return mp.walFailed(mp.wal.Append(mevwal.Record{Type: walRemove, Data: []byte(id)}))
+}
+
+// walFailed keeps the first log write failure for WALErr and returns err.
+// Caller holds the lock.
+func (mp *MEVMempool) walFailed(err error) error {
+	if err != nil && mp.walErr == nil {
+		mp.walErr = fmt.Errorf("wal: %w", err)
+	}
+	return err
+}
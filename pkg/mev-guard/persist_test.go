@@ -0,0 +1,118 @@
+// This file contains tests for WAL-backed recovery and compaction of the
+// encrypted pool, and for reporting failed log writes.
+
+package mevguard
+
+import (
+	"crypto/rand"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mellis0303/mev-vem/pkg/mev-wal"
+)
+
+func openDurablePool(t *testing.T, key []byte, path string) *MEVMempool {
+	t.Helper()
+	pool, err := NewMEVMempool(key, testChainID)
+	if err != nil {
+		t.Fatalf("NewMEVMempool: %v", err)
+	}
+	if err := pool.OpenWAL(path, mevwal.Options{}); err != nil {
+		t.Fatalf("OpenWAL: %v", err)
+	}
+	return pool
+}
+
+func TestWALRecovery(t *testing.T) {
+	key := make([]byte, 32)
+	rand.Read(key)
+	path := filepath.Join(t.TempDir(), "pool.wal")
+
+	pool := openDurablePool(t, key, path)
+	addSealed(t, pool, "0xA", 1, 0)
+	addSealed(t, pool, "0xB", 1, 0)
+	addSealed(t, pool, "0xC", 1, 0)
+	txs, _ := pool.RetrieveTransactions()
+	if len(txs) != 3 {
+		t.Fatalf("RetrieveTransactions = %d txs", len(txs))
+	}
+	pool.Ack(txs[0].ID)
+	pool.Nack(txs[1].ID) // txs[2] stays in flight
+	pool.Close()
+
+	pool = openDurablePool(t, key, path)
+	defer pool.Close()
+	recovered, err := pool.RetrieveTransactions()
+	if err != nil {
+		t.Fatalf("RetrieveTransactions after reopen: %v", err)
+	}
+	if len(recovered) != 2 || recovered[0].From != "0xB" || recovered[1].From != "0xC" {
+		t.Fatalf("recovered %d txs, want 0xB then 0xC", len(recovered))
+	}
+	if recovered[0].EncryptedData != "0xB" {
+		t.Errorf("recovered payload = %q", recovered[0].EncryptedData)
+	}
+}
+
+func TestWALCompaction(t *testing.T) {
+	key := make([]byte, 32)
+	rand.Read(key)
+	path := filepath.Join(t.TempDir(), "pool.wal")
+
+	pool := openDurablePool(t, key, path)
+	for i := 0; i < 20; i++ {
+		addSealed(t, pool, "0xA", uint64(i), 0)
+	}
+	txs, _ := pool.RetrieveTransactions()
+	for _, tx := range txs[1:] {
+		pool.Ack(tx.ID)
+	}
+	pool.Nack(txs[0].ID)
+	before, _ := os.Stat(path)
+	if err := pool.CompactWAL(); err != nil {
+		t.Fatalf("CompactWAL: %v", err)
+	}
+	pool.Close()
+
+	after, _ := os.Stat(path)
+	if after.Size() >= before.Size() {
+		t.Errorf("compaction did not shrink the log (%d -> %d bytes)", before.Size(), after.Size())
+	}
+	w, records, err := mevwal.Open(path, mevwal.Options{})
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	w.Close()
+	if len(records) != 1 || records[0].Type != walAdd {
+		t.Errorf("compacted log holds %d records, want 1 add", len(records))
+	}
+}
+
+func TestWALFailureIsReported(t *testing.T) {
+	key := make([]byte, 32)
+	rand.Read(key)
+	pool := openDurablePool(t, key, filepath.Join(t.TempDir(), "pool.wal"))
+	addSealed(t, pool, "0xA", 1, 0)
+	txs, _ := pool.RetrieveTransactions()
+	if err := pool.WALErr(); err != nil {
+		t.Fatalf("WALErr = %v on a healthy log", err)
+	}
+
+	// the ack cannot be logged; it is kept for WALErr
+	pool.wal.Close()
+	if n := pool.Ack(txs[0].ID); n != 1 {
+		t.Fatalf("Ack = %d", n)
+	}
+	if err := pool.WALErr(); !errors.Is(err, mevwal.ErrClosed) {
+		t.Errorf("WALErr = %v, want ErrClosed", err)
+	}
+
+	// and new txs are refused rather than accepted without a log entry
+	client := &Client{PoolKey: pool.PublicKey(), ChainID: testChainID}
+	envelope, _ := client.Seal(TxContext{From: "0xB", Nonce: 1}, []byte("order"))
+	if err := pool.AddTransaction(envelope, 1, "0xB"); err == nil {
+		t.Errorf("expected AddTransaction to fail once the log has failed")
+	}
+}
@@ -0,0 +1,141 @@
+package mevguard
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// EntryError = why one pooled tx could not be decrypted.
+type EntryError struct {
+	ID    string
+	From  string
+	Nonce uint64
+	Err   error
+}
+
+func (e *EntryError) Error() string {
+	return fmt.Sprintf("tx %s from %s nonce %d: %v", e.ID, e.From, e.Nonce, e.Err)
+}
+
+func (e *EntryError) Unwrap() error { return e.Err }
+
+// RetrievalError is returned next to the txs that did decrypt when some
+// entries failed. The failed entries have been moved to quarantine.
+type RetrievalError struct {
+	Failed []*EntryError
+	Total  int
+}
+
+func (e *RetrievalError) Error() string {
+	return fmt.Sprintf("%d of %d pool entries failed to decrypt and were quarantined", len(e.Failed), e.Total)
+}
+
+// Unwrap exposes the per-entry errors to errors.Is and errors.As.
+func (e *RetrievalError) Unwrap() []error {
+	errs := make([]error, len(e.Failed))
+	for i, f := range e.Failed {
+		errs[i] = f
+	}
+	return errs
+}
+
+// QuarantinedTx = a pool entry set aside because it failed to decrypt.
+type QuarantinedTx struct {
+	Tx     *Transaction
+	Reason string
+	Err    error
+	Since  time.Time
+}
+
+// txID identifies an entry by its envelope at submission time. It stays the
+// same when the envelope is later resealed.
+func txID(envelope string) string {
+	sum := sha256.Sum256([]byte(envelope))
+	return hex.EncodeToString(sum[:8])
+}
+
+// quarantineReason classifies a decryption failure for operators.
+func quarantineReason(err error) string {
+	var integrityErr *IntegrityError
+	switch {
+	case errors.As(err, &integrityErr):
+		return "integrity"
+	default:
+		return "undecryptable"
+	}
+}
+
+// openEach decrypts txs with open, moving failures to quarantine. It returns
+// the decrypted copies and a *RetrievalError if anything failed. Caller holds
+// the write lock.
+func (mp *MEVMempool) openEach(txs []*Transaction, open func(*Transaction) ([]byte, error)) ([]*Transaction, error) {
+	var decryptedTxs []*Transaction
+	var failed []*EntryError
+	bad := make(map[*Transaction]bool)
+	for _, tx := range txs {
+		decData, err := open(tx)
+		if err != nil {
+			failed = append(failed, &EntryError{ID: tx.ID, From: tx.From, Nonce: tx.Nonce, Err: err})
+			mp.quarantine = append(mp.quarantine, &QuarantinedTx{Tx: tx, Reason: quarantineReason(err), Err: err, Since: time.Now()})
+			bad[tx] = true
+			mp.logRemove(tx.ID)
+			continue
+		}
+		decryptedTxs = append(decryptedTxs, &Transaction{
+			ID:            tx.ID,
+			EncryptedData: string(decData),
+			Nonce:         tx.Nonce,
+			From:          tx.From,
+			ChainID:       tx.ChainID,
+			TargetBlock:   tx.TargetBlock,
+		})
+	}
+	if len(failed) == 0 {
+		return decryptedTxs, nil
+	}
+
+	var kept []*Transaction
+	for _, tx := range mp.transactions {
+		if !bad[tx] {
+			kept = append(kept, tx)
+		}
+	}
+	mp.transactions = kept
+	return decryptedTxs, &RetrievalError{Failed: failed, Total: len(txs)}
+}
+
+// Quarantine lists entries that failed to decrypt, oldest first.
+func (mp *MEVMempool) Quarantine() []*QuarantinedTx {
+	mp.mutex.RLock()
+	defer mp.mutex.RUnlock()
+	return append([]*QuarantinedTx(nil), mp.quarantine...)
+}
+
+// PurgeQuarantine drops the given quarantined entries, or all of them when no
+// IDs are passed, and returns how many were dropped.
+func (mp *MEVMempool) PurgeQuarantine(ids ...string) int {
+	mp.mutex.Lock()
+	defer mp.mutex.Unlock()
+
+	if len(ids) == 0 {
+		n := len(mp.quarantine)
+		mp.quarantine = nil
+		return n
+	}
+	drop := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		drop[id] = true
+	}
+	var kept []*QuarantinedTx
+	for _, q := range mp.quarantine {
+		if !drop[q.Tx.ID] {
+			kept = append(kept, q)
+		}
+	}
+	n := len(mp.quarantine) - len(kept)
+	mp.quarantine = kept
+	return n
+}
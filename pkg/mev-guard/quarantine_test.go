@@ -0,0 +1,78 @@
+// This file contains tests for per-entry error isolation and quarantine in
+// pool retrieval.
+
+package mevguard
+
+import (
+	"encoding/base64"
+	"errors"
+	"testing"
+)
+
+func TestBadEntryDoesNotBlockRetrieval(t *testing.T) {
+	pool := newTestPool(t)
+	client := &Client{PoolKey: pool.PublicKey(), ChainID: testChainID}
+
+	add := func(from string, nonce uint64, data string) {
+		envelope, _ := client.Seal(TxContext{From: from, Nonce: nonce}, []byte(data))
+		if err := pool.AddTransaction(envelope, nonce, from); err != nil {
+			t.Fatalf("AddTransaction: %v", err)
+		}
+	}
+	add("0xAlice", 1, "alice order")
+	add("0xMallory", 1, "mallory order")
+	add("0xBob", 1, "bob order")
+
+	// corrupt Mallory's entry in place
+	raw, _ := base64.StdEncoding.DecodeString(pool.transactions[1].EncryptedData)
+	raw[len(raw)-1] ^= 1
+	pool.transactions[1].EncryptedData = base64.StdEncoding.EncodeToString(raw)
+	badID := pool.transactions[1].ID
+
+	txs, err := pool.RetrieveTransactions()
+	var retrievalErr *RetrievalError
+	if !errors.As(err, &retrievalErr) {
+		t.Fatalf("expected *RetrievalError, got %v", err)
+	}
+	if len(txs) != 2 || txs[0].EncryptedData != "alice order" || txs[1].EncryptedData != "bob order" {
+		t.Errorf("honest txs not returned: %+v", txs)
+	}
+	if len(retrievalErr.Failed) != 1 || retrievalErr.Failed[0].ID != badID || retrievalErr.Total != 3 {
+		t.Errorf("unexpected failure report %+v", retrievalErr.Failed)
+	}
+	if !errors.Is(err, ErrIntegrity) {
+		t.Errorf("expected the report to wrap ErrIntegrity")
+	}
+
+	q := pool.Quarantine()
+	if len(q) != 1 || q[0].Tx.ID != badID || q[0].Reason != "integrity" {
+		t.Fatalf("unexpected quarantine %+v", q)
+	}
+
+	// quarantined entries are out of the pool, so the next retrieval is clean
+	pool.Nack(txs[0].ID, txs[1].ID)
+	txs, err = pool.RetrieveTransactions()
+	if err != nil || len(txs) != 2 {
+		t.Errorf("second retrieval = %d txs, %v", len(txs), err)
+	}
+
+	if n := pool.PurgeQuarantine("unknown"); n != 0 {
+		t.Errorf("purged %d entries for an unknown ID", n)
+	}
+	if n := pool.PurgeQuarantine(badID); n != 1 || len(pool.Quarantine()) != 0 {
+		t.Errorf("PurgeQuarantine(%s) = %d", badID, n)
+	}
+}
+
+func TestClosedPoolDoesNotQuarantine(t *testing.T) {
+	pool := newTestPool(t)
+	envelope, _ := (&Client{PoolKey: pool.PublicKey(), ChainID: testChainID}).Seal(TxContext{From: "0xA", Nonce: 1}, []byte("order"))
+	pool.AddTransaction(envelope, 1, "0xA")
+	pool.Close()
+	if _, err := pool.RetrieveTransactions(); err == nil {
+		t.Fatalf("expected closed pool to fail")
+	}
+	if len(pool.Quarantine()) != 0 {
+		t.Errorf("a closed pool must not quarantine honest entries")
+	}
+}
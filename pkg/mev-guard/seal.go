@@ -0,0 +1,242 @@
+package mevguard
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// Envelope versions. v1 = base64(0x01 || ephemeral pub || nonce || ciphertext);
+// v2 adds the recipient key ID after the version byte so keys can rotate;
+// v3 has the v2 layout but binds a TxContext as associated data.
+const (
+	envelopeV1 = 0x01
+	envelopeV2 = 0x02
+	envelopeV3 = 0x03
+	keyIDSize  = 8
+)
+
+// hkdfInfo separates keys derived for sealed mempool entries from other uses.
+const hkdfInfo = "mev-guard sealed tx"
+
+// deriveKey runs HKDF-SHA256 over the X25519 shared secret, salted with both
+// public keys so a ciphertext is tied to the recipient it was sealed for.
+func deriveKey(shared, ephPub, recipientPub []byte) ([]byte, error) {
+	salt := append(append([]byte{}, ephPub...), recipientPub...)
+	key := make([]byte, 32)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, shared, salt, []byte(hkdfInfo)), key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// sealTo encrypts data to an X25519 public key: ephemeral pub || nonce || ciphertext.
+func sealTo(pub *ecdh.PublicKey, data, ad []byte) ([]byte, error) {
+	eph, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	shared, err := eph.ECDH(pub)
+	if err != nil {
+		return nil, err
+	}
+	key, err := deriveKey(shared, eph.PublicKey().Bytes(), pub.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	aesGCM, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aesGCM.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	out := append(eph.PublicKey().Bytes(), nonce...)
+	return aesGCM.Seal(out, nonce, data, ad), nil
+}
+
+// openWith decrypts the output of sealTo with the recipient's private key.
+func openWith(priv *ecdh.PrivateKey, sealed, ad []byte) ([]byte, error) {
+	if len(sealed) < 32 {
+		return nil, errors.New("ciphertext too short")
+	}
+	ephPub, err := ecdh.X25519().NewPublicKey(sealed[:32])
+	if err != nil {
+		return nil, err
+	}
+	shared, err := priv.ECDH(ephPub)
+	if err != nil {
+		return nil, err
+	}
+	key, err := deriveKey(shared, sealed[:32], priv.PublicKey().Bytes())
+	if err != nil {
+		return nil, err
+	}
+	aesGCM, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	rest := sealed[32:]
+	if len(rest) < aesGCM.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	nonce, ciphertext := rest[:aesGCM.NonceSize()], rest[aesGCM.NonceSize():]
+	return aesGCM.Open(nil, nonce, ciphertext, ad)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// TxContext = the tx metadata bound to a v3 envelope as AEAD associated data.
+// TargetBlock 0 means the tx is not tied to a block.
+type TxContext struct {
+	From        string
+	Nonce       uint64
+	ChainID     uint64
+	TargetBlock uint64
+}
+
+// associatedData = header || len(from) || lower(from) || nonce || chain ID ||
+// target block, integers big-endian. The header covers version and key ID.
+func (c TxContext) associatedData(header []byte) []byte {
+	from := strings.ToLower(c.From)
+	ad := append([]byte{}, header...)
+	ad = binary.BigEndian.AppendUint16(ad, uint16(len(from)))
+	ad = append(ad, from...)
+	ad = binary.BigEndian.AppendUint64(ad, c.Nonce)
+	ad = binary.BigEndian.AppendUint64(ad, c.ChainID)
+	return binary.BigEndian.AppendUint64(ad, c.TargetBlock)
+}
+
+// ErrIntegrity is wrapped by every IntegrityError.
+var ErrIntegrity = errors.New("envelope failed integrity check")
+
+// IntegrityError means an envelope did not authenticate: its ciphertext was
+// altered, or it was moved to a different sender, nonce, chain or block.
+type IntegrityError struct {
+	From    string
+	Nonce   uint64
+	KeyID   string
+	Version byte
+}
+
+func (e *IntegrityError) Error() string {
+	return fmt.Sprintf("%v: v%d envelope from %s nonce %d (key %s)", ErrIntegrity, e.Version, e.From, e.Nonce, e.KeyID)
+}
+
+func (e *IntegrityError) Unwrap() error { return ErrIntegrity }
+
+// envelope = a decoded submission. v1 envelopes carry no key ID; only v3
+// envelopes bind the tx context.
+type envelope struct {
+	version byte
+	keyID   string
+	header  []byte // version || key ID
+	sealed  []byte // ephemeral pub || nonce || ciphertext
+}
+
+// KeyID identifies a pool key in envelopes: hex of the first 8 bytes of
+// sha256(public key).
+func KeyID(pub *ecdh.PublicKey) string {
+	sum := sha256.Sum256(pub.Bytes())
+	return hex.EncodeToString(sum[:keyIDSize])
+}
+
+// sealEnvelope seals data to pub as a v3 envelope, base64(0x03 || key ID ||
+// sealed), with ctx as associated data.
+func sealEnvelope(pub *ecdh.PublicKey, data []byte, ctx TxContext) (string, error) {
+	id, _ := hex.DecodeString(KeyID(pub))
+	header := append([]byte{envelopeV3}, id...)
+	sealed, err := sealTo(pub, data, ctx.associatedData(header))
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(append(header, sealed...)), nil
+}
+
+// parseEnvelope decodes an envelope and checks its version and size, without
+// decrypting it.
+func parseEnvelope(s string) (*envelope, error) {
+	raw, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(raw) == 0 {
+		return nil, errors.New("empty envelope")
+	}
+	env := &envelope{version: raw[0]}
+	switch raw[0] {
+	case envelopeV1:
+		env.header, env.sealed = raw[:1], raw[1:]
+	case envelopeV2, envelopeV3:
+		if len(raw) < 1+keyIDSize {
+			return nil, errors.New("ciphertext too short")
+		}
+		env.keyID = hex.EncodeToString(raw[1 : 1+keyIDSize])
+		env.header, env.sealed = raw[:1+keyIDSize], raw[1+keyIDSize:]
+	default:
+		return nil, fmt.Errorf("unsupported envelope version %d", raw[0])
+	}
+	// ephemeral key, GCM nonce and tag
+	if len(env.sealed) < 32+12+16 {
+		return nil, errors.New("ciphertext too short")
+	}
+	return env, nil
+}
+
+// legacy reports whether the envelope predates context binding.
+func (env *envelope) legacy() bool {
+	return env.version < envelopeV3
+}
+
+// open decrypts the envelope, checking ctx for v3 envelopes. Authentication
+// failures are returned as *IntegrityError.
+func (env *envelope) open(priv *ecdh.PrivateKey, ctx TxContext) ([]byte, error) {
+	var ad []byte
+	if !env.legacy() {
+		ad = ctx.associatedData(env.header)
+	}
+	data, err := openWith(priv, env.sealed, ad)
+	if err != nil {
+		return nil, &IntegrityError{From: ctx.From, Nonce: ctx.Nonce, KeyID: env.keyID, Version: env.version}
+	}
+	return data, nil
+}
+
+// openEnvelope decrypts an envelope with the recipient's private key.
+func openEnvelope(priv *ecdh.PrivateKey, s string, ctx TxContext) ([]byte, error) {
+	env, err := parseEnvelope(s)
+	if err != nil {
+		return nil, err
+	}
+	if env.keyID != "" && env.keyID != KeyID(priv.PublicKey()) {
+		return nil, fmt.Errorf("envelope sealed to key %s", env.keyID)
+	}
+	return env.open(priv, ctx)
+}
+
+// ParsePublicKey decodes a hex X25519 public key as printed by the pool.
+func ParsePublicKey(s string) (*ecdh.PublicKey, error) {
+	b, err := hex.DecodeString(strings.TrimPrefix(s, "0x"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key: %w", err)
+	}
+	return ecdh.X25519().NewPublicKey(b)
+}
@@ -0,0 +1,91 @@
+// This file contains tests for binding tx context to envelopes and upgrading
+// legacy envelopes.
+
+package mevguard
+
+import (
+	"encoding/base64"
+	"errors"
+	"testing"
+)
+
+func TestTamperedContextFailsIntegrity(t *testing.T) {
+	pool := newTestPool(t)
+	client, _ := NewClient(PublicKeyHex(pool.PublicKey()), testChainID)
+	envelope, _ := client.Seal(TxContext{From: "0xAlice", Nonce: 7, TargetBlock: 100}, []byte("order"))
+	if err := pool.AddTransactionForBlock(envelope, 7, "0xAlice", 100); err != nil {
+		t.Fatalf("AddTransactionForBlock: %v", err)
+	}
+	honest := &Transaction{EncryptedData: envelope, From: "0xAlice", Nonce: 7, ChainID: testChainID, TargetBlock: 100}
+	if _, err := pool.Decrypt(honest); err != nil {
+		t.Fatalf("Decrypt honest tx: %v", err)
+	}
+	// sender addresses are case-insensitive
+	mixed := *honest
+	mixed.From = "0XALICE"
+	if _, err := pool.Decrypt(&mixed); err != nil {
+		t.Errorf("Decrypt with different address case: %v", err)
+	}
+
+	for name, mutate := range map[string]func(tx *Transaction){
+		"sender": func(tx *Transaction) { tx.From = "0xBob" },
+		"nonce":  func(tx *Transaction) { tx.Nonce = 8 },
+		"chain":  func(tx *Transaction) { tx.ChainID = 10 },
+		"block":  func(tx *Transaction) { tx.TargetBlock = 101 },
+	} {
+		tx := *honest
+		mutate(&tx)
+		_, err := pool.Decrypt(&tx)
+		var integrityErr *IntegrityError
+		if !errors.As(err, &integrityErr) || !errors.Is(err, ErrIntegrity) {
+			t.Errorf("%s swap: expected *IntegrityError, got %v", name, err)
+		}
+	}
+
+	raw, _ := base64.StdEncoding.DecodeString(envelope)
+	raw[len(raw)-1] ^= 1
+	tampered := *honest
+	tampered.EncryptedData = base64.StdEncoding.EncodeToString(raw)
+	if _, err := pool.Decrypt(&tampered); !errors.Is(err, ErrIntegrity) {
+		t.Errorf("flipped ciphertext bit: expected ErrIntegrity, got %v", err)
+	}
+}
+
+func TestUpgradeLegacyEnvelopes(t *testing.T) {
+	pool := newTestPool(t)
+	pub := pool.PublicKey()
+	sealed, _ := sealTo(pub, []byte("v1 order"), nil)
+	v1 := base64.StdEncoding.EncodeToString(append([]byte{envelopeV1}, sealed...))
+	if err := pool.AddTransaction(v1, 1, "0xAlice"); err == nil {
+		t.Fatalf("expected legacy envelopes to be rejected by default")
+	}
+	pool.SetAcceptLegacy(true)
+	if err := pool.AddTransaction(v1, 1, "0xAlice"); err != nil {
+		t.Fatalf("AddTransaction(v1): %v", err)
+	}
+
+	upgraded, err := pool.UpgradeEnvelopes()
+	if err != nil || upgraded != 1 {
+		t.Fatalf("UpgradeEnvelopes = %d, %v", upgraded, err)
+	}
+	env, _ := parseEnvelope(pool.transactions[0].EncryptedData)
+	if env.version != envelopeV3 || env.keyID != KeyID(pub) {
+		t.Errorf("expected a v3 envelope for the pool key, got v%d key %s", env.version, env.keyID)
+	}
+
+	// the upgraded envelope is now bound to its sender
+	moved := *pool.transactions[0]
+	moved.From = "0xMallory"
+	if _, err := pool.Decrypt(&moved); !errors.Is(err, ErrIntegrity) {
+		t.Errorf("expected upgraded envelope to be bound to its sender, got %v", err)
+	}
+	txs, err := pool.RetrieveTransactions()
+	if err != nil || len(txs) != 1 || txs[0].EncryptedData != "v1 order" {
+		t.Errorf("RetrieveTransactions = %+v, %v", txs, err)
+	}
+
+	pool.SetAcceptLegacy(false)
+	if err := pool.AddTransaction(v1, 2, "0xAlice"); err == nil {
+		t.Errorf("expected legacy envelopes to be rejected")
+	}
+}
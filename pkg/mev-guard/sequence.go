@@ -0,0 +1,367 @@
+package mevguard
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	"github.com/decred/dcrd/dcrec/secp256k1/v4/ecdsa"
+)
+
+// DefaultGapTimeout is how long a tx waits behind a missing nonce before it
+// is dropped.
+const DefaultGapTimeout = 30 * time.Second
+
+var (
+	// ErrNonceTooLow is returned for a tx below its sender's next nonce.
+	ErrNonceTooLow = errors.New("nonce too low")
+	// ErrReplacementUnderpriced is returned when a tx with the same sender
+	// and nonce is already pooled at an equal or higher fee.
+	ErrReplacementUnderpriced = errors.New("replacement tx underpriced")
+	// ErrFeeUnsigned is returned for a fee without a valid signature from the
+	// sender over it and the envelope.
+	ErrFeeUnsigned = errors.New("fee not signed by sender")
+)
+
+// NonceGap = a sender whose queued txs wait on a missing nonce.
+type NonceGap struct {
+	From    string
+	Missing uint64    // first nonce not in the pool
+	Held    int       // txs waiting behind it
+	Since   time.Time // when the oldest held tx arrived
+}
+
+// senderNonce = the next nonce expected from a sender, as learned from Ack or
+// SetSenderNonce.
+type senderNonce struct {
+	next uint64
+	at   time.Time
+}
+
+// senderQueue = one sender's pooled txs split around the first nonce gap.
+type senderQueue struct {
+	ready   []*Transaction // contiguous from the expected nonce, by nonce
+	held    []*Transaction // behind the gap, by nonce
+	stale   []*Transaction // below the sender's next nonce
+	missing uint64
+}
+
+// SetGapTimeout sets how long txs behind a nonce gap are held before they are
+// dropped. 0 holds them until their TTL.
+func (mp *MEVMempool) SetGapTimeout(d time.Duration) {
+	mp.mutex.Lock()
+	defer mp.mutex.Unlock()
+	mp.gapTimeout = d
+}
+
+// SetSenderNonce records a sender's next nonce, e.g. from chain state. Pooled
+// txs below it can never be included and are dropped.
+func (mp *MEVMempool) SetSenderNonce(from string, next uint64) int {
+	mp.mutex.Lock()
+	defer mp.mutex.Unlock()
+	mp.nonces[from] = &senderNonce{next: next, at: time.Now()}
+
+	dropped := 0
+	var kept []*Transaction
+	for _, tx := range mp.transactions {
+		if tx.From == from && tx.Nonce < next {
+			mp.logRemove(tx.ID)
+			dropped++
+			continue
+		}
+		kept = append(kept, tx)
+	}
+	mp.transactions = kept
+	return dropped
+}
+
+// Gaps lists senders whose txs are held behind a missing nonce.
+func (mp *MEVMempool) Gaps() []NonceGap {
+	mp.mutex.RLock()
+	defer mp.mutex.RUnlock()
+	var gaps []NonceGap
+	for from, q := range mp.senderQueues() {
+		if len(q.held) == 0 {
+			continue
+		}
+		gap := NonceGap{From: from, Missing: q.missing, Held: len(q.held), Since: q.held[0].AddedAt}
+		for _, tx := range q.held[1:] {
+			if tx.AddedAt.Before(gap.Since) {
+				gap.Since = tx.AddedAt
+			}
+		}
+		gaps = append(gaps, gap)
+	}
+	sort.Slice(gaps, func(i, j int) bool { return gaps[i].From < gaps[j].From })
+	return gaps
+}
+
+// feeOf treats a missing fee as zero. Fees are only stored once verifyFee has
+// checked them, so an unsigned tx never outranks a signed one.
+func feeOf(tx *Transaction) *big.Int {
+	if tx.Fee == nil {
+		return new(big.Int)
+	}
+	return tx.Fee
+}
+
+// FeeDigest = keccak256("mev-guard fee" || chain ID || nonce || len(from) ||
+// lower(from) || len(fee) || fee || keccak256(envelope)), the digest a sender
+// signs to attach a fee to its tx (see AddTransactionWithFee).
+// The envelope hash covers the ciphertext, so the signature also binds the
+// sealed tx itself.
+func FeeDigest(chainID uint64, envelope, from string, nonce uint64, fee *big.Int) []byte {
+	addr := strings.ToLower(from)
+	var amount []byte
+	if fee != nil {
+		amount = fee.Bytes()
+	}
+	var fields []byte
+	fields = binary.BigEndian.AppendUint64(fields, chainID)
+	fields = binary.BigEndian.AppendUint64(fields, nonce)
+	fields = binary.BigEndian.AppendUint16(fields, uint16(len(addr)))
+	fields = append(fields, addr...)
+	fields = binary.BigEndian.AppendUint16(fields, uint16(len(amount)))
+	fields = append(fields, amount...)
+	return keccak256([]byte("mev-guard fee"), fields, keccak256([]byte(envelope)))
+}
+
+// SignFee signs FeeDigest with the sender's secp256k1 key and
+// returns an r || s || v hex signature.
+func SignFee(key []byte, chainID uint64, envelope, from string, nonce uint64, fee *big.Int) (string, error) {
+	if len(key) != 32 {
+		return "", errors.New("signing key must be 32 bytes long")
+	}
+	compact := ecdsa.SignCompact(secp256k1.PrivKeyFromBytes(key), FeeDigest(chainID, envelope, from, nonce, fee), false)
+	sig := append(append([]byte{}, compact[1:]...), compact[0])
+	return "0x" + hex.EncodeToString(sig), nil
+}
+
+// SenderAddress returns the address of a secp256k1 key, the From that
+// SignFee signatures verify against.
+func SenderAddress(key []byte) string {
+	return "0x" + hex.EncodeToString(pubkeyAddress(secp256k1.PrivKeyFromBytes(key).PubKey()))
+}
+
+// pubkeyAddress = the last 20 bytes of keccak256 of the uncompressed key.
+func pubkeyAddress(pub *secp256k1.PublicKey) []byte {
+	return keccak256(pub.SerializeUncompressed()[1:])[12:]
+}
+
+// verifyFee checks that signature over tx's envelope and fee was made by
+// tx.From. Signatures are r || s || v with v in {0, 1, 27, 28}; high-s
+// signatures are refused.
+func verifyFee(tx *Transaction, signature string) error {
+	want, err := hex.DecodeString(strings.TrimPrefix(strings.ToLower(tx.From), "0x"))
+	if err != nil || len(want) != 20 {
+		return fmt.Errorf("%w: %s is not an address", ErrFeeUnsigned, tx.From)
+	}
+	sig, err := hex.DecodeString(strings.TrimPrefix(signature, "0x"))
+	if err != nil || len(sig) != 65 {
+		return fmt.Errorf("%w: signature must be 65 bytes of hex", ErrFeeUnsigned)
+	}
+	v := sig[64]
+	if v >= 27 {
+		v -= 27
+	}
+	var s secp256k1.ModNScalar
+	if overflow := s.SetByteSlice(sig[32:64]); v > 1 || overflow || s.IsOverHalfOrder() {
+		return fmt.Errorf("%w: malformed signature", ErrFeeUnsigned)
+	}
+	compact := append([]byte{27 + v}, sig[:64]...)
+	pub, _, err := ecdsa.RecoverCompact(compact, FeeDigest(tx.ChainID, tx.EncryptedData, tx.From, tx.Nonce, tx.Fee))
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrFeeUnsigned, err)
+	}
+	if got := pubkeyAddress(pub); !bytes.Equal(got, want) {
+		return fmt.Errorf("%w: signed by 0x%x", ErrFeeUnsigned, got)
+	}
+	return nil
+}
+
+// admit applies nonce rules to a new tx: it rejects stale nonces and decides
+// whether it replaces a pooled tx with the same sender and nonce, which it
+// returns. Caller holds the lock.
+func (mp *MEVMempool) admit(tx *Transaction) (*Transaction, error) {
+	if n, ok := mp.nonces[tx.From]; ok && tx.Nonce < n.next {
+		return nil, fmt.Errorf("%w: %s nonce %d, next is %d", ErrNonceTooLow, tx.From, tx.Nonce, n.next)
+	}
+	for _, l := range mp.inflight {
+		if l.tx.From == tx.From && l.tx.Nonce == tx.Nonce {
+			return nil, fmt.Errorf("%s nonce %d is in flight and cannot be replaced", tx.From, tx.Nonce)
+		}
+	}
+	for _, old := range mp.transactions {
+		if old.From != tx.From || old.Nonce != tx.Nonce {
+			continue
+		}
+		if feeOf(tx).Cmp(feeOf(old)) <= 0 {
+			return nil, fmt.Errorf("%w: %s nonce %d pays %s, new tx %s", ErrReplacementUnderpriced, tx.From, tx.Nonce, feeOf(old), feeOf(tx))
+		}
+		return old, nil
+	}
+	return nil, nil
+}
+
+// replace swaps a pooled tx for its replacement in place. It returns an error
+// if the removal of old could not be logged. Caller holds the lock.
+func (mp *MEVMempool) replace(old, tx *Transaction) error {
+	for i, pooled := range mp.transactions {
+		if pooled == old {
+			mp.transactions[i] = tx
+			return mp.logRemove(old.ID)
+		}
+	}
+	return nil
+}
+
+// senderQueues groups pooled txs by sender and finds each sender's first nonce
+// gap. The expected nonce is the sender's known next nonce, or else the lowest
+// one pooled or in flight; in-flight nonces count as present. Caller holds the
+// lock.
+func (mp *MEVMempool) senderQueues() map[string]*senderQueue {
+	pending := make(map[string][]*Transaction)
+	for _, tx := range mp.transactions {
+		pending[tx.From] = append(pending[tx.From], tx)
+	}
+	leased := make(map[string]map[uint64]bool)
+	for _, l := range mp.inflight {
+		if leased[l.tx.From] == nil {
+			leased[l.tx.From] = make(map[uint64]bool)
+		}
+		leased[l.tx.From][l.tx.Nonce] = true
+	}
+
+	queues := make(map[string]*senderQueue, len(pending))
+	for from, txs := range pending {
+		sort.SliceStable(txs, func(i, j int) bool { return txs[i].Nonce < txs[j].Nonce })
+
+		expected := txs[0].Nonce
+		if n, ok := mp.nonces[from]; ok {
+			expected = n.next
+		} else {
+			for nonce := range leased[from] {
+				if nonce < expected {
+					expected = nonce
+				}
+			}
+		}
+
+		q := &senderQueue{}
+		i := 0
+		for ; i < len(txs) && txs[i].Nonce < expected; i++ {
+			q.stale = append(q.stale, txs[i])
+		}
+		for {
+			if leased[from][expected] {
+				expected++
+				continue
+			}
+			if i < len(txs) && txs[i].Nonce == expected {
+				q.ready = append(q.ready, txs[i])
+				expected++
+				i++
+				continue
+			}
+			break
+		}
+		q.held = txs[i:]
+		q.missing = expected
+		queues[from] = q
+	}
+	return queues
+}
+
+// sequence returns the txs that can be served now: each sender's contiguous
+// run of nonces, in nonce order. Senders keep the slots their txs arrived in,
+// so one sender's backlog does not jump ahead of others. Stale txs and txs
+// held behind a gap for longer than the gap timeout are dropped. Caller holds
+// the lock.
+func (mp *MEVMempool) sequence(now time.Time) []*Transaction {
+	queues := mp.senderQueues()
+	drop := make(map[*Transaction]bool)
+	var ready []*Transaction
+	for _, q := range queues {
+		for _, tx := range q.stale {
+			drop[tx] = true
+		}
+		for _, tx := range q.held {
+			if mp.gapTimeout > 0 && now.Sub(tx.AddedAt) >= mp.gapTimeout {
+				drop[tx] = true
+			}
+		}
+		ready = append(ready, q.ready...)
+	}
+
+	if len(drop) > 0 {
+		var kept []*Transaction
+		for _, tx := range mp.transactions {
+			if drop[tx] {
+				mp.logRemove(tx.ID)
+				continue
+			}
+			kept = append(kept, tx)
+		}
+		mp.transactions = kept
+	}
+	return interleave(ready)
+}
+
+// interleave orders txs by arrival, then refills each sender's slots with its
+// txs in nonce order.
+func interleave(txs []*Transaction) []*Transaction {
+	slots := append([]*Transaction(nil), txs...)
+	sort.SliceStable(slots, func(i, j int) bool { return slots[i].AddedAt.Before(slots[j].AddedAt) })
+
+	byNonce := make(map[string][]*Transaction)
+	for _, tx := range txs {
+		byNonce[tx.From] = append(byNonce[tx.From], tx)
+	}
+	for _, q := range byNonce {
+		sort.SliceStable(q, func(i, j int) bool { return q[i].Nonce < q[j].Nonce })
+	}
+	ordered := make([]*Transaction, len(slots))
+	for i, slot := range slots {
+		q := byNonce[slot.From]
+		ordered[i] = q[0]
+		byNonce[slot.From] = q[1:]
+	}
+	return ordered
+}
+
+// ackNonce advances a sender's next nonce past an acked tx. Caller holds the lock.
+func (mp *MEVMempool) ackNonce(tx *Transaction, now time.Time) {
+	n, ok := mp.nonces[tx.From]
+	if !ok {
+		n = &senderNonce{}
+		mp.nonces[tx.From] = n
+	}
+	if tx.Nonce+1 > n.next {
+		n.next = tx.Nonce + 1
+	}
+	n.at = now
+}
+
+// pruneNonces forgets senders with nothing pooled or in flight whose nonce was
+// last updated before cutoff. Caller holds the lock.
+func (mp *MEVMempool) pruneNonces(cutoff time.Time) {
+	active := make(map[string]bool)
+	for _, tx := range mp.transactions {
+		active[tx.From] = true
+	}
+	for _, l := range mp.inflight {
+		active[l.tx.From] = true
+	}
+	for from, n := range mp.nonces {
+		if !active[from] && n.at.Before(cutoff) {
+			delete(mp.nonces, from)
+		}
+	}
+}
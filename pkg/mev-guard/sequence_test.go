@@ -0,0 +1,196 @@
+// This file contains tests for per-sender nonce ordering, signed fees,
+// fee-based replacement and nonce gap handling.
+
+package mevguard
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+)
+
+// add seals data for from and submits it without a fee.
+func add(t *testing.T, pool *MEVMempool, from string, nonce uint64, data string) error {
+	t.Helper()
+	client := &Client{PoolKey: pool.PublicKey(), ChainID: testChainID}
+	envelope, err := client.Seal(TxContext{From: from, Nonce: nonce}, []byte(data))
+	if err != nil {
+		t.Fatalf("Seal: %v", err)
+	}
+	return pool.AddTransaction(envelope, nonce, from)
+}
+
+// addWithFee seals data for the sender of key and submits it with a signed
+// fee.
+func addWithFee(t *testing.T, pool *MEVMempool, key []byte, nonce uint64, fee int64, data string) error {
+	t.Helper()
+	from := SenderAddress(key)
+	client := &Client{PoolKey: pool.PublicKey(), ChainID: testChainID}
+	envelope, err := client.Seal(TxContext{From: from, Nonce: nonce}, []byte(data))
+	if err != nil {
+		t.Fatalf("Seal: %v", err)
+	}
+	sig, err := SignFee(key, testChainID, envelope, from, nonce, big.NewInt(fee))
+	if err != nil {
+		t.Fatalf("SignFee: %v", err)
+	}
+	return pool.AddTransactionWithFee(envelope, nonce, from, 0, big.NewInt(fee), sig)
+}
+
+func TestRetrievalOrdersEachSenderByNonce(t *testing.T) {
+	pool := newTestPool(t)
+	add(t, pool, "0xA", 3, "a3")
+	add(t, pool, "0xB", 1, "b1")
+	add(t, pool, "0xA", 1, "a1")
+	add(t, pool, "0xA", 2, "a2")
+
+	txs, err := pool.RetrieveTransactions()
+	if err != nil {
+		t.Fatalf("RetrieveTransactions: %v", err)
+	}
+	var got []string
+	for _, tx := range txs {
+		got = append(got, tx.EncryptedData)
+	}
+	want := []string{"a1", "b1", "a2", "a3"}
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+	}
+}
+
+func TestReplacementNeedsHigherFee(t *testing.T) {
+	pool := newTestPool(t)
+	key := randomKey()
+	if err := addWithFee(t, pool, key, 1, 10, "first"); err != nil {
+		t.Fatalf("add: %v", err)
+	}
+	if err := addWithFee(t, pool, key, 1, 10, "same fee"); !errors.Is(err, ErrReplacementUnderpriced) {
+		t.Errorf("expected ErrReplacementUnderpriced for an equal fee, got %v", err)
+	}
+	if err := addWithFee(t, pool, key, 1, 11, "bumped"); err != nil {
+		t.Fatalf("replacement: %v", err)
+	}
+	txs, _ := pool.RetrieveTransactions()
+	if len(txs) != 1 || txs[0].EncryptedData != "bumped" {
+		t.Fatalf("expected only the replacement, got %d txs", len(txs))
+	}
+	if err := addWithFee(t, pool, key, 1, 100, "late"); err == nil {
+		t.Errorf("expected an in-flight tx not to be replaceable")
+	}
+	pool.Ack(txs[0].ID)
+	if err := addWithFee(t, pool, key, 1, 100, "replay"); !errors.Is(err, ErrNonceTooLow) {
+		t.Errorf("expected ErrNonceTooLow after ack, got %v", err)
+	}
+}
+
+func TestFeeNeedsSenderSignature(t *testing.T) {
+	pool := newTestPool(t)
+	alice, mallory := randomKey(), randomKey()
+	from := SenderAddress(alice)
+	if err := addWithFee(t, pool, alice, 1, 10, "alice"); err != nil {
+		t.Fatalf("add: %v", err)
+	}
+	client := &Client{PoolKey: pool.PublicKey(), ChainID: testChainID}
+	envelope, _ := client.Seal(TxContext{From: from, Nonce: 1}, []byte("mallory"))
+
+	// a declared fee without a signature is refused
+	if err := pool.AddTransactionWithFee(envelope, 1, from, 0, big.NewInt(1000), ""); !errors.Is(err, ErrFeeUnsigned) {
+		t.Errorf("unsigned fee: expected ErrFeeUnsigned, got %v", err)
+	}
+	// and without a fee the tx cannot outbid alice
+	if err := pool.AddTransaction(envelope, 1, from); !errors.Is(err, ErrReplacementUnderpriced) {
+		t.Errorf("feeless replacement: expected ErrReplacementUnderpriced, got %v", err)
+	}
+
+	// nor does a signature by someone else count
+	sig, _ := SignFee(mallory, testChainID, envelope, from, 1, big.NewInt(1000))
+	if err := pool.AddTransactionWithFee(envelope, 1, from, 0, big.NewInt(1000), sig); !errors.Is(err, ErrFeeUnsigned) {
+		t.Errorf("fee signed by another key: expected ErrFeeUnsigned, got %v", err)
+	}
+
+	// and alice's signature does not carry over to a different fee
+	sig, _ = SignFee(alice, testChainID, envelope, from, 1, big.NewInt(20))
+	if err := pool.AddTransactionWithFee(envelope, 1, from, 0, big.NewInt(1000), sig); !errors.Is(err, ErrFeeUnsigned) {
+		t.Errorf("signature over another fee: expected ErrFeeUnsigned, got %v", err)
+	}
+
+	txs, _ := pool.RetrieveTransactions()
+	if len(txs) != 1 || txs[0].EncryptedData != "alice" {
+		t.Errorf("expected alice's tx to stay pooled, got %+v", txs)
+	}
+}
+
+func TestUnsignedTxCannotSquatSlot(t *testing.T) {
+	pool := newTestPool(t)
+	alice, mallory := randomKey(), randomKey()
+	from := SenderAddress(alice)
+	client := &Client{PoolKey: pool.PublicKey(), ChainID: testChainID}
+
+	// mallory takes alice's next slot first, claiming a huge fee
+	envelope, _ := client.Seal(TxContext{From: from, Nonce: 1}, []byte("squat"))
+	sig, _ := SignFee(mallory, testChainID, envelope, from, 1, big.NewInt(1_000_000))
+	if err := pool.AddTransactionWithFee(envelope, 1, from, 0, big.NewInt(1_000_000), sig); !errors.Is(err, ErrFeeUnsigned) {
+		t.Fatalf("forged fee: expected ErrFeeUnsigned, got %v", err)
+	}
+	if err := pool.AddTransaction(envelope, 1, from); err != nil {
+		t.Fatalf("feeless add: %v", err)
+	}
+
+	// the squatter counts as paying nothing, so alice's signed tx evicts it
+	if err := addWithFee(t, pool, alice, 1, 1, "alice"); err != nil {
+		t.Fatalf("alice's tx should replace the squatter: %v", err)
+	}
+	txs, _ := pool.RetrieveTransactions()
+	if len(txs) != 1 || txs[0].EncryptedData != "alice" {
+		t.Errorf("expected alice's tx in the slot, got %+v", txs)
+	}
+}
+
+func TestNonceGapHoldsTxs(t *testing.T) {
+	pool := newTestPool(t)
+	pool.SetSenderNonce("0xA", 1)
+	add(t, pool, "0xA", 1, "a1")
+	add(t, pool, "0xA", 3, "a3")
+
+	txs, _ := pool.RetrieveTransactions()
+	if len(txs) != 1 || txs[0].Nonce != 1 {
+		t.Fatalf("expected only nonce 1 before the gap, got %d txs", len(txs))
+	}
+	gaps := pool.Gaps()
+	if len(gaps) != 1 || gaps[0].Missing != 2 || gaps[0].Held != 1 {
+		t.Fatalf("unexpected gaps %+v", gaps)
+	}
+
+	add(t, pool, "0xA", 2, "a2")
+	txs, _ = pool.RetrieveTransactions()
+	if len(txs) != 2 || txs[0].Nonce != 2 || txs[1].Nonce != 3 {
+		t.Fatalf("expected nonces 2 and 3 once the gap filled, got %d txs", len(txs))
+	}
+	if len(pool.Gaps()) != 0 {
+		t.Errorf("gap should be closed")
+	}
+}
+
+func TestNonceGapTimesOut(t *testing.T) {
+	pool := newTestPool(t)
+	pool.SetGapTimeout(10 * time.Millisecond)
+	pool.SetSenderNonce("0xA", 1)
+	add(t, pool, "0xA", 5, "a5")
+
+	time.Sleep(20 * time.Millisecond)
+	if txs, _ := pool.RetrieveTransactions(); len(txs) != 0 {
+		t.Fatalf("held tx must not be served")
+	}
+	if len(pool.Gaps()) != 0 {
+		t.Errorf("timed-out tx should have been dropped")
+	}
+	if err := add(t, pool, "0xA", 1, "a1"); err != nil {
+		t.Errorf("add after drop: %v", err)
+	}
+}
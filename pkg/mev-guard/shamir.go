@@ -0,0 +1,106 @@
+package mevguard
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+)
+
+// Share = one Shamir share of a secret. Index is the x coordinate (1..255).
+type Share struct {
+	Index byte
+	Value []byte
+}
+
+// gfMul multiplies in GF(2^8) with the AES polynomial x^8+x^4+x^3+x+1.
+func gfMul(a, b byte) byte {
+	var p byte
+	for b > 0 {
+		if b&1 == 1 {
+			p ^= a
+		}
+		carry := a & 0x80
+		a <<= 1
+		if carry != 0 {
+			a ^= 0x1b
+		}
+		b >>= 1
+	}
+	return p
+}
+
+// gfInv returns a^-1 = a^254. a must be non-zero.
+func gfInv(a byte) byte {
+	r := byte(1)
+	for i := 0; i < 254; i++ {
+		r = gfMul(r, a)
+	}
+	return r
+}
+
+// SplitSecret splits secret into n shares, any threshold of which recover it.
+func SplitSecret(secret []byte, threshold, n int) ([]Share, error) {
+	if threshold < 1 || threshold > n {
+		return nil, fmt.Errorf("invalid threshold %d of %d", threshold, n)
+	}
+	if n > 255 {
+		return nil, errors.New("at most 255 shares are supported")
+	}
+
+	shares := make([]Share, n)
+	for i := range shares {
+		shares[i] = Share{Index: byte(i + 1), Value: make([]byte, len(secret))}
+	}
+	coeffs := make([]byte, threshold)
+	for b, s := range secret {
+		// random polynomial of degree threshold-1 with f(0) = s
+		coeffs[0] = s
+		if _, err := rand.Read(coeffs[1:]); err != nil {
+			return nil, err
+		}
+		for i := range shares {
+			x := shares[i].Index
+			var y byte
+			for j := threshold - 1; j >= 0; j-- {
+				y = gfMul(y, x) ^ coeffs[j]
+			}
+			shares[i].Value[b] = y
+		}
+	}
+	Zero(coeffs)
+	return shares, nil
+}
+
+// CombineShares recovers the secret by Lagrange interpolation at x = 0. With
+// fewer shares than the threshold the result is unrelated to the secret.
+func CombineShares(shares []Share) ([]byte, error) {
+	if len(shares) == 0 {
+		return nil, errors.New("no shares")
+	}
+	size := len(shares[0].Value)
+	seen := make(map[byte]bool)
+	for _, s := range shares {
+		if s.Index == 0 || seen[s.Index] {
+			return nil, fmt.Errorf("invalid or duplicate share index %d", s.Index)
+		}
+		if len(s.Value) != size {
+			return nil, errors.New("shares have different lengths")
+		}
+		seen[s.Index] = true
+	}
+
+	secret := make([]byte, size)
+	for i, si := range shares {
+		// basis polynomial l_i(0) = prod x_j / (x_j - x_i); subtraction is xor
+		basis := byte(1)
+		for j, sj := range shares {
+			if i != j {
+				basis = gfMul(basis, gfMul(sj.Index, gfInv(sj.Index^si.Index)))
+			}
+		}
+		for b := range secret {
+			secret[b] ^= gfMul(si.Value[b], basis)
+		}
+	}
+	return secret, nil
+}
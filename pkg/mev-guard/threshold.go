@@ -0,0 +1,282 @@
+package mevguard
+
+import (
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Keyholder = one committee member. It holds a share of each block's
+// decryption key and releases it only once the block's ordering is committed.
+type Keyholder struct {
+	ID     int
+	shares map[uint64]Share
+	roots  map[uint64]string
+	mutex  sync.Mutex
+}
+
+// NewKeyholder initializes a keyholder with no shares.
+func NewKeyholder(id int) *Keyholder {
+	return &Keyholder{
+		ID:     id,
+		shares: make(map[uint64]Share),
+		roots:  make(map[uint64]string),
+	}
+}
+
+// Deliver stores this keyholder's share of the block key.
+func (k *Keyholder) Deliver(block uint64, share Share) {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+	k.shares[block] = share
+}
+
+// OrderingCommitted records the ordering root for a block. The first root wins;
+// a different root for the same block means the pool tried to reorder.
+func (k *Keyholder) OrderingCommitted(block uint64, root string) error {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+	if prev, ok := k.roots[block]; ok && prev != root {
+		return fmt.Errorf("keyholder %d: block %d already committed to %s", k.ID, block, prev)
+	}
+	k.roots[block] = root
+	return nil
+}
+
+// ReleaseShare returns the share for a block whose ordering has been committed.
+func (k *Keyholder) ReleaseShare(block uint64) (Share, error) {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+	if _, ok := k.roots[block]; !ok {
+		return Share{}, fmt.Errorf("keyholder %d: ordering for block %d not committed", k.ID, block)
+	}
+	share, ok := k.shares[block]
+	if !ok {
+		return Share{}, fmt.Errorf("keyholder %d: no share for block %d", k.ID, block)
+	}
+	return share, nil
+}
+
+// Committee = t-of-n keyholders sharing a fresh X25519 key per block.
+// Keys are dealt by the committee, which forgets the private key once it is
+// split; nobody, including the pool, can decrypt a block on their own.
+type Committee struct {
+	Threshold  int
+	Keyholders []*Keyholder
+	publicKeys map[uint64]*ecdh.PublicKey
+	mutex      sync.Mutex
+}
+
+// NewCommittee initializes a committee of n in-process keyholders.
+func NewCommittee(threshold, n int) (*Committee, error) {
+	if threshold < 1 || threshold > n {
+		return nil, fmt.Errorf("invalid threshold %d of %d", threshold, n)
+	}
+	c := &Committee{Threshold: threshold, publicKeys: make(map[uint64]*ecdh.PublicKey)}
+	for i := 1; i <= n; i++ {
+		c.Keyholders = append(c.Keyholders, NewKeyholder(i))
+	}
+	return c, nil
+}
+
+// BlockKey returns the public key txs for a block are sealed to, dealing a new
+// key pair to the keyholders the first time a block is requested.
+func (c *Committee) BlockKey(block uint64) (*ecdh.PublicKey, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if pub, ok := c.publicKeys[block]; ok {
+		return pub, nil
+	}
+
+	priv, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	secret := priv.Bytes()
+	shares, err := SplitSecret(secret, c.Threshold, len(c.Keyholders))
+	Zero(secret)
+	if err != nil {
+		return nil, err
+	}
+	for i, k := range c.Keyholders {
+		k.Deliver(block, shares[i])
+	}
+	c.publicKeys[block] = priv.PublicKey()
+	return c.publicKeys[block], nil
+}
+
+// CommitOrdering announces a block's ordering root to every keyholder.
+func (c *Committee) CommitOrdering(block uint64, root string) error {
+	for _, k := range c.Keyholders {
+		if err := k.OrderingCommitted(block, root); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CollectShares gathers shares from keyholders until the threshold is met.
+func (c *Committee) CollectShares(block uint64) ([]Share, error) {
+	var shares []Share
+	for _, k := range c.Keyholders {
+		share, err := k.ReleaseShare(block)
+		if err != nil {
+			continue
+		}
+		shares = append(shares, share)
+		if len(shares) == c.Threshold {
+			return shares, nil
+		}
+	}
+	return nil, fmt.Errorf("only %d of %d shares released for block %d", len(shares), c.Threshold, block)
+}
+
+// NewThresholdMEVMempool initializes a pool whose txs can only be decrypted
+// with the committee's shares, after the ordering for their block is committed.
+// chainID is the chain envelopes must be bound to and may not be zero.
+func NewThresholdMEVMempool(committee *Committee, chainID uint64) (*MEVMempool, error) {
+	if chainID == 0 {
+		return nil, ErrNoChainID
+	}
+	return &MEVMempool{
+		transactions: []*Transaction{},
+		chainID:      chainID,
+		committee:    committee,
+		inflight:     make(map[string]*leasedTx),
+		leaseTimeout: DefaultLeaseTimeout,
+		ttl:          DefaultTTL,
+		nonces:       make(map[string]*senderNonce),
+		gapTimeout:   DefaultGapTimeout,
+		committed:    make(map[uint64]*committedBlock),
+	}, nil
+}
+
+// blockTransactions returns a block's txs in pool order, each sender's by
+// nonce. Caller holds the lock.
+func (mp *MEVMempool) blockTransactions(block uint64) []*Transaction {
+	var txs []*Transaction
+	for _, tx := range mp.transactions {
+		if tx.TargetBlock == block {
+			txs = append(txs, tx)
+		}
+	}
+	return interleave(txs)
+}
+
+// orderingRoot = sha256 over the ordered ciphertext hashes of a block.
+func orderingRoot(sums [][sha256.Size]byte) string {
+	h := sha256.New()
+	for _, sum := range sums {
+		h.Write(sum[:])
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// committedBlock = the ordering a block was committed to.
+type committedBlock struct {
+	root string
+	ids  []string            // committed txs, in order
+	sums [][sha256.Size]byte // their ciphertext hashes, under root
+}
+
+// CommitOrdering fixes the order of a block's sealed txs and announces its root
+// to the committee. It must happen before RetrieveBlock can decrypt anything;
+// afterwards the block takes no new or replacement txs.
+func (mp *MEVMempool) CommitOrdering(block uint64) (string, error) {
+	if mp.committee == nil {
+		return "", errors.New("pool has no keyholder committee")
+	}
+	mp.mutex.Lock()
+	defer mp.mutex.Unlock()
+
+	if c, ok := mp.committed[block]; ok {
+		return c.root, nil
+	}
+	c := &committedBlock{}
+	for _, tx := range mp.blockTransactions(block) {
+		c.ids = append(c.ids, tx.ID)
+		c.sums = append(c.sums, sha256.Sum256([]byte(tx.EncryptedData)))
+	}
+	c.root = orderingRoot(c.sums)
+	if err := mp.committee.CommitOrdering(block, c.root); err != nil {
+		return "", err
+	}
+	mp.committed[block] = c
+	return c.root, nil
+}
+
+// committedTransactions returns a block's unfinished committed txs, pooled or
+// in flight, after checking each still hashes to its place under the committed
+// root. Txs that were acked, quarantined or expired are skipped. Caller holds
+// the lock.
+func (mp *MEVMempool) committedTransactions(block uint64) ([]*Transaction, error) {
+	c, ok := mp.committed[block]
+	if !ok {
+		return nil, fmt.Errorf("ordering for block %d not committed", block)
+	}
+	var txs []*Transaction
+	for i, id := range c.ids {
+		tx := mp.findTx(id)
+		if l, ok := mp.inflight[id]; tx == nil && ok {
+			tx = l.tx
+		}
+		if tx == nil {
+			continue
+		}
+		if sha256.Sum256([]byte(tx.EncryptedData)) != c.sums[i] {
+			return nil, fmt.Errorf("block %d: committed tx %s no longer matches the committed root %s", block, id, c.root)
+		}
+		txs = append(txs, tx)
+	}
+	return txs, nil
+}
+
+// RetrieveBlock combines the committee's shares and decrypts a block's
+// committed txs in the committed order, once they are checked against the
+// committed root. Txs already in flight are not returned again, and leases
+// and TTLs are expired first. Like RetrieveTransactions, bad entries are
+// quarantined and reported in a *RetrievalError.
+func (mp *MEVMempool) RetrieveBlock(block uint64) ([]*Transaction, error) {
+	if mp.committee == nil {
+		return nil, errors.New("pool has no keyholder committee")
+	}
+	mp.mutex.Lock()
+	defer mp.mutex.Unlock()
+
+	now := time.Now()
+	mp.expire(now)
+	txs, err := mp.committedTransactions(block)
+	if err != nil {
+		return nil, err
+	}
+	shares, err := mp.committee.CollectShares(block)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := CombineShares(shares)
+	if err != nil {
+		return nil, err
+	}
+	priv, err := ecdh.X25519().NewPrivateKey(secret)
+	Zero(secret)
+	if err != nil {
+		return nil, err
+	}
+
+	var pending []*Transaction
+	for _, tx := range txs {
+		if _, ok := mp.inflight[tx.ID]; !ok {
+			pending = append(pending, tx)
+		}
+	}
+	opened, err := mp.openEach(pending, func(tx *Transaction) ([]byte, error) {
+		return openEnvelope(priv, tx.EncryptedData, tx.Context())
+	})
+	mp.lease(opened, now)
+	return opened, err
+}
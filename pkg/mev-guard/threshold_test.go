@@ -0,0 +1,219 @@
+// This file contains tests for Shamir secret sharing, threshold decryption
+// of the protected pool by in-process keyholders and committed orderings,
+// including retrieval after some of a block's txs are finished.
+
+package mevguard
+
+import (
+	"bytes"
+	"math/big"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mellis0303/mev-vem/pkg/mev-wal"
+)
+
+func TestSplitAndCombineShares(t *testing.T) {
+	secret := []byte("0123456789abcdef0123456789abcdef")
+	shares, err := SplitSecret(secret, 3, 5)
+	if err != nil {
+		t.Fatalf("SplitSecret: %v", err)
+	}
+
+	for _, subset := range [][]int{{0, 1, 2}, {4, 2, 0}, {1, 3, 4}, {0, 1, 2, 3, 4}} {
+		var picked []Share
+		for _, i := range subset {
+			picked = append(picked, shares[i])
+		}
+		got, err := CombineShares(picked)
+		if err != nil {
+			t.Fatalf("CombineShares(%v): %v", subset, err)
+		}
+		if !bytes.Equal(got, secret) {
+			t.Errorf("CombineShares(%v) = %x, want %x", subset, got, secret)
+		}
+	}
+
+	got, _ := CombineShares(shares[:2])
+	if bytes.Equal(got, secret) {
+		t.Errorf("two shares must not recover a 3-of-5 secret")
+	}
+	if _, err := CombineShares([]Share{shares[0], shares[0]}); err == nil {
+		t.Errorf("expected duplicate share indexes to be rejected")
+	}
+}
+
+func newThresholdPool(t *testing.T, committee *Committee) *MEVMempool {
+	t.Helper()
+	pool, err := NewThresholdMEVMempool(committee, testChainID)
+	if err != nil {
+		t.Fatalf("NewThresholdMEVMempool: %v", err)
+	}
+	return pool
+}
+
+func TestThresholdPoolDecryptsOnlyAfterCommit(t *testing.T) {
+	committee, err := NewCommittee(3, 5)
+	if err != nil {
+		t.Fatalf("NewCommittee: %v", err)
+	}
+	pool := newThresholdPool(t, committee)
+	add := func(data string, nonce uint64, from string, block uint64) {
+		envelope, err := SealForBlock(committee, TxContext{From: from, Nonce: nonce, ChainID: testChainID, TargetBlock: block}, []byte(data))
+		if err != nil {
+			t.Fatalf("SealForBlock: %v", err)
+		}
+		if err := pool.AddTransactionForBlock(envelope, nonce, from, block); err != nil {
+			t.Fatalf("AddTransactionForBlock: %v", err)
+		}
+	}
+	add("swap A", 1, "0xAlice", 7)
+	add("swap B", 1, "0xBob", 7)
+	add("next block", 2, "0xAlice", 8)
+
+	if _, err := pool.RetrieveBlock(7); err == nil {
+		t.Fatalf("expected retrieval to fail before the ordering is committed")
+	}
+	if _, err := pool.RetrieveTransactions(); err == nil {
+		t.Errorf("threshold pool must not decrypt without the committee")
+	}
+
+	root, err := pool.CommitOrdering(7)
+	if err != nil {
+		t.Fatalf("CommitOrdering: %v", err)
+	}
+
+	// two keyholders are offline; the other three are enough
+	committee.Keyholders[0] = NewKeyholder(1)
+	committee.Keyholders[3] = NewKeyholder(4)
+
+	txs, err := pool.RetrieveBlock(7)
+	if err != nil {
+		t.Fatalf("RetrieveBlock: %v", err)
+	}
+	if len(txs) != 2 || txs[0].EncryptedData != "swap A" || txs[1].EncryptedData != "swap B" {
+		t.Errorf("unexpected block 7 txs: %+v", txs)
+	}
+
+	// block 8 stays sealed even though block 7's key is now known
+	if _, err := pool.RetrieveBlock(8); err == nil {
+		t.Errorf("expected block 8 to stay sealed")
+	}
+
+	// a committed block takes no more txs, and its root stays put
+	envelope, _ := SealForBlock(committee, TxContext{From: "0xMallory", Nonce: 3, ChainID: testChainID, TargetBlock: 7}, []byte("late"))
+	if err := pool.AddTransactionForBlock(envelope, 3, "0xMallory", 7); err == nil {
+		t.Errorf("expected a tx for committed block 7 to be refused")
+	}
+	if again, err := pool.CommitOrdering(7); err != nil || again != root {
+		t.Errorf("recommitting block 7 = %s, %v; want %s", again, err, root)
+	}
+
+	// the keyholders refuse a different root for the same block
+	if err := committee.CommitOrdering(7, "reordered"); err == nil {
+		t.Errorf("expected a second, different ordering root for block 7 to be rejected (first was %s)", root)
+	}
+}
+
+func TestThresholdPoolChecksCommittedSet(t *testing.T) {
+	committee, _ := NewCommittee(2, 3)
+	pool := newThresholdPool(t, committee)
+	seal := func(data string, nonce uint64, from string) string {
+		envelope, err := SealForBlock(committee, TxContext{From: from, Nonce: nonce, ChainID: testChainID, TargetBlock: 5}, []byte(data))
+		if err != nil {
+			t.Fatalf("SealForBlock: %v", err)
+		}
+		return envelope
+	}
+	if err := pool.AddTransactionForBlock(seal("swap A", 1, "0xAlice"), 1, "0xAlice", 5); err != nil {
+		t.Fatalf("AddTransactionForBlock: %v", err)
+	}
+	if _, err := pool.CommitOrdering(5); err != nil {
+		t.Fatalf("CommitOrdering: %v", err)
+	}
+
+	// a replacement for a committed tx is refused
+	if err := pool.AddTransactionWithFee(seal("swap A'", 1, "0xAlice"), 1, "0xAlice", 5, big.NewInt(100), ""); err == nil {
+		t.Errorf("expected a replacement in a committed block to be refused")
+	}
+
+	// an entry that slipped in after the commit is not decrypted with the block
+	pool.mutex.Lock()
+	pool.transactions = append(pool.transactions, &Transaction{ID: "sneak", EncryptedData: seal("sneak", 1, "0xMallory"), Nonce: 1, From: "0xMallory", ChainID: testChainID, TargetBlock: 5})
+	pool.mutex.Unlock()
+	txs, err := pool.RetrieveBlock(5)
+	if err != nil {
+		t.Fatalf("RetrieveBlock: %v", err)
+	}
+	if len(txs) != 1 || txs[0].EncryptedData != "swap A" {
+		t.Errorf("expected only the committed tx, got %+v", txs)
+	}
+
+	// a committed entry swapped out from under the root stops the block
+	pool.Nack(txs[0].ID)
+	pool.mutex.Lock()
+	pool.findTx(txs[0].ID).EncryptedData = seal("swap B", 1, "0xAlice")
+	pool.mutex.Unlock()
+	if _, err := pool.RetrieveBlock(5); err == nil {
+		t.Errorf("expected a changed committed tx to fail the root check")
+	}
+}
+
+func TestThresholdBlockSurvivesFinishedTxs(t *testing.T) {
+	committee, _ := NewCommittee(2, 3)
+	pool := newThresholdPool(t, committee)
+	pool.SetLeaseTimeout(10 * time.Millisecond)
+	for i, from := range []string{"0xAlice", "0xBob", "0xCarol"} {
+		envelope, _ := SealForBlock(committee, TxContext{From: from, Nonce: 1, ChainID: testChainID, TargetBlock: 3}, []byte("swap "+from))
+		if err := pool.AddTransactionForBlock(envelope, 1, from, 3); err != nil {
+			t.Fatalf("add %d: %v", i, err)
+		}
+	}
+	pool.CommitOrdering(3)
+
+	txs, err := pool.RetrieveBlock(3)
+	if err != nil || len(txs) != 3 {
+		t.Fatalf("RetrieveBlock = %d txs, %v", len(txs), err)
+	}
+	pool.Ack(txs[0].ID)
+	pool.Nack(txs[1].ID)
+
+	// the acked tx is skipped; the nacked one comes back
+	again, err := pool.RetrieveBlock(3)
+	if err != nil {
+		t.Fatalf("RetrieveBlock after ack: %v", err)
+	}
+	if len(again) != 1 || again[0].ID != txs[1].ID {
+		t.Fatalf("expected the nacked tx back, got %+v", again)
+	}
+
+	// leases taken through RetrieveBlock time out on the same path
+	time.Sleep(20 * time.Millisecond)
+	again, err = pool.RetrieveBlock(3)
+	if err != nil {
+		t.Fatalf("RetrieveBlock after lease timeout: %v", err)
+	}
+	if len(again) != 2 {
+		t.Errorf("expected both unacked txs back once their leases timed out, got %d", len(again))
+	}
+
+	if err := pool.OpenWAL(filepath.Join(t.TempDir(), "pool.wal"), mevwal.Options{}); err == nil {
+		t.Errorf("expected OpenWAL to refuse a threshold pool")
+	}
+}
+
+func TestThresholdPoolFailsBelowThreshold(t *testing.T) {
+	committee, _ := NewCommittee(3, 5)
+	pool := newThresholdPool(t, committee)
+	envelope, _ := SealForBlock(committee, TxContext{From: "0xAlice", Nonce: 1, ChainID: testChainID, TargetBlock: 1}, []byte("swap"))
+	pool.AddTransactionForBlock(envelope, 1, "0xAlice", 1)
+	pool.CommitOrdering(1)
+
+	for i := 0; i < 3; i++ {
+		committee.Keyholders[i] = NewKeyholder(i + 1)
+	}
+	if _, err := pool.RetrieveBlock(1); err == nil {
+		t.Errorf("expected retrieval to fail with only 2 of 3 shares")
+	}
+}
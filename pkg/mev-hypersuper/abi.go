@@ -0,0 +1,148 @@
+package mevhypersuper
+
+import (
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"golang.org/x/crypto/sha3"
+)
+
+// keccak256 hashes data with the legacy Keccak-256 used by Ethereum.
+func keccak256(data ...[]byte) []byte {
+	h := sha3.NewLegacyKeccak256()
+	for _, d := range data {
+		h.Write(d)
+	}
+	return h.Sum(nil)
+}
+
+// abiSelector returns the 4-byte function selector of a canonical signature.
+func abiSelector(signature string) []byte {
+	return keccak256([]byte(signature))[:4]
+}
+
+// abiValue = one ABI-encodable argument.
+type abiValue interface {
+	dynamic() bool
+	encode() []byte // head for static values, tail contents for dynamic ones
+}
+
+type abiUint struct{ v *big.Int }
+type abiBool bool
+type abiAddress [20]byte
+type abiFixedBytes []byte // bytes1..bytes32
+type abiBytes []byte      // bytes and string
+type abiArray []abiValue  // T[] of any element type
+
+func (abiUint) dynamic() bool       { return false }
+func (abiBool) dynamic() bool       { return false }
+func (abiAddress) dynamic() bool    { return false }
+func (abiFixedBytes) dynamic() bool { return false }
+func (abiBytes) dynamic() bool      { return true }
+func (abiArray) dynamic() bool      { return true }
+
+func word(v *big.Int) []byte {
+	w := make([]byte, 32)
+	return v.FillBytes(w)
+}
+
+func (u abiUint) encode() []byte { return word(u.v) }
+
+func (b abiBool) encode() []byte {
+	if b {
+		return word(big.NewInt(1))
+	}
+	return word(big.NewInt(0))
+}
+
+func (a abiAddress) encode() []byte {
+	w := make([]byte, 32)
+	copy(w[12:], a[:])
+	return w
+}
+
+func (f abiFixedBytes) encode() []byte {
+	w := make([]byte, 32)
+	copy(w, f)
+	return w
+}
+
+func (b abiBytes) encode() []byte {
+	padded := make([]byte, (len(b)+31)/32*32)
+	copy(padded, b)
+	return append(word(big.NewInt(int64(len(b)))), padded...)
+}
+
+func (a abiArray) encode() []byte {
+	return append(word(big.NewInt(int64(len(a)))), abiEncode(a...)...)
+}
+
+// abiEncode encodes a tuple of values using the standard head/tail layout.
+func abiEncode(values ...abiValue) []byte {
+	headSize := 32 * len(values)
+	var head, tail []byte
+	for _, v := range values {
+		if v.dynamic() {
+			head = append(head, word(big.NewInt(int64(headSize+len(tail))))...)
+			tail = append(tail, v.encode()...)
+		} else {
+			head = append(head, v.encode()...)
+		}
+	}
+	return append(head, tail...)
+}
+
+// abiCall encodes a call to signature with the given arguments.
+func abiCall(signature string, args ...abiValue) []byte {
+	return append(abiSelector(signature), abiEncode(args...)...)
+}
+
+// EncodeCall ABI-encodes a call to signature, for strategies that build
+// EventTx calldata. Arguments may be *big.Int (uint), bool, a 0x address
+// string or a []string of addresses.
+func EncodeCall(signature string, args ...interface{}) ([]byte, error) {
+	values := make([]abiValue, len(args))
+	for i, arg := range args {
+		switch v := arg.(type) {
+		case *big.Int:
+			if v.Sign() < 0 {
+				return nil, fmt.Errorf("argument %d of %s is negative", i, signature)
+			}
+			values[i] = abiUint{v}
+		case bool:
+			values[i] = abiBool(v)
+		case string:
+			addr, err := parseAddress(v)
+			if err != nil {
+				return nil, fmt.Errorf("argument %d of %s: %w", i, signature, err)
+			}
+			values[i] = addr
+		case []string:
+			arr := make(abiArray, len(v))
+			for j, s := range v {
+				addr, err := parseAddress(s)
+				if err != nil {
+					return nil, fmt.Errorf("argument %d of %s: %w", i, signature, err)
+				}
+				arr[j] = addr
+			}
+			values[i] = arr
+		default:
+			return nil, fmt.Errorf("argument %d of %s has unsupported type %T", i, signature, arg)
+		}
+	}
+	return abiCall(signature, values...), nil
+}
+
+// parseAddress decodes a 0x-prefixed 20-byte hex address.
+func parseAddress(s string) (abiAddress, error) {
+	var a abiAddress
+	b, err := hex.DecodeString(strings.TrimPrefix(s, "0x"))
+	if err != nil || len(b) != 20 {
+		return a, fmt.Errorf("invalid address %q", s)
+	}
+	copy(a[:], b)
+	return a, nil
+}
@@ -0,0 +1,332 @@
+package mevhypersuper
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	"github.com/decred/dcrd/dcrec/secp256k1/v4/ecdsa"
+)
+
+// Executor contract entry points. multicall runs the steps in order. A
+// flashLoan step borrows from the provider, which calls back into the
+// executor; the executor runs the step's callback bytes as a multicall while
+// the loan is out, so the steps that spend and repay it run inside the
+// callback and the whole bundle is one atomic tx.
+const (
+	sigMulticall   = "multicall(bytes[])"
+	sigFlashLoan   = "flashLoan(uint8,address,address,uint256,bytes)"
+	sigCall        = "call(address,uint256,bytes)"
+	sigApprove     = "approve(address,address,uint256)"
+	sigUnwrap      = "unwrap(address,uint256)"
+	sigWrap        = "wrap(address,uint256)"
+	sigRepay       = "repay(address,address,uint256)"
+	sigPayCoinbase = "payCoinbase(uint256)"
+)
+
+// Gas budgeted per executor step, on top of intrinsic and calldata gas.
+const (
+	txIntrinsicGas   = 21000
+	flashLoanStepGas = 80000
+	callStepGas      = 150000
+	approveStepGas   = 30000
+	wrapStepGas      = 30000
+	repayStepGas     = 40000
+	coinbaseStepGas  = 10000
+)
+
+// flashLoanKinds maps provider kinds to the executor's uint8 enum.
+var flashLoanKinds = map[string]int64{
+	ProviderAaveV3:    1,
+	ProviderBalancer:  2,
+	ProviderUniswapV3: 3,
+}
+
+// ExecutorTx = a signed EIP-1559 transaction calling the executor contract.
+type ExecutorTx struct {
+	From                 string
+	To                   string
+	Nonce                uint64
+	ChainID              *big.Int
+	MaxFeePerGas         *big.Int
+	MaxPriorityFeePerGas *big.Int
+	GasLimit             uint64
+	Value                *big.Int
+	Calldata             []byte
+	CoinbasePayment      *big.Int
+	Raw                  []byte // 0x02 || rlp(...), ready for eth_sendRawTransaction or eth_sendBundle
+	Hash                 string
+}
+
+// Executor builds and signs calls into the on-chain executor contract.
+type Executor struct {
+	Address              string
+	ChainID              *big.Int
+	Tokens               map[string]string // asset symbol -> token address
+	CoinbaseBps          int64             // share of net profit paid to the block builder
+	MaxFeePerGas         *big.Int
+	MaxPriorityFeePerGas *big.Int
+	key                  *secp256k1.PrivateKey
+	nonce                uint64
+	mutex                sync.Mutex
+}
+
+// NewExecutor initializes an executor signing with a 32-byte secp256k1 key
+// for the given chain.
+func NewExecutor(address string, chainID *big.Int, key []byte) (*Executor, error) {
+	if _, err := parseAddress(address); err != nil {
+		return nil, err
+	}
+	if chainID == nil || chainID.Sign() <= 0 {
+		return nil, errors.New("executor needs a chain ID")
+	}
+	if len(key) != 32 {
+		return nil, errors.New("executor key must be 32 bytes long")
+	}
+	return &Executor{
+		Address:              address,
+		ChainID:              chainID,
+		Tokens:               make(map[string]string),
+		CoinbaseBps:          9000,
+		MaxFeePerGas:         big.NewInt(100e9),
+		MaxPriorityFeePerGas: big.NewInt(2e9),
+		key:                  secp256k1.PrivKeyFromBytes(key),
+	}, nil
+}
+
+// From returns the address the executor signs as.
+func (ex *Executor) From() string {
+	pub := ex.key.PubKey().SerializeUncompressed()
+	return "0x" + hex.EncodeToString(keccak256(pub[1:])[12:])
+}
+
+// SetNonce sets the nonce used for the next signed transaction.
+func (ex *Executor) SetNonce(nonce uint64) {
+	ex.mutex.Lock()
+	defer ex.mutex.Unlock()
+	ex.nonce = nonce
+}
+
+// Nonce returns the nonce the next signed transaction will use.
+func (ex *Executor) Nonce() uint64 {
+	ex.mutex.Lock()
+	defer ex.mutex.Unlock()
+	return ex.nonce
+}
+
+// Confirm advances the nonce past etx once it has been submitted. Built txs
+// that are never sent do not use up a nonce.
+func (ex *Executor) Confirm(etx *ExecutorTx) {
+	ex.mutex.Lock()
+	defer ex.mutex.Unlock()
+	if etx.Nonce >= ex.nonce {
+		ex.nonce = etx.Nonce + 1
+	}
+}
+
+// tokenAddress resolves an asset symbol (or raw address) to a token address.
+func (ex *Executor) tokenAddress(asset string) (abiAddress, error) {
+	if addr, ok := ex.Tokens[asset]; ok {
+		return parseAddress(addr)
+	}
+	if strings.HasPrefix(asset, "0x") {
+		return parseAddress(asset)
+	}
+	return abiAddress{}, fmt.Errorf("no token address for asset %s", asset)
+}
+
+// orderByDependencies returns txs so that every tx follows the ones it depends on.
+func orderByDependencies(txs []*EventTx) []*EventTx {
+	inPlan := make(map[string]*EventTx, len(txs))
+	for _, tx := range txs {
+		inPlan[tx.Hash] = tx
+	}
+	done := make(map[string]bool)
+	var ordered []*EventTx
+	var visit func(*EventTx)
+	visit = func(tx *EventTx) {
+		if done[tx.Hash] {
+			return
+		}
+		done[tx.Hash] = true
+		for _, dep := range tx.DependsOn {
+			if depTx, ok := inPlan[dep]; ok {
+				visit(depTx)
+			}
+		}
+		ordered = append(ordered, tx)
+	}
+	for _, tx := range txs {
+		visit(tx)
+	}
+	return ordered
+}
+
+// calldataGas prices calldata at 16 gas per non-zero byte and 4 per zero byte.
+func calldataGas(data []byte) uint64 {
+	var gas uint64
+	for _, b := range data {
+		if b == 0 {
+			gas += 4
+		} else {
+			gas += 16
+		}
+	}
+	return gas
+}
+
+// mergeLoans sums the legs borrowed from each provider into one loan, in the
+// order the providers first appear.
+func mergeLoans(legs []*FlashloanLeg) []*FlashloanLeg {
+	var merged []*FlashloanLeg
+	byProvider := make(map[*FlashloanProvider]*FlashloanLeg)
+	for _, leg := range legs {
+		m, ok := byProvider[leg.Provider]
+		if !ok {
+			m = &FlashloanLeg{Provider: leg.Provider, Amount: new(big.Int), Fee: new(big.Int)}
+			byProvider[leg.Provider] = m
+			merged = append(merged, m)
+		}
+		m.Amount.Add(m.Amount, leg.Amount)
+		m.Fee.Add(m.Fee, leg.Fee)
+	}
+	return merged
+}
+
+// EncodePlan ABI-encodes the plan as multicall([flashLoan(loan 1, callback),
+// payCoinbase]). Loans from the same provider are merged, and each loan's
+// callback is a multicall run while it is out: the next loan, or for the
+// innermost one the bundle's calls, then its own repay. Native borrowings
+// come as wrapped ETH and are unwrapped to fund the calls' value; other
+// tokens are approved to the tx's receiver. It returns the calldata, the
+// coinbase payment and the gas estimate.
+func (ex *Executor) EncodePlan(plan *BundlePlan) ([]byte, *big.Int, uint64, error) {
+	var steps []abiValue
+	var gas uint64 = txIntrinsicGas
+
+	loans := mergeLoans(plan.Loans)
+	native, nativeOwed := new(big.Int), new(big.Int)
+	for _, loan := range loans {
+		if loan.Provider.Asset == NativeAsset {
+			native.Add(native, loan.Amount)
+			nativeOwed.Add(nativeOwed, loan.Amount).Add(nativeOwed, loan.Fee)
+		}
+	}
+	var weth abiAddress
+	if native.Sign() > 0 {
+		var err error
+		if weth, err = ex.tokenAddress(NativeAsset); err != nil {
+			return nil, nil, 0, err
+		}
+		steps = append(steps, abiBytes(abiCall(sigUnwrap, weth, abiUint{native})))
+		gas += wrapStepGas
+	}
+
+	for _, tx := range orderByDependencies(plan.Txs) {
+		target, err := parseAddress(tx.Receiver)
+		if err != nil {
+			return nil, nil, 0, fmt.Errorf("tx %s: %w", tx.Hash, err)
+		}
+		value := big.NewInt(0)
+		if tx.Value != nil && tx.Value.Sign() > 0 {
+			if txAsset(tx) == NativeAsset {
+				value = tx.Value
+			} else {
+				token, err := ex.tokenAddress(txAsset(tx))
+				if err != nil {
+					return nil, nil, 0, fmt.Errorf("tx %s: %w", tx.Hash, err)
+				}
+				steps = append(steps, abiBytes(abiCall(sigApprove, token, target, abiUint{tx.Value})))
+				gas += approveStepGas
+			}
+		}
+		steps = append(steps, abiBytes(abiCall(sigCall, target, abiUint{value}, abiBytes(tx.Calldata))))
+		gas += callStepGas
+	}
+
+	if native.Sign() > 0 {
+		steps = append(steps, abiBytes(abiCall(sigWrap, weth, abiUint{nativeOwed})))
+		gas += wrapStepGas
+	}
+
+	// wrap the steps in the loans, innermost last
+	for i := len(loans) - 1; i >= 0; i-- {
+		loan := loans[i]
+		kind, ok := flashLoanKinds[loan.Provider.Kind]
+		if !ok {
+			return nil, nil, 0, fmt.Errorf("flashloan source %q cannot be called on-chain", loan.Provider.Name)
+		}
+		provider, err := parseAddress(loan.Provider.Address)
+		if err != nil {
+			return nil, nil, 0, err
+		}
+		asset, err := ex.tokenAddress(loan.Provider.Asset)
+		if err != nil {
+			return nil, nil, 0, err
+		}
+		owed := new(big.Int).Add(loan.Amount, loan.Fee)
+		steps = append(steps, abiBytes(abiCall(sigRepay, provider, asset, abiUint{owed})))
+		callback := abiCall(sigMulticall, abiArray(steps))
+		steps = []abiValue{abiBytes(abiCall(sigFlashLoan, abiUint{big.NewInt(kind)}, provider, asset, abiUint{loan.Amount}, abiBytes(callback)))}
+		gas += flashLoanStepGas + repayStepGas
+	}
+
+	coinbase := new(big.Int).Mul(plan.NetProfit, big.NewInt(ex.CoinbaseBps))
+	coinbase.Quo(coinbase, big.NewInt(10000))
+	if coinbase.Sign() < 0 {
+		coinbase.SetInt64(0)
+	}
+	steps = append(steps, abiBytes(abiCall(sigPayCoinbase, abiUint{coinbase})))
+	gas += coinbaseStepGas
+
+	calldata := abiCall(sigMulticall, abiArray(steps))
+	gas += calldataGas(calldata)
+	return calldata, coinbase, gas, nil
+}
+
+// Build encodes the plan and signs it as an EIP-1559 transaction to the
+// executor at the current nonce. Call Confirm once it has been submitted.
+func (ex *Executor) Build(plan *BundlePlan) (*ExecutorTx, error) {
+	calldata, coinbase, gas, err := ex.EncodePlan(plan)
+	if err != nil {
+		return nil, err
+	}
+	to, _ := parseAddress(ex.Address)
+
+	nonce := ex.Nonce()
+
+	fields := []rlpItem{
+		rlpUint(ex.ChainID),
+		rlpUint64(nonce),
+		rlpUint(ex.MaxPriorityFeePerGas),
+		rlpUint(ex.MaxFeePerGas),
+		rlpUint64(gas),
+		to[:],
+		rlpUint(big.NewInt(0)),
+		calldata,
+		[]rlpItem{}, // access list
+	}
+	sigHash := keccak256([]byte{0x02}, rlpEncode(fields))
+	sig := ecdsa.SignCompact(ex.key, sigHash, false) // [27+v, r, s]
+	fields = append(fields, rlpUint64(uint64(sig[0]-27)), rlpUint(new(big.Int).SetBytes(sig[1:33])), rlpUint(new(big.Int).SetBytes(sig[33:65])))
+
+	raw := append([]byte{0x02}, rlpEncode(fields)...)
+	return &ExecutorTx{
+		From:                 ex.From(),
+		To:                   ex.Address,
+		Nonce:                nonce,
+		ChainID:              ex.ChainID,
+		MaxFeePerGas:         ex.MaxFeePerGas,
+		MaxPriorityFeePerGas: ex.MaxPriorityFeePerGas,
+		GasLimit:             gas,
+		Value:                big.NewInt(0),
+		Calldata:             calldata,
+		CoinbasePayment:      coinbase,
+		Raw:                  raw,
+		Hash:                 "0x" + hex.EncodeToString(keccak256(raw)),
+	}, nil
+}
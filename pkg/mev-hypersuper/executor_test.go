@@ -0,0 +1,327 @@
+// This file contains tests for the executor calldata encoder against the
+// Solidity ABI specification vectors, nested flashloan callbacks, RLP
+// encoding, EIP-1559 signing and nonce handling.
+
+package mevhypersuper
+
+import (
+	"bytes"
+	"encoding/hex"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4/ecdsa"
+)
+
+func mustHex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(strings.Join(strings.Fields(s), ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func u(v int64) abiUint { return abiUint{big.NewInt(v)} }
+
+func TestABISelectors(t *testing.T) {
+	if got := hex.EncodeToString(abiSelector("transfer(address,uint256)")); got != "a9059cbb" {
+		t.Errorf("transfer selector = %s", got)
+	}
+	if got := hex.EncodeToString(abiSelector("baz(uint32,bool)")); got != "cdcd77c0" {
+		t.Errorf("baz selector = %s", got)
+	}
+}
+
+// Vectors from the "Examples" section of the Solidity ABI specification.
+func TestABIEncodeSpecVectors(t *testing.T) {
+	cases := []struct {
+		name string
+		got  []byte
+		want string
+	}{
+		{
+			name: "baz(69, true)",
+			got:  abiCall("baz(uint32,bool)", u(69), abiBool(true)),
+			want: `cdcd77c0
+				0000000000000000000000000000000000000000000000000000000000000045
+				0000000000000000000000000000000000000000000000000000000000000001`,
+		},
+		{
+			name: `sam("dave", true, [1,2,3])`,
+			got:  abiCall("sam(bytes,bool,uint256[])", abiBytes("dave"), abiBool(true), abiArray{u(1), u(2), u(3)}),
+			want: `a5643bf2
+				0000000000000000000000000000000000000000000000000000000000000060
+				0000000000000000000000000000000000000000000000000000000000000001
+				00000000000000000000000000000000000000000000000000000000000000a0
+				0000000000000000000000000000000000000000000000000000000000000004
+				6461766500000000000000000000000000000000000000000000000000000000
+				0000000000000000000000000000000000000000000000000000000000000003
+				0000000000000000000000000000000000000000000000000000000000000001
+				0000000000000000000000000000000000000000000000000000000000000002
+				0000000000000000000000000000000000000000000000000000000000000003`,
+		},
+		{
+			name: `f(0x123, [0x456, 0x789], "1234567890", "Hello, world!")`,
+			got:  abiCall("f(uint256,uint32[],bytes10,bytes)", u(0x123), abiArray{u(0x456), u(0x789)}, abiFixedBytes("1234567890"), abiBytes("Hello, world!")),
+			want: `8be65246
+				0000000000000000000000000000000000000000000000000000000000000123
+				0000000000000000000000000000000000000000000000000000000000000080
+				3132333435363738393000000000000000000000000000000000000000000000
+				00000000000000000000000000000000000000000000000000000000000000e0
+				0000000000000000000000000000000000000000000000000000000000000002
+				0000000000000000000000000000000000000000000000000000000000000456
+				0000000000000000000000000000000000000000000000000000000000000789
+				000000000000000000000000000000000000000000000000000000000000000d
+				48656c6c6f2c20776f726c642100000000000000000000000000000000000000`,
+		},
+		{
+			name: `g([[1,2],[3]], ["one","two","three"])`,
+			got: abiCall("g(uint256[][],string[])",
+				abiArray{abiArray{u(1), u(2)}, abiArray{u(3)}},
+				abiArray{abiBytes("one"), abiBytes("two"), abiBytes("three")}),
+			want: `2289b18c
+				0000000000000000000000000000000000000000000000000000000000000040
+				0000000000000000000000000000000000000000000000000000000000000140
+				0000000000000000000000000000000000000000000000000000000000000002
+				0000000000000000000000000000000000000000000000000000000000000040
+				00000000000000000000000000000000000000000000000000000000000000a0
+				0000000000000000000000000000000000000000000000000000000000000002
+				0000000000000000000000000000000000000000000000000000000000000001
+				0000000000000000000000000000000000000000000000000000000000000002
+				0000000000000000000000000000000000000000000000000000000000000001
+				0000000000000000000000000000000000000000000000000000000000000003
+				0000000000000000000000000000000000000000000000000000000000000003
+				0000000000000000000000000000000000000000000000000000000000000060
+				00000000000000000000000000000000000000000000000000000000000000a0
+				00000000000000000000000000000000000000000000000000000000000000e0
+				0000000000000000000000000000000000000000000000000000000000000003
+				6f6e650000000000000000000000000000000000000000000000000000000000
+				0000000000000000000000000000000000000000000000000000000000000003
+				74776f0000000000000000000000000000000000000000000000000000000000
+				0000000000000000000000000000000000000000000000000000000000000005
+				7468726565000000000000000000000000000000000000000000000000000000`,
+		},
+	}
+	for _, c := range cases {
+		if want := mustHex(t, c.want); !bytes.Equal(c.got, want) {
+			t.Errorf("%s:\n got %x\nwant %x", c.name, c.got, want)
+		}
+	}
+}
+
+func TestRLPVectors(t *testing.T) {
+	cases := []struct {
+		item rlpItem
+		want string
+	}{
+		{[]byte("dog"), "83646f67"},
+		{[]rlpItem{[]byte("cat"), []byte("dog")}, "c88363617483646f67"},
+		{[]byte{}, "80"},
+		{[]rlpItem{}, "c0"},
+		{rlpUint64(0), "80"},
+		{rlpUint64(15), "0f"},
+		{rlpUint64(1024), "820400"},
+		{[]byte("Lorem ipsum dolor sit amet, consectetur adipisicing elit"), "b8384c6f72656d20697073756d20646f6c6f722073697420616d65742c20636f6e7365637465747572206164697069736963696e6720656c6974"},
+	}
+	for _, c := range cases {
+		if got := hex.EncodeToString(rlpEncode(c.item)); got != c.want {
+			t.Errorf("rlp(%v) = %s, want %s", c.item, got, c.want)
+		}
+	}
+}
+
+func testExecutor(t *testing.T) *Executor {
+	t.Helper()
+	key := make([]byte, 32)
+	key[31] = 1
+	ex, err := NewExecutor("0x00000000000000000000000000000000E0EC0001", big.NewInt(1), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ex.Tokens[NativeAsset] = "0xC02aaA39b223FE8D0A0e5C4F27eAD9083C756Cc2"
+	return ex
+}
+
+func TestExecutorAddress(t *testing.T) {
+	// the well-known address of private key 1
+	if got := testExecutor(t).From(); got != "0x7e5f4552091a69125d5dfcb7b8c2659029395bdf" {
+		t.Errorf("From() = %s", got)
+	}
+}
+
+func TestExecuteBundleEncodesAndSigns(t *testing.T) {
+	eh := NewEventHorizon(5, EthToWei(1000))
+	eh.AddFlashloanProvider(NewAaveV3Flashloan("0x87870Bca3F3fD6335C3F4ce8392D69350B4fA4E2", NativeAsset, EthToWei(1000)))
+	eh.SetExecutor(testExecutor(t))
+
+	swap := []byte{0xde, 0xad, 0xbe, 0xef}
+	// 0xb has the higher profit but must run after 0xa
+	eh.AddTransaction(&EventTx{Hash: "0xa", Receiver: "0x7a250d5630B4cF539739dF2C5dAcb4c659F2488D", GasPrice: big.NewInt(1), Value: EthToWei(10), Profit: EthToWei(1), DependsOn: []string{}, Timestamp: time.Now(), Calldata: swap})
+	eh.AddTransaction(&EventTx{Hash: "0xb", Receiver: "0xd9e1cE17f2641f24aE83637ab66a2cca9C378B9F", GasPrice: big.NewInt(1), Value: EthToWei(10), Profit: EthToWei(2), DependsOn: []string{"0xa"}, Timestamp: time.Now()})
+
+	plan := eh.GenerateBundlePlan()
+	etx, err := eh.ExecuteBundle(plan)
+	if err != nil {
+		t.Fatalf("ExecuteBundle: %v", err)
+	}
+
+	weth, _ := parseAddress("0xC02aaA39b223FE8D0A0e5C4F27eAD9083C756Cc2")
+	aave, _ := parseAddress("0x87870Bca3F3fD6335C3F4ce8392D69350B4fA4E2")
+	uni, _ := parseAddress("0x7a250d5630B4cF539739dF2C5dAcb4c659F2488D")
+	sushi, _ := parseAddress("0xd9e1cE17f2641f24aE83637ab66a2cca9C378B9F")
+	fee := new(big.Int).Quo(EthToWei(20), big.NewInt(2000)) // 0.05%
+	owed := new(big.Int).Add(EthToWei(20), fee)
+	coinbase := new(big.Int).Sub(EthToWei(3), fee)
+	coinbase.Mul(coinbase, big.NewInt(9000))
+	coinbase.Quo(coinbase, big.NewInt(10000))
+
+	// both txs borrow from Aave: one merged loan whose callback unwraps it,
+	// funds the calls in dependency order, rewraps what is owed and repays
+	callback := abiCall(sigMulticall, abiArray{
+		abiBytes(abiCall(sigUnwrap, weth, abiUint{EthToWei(20)})),
+		abiBytes(abiCall(sigCall, uni, abiUint{EthToWei(10)}, abiBytes(swap))),
+		abiBytes(abiCall(sigCall, sushi, abiUint{EthToWei(10)}, abiBytes(nil))),
+		abiBytes(abiCall(sigWrap, weth, abiUint{owed})),
+		abiBytes(abiCall(sigRepay, aave, weth, abiUint{owed})),
+	})
+	want := abiCall(sigMulticall, abiArray{
+		abiBytes(abiCall(sigFlashLoan, u(1), aave, weth, abiUint{EthToWei(20)}, abiBytes(callback))),
+		abiBytes(abiCall(sigPayCoinbase, abiUint{coinbase})),
+	})
+	if !bytes.Equal(etx.Calldata, want) {
+		t.Errorf("calldata mismatch:\n got %x\nwant %x", etx.Calldata, want)
+	}
+	if etx.CoinbasePayment.Cmp(coinbase) != 0 {
+		t.Errorf("coinbase = %s, want %s", etx.CoinbasePayment, coinbase)
+	}
+	if etx.GasLimit <= txIntrinsicGas+calldataGas(etx.Calldata) {
+		t.Errorf("gas estimate %d does not cover the steps", etx.GasLimit)
+	}
+
+	// the raw tx must be a type-2 envelope whose signature recovers to the executor key
+	if etx.Raw[0] != 0x02 {
+		t.Fatalf("expected EIP-1559 envelope, got type %#x", etx.Raw[0])
+	}
+	to, _ := parseAddress("0x00000000000000000000000000000000E0EC0001")
+	unsigned := []rlpItem{rlpUint64(1), rlpUint64(0), rlpUint(big.NewInt(2e9)), rlpUint(big.NewInt(100e9)), rlpUint64(etx.GasLimit), to[:], rlpUint64(0), etx.Calldata, []rlpItem{}}
+	payload := rlpEncode(unsigned)
+	sigHash := keccak256([]byte{0x02}, payload)
+
+	// the signature is the last 67 bytes: v (1), r (0xa0 + 32), s (0xa0 + 32)
+	tail := etx.Raw[len(etx.Raw)-67:]
+	if tail[1] != 0xa0 || tail[34] != 0xa0 {
+		t.Fatalf("unexpected signature encoding %x", tail)
+	}
+	v := tail[0] // rlp(0) is 0x80, rlp(1) is 0x01
+	if v == 0x80 {
+		v = 0
+	}
+	compact := append([]byte{27 + v}, append(tail[2:34], tail[35:67]...)...)
+	pub, _, err := ecdsa.RecoverCompact(compact, sigHash)
+	if err != nil {
+		t.Fatalf("RecoverCompact: %v", err)
+	}
+	uncompressed := pub.SerializeUncompressed()
+	if got := "0x" + hex.EncodeToString(keccak256(uncompressed[1:])[12:]); got != etx.From {
+		t.Errorf("signature recovers to %s, want %s", got, etx.From)
+	}
+}
+
+func TestEncodePlanNestsLoansAndApprovesTokens(t *testing.T) {
+	ex := testExecutor(t)
+	ex.Tokens["USDC"] = "0xA0b86991c6218b36c1d19D4a2e9Eb0cE3606eB48"
+	aaveUSDC := NewAaveV3Flashloan("0x87870Bca3F3fD6335C3F4ce8392D69350B4fA4E2", "USDC", big.NewInt(1e12))
+	balancerUSDC := NewBalancerFlashloan(BalancerVault, "USDC", big.NewInt(1e12))
+	target := "0x7a250d5630B4cF539739dF2C5dAcb4c659F2488D"
+	plan := &BundlePlan{
+		Txs: []*EventTx{{Hash: "0xa", Receiver: target, Value: big.NewInt(3e6), Asset: "USDC"}},
+		Loans: []*FlashloanLeg{
+			{Provider: balancerUSDC, TxHash: "0xa", Amount: big.NewInt(2e6), Fee: big.NewInt(0)},
+			{Provider: aaveUSDC, TxHash: "0xa", Amount: big.NewInt(1e6), Fee: big.NewInt(500)},
+		},
+		NetProfit: big.NewInt(0),
+	}
+	calldata, _, _, err := ex.EncodePlan(plan)
+	if err != nil {
+		t.Fatalf("EncodePlan: %v", err)
+	}
+
+	usdc, _ := parseAddress("0xA0b86991c6218b36c1d19D4a2e9Eb0cE3606eB48")
+	aave, _ := parseAddress("0x87870Bca3F3fD6335C3F4ce8392D69350B4fA4E2")
+	vault, _ := parseAddress(BalancerVault)
+	to, _ := parseAddress(target)
+	inner := abiCall(sigMulticall, abiArray{
+		abiBytes(abiCall(sigApprove, usdc, to, u(3e6))),
+		abiBytes(abiCall(sigCall, to, u(0), abiBytes(nil))),
+		abiBytes(abiCall(sigRepay, aave, usdc, u(1e6+500))),
+	})
+	outer := abiCall(sigMulticall, abiArray{
+		abiBytes(abiCall(sigFlashLoan, u(1), aave, usdc, u(1e6), abiBytes(inner))),
+		abiBytes(abiCall(sigRepay, vault, usdc, u(2e6))),
+	})
+	want := abiCall(sigMulticall, abiArray{
+		abiBytes(abiCall(sigFlashLoan, u(2), vault, usdc, u(2e6), abiBytes(outer))),
+		abiBytes(abiCall(sigPayCoinbase, u(0))),
+	})
+	if !bytes.Equal(calldata, want) {
+		t.Errorf("calldata mismatch:\n got %x\nwant %x", calldata, want)
+	}
+}
+
+func TestNewExecutorNeedsChainID(t *testing.T) {
+	key := make([]byte, 32)
+	key[31] = 1
+	if _, err := NewExecutor("0x00000000000000000000000000000000E0EC0001", nil, key); err == nil {
+		t.Error("expected NewExecutor to refuse a nil chain ID")
+	}
+}
+
+func TestBuildAdvancesNonceOnConfirm(t *testing.T) {
+	ex := testExecutor(t)
+	ex.SetNonce(7)
+	plan := &BundlePlan{Txs: []*EventTx{}, GrossWei: big.NewInt(0), FeesWei: big.NewInt(0), NetProfit: big.NewInt(0)}
+
+	first, err := ex.Build(plan)
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+	again, err := ex.Build(plan)
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+	// an unsent tx does not use up its nonce
+	if first.Nonce != 7 || again.Nonce != 7 {
+		t.Fatalf("unsent builds should reuse nonce 7, got %d and %d", first.Nonce, again.Nonce)
+	}
+	ex.Confirm(again)
+	next, err := ex.Build(plan)
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+	if next.Nonce != 8 {
+		t.Errorf("nonce after confirm = %d, want 8", next.Nonce)
+	}
+	// confirming an older tx does not move the nonce back
+	ex.Confirm(first)
+	if ex.Nonce() != 8 {
+		t.Errorf("nonce = %d after confirming a stale tx, want 8", ex.Nonce())
+	}
+}
+
+func TestLegacyCapExecutes(t *testing.T) {
+	// no providers: the cap borrows from the Balancer vault
+	eh := NewEventHorizon(5, EthToWei(1000))
+	eh.SetExecutor(testExecutor(t))
+	eh.AddTransaction(&EventTx{Hash: "0xa", Receiver: "0x7a250d5630B4cF539739dF2C5dAcb4c659F2488D", GasPrice: big.NewInt(1), Value: EthToWei(10), Profit: EthToWei(1), DependsOn: []string{}, Timestamp: time.Now()})
+
+	plan := eh.GenerateBundlePlan()
+	if len(plan.Loans) != 1 || plan.Loans[0].Provider.Address != BalancerVault {
+		t.Fatalf("expected one loan from the Balancer vault, got %+v", plan.Loans)
+	}
+	if _, err := eh.ExecuteBundle(plan); err != nil {
+		t.Errorf("ExecuteBundle: %v", err)
+	}
+}
@@ -0,0 +1,292 @@
+package mevhypersuper
+
+import (
+	"fmt"
+	"math/big"
+	"sort"
+)
+
+// NativeAsset is the asset an EventTx borrows when its Asset is empty.
+const NativeAsset = "ETH"
+
+// Flashloan provider kinds.
+const (
+	ProviderAaveV3    = "aave-v3"
+	ProviderBalancer  = "balancer"
+	ProviderUniswapV3 = "uniswap-v3"
+)
+
+// BalancerVault is the Balancer V2 vault, deployed at the same address on
+// every chain. The legacy flashloan cap from NewEventHorizon borrows from it.
+const BalancerVault = "0xBA12222222228d8Ba445958a75a0704d566BF2C8"
+
+// Standard flashloan fees in basis points.
+const (
+	AaveV3FlashloanFeeBps   = 5 // 0.05%
+	BalancerFlashloanFeeBps = 0
+)
+
+// FlashloanProvider = one source of flashloan liquidity for one asset.
+type FlashloanProvider struct {
+	Name      string
+	Kind      string
+	Address   string // lending pool, vault or Uniswap V3 pool
+	Asset     string
+	FeeBps    int64
+	Available *big.Int
+}
+
+// NewAaveV3Flashloan models an Aave V3 pool's flashLoanSimple for asset.
+func NewAaveV3Flashloan(pool, asset string, available *big.Int) *FlashloanProvider {
+	return &FlashloanProvider{Name: "Aave V3", Kind: ProviderAaveV3, Address: pool, Asset: asset, FeeBps: AaveV3FlashloanFeeBps, Available: available}
+}
+
+// NewBalancerFlashloan models the Balancer vault's fee-free flashLoan for asset.
+func NewBalancerFlashloan(vault, asset string, available *big.Int) *FlashloanProvider {
+	return &FlashloanProvider{Name: "Balancer", Kind: ProviderBalancer, Address: vault, Asset: asset, FeeBps: BalancerFlashloanFeeBps, Available: available}
+}
+
+// NewUniswapV3Flashloan models flash() on a Uniswap V3 pool; the fee equals the
+// pool's fee tier (e.g. 5 bps for the 0.05% tier).
+func NewUniswapV3Flashloan(pool, asset string, feeBps int64, available *big.Int) *FlashloanProvider {
+	return &FlashloanProvider{Name: "Uniswap V3", Kind: ProviderUniswapV3, Address: pool, Asset: asset, FeeBps: feeBps, Available: available}
+}
+
+// FlashloanLeg = an amount borrowed from one provider to fund one tx.
+type FlashloanLeg struct {
+	Provider *FlashloanProvider
+	TxHash   string
+	Amount   *big.Int
+	Fee      *big.Int // in Provider.Asset units
+	FeeWei   *big.Int
+}
+
+// BundlePlan = a bundle plus the flashloans that fund it.
+type BundlePlan struct {
+	Txs       []*EventTx
+	Loans     []*FlashloanLeg
+	GrossWei  *big.Int // sum of tx profits
+	FeesWei   *big.Int // flashloan fees valued in wei
+	NetProfit *big.Int // GrossWei - FeesWei
+}
+
+// AddFlashloanProvider registers a flashloan source. Once any provider exists
+// for an asset, the legacy flashloan cap no longer applies to it.
+func (eh *EventHorizonCore) AddFlashloanProvider(p *FlashloanProvider) {
+	eh.graph.mutex.Lock()
+	defer eh.graph.mutex.Unlock()
+	eh.providers[p.Asset] = append(eh.providers[p.Asset], p)
+}
+
+// SetAssetPrice sets the wei value of one base unit of asset, scaled by 1e18.
+// It is used to value flashloan fees in non-native assets.
+func (eh *EventHorizonCore) SetAssetPrice(asset string, weiPerUnitWAD *big.Int) {
+	eh.graph.mutex.Lock()
+	defer eh.graph.mutex.Unlock()
+	eh.assetPrices[asset] = weiPerUnitWAD
+}
+
+func txAsset(tx *EventTx) string {
+	if tx.Asset == "" {
+		return NativeAsset
+	}
+	return tx.Asset
+}
+
+// flashloanBook tracks remaining provider liquidity while a bundle is built.
+type flashloanBook struct {
+	providers map[string][]*FlashloanProvider
+	remaining map[*FlashloanProvider]*big.Int
+	prices    map[string]*big.Int
+}
+
+// newFlashloanBook snapshots providers, cheapest first per asset.
+func (eh *EventHorizonCore) newFlashloanBook() *flashloanBook {
+	eh.graph.mutex.RLock()
+	defer eh.graph.mutex.RUnlock()
+
+	book := &flashloanBook{
+		providers: make(map[string][]*FlashloanProvider),
+		remaining: make(map[*FlashloanProvider]*big.Int),
+		prices:    make(map[string]*big.Int),
+	}
+	for asset, ps := range eh.providers {
+		sorted := append([]*FlashloanProvider(nil), ps...)
+		sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].FeeBps < sorted[j].FeeBps })
+		book.providers[asset] = sorted
+	}
+	if len(book.providers[NativeAsset]) == 0 && eh.flashloanLimit != nil {
+		book.providers[NativeAsset] = []*FlashloanProvider{NewBalancerFlashloan(BalancerVault, NativeAsset, eh.flashloanLimit)}
+	}
+	for _, ps := range book.providers {
+		for _, p := range ps {
+			book.remaining[p] = new(big.Int).Set(p.Available)
+		}
+	}
+	for asset, price := range eh.assetPrices {
+		book.prices[asset] = price
+	}
+	return book
+}
+
+// feeWei values a fee in asset units in wei.
+func (b *flashloanBook) feeWei(asset string, fee *big.Int) (*big.Int, error) {
+	if fee.Sign() == 0 || asset == NativeAsset {
+		return new(big.Int).Set(fee), nil
+	}
+	price, ok := b.prices[asset]
+	if !ok {
+		return nil, fmt.Errorf("no price for flashloan asset %s", asset)
+	}
+	v := new(big.Int).Mul(fee, price)
+	return v.Quo(v, big.NewInt(1e18)), nil
+}
+
+// borrow funds tx from the cheapest providers with liquidity left. Nothing is
+// reserved unless the whole amount can be covered.
+func (b *flashloanBook) borrow(tx *EventTx) ([]*FlashloanLeg, *big.Int, error) {
+	asset := txAsset(tx)
+	need := new(big.Int).Set(tx.Value)
+	if need.Sign() <= 0 {
+		return nil, big.NewInt(0), nil
+	}
+
+	var legs []*FlashloanLeg
+	totalFeeWei := big.NewInt(0)
+	for _, p := range b.providers[asset] {
+		if need.Sign() == 0 {
+			break
+		}
+		left := b.remaining[p]
+		if left.Sign() <= 0 {
+			continue
+		}
+		amount := new(big.Int).Set(need)
+		if amount.Cmp(left) > 0 {
+			amount.Set(left)
+		}
+		// fees round up, as the providers do
+		fee := new(big.Int).Mul(amount, big.NewInt(p.FeeBps))
+		fee.Add(fee, big.NewInt(9999))
+		fee.Quo(fee, big.NewInt(10000))
+		feeWei, err := b.feeWei(asset, fee)
+		if err != nil {
+			return nil, nil, err
+		}
+		legs = append(legs, &FlashloanLeg{Provider: p, TxHash: tx.Hash, Amount: amount, Fee: fee, FeeWei: feeWei})
+		totalFeeWei.Add(totalFeeWei, feeWei)
+		need.Sub(need, amount)
+	}
+	if need.Sign() > 0 {
+		return nil, nil, fmt.Errorf("insufficient %s flashloan liquidity for %s", asset, tx.Hash)
+	}
+	return legs, totalFeeWei, nil
+}
+
+// commit reserves liquidity for accepted legs.
+func (b *flashloanBook) commit(legs []*FlashloanLeg) {
+	for _, leg := range legs {
+		b.remaining[leg.Provider].Sub(b.remaining[leg.Provider], leg.Amount)
+	}
+}
+
+// release returns liquidity reserved by commit.
+func (b *flashloanBook) release(legs []*FlashloanLeg) {
+	for _, leg := range legs {
+		b.remaining[leg.Provider].Add(b.remaining[leg.Provider], leg.Amount)
+	}
+}
+
+// closure returns tx after the in-pool dependencies not yet in the plan, in
+// dependency order, or false if one of them was skipped.
+func closure(tx *EventTx, pool map[string]*EventTx, included, skipped map[string]bool) ([]*EventTx, bool) {
+	var txs []*EventTx
+	seen := map[string]bool{}
+	var visit func(*EventTx) bool
+	visit = func(tx *EventTx) bool {
+		if seen[tx.Hash] || included[tx.Hash] {
+			return true
+		}
+		if skipped[tx.Hash] {
+			return false
+		}
+		seen[tx.Hash] = true
+		for _, dep := range tx.DependsOn {
+			// dependencies outside the pool (e.g. a pending oracle update) land on their own
+			if d, ok := pool[dep]; ok && !visit(d) {
+				return false
+			}
+		}
+		txs = append(txs, tx)
+		return true
+	}
+	return txs, visit(tx)
+}
+
+// GenerateBundlePlan selects the most profitable txs after flashloan fees and
+// picks the cheapest provider combination for each. A tx is planned together
+// with the in-pool txs it depends on: if any of them cannot be funded, or was
+// skipped, the tx is left out too.
+func (eh *EventHorizonCore) GenerateBundlePlan() *BundlePlan {
+	txs := eh.ResolveDependencies()
+	pool := make(map[string]*EventTx, len(txs))
+	for _, tx := range txs {
+		pool[tx.Hash] = tx
+	}
+
+	sort.SliceStable(txs, func(i, j int) bool {
+		return txs[i].Profit.Cmp(txs[j].Profit) > 0
+	})
+
+	book := eh.newFlashloanBook()
+	plan := &BundlePlan{
+		Txs:       []*EventTx{},
+		GrossWei:  big.NewInt(0),
+		FeesWei:   big.NewInt(0),
+		NetProfit: big.NewInt(0),
+	}
+	included := map[string]bool{}
+	skipped := map[string]bool{}
+	for _, tx := range txs {
+		if included[tx.Hash] || skipped[tx.Hash] {
+			continue
+		}
+		group, ok := closure(tx, pool, included, skipped)
+		if !ok {
+			skipped[tx.Hash] = true
+			continue
+		}
+		if len(plan.Txs)+len(group) > eh.maxBundleSize {
+			continue
+		}
+
+		var loans []*FlashloanLeg
+		gross, fees := big.NewInt(0), big.NewInt(0)
+		for _, t := range group {
+			legs, feeWei, err := book.borrow(t)
+			if err != nil {
+				ok = false
+				break
+			}
+			book.commit(legs)
+			loans = append(loans, legs...)
+			gross.Add(gross, t.Profit)
+			fees.Add(fees, feeWei)
+		}
+		// a loan that costs more than the txs earn is not worth taking
+		if !ok || (fees.Sign() > 0 && new(big.Int).Sub(gross, fees).Sign() <= 0) {
+			book.release(loans)
+			skipped[tx.Hash] = true
+			continue
+		}
+		for _, t := range group {
+			included[t.Hash] = true
+		}
+		plan.Txs = append(plan.Txs, group...)
+		plan.Loans = append(plan.Loans, loans...)
+		plan.GrossWei.Add(plan.GrossWei, gross)
+		plan.FeesWei.Add(plan.FeesWei, fees)
+	}
+	plan.NetProfit.Sub(plan.GrossWei, plan.FeesWei)
+	return plan
+}
@@ -0,0 +1,97 @@
+// This file contains tests for flashloan provider selection, fee accounting
+// and dependency handling in EventHorizonCore bundle generation.
+
+package mevhypersuper
+
+import (
+	"math/big"
+	"testing"
+	"time"
+)
+
+func TestBundlePlanUsesCheapestProviders(t *testing.T) {
+	eh := NewEventHorizon(5, EthToWei(1000))
+	eh.AddFlashloanProvider(NewAaveV3Flashloan("0xAave", NativeAsset, EthToWei(1000)))
+	eh.AddFlashloanProvider(NewBalancerFlashloan("0xVault", NativeAsset, EthToWei(100)))
+
+	eh.AddTransaction(&EventTx{Hash: "0xa", GasPrice: big.NewInt(1), Value: EthToWei(300), Profit: EthToWei(2), DependsOn: []string{}, Timestamp: time.Now()})
+
+	plan := eh.GenerateBundlePlan()
+	if len(plan.Txs) != 1 || len(plan.Loans) != 2 {
+		t.Fatalf("expected 1 tx funded by 2 loans, got %d txs / %d loans", len(plan.Txs), len(plan.Loans))
+	}
+	if plan.Loans[0].Provider.Kind != ProviderBalancer || plan.Loans[0].Amount.Cmp(EthToWei(100)) != 0 {
+		t.Errorf("expected the free Balancer liquidity to be drawn first, got %s from %s", plan.Loans[0].Amount, plan.Loans[0].Provider.Name)
+	}
+	// 200 ETH from Aave at 0.05% = 0.1 ETH
+	wantFee := new(big.Int).Quo(EthToWei(1), big.NewInt(10))
+	if plan.FeesWei.Cmp(wantFee) != 0 {
+		t.Errorf("fees = %s, want %s", plan.FeesWei, wantFee)
+	}
+	if want := new(big.Int).Sub(EthToWei(2), wantFee); plan.NetProfit.Cmp(want) != 0 {
+		t.Errorf("net profit = %s, want %s", plan.NetProfit, want)
+	}
+}
+
+func TestBundlePlanSkipsUnfundableAndUnprofitable(t *testing.T) {
+	eh := NewEventHorizon(5, EthToWei(1000))
+	eh.AddFlashloanProvider(NewAaveV3Flashloan("0xAave", "USDC", big.NewInt(1_000_000e6)))
+	eh.SetAssetPrice("USDC", new(big.Int).Mul(big.NewInt(5e8), big.NewInt(1e18))) // $2000/ETH
+
+	// 2M USDC exceeds liquidity
+	eh.AddTransaction(&EventTx{Hash: "0xbig", Asset: "USDC", GasPrice: big.NewInt(1), Value: big.NewInt(2_000_000e6), Profit: EthToWei(5), DependsOn: []string{}, Timestamp: time.Now()})
+	// fee on 100k USDC is $50 = 0.025 ETH, more than the 0.01 ETH profit
+	eh.AddTransaction(&EventTx{Hash: "0xthin", Asset: "USDC", GasPrice: big.NewInt(1), Value: big.NewInt(100_000e6), Profit: big.NewInt(1e16), DependsOn: []string{}, Timestamp: time.Now()})
+	// fee on 10k USDC is $5 = 0.0025 ETH
+	eh.AddTransaction(&EventTx{Hash: "0xok", Asset: "USDC", GasPrice: big.NewInt(1), Value: big.NewInt(10_000e6), Profit: big.NewInt(1e16), DependsOn: []string{}, Timestamp: time.Now()})
+
+	plan := eh.GenerateBundlePlan()
+	if len(plan.Txs) != 1 || plan.Txs[0].Hash != "0xok" {
+		t.Fatalf("expected only 0xok in the plan, got %d txs", len(plan.Txs))
+	}
+	if want := big.NewInt(25e14); plan.FeesWei.Cmp(want) != 0 {
+		t.Errorf("fees = %s wei, want %s", plan.FeesWei, want)
+	}
+}
+
+func TestBundlePlanDropsDependentsOfSkipped(t *testing.T) {
+	eh := NewEventHorizon(5, EthToWei(1000))
+	eh.AddFlashloanProvider(NewBalancerFlashloan("0xVault", NativeAsset, EthToWei(100)))
+
+	// 0xparent needs more than the vault holds, so 0xchild cannot run after it
+	eh.AddTransaction(&EventTx{Hash: "0xparent", GasPrice: big.NewInt(1), Value: EthToWei(500), Profit: EthToWei(1), DependsOn: []string{}, Timestamp: time.Now()})
+	eh.AddTransaction(&EventTx{Hash: "0xchild", GasPrice: big.NewInt(1), Value: EthToWei(10), Profit: EthToWei(3), DependsOn: []string{"0xparent"}, Timestamp: time.Now()})
+	// a dependency outside the pool does not hold 0xoracle back
+	eh.AddTransaction(&EventTx{Hash: "0xoracle", GasPrice: big.NewInt(1), Value: EthToWei(10), Profit: EthToWei(2), DependsOn: []string{"0xpending"}, Timestamp: time.Now()})
+
+	plan := eh.GenerateBundlePlan()
+	if len(plan.Txs) != 1 || plan.Txs[0].Hash != "0xoracle" {
+		var hashes []string
+		for _, tx := range plan.Txs {
+			hashes = append(hashes, tx.Hash)
+		}
+		t.Fatalf("expected only 0xoracle in the plan, got %v", hashes)
+	}
+	if len(plan.Loans) != 1 || plan.Loans[0].TxHash != "0xoracle" {
+		t.Errorf("skipped txs must not hold flashloan liquidity, got %d loans", len(plan.Loans))
+	}
+}
+
+func TestBundlePlanFundsDependencyClosure(t *testing.T) {
+	eh := NewEventHorizon(5, EthToWei(1000))
+	eh.AddFlashloanProvider(NewBalancerFlashloan("0xVault", NativeAsset, EthToWei(100)))
+
+	// the low-profit parent is planned ahead of its profitable child
+	eh.AddTransaction(&EventTx{Hash: "0xparent", GasPrice: big.NewInt(1), Value: EthToWei(50), Profit: big.NewInt(1), DependsOn: []string{}, Timestamp: time.Now()})
+	eh.AddTransaction(&EventTx{Hash: "0xchild", GasPrice: big.NewInt(1), Value: EthToWei(50), Profit: EthToWei(3), DependsOn: []string{"0xparent"}, Timestamp: time.Now()})
+	eh.AddTransaction(&EventTx{Hash: "0xother", GasPrice: big.NewInt(1), Value: EthToWei(10), Profit: EthToWei(2), DependsOn: []string{}, Timestamp: time.Now()})
+
+	plan := eh.GenerateBundlePlan()
+	if len(plan.Txs) != 2 || plan.Txs[0].Hash != "0xparent" || plan.Txs[1].Hash != "0xchild" {
+		var hashes []string
+		for _, tx := range plan.Txs {
+			hashes = append(hashes, tx.Hash)
+		}
+		t.Fatalf("expected [0xparent 0xchild], got %v", hashes)
+	}
+}
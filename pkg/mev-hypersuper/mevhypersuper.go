@@ -1,9 +1,9 @@
 package mevhypersuper
 
 import (
+	"errors"
 	"fmt"
 	"math/big"
-	"sort"
 	"sync"
 	"time"
 )
@@ -23,6 +23,8 @@ type EventTx struct {
 	Profit     *big.Int
 	DependsOn  []string
 	Timestamp  time.Time
+	Asset      string // asset Value is borrowed in; empty means NativeAsset
+	Calldata   []byte // call the executor makes on Receiver
 }
 
 // TxGraph resolves complex dependencies for MEV optimization.
@@ -37,6 +39,9 @@ type EventHorizonCore struct {
 	graph           *TxGraph
 	flashloanLimit  *big.Int
 	maxBundleSize   int
+	providers       map[string][]*FlashloanProvider
+	assetPrices     map[string]*big.Int
+	executor        *Executor
 }
 
 // NewEventHorizon initializes Event Horizon engine.
@@ -48,6 +53,8 @@ func NewEventHorizon(bundleSize int, flashloanCap *big.Int) *EventHorizonCore {
 		},
 		flashloanLimit: flashloanCap,
 		maxBundleSize:  bundleSize,
+		providers:      make(map[string][]*FlashloanProvider),
+		assetPrices:    make(map[string]*big.Int),
 	}
 }
 
@@ -56,7 +63,10 @@ func (eh *EventHorizonCore) AddTransaction(tx *EventTx) {
 	eh.graph.mutex.Lock()
 	defer eh.graph.mutex.Unlock()
 
-	tx.Profit = new(big.Int).Sub(tx.Value, tx.GasPrice)
+	// strategies that already priced the opportunity (e.g. liquidations) keep their profit
+	if tx.Profit == nil {
+		tx.Profit = new(big.Int).Sub(tx.Value, tx.GasPrice)
+	}
 	eh.graph.Nodes[tx.Hash] = tx
 	for _, dep := range tx.DependsOn {
 		eh.graph.Edges[dep] = append(eh.graph.Edges[dep], tx.Hash)
@@ -76,10 +86,15 @@ func (eh *EventHorizonCore) ResolveDependencies() []*EventTx {
 		if resolved[hash] {
 			return
 		}
-		for _, depHash := range eh.graph.Nodes[hash].DependsOn {
+		tx, exists := eh.graph.Nodes[hash]
+		if !exists {
+			// dependency lives outside the graph (e.g. a pending oracle update)
+			return
+		}
+		for _, depHash := range tx.DependsOn {
 			visit(depHash)
 		}
-		executionOrder = append(executionOrder, eh.graph.Nodes[hash])
+		executionOrder = append(executionOrder, tx)
 		resolved[hash] = true
 	}
 
@@ -92,45 +107,69 @@ func (eh *EventHorizonCore) ResolveDependencies() []*EventTx {
 
 // GenerateOptimalBundle optimizes tx selection across protocols.
 func (eh *EventHorizonCore) GenerateOptimalBundle() []*EventTx {
-	txs := eh.ResolveDependencies()
+	return eh.GenerateBundlePlan().Txs
+}
 
-	sort.Slice(txs, func(i, j int) bool {
-		return txs[i].Profit.Cmp(txs[j].Profit) > 0
-	})
+// SetExecutor configures the executor contract bundles are compiled for.
+func (eh *EventHorizonCore) SetExecutor(ex *Executor) {
+	eh.graph.mutex.Lock()
+	defer eh.graph.mutex.Unlock()
+	eh.executor = ex
+}
 
-	bundle := []*EventTx{}
-	flashloanUsed := big.NewInt(0)
-	for _, tx := range txs {
-		if len(bundle) >= eh.maxBundleSize {
-			break
-		}
-		if flashloanUsed.Add(flashloanUsed, tx.Value).Cmp(eh.flashloanLimit) <= 0 {
-			bundle = append(bundle, tx)
-		}
+// ExecuteBundle compiles the plan into one signed, atomic executor transaction:
+// take the flashloans, run the txs in dependency order, repay, pay the coinbase.
+func (eh *EventHorizonCore) ExecuteBundle(plan *BundlePlan) (*ExecutorTx, error) {
+	eh.graph.mutex.RLock()
+	ex := eh.executor
+	eh.graph.mutex.RUnlock()
+	if ex == nil {
+		return nil, errors.New("no executor configured")
 	}
 
-	return bundle
-}
-
-// ExecuteBundle integrates Flashbots and flashloans.
-func (eh *EventHorizonCore) ExecuteBundle(bundle []*EventTx) {
+	etx, err := ex.Build(plan)
+	if err != nil {
+		return nil, err
+	}
 	fmt.Println("Executing MEV Event Horizon Master Bundle:")
-	for _, tx := range bundle {
-		fmt.Printf("Tx: %s | Sender: %s | Receiver: %s | Profit: %s wei | Value: %s wei\n",
+	for _, tx := range orderByDependencies(plan.Txs) {
+		fmt.Printf("Tx: %s | Sender: %s | Receiver: %s | Profit: %s wei | Value: %s\n",
 			tx.Hash, tx.Sender, tx.Receiver, tx.Profit.String(), tx.Value.String())
 	}
+	fmt.Printf("Executor Tx: %s | Gas: %d | Coinbase: %s wei | Calldata: %d bytes\n",
+		etx.Hash, etx.GasLimit, etx.CoinbasePayment.String(), len(etx.Calldata))
+	return etx, nil
 }
 
 // Example demonstrates Event Horizon's MEV strategy.
 func Example() {
 	eh := NewEventHorizon(5, EthToWei(1000)) // 1000 ETH Flashloan limit
 
-	eh.AddTransaction(&EventTx{"0xa", "0xA", "0xUni", big.NewInt(100e9), EthToWei(400), nil, []string{}, time.Now()})
-	eh.AddTransaction(&EventTx{"0xb", "0xB", "0xSushi", big.NewInt(150e9), EthToWei(300), nil, []string{"0xa"}, time.Now()})
-	eh.AddTransaction(&EventTx{"0xc", "0xC", "0xCurve", big.NewInt(200e9), EthToWei(500), nil, []string{"0xb"}, time.Now()})
-	eh.AddTransaction(&EventTx{"0xd", "0xD", "0xBalancer", big.NewInt(250e9), EthToWei(450), nil, []string{}, time.Now()})
-	eh.AddTransaction(&EventTx{"0xe", "0xE", "0x1inch", big.NewInt(300e9), EthToWei(600), nil, []string{"0xc", "0xd"}, time.Now()})
+	// Flashloan sources; Balancer is free so it is drawn first
+	eh.AddFlashloanProvider(NewBalancerFlashloan("0xBA12222222228d8Ba445958a75a0704d566BF2C8", NativeAsset, EthToWei(600)))
+	eh.AddFlashloanProvider(NewAaveV3Flashloan("0x87870Bca3F3fD6335C3F4ce8392D69350B4fA4E2", NativeAsset, EthToWei(2000)))
+
+	eh.AddTransaction(&EventTx{Hash: "0xa", Sender: "0xA", Receiver: "0x7a250d5630B4cF539739dF2C5dAcb4c659F2488D", GasPrice: big.NewInt(100e9), Value: EthToWei(400), DependsOn: []string{}, Timestamp: time.Now()})
+	eh.AddTransaction(&EventTx{Hash: "0xb", Sender: "0xB", Receiver: "0xd9e1cE17f2641f24aE83637ab66a2cca9C378B9F", GasPrice: big.NewInt(150e9), Value: EthToWei(300), DependsOn: []string{"0xa"}, Timestamp: time.Now()})
+	eh.AddTransaction(&EventTx{Hash: "0xc", Sender: "0xC", Receiver: "0xbEbc44782C7dB0a1A60Cb6fe97d0b483032FF1C7", GasPrice: big.NewInt(200e9), Value: EthToWei(500), DependsOn: []string{"0xb"}, Timestamp: time.Now()})
+	eh.AddTransaction(&EventTx{Hash: "0xd", Sender: "0xD", Receiver: "0xBA12222222228d8Ba445958a75a0704d566BF2C8", GasPrice: big.NewInt(250e9), Value: EthToWei(450), DependsOn: []string{}, Timestamp: time.Now()})
+	eh.AddTransaction(&EventTx{Hash: "0xe", Sender: "0xE", Receiver: "0x1111111254EEB25477B68fb85Ed929f73A960582", GasPrice: big.NewInt(300e9), Value: EthToWei(600), DependsOn: []string{"0xc", "0xd"}, Timestamp: time.Now()})
+
+	key := make([]byte, 32)
+	key[31] = 1 // demo key, never use on mainnet
+	executor, err := NewExecutor("0x00000000000000000000000000000000E0EC0001", big.NewInt(1), key)
+	if err != nil {
+		fmt.Println("Executor setup failed:", err)
+		return
+	}
+	executor.Tokens[NativeAsset] = "0xC02aaA39b223FE8D0A0e5C4F27eAD9083C756Cc2" // WETH
+	eh.SetExecutor(executor)
 
-	bundle := eh.GenerateOptimalBundle()
-	eh.ExecuteBundle(bundle)
+	plan := eh.GenerateBundlePlan()
+	for _, loan := range plan.Loans {
+		fmt.Printf("Flashloan: %s wei from %s for %s (fee %s wei)\n", loan.Amount, loan.Provider.Name, loan.TxHash, loan.FeeWei)
+	}
+	if _, err := eh.ExecuteBundle(plan); err != nil {
+		fmt.Println("Execution failed:", err)
+	}
 }
@@ -0,0 +1,48 @@
+package mevhypersuper
+
+import (
+	"math/big"
+)
+
+// rlpItem = a byte string or a list of items, as defined by Ethereum's RLP.
+type rlpItem interface{}
+
+// rlpUint encodes an unsigned integer as a minimal big-endian byte string.
+func rlpUint(v *big.Int) []byte {
+	if v == nil {
+		return []byte{}
+	}
+	return v.Bytes()
+}
+
+// rlpUint64 is rlpUint for native integers.
+func rlpUint64(v uint64) []byte {
+	return rlpUint(new(big.Int).SetUint64(v))
+}
+
+// rlpEncode encodes []byte and []rlpItem values.
+func rlpEncode(item rlpItem) []byte {
+	switch v := item.(type) {
+	case []byte:
+		if len(v) == 1 && v[0] < 0x80 {
+			return []byte{v[0]}
+		}
+		return append(rlpLength(len(v), 0x80), v...)
+	case []rlpItem:
+		var payload []byte
+		for _, it := range v {
+			payload = append(payload, rlpEncode(it)...)
+		}
+		return append(rlpLength(len(payload), 0xc0), payload...)
+	}
+	panic("rlp: unsupported item type")
+}
+
+// rlpLength returns the prefix for a payload of n bytes.
+func rlpLength(n int, offset byte) []byte {
+	if n < 56 {
+		return []byte{offset + byte(n)}
+	}
+	size := new(big.Int).SetInt64(int64(n)).Bytes()
+	return append([]byte{offset + 55 + byte(len(size))}, size...)
+}
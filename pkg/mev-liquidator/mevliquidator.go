@@ -0,0 +1,524 @@
+package mevliquidator
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mellis0303/mev-vem/pkg/mev-hypersuper"
+)
+
+// Supported lending protocols.
+const (
+	ProtocolAaveV3     = "aave-v3"
+	ProtocolCompoundV3 = "compound-v3"
+)
+
+// DefaultLiquidationGas is the gas budgeted per liquidation call.
+const DefaultLiquidationGas = 450000
+
+// DefaultAbsorbGas is the gas budgeted for a Compound V3 absorb, which runs
+// before the buyCollateral call.
+const DefaultAbsorbGas = 250000
+
+// Liquidation entry points on each protocol's market contract.
+const (
+	sigLiquidationCall = "liquidationCall(address,address,address,uint256,bool)" // Aave V3 Pool
+	sigAbsorb          = "absorb(address,address[])"                             // Compound V3 Comet
+	sigBuyCollateral   = "buyCollateral(address,uint256,uint256,address)"        // Compound V3 Comet
+)
+
+var (
+	// WAD is the 1e18 scale health factors are expressed in (1e18 == 1.0).
+	WAD = big.NewInt(1e18)
+	// aaveFullCloseThreshold is Aave V3's CLOSE_FACTOR_HF_THRESHOLD (0.95).
+	aaveFullCloseThreshold = big.NewInt(95e16)
+)
+
+// AssetConfig = per-protocol risk parameters of one asset.
+type AssetConfig struct {
+	Protocol             string `json:"protocol"`
+	Symbol               string `json:"symbol"`
+	Address              string `json:"address"` // token contract
+	Decimals             int    `json:"decimals"`
+	LiquidationThreshold int64  `json:"liquidationThreshold"` // bps; Compound's liquidateCollateralFactor
+	LiquidationBonus     int64  `json:"liquidationBonus"`     // bps; Compound's store-front discount
+}
+
+// Position = one borrower's collateral and debt on one protocol.
+type Position struct {
+	Borrower   string              `json:"borrower"`
+	Protocol   string              `json:"protocol"`
+	Collateral map[string]*big.Int `json:"collateral"`
+	Debt       map[string]*big.Int `json:"debt"`
+}
+
+// Snapshot = borrower positions and oracle prices at a given block.
+type Snapshot struct {
+	Block     uint64              `json:"block"`
+	Native    string              `json:"native"`  // asset gas and profit are paid in, e.g. WETH
+	Prices    map[string]*big.Int `json:"prices"`  // USD, 8 decimals
+	Markets   map[string]string   `json:"markets"` // protocol -> Aave V3 Pool or Compound V3 Comet
+	Assets    []AssetConfig       `json:"assets"`
+	Positions []*Position         `json:"positions"`
+}
+
+// LoadSnapshot reads a local JSON snapshot of positions and prices.
+func LoadSnapshot(path string) (*Snapshot, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	snap := &Snapshot{}
+	if err := json.Unmarshal(data, snap); err != nil {
+		return nil, fmt.Errorf("decode snapshot %s: %w", path, err)
+	}
+	if snap.Prices[snap.Native] == nil {
+		return nil, fmt.Errorf("snapshot %s has no price for native asset %q", path, snap.Native)
+	}
+	return snap, nil
+}
+
+// PriceUpdate = a pending oracle update that may push positions under.
+type PriceUpdate struct {
+	Hash  string
+	Asset string
+	Price *big.Int // USD, 8 decimals
+}
+
+// Candidate = a profitable liquidation ready to be paired with a flashloan.
+// On Compound V3 the protocol absorbs the whole position and the liquidator
+// buys the absorbed collateral: RepayAmount is then the base asset paid to
+// buyCollateral and Seized the collateral bought.
+type Candidate struct {
+	Borrower        string
+	Protocol        string
+	HealthFactor    *big.Int // WAD
+	DebtAsset       string
+	RepayAmount     *big.Int // in DebtAsset units
+	CollateralAsset string
+	Seized          *big.Int // in CollateralAsset units, bonus included
+	Bonus           *big.Int // USD, 8 decimals
+	GasCost         *big.Int // wei
+	Profit          *big.Int // wei, bonus net of gas
+	DependsOn       []string // pending oracle update that makes it liquidatable
+}
+
+// SkippedPosition = a position a scan could not evaluate.
+type SkippedPosition struct {
+	Borrower string
+	Protocol string
+	Err      error
+}
+
+// ScanError is returned alongside the candidates found when some positions
+// were skipped, e.g. for lack of a price; the candidates are still valid.
+type ScanError struct {
+	Skipped []SkippedPosition
+}
+
+func (e *ScanError) Error() string {
+	first := e.Skipped[0]
+	return fmt.Sprintf("%d positions skipped, first %s on %s: %v", len(e.Skipped), first.Borrower, first.Protocol, first.Err)
+}
+
+// LiquidationScanner finds underwater accounts on Aave V3 and Compound V3.
+type LiquidationScanner struct {
+	snapshot *Snapshot
+	assets   map[string]map[string]AssetConfig // protocol -> symbol -> config
+	gasPrice *big.Int
+	gasLimit uint64
+	mutex    sync.RWMutex
+}
+
+// NewLiquidationScanner initializes a scanner over a loaded snapshot.
+func NewLiquidationScanner(snap *Snapshot, gasPrice *big.Int) *LiquidationScanner {
+	assets := make(map[string]map[string]AssetConfig)
+	for _, cfg := range snap.Assets {
+		if assets[cfg.Protocol] == nil {
+			assets[cfg.Protocol] = make(map[string]AssetConfig)
+		}
+		assets[cfg.Protocol][cfg.Symbol] = cfg
+	}
+	return &LiquidationScanner{
+		snapshot: snap,
+		assets:   assets,
+		gasPrice: gasPrice,
+		gasLimit: DefaultLiquidationGas,
+	}
+}
+
+// usdValue converts an asset amount into USD (8 decimals).
+func usdValue(amount, price *big.Int, decimals int) *big.Int {
+	v := new(big.Int).Mul(amount, price)
+	return v.Quo(v, pow10(decimals))
+}
+
+// fromUSD converts USD (8 decimals) into an asset amount.
+func fromUSD(usd, price *big.Int, decimals int) *big.Int {
+	v := new(big.Int).Mul(usd, pow10(decimals))
+	return v.Quo(v, price)
+}
+
+func pow10(n int) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+}
+
+func bps(v *big.Int, b int64) *big.Int {
+	r := new(big.Int).Mul(v, big.NewInt(b))
+	return r.Quo(r, big.NewInt(10000))
+}
+
+// HealthFactor returns sum(collateral * threshold) / sum(debt) as a WAD.
+// Positions without debt report nil (infinitely healthy).
+func (ls *LiquidationScanner) HealthFactor(pos *Position, prices map[string]*big.Int) (*big.Int, error) {
+	cfgs := ls.assets[pos.Protocol]
+	weighted, debt := big.NewInt(0), big.NewInt(0)
+	for asset, amount := range pos.Collateral {
+		cfg, ok := cfgs[asset]
+		if !ok || prices[asset] == nil {
+			return nil, fmt.Errorf("%s: no config or price for collateral %s", pos.Protocol, asset)
+		}
+		weighted.Add(weighted, bps(usdValue(amount, prices[asset], cfg.Decimals), cfg.LiquidationThreshold))
+	}
+	for asset, amount := range pos.Debt {
+		cfg, ok := cfgs[asset]
+		if !ok || prices[asset] == nil {
+			return nil, fmt.Errorf("%s: no config or price for debt %s", pos.Protocol, asset)
+		}
+		debt.Add(debt, usdValue(amount, prices[asset], cfg.Decimals))
+	}
+	if debt.Sign() == 0 {
+		return nil, nil
+	}
+	hf := new(big.Int).Mul(weighted, WAD)
+	return hf.Quo(hf, debt), nil
+}
+
+// closeFactorBps returns the share of an Aave V3 debt that may be repaid in
+// one call: half above a 0.95 health factor, all of it below.
+func closeFactorBps(hf *big.Int) int64 {
+	if hf.Cmp(aaveFullCloseThreshold) > 0 {
+		return 5000
+	}
+	return 10000
+}
+
+// bestLiquidation picks the liquidation with the largest bonus.
+func (ls *LiquidationScanner) bestLiquidation(pos *Position, hf *big.Int, prices map[string]*big.Int) *Candidate {
+	if pos.Protocol == ProtocolCompoundV3 {
+		return ls.bestPurchase(pos, hf, prices)
+	}
+	cfgs := ls.assets[pos.Protocol]
+	closeFactor := closeFactorBps(hf)
+
+	var best *Candidate
+	for debtAsset, debtAmount := range pos.Debt {
+		debtCfg := cfgs[debtAsset]
+		for collAsset, collAmount := range pos.Collateral {
+			collCfg := cfgs[collAsset]
+
+			repayUSD := bps(usdValue(debtAmount, prices[debtAsset], debtCfg.Decimals), closeFactor)
+			// collateral needed = repay * (1 + bonus); cap by what the borrower holds
+			collUSD := usdValue(collAmount, prices[collAsset], collCfg.Decimals)
+			maxRepayUSD := new(big.Int).Mul(collUSD, big.NewInt(10000))
+			maxRepayUSD.Quo(maxRepayUSD, big.NewInt(10000+collCfg.LiquidationBonus))
+			if repayUSD.Cmp(maxRepayUSD) > 0 {
+				repayUSD = maxRepayUSD
+			}
+			seizedUSD := bps(repayUSD, 10000+collCfg.LiquidationBonus)
+			bonus := new(big.Int).Sub(seizedUSD, repayUSD)
+
+			if best == nil || bonus.Cmp(best.Bonus) > 0 {
+				seized := fromUSD(seizedUSD, prices[collAsset], collCfg.Decimals)
+				if seized.Cmp(collAmount) > 0 {
+					seized = new(big.Int).Set(collAmount)
+				}
+				best = &Candidate{
+					Borrower:        pos.Borrower,
+					Protocol:        pos.Protocol,
+					HealthFactor:    hf,
+					DebtAsset:       debtAsset,
+					RepayAmount:     fromUSD(repayUSD, prices[debtAsset], debtCfg.Decimals),
+					CollateralAsset: collAsset,
+					Seized:          seized,
+					Bonus:           bonus,
+				}
+			}
+		}
+	}
+	return best
+}
+
+// bestPurchase models a Compound V3 liquidation as its two steps. absorb
+// takes the whole position into the protocol: the debt is written off and
+// every collateral asset moves to the reserves, with nothing paid to the
+// absorber. buyCollateral then sells the absorbed reserves of one asset at
+// the store-front discount. It picks the asset whose purchase earns the
+// largest discount.
+func (ls *LiquidationScanner) bestPurchase(pos *Position, hf *big.Int, prices map[string]*big.Int) *Candidate {
+	cfgs := ls.assets[pos.Protocol]
+	var base string
+	for asset := range pos.Debt {
+		base = asset // Comet lends a single base asset
+	}
+	baseCfg := cfgs[base]
+
+	var best *Candidate
+	for collAsset, collAmount := range pos.Collateral {
+		collCfg := cfgs[collAsset]
+		valueUSD := usdValue(collAmount, prices[collAsset], collCfg.Decimals)
+		costUSD := bps(valueUSD, 10000-collCfg.LiquidationBonus)
+		bonus := new(big.Int).Sub(valueUSD, costUSD)
+		if best == nil || bonus.Cmp(best.Bonus) > 0 {
+			best = &Candidate{
+				Borrower:        pos.Borrower,
+				Protocol:        pos.Protocol,
+				HealthFactor:    hf,
+				DebtAsset:       base,
+				RepayAmount:     fromUSD(costUSD, prices[base], baseCfg.Decimals),
+				CollateralAsset: collAsset,
+				Seized:          new(big.Int).Set(collAmount),
+				Bonus:           bonus,
+			}
+		}
+	}
+	return best
+}
+
+// scan evaluates every position against prices and returns profitable
+// candidates. Positions that cannot be priced are skipped and reported in a
+// *ScanError returned with the candidates.
+func (ls *LiquidationScanner) scan(prices map[string]*big.Int) ([]*Candidate, error) {
+	native := prices[ls.snapshot.Native]
+	gasCost := new(big.Int).Mul(ls.gasPrice, new(big.Int).SetUint64(ls.gasLimit))
+	absorbCost := new(big.Int).Mul(ls.gasPrice, big.NewInt(DefaultAbsorbGas))
+
+	var candidates []*Candidate
+	var skipped []SkippedPosition
+	for _, pos := range ls.snapshot.Positions {
+		hf, err := ls.HealthFactor(pos, prices)
+		if err != nil {
+			skipped = append(skipped, SkippedPosition{Borrower: pos.Borrower, Protocol: pos.Protocol, Err: err})
+			continue
+		}
+		if hf == nil || hf.Cmp(WAD) >= 0 {
+			continue
+		}
+		c := ls.bestLiquidation(pos, hf, prices)
+		if c == nil {
+			continue
+		}
+		c.GasCost = gasCost
+		if pos.Protocol == ProtocolCompoundV3 {
+			c.GasCost = new(big.Int).Add(gasCost, absorbCost)
+		}
+		c.Profit = new(big.Int).Sub(fromUSD(c.Bonus, native, 18), c.GasCost)
+		if c.Profit.Sign() > 0 {
+			candidates = append(candidates, c)
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].Profit.Cmp(candidates[j].Profit) > 0
+	})
+	if len(skipped) > 0 {
+		return candidates, &ScanError{Skipped: skipped}
+	}
+	return candidates, nil
+}
+
+// Scan returns every currently underwater account worth liquidating. If some
+// positions could not be priced, they are reported in a *ScanError returned
+// with the candidates from the rest.
+func (ls *LiquidationScanner) Scan() ([]*Candidate, error) {
+	ls.mutex.RLock()
+	defer ls.mutex.RUnlock()
+	return ls.scan(ls.snapshot.Prices)
+}
+
+// OnOracleUpdate re-checks positions under a pending price and returns the
+// accounts it would push under. Candidates depend on the update's hash.
+// Unpriceable positions are skipped as in Scan.
+func (ls *LiquidationScanner) OnOracleUpdate(update *PriceUpdate) ([]*Candidate, error) {
+	ls.mutex.RLock()
+	defer ls.mutex.RUnlock()
+
+	var scanErr *ScanError
+	before, err := ls.scan(ls.snapshot.Prices)
+	if err != nil && !errors.As(err, &scanErr) {
+		return nil, err
+	}
+	already := make(map[string]bool)
+	for _, c := range before {
+		already[c.Protocol+"/"+c.Borrower] = true
+	}
+
+	prices := make(map[string]*big.Int, len(ls.snapshot.Prices))
+	for asset, price := range ls.snapshot.Prices {
+		prices[asset] = price
+	}
+	prices[update.Asset] = update.Price
+
+	after, err := ls.scan(prices)
+	if err != nil && !errors.As(err, &scanErr) {
+		return nil, err
+	}
+	var pushed []*Candidate
+	for _, c := range after {
+		if !already[c.Protocol+"/"+c.Borrower] {
+			c.DependsOn = []string{update.Hash}
+			pushed = append(pushed, c)
+		}
+	}
+	return pushed, err
+}
+
+// EventTxs converts candidates into EventHorizonCore transactions that borrow
+// the repay amount of the debt asset and call the protocol's market. An Aave
+// V3 candidate is one liquidationCall. A Compound V3 candidate is an absorb,
+// then a buyCollateral of the absorbed collateral that depends on it; the
+// absorb carries no value or profit of its own.
+func (ls *LiquidationScanner) EventTxs(candidates []*Candidate, liquidator string) ([]*mevhypersuper.EventTx, error) {
+	ls.mutex.RLock()
+	defer ls.mutex.RUnlock()
+
+	txs := make([]*mevhypersuper.EventTx, 0, len(candidates))
+	for _, c := range candidates {
+		market, ok := ls.snapshot.Markets[c.Protocol]
+		if !ok {
+			return nil, fmt.Errorf("no market address for %s", c.Protocol)
+		}
+		debt, coll := ls.assets[c.Protocol][c.DebtAsset].Address, ls.assets[c.Protocol][c.CollateralAsset].Address
+		dependsOn := c.DependsOn
+		if dependsOn == nil {
+			dependsOn = []string{}
+		}
+		hash := fmt.Sprintf("liq:%s:%s:%s", c.Protocol, c.Borrower, c.DebtAsset)
+
+		var calldata []byte
+		var err error
+		switch c.Protocol {
+		case ProtocolAaveV3:
+			calldata, err = mevhypersuper.EncodeCall(sigLiquidationCall, coll, debt, c.Borrower, c.RepayAmount, false)
+		case ProtocolCompoundV3:
+			absorb, aerr := mevhypersuper.EncodeCall(sigAbsorb, liquidator, []string{c.Borrower})
+			if aerr != nil {
+				return nil, fmt.Errorf("absorb %s: %w", c.Borrower, aerr)
+			}
+			absorbHash := fmt.Sprintf("liq:%s:%s:absorb", c.Protocol, c.Borrower)
+			txs = append(txs, &mevhypersuper.EventTx{
+				Hash:      absorbHash,
+				Sender:    liquidator,
+				Receiver:  market,
+				GasPrice:  ls.gasPrice,
+				Value:     big.NewInt(0),
+				Profit:    big.NewInt(0),
+				DependsOn: dependsOn,
+				Timestamp: time.Now(),
+				Asset:     c.DebtAsset,
+				Calldata:  absorb,
+			})
+			dependsOn = []string{absorbHash}
+			calldata, err = mevhypersuper.EncodeCall(sigBuyCollateral, coll, c.Seized, c.RepayAmount, liquidator)
+		default:
+			return nil, fmt.Errorf("unsupported protocol %s", c.Protocol)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("liquidate %s on %s: %w", c.Borrower, c.Protocol, err)
+		}
+		txs = append(txs, &mevhypersuper.EventTx{
+			Hash:      hash,
+			Sender:    liquidator,
+			Receiver:  market,
+			GasPrice:  ls.gasPrice,
+			Value:     new(big.Int).Set(c.RepayAmount),
+			Profit:    new(big.Int).Set(c.Profit),
+			DependsOn: dependsOn,
+			Timestamp: time.Now(),
+			Asset:     c.DebtAsset,
+			Calldata:  calldata,
+		})
+	}
+	return txs, nil
+}
+
+// WeiPrices returns the wei value of one base unit of each asset, scaled by
+// 1e18, for EventHorizonCore.SetAssetPrice.
+func (ls *LiquidationScanner) WeiPrices() map[string]*big.Int {
+	ls.mutex.RLock()
+	defer ls.mutex.RUnlock()
+
+	decimals := make(map[string]int)
+	for _, cfg := range ls.snapshot.Assets {
+		decimals[cfg.Symbol] = cfg.Decimals
+	}
+	native := ls.snapshot.Prices[ls.snapshot.Native]
+	prices := make(map[string]*big.Int)
+	for asset, price := range ls.snapshot.Prices {
+		dec, ok := decimals[asset]
+		if !ok {
+			continue
+		}
+		v := new(big.Int).Mul(price, WAD)
+		v.Mul(v, WAD)
+		prices[asset] = v.Quo(v, new(big.Int).Mul(pow10(dec), native))
+	}
+	return prices
+}
+
+// Example demonstrates pairing liquidation candidates with Event Horizon flashloans.
+func Example() {
+	snap := &Snapshot{
+		Block:  19000000,
+		Native: "WETH",
+		Prices: map[string]*big.Int{"WETH": big.NewInt(2000e8), "USDC": big.NewInt(1e8)},
+		Assets: []AssetConfig{
+			{Protocol: ProtocolAaveV3, Symbol: "WETH", Address: "0xC02aaA39b223FE8D0A0e5C4F27eAD9083C756Cc2", Decimals: 18, LiquidationThreshold: 8250, LiquidationBonus: 500},
+			{Protocol: ProtocolAaveV3, Symbol: "USDC", Address: "0xA0b86991c6218b36c1d19D4a2e9Eb0cE3606eB48", Decimals: 6, LiquidationThreshold: 7800, LiquidationBonus: 450},
+		},
+		Markets: map[string]string{ProtocolAaveV3: "0x87870Bca3F3fD6335C3F4ce8392D69350B4fA4E2"},
+		Positions: []*Position{{
+			Borrower:   "0x00000000000000000000000000000000000B0B01",
+			Protocol:   ProtocolAaveV3,
+			Collateral: map[string]*big.Int{"WETH": mevhypersuper.EthToWei(10)},
+			Debt:       map[string]*big.Int{"USDC": big.NewInt(16000e6)},
+		}},
+	}
+	scanner := NewLiquidationScanner(snap, big.NewInt(30e9))
+
+	// a pending oracle update pushes WETH to $1900, taking the borrower under
+	candidates, err := scanner.OnOracleUpdate(&PriceUpdate{Hash: "0xoracle", Asset: "WETH", Price: big.NewInt(1900e8)})
+	var scanErr *ScanError
+	if errors.As(err, &scanErr) {
+		for _, p := range scanErr.Skipped {
+			fmt.Printf("Skipped %s on %s: %v\n", p.Borrower, p.Protocol, p.Err)
+		}
+	} else if err != nil {
+		fmt.Println("Scan failed:", err)
+		return
+	}
+
+	eh := mevhypersuper.NewEventHorizon(5, mevhypersuper.EthToWei(1000))
+	eh.AddFlashloanProvider(mevhypersuper.NewAaveV3Flashloan("0x87870Bca3F3fD6335C3F4ce8392D69350B4fA4E2", "USDC", big.NewInt(50_000_000e6)))
+	for asset, price := range scanner.WeiPrices() {
+		eh.SetAssetPrice(asset, price)
+	}
+	txs, err := scanner.EventTxs(candidates, "0x00000000000000000000000000000000E0EC0001")
+	if err != nil {
+		fmt.Println("Encoding failed:", err)
+		return
+	}
+	for _, tx := range txs {
+		eh.AddTransaction(tx)
+	}
+	plan := eh.GenerateBundlePlan()
+	for _, tx := range plan.Txs {
+		fmt.Printf("Liquidation: %s | Repay: %s %s | Profit: %s wei\n", tx.Hash, tx.Value, tx.Asset, tx.Profit)
+	}
+	fmt.Printf("Flashloan fees: %s wei | Net profit: %s wei\n", plan.FeesWei, plan.NetProfit)
+}
@@ -0,0 +1,209 @@
+// This file contains tests for health factor computation, close factors,
+// Compound V3 absorb and purchase, unpriced positions and oracle-update
+// re-checks in the liquidation scanner, and the liquidation calls it hands
+// to EventHorizonCore.
+
+package mevliquidator
+
+import (
+	"bytes"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mellis0303/mev-vem/pkg/mev-hypersuper"
+)
+
+const (
+	healthy = "0x000000000000000000000000000000000000a001"
+	under   = "0x000000000000000000000000000000000000a002"
+	edge    = "0x000000000000000000000000000000000000a003"
+
+	weth = "0xC02aaA39b223FE8D0A0e5C4F27eAD9083C756Cc2"
+	usdc = "0xA0b86991c6218b36c1d19D4a2e9Eb0cE3606eB48"
+
+	aavePool = "0x87870Bca3F3fD6335C3F4ce8392D69350B4fA4E2"
+	comet    = "0xc3d688B66703497DAA19211EEdff47f25384cdc3"
+
+	liquidator = "0x00000000000000000000000000000000E0EC0001"
+)
+
+const testSnapshot = `{
+  "block": 19000000,
+  "native": "WETH",
+  "prices": {"WETH": 200000000000, "USDC": 100000000},
+  "markets": {"aave-v3": "` + aavePool + `", "compound-v3": "` + comet + `"},
+  "assets": [
+    {"protocol": "aave-v3", "symbol": "WETH", "address": "` + weth + `", "decimals": 18, "liquidationThreshold": 8250, "liquidationBonus": 500},
+    {"protocol": "aave-v3", "symbol": "USDC", "address": "` + usdc + `", "decimals": 6, "liquidationThreshold": 7800, "liquidationBonus": 450},
+    {"protocol": "compound-v3", "symbol": "WETH", "address": "` + weth + `", "decimals": 18, "liquidationThreshold": 9000, "liquidationBonus": 700},
+    {"protocol": "compound-v3", "symbol": "USDC", "address": "` + usdc + `", "decimals": 6, "liquidationThreshold": 0, "liquidationBonus": 0}
+  ],
+  "positions": [
+    {"borrower": "` + healthy + `", "protocol": "aave-v3", "collateral": {"WETH": 10000000000000000000}, "debt": {"USDC": 10000000000}},
+    {"borrower": "` + under + `", "protocol": "aave-v3", "collateral": {"WETH": 10000000000000000000}, "debt": {"USDC": 17000000000}},
+    {"borrower": "` + edge + `", "protocol": "compound-v3", "collateral": {"WETH": 10000000000000000000}, "debt": {"USDC": 17500000000}}
+  ]
+}`
+
+func loadTestScanner(t *testing.T) *LiquidationScanner {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "snapshot.json")
+	if err := os.WriteFile(path, []byte(testSnapshot), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	snap, err := LoadSnapshot(path)
+	if err != nil {
+		t.Fatalf("LoadSnapshot: %v", err)
+	}
+	return NewLiquidationScanner(snap, big.NewInt(30e9))
+}
+
+func TestScanFindsUnderwaterAccounts(t *testing.T) {
+	scanner := loadTestScanner(t)
+	candidates, err := scanner.Scan()
+	if err != nil {
+		t.Fatalf("Scan: %v", err)
+	}
+	if len(candidates) != 1 || candidates[0].Borrower != under {
+		t.Fatalf("expected only the under borrower to be liquidatable, got %+v", candidates)
+	}
+	c := candidates[0]
+
+	// 10 WETH * $2000 * 82.5% / $17000 = 0.970588...
+	if want := big.NewInt(970588235294117647); c.HealthFactor.Cmp(want) != 0 {
+		t.Errorf("health factor = %s, want %s", c.HealthFactor, want)
+	}
+	// HF above 0.95 caps Aave repay at 50% of the debt
+	if want := big.NewInt(8500e6); c.RepayAmount.Cmp(want) != 0 {
+		t.Errorf("repay = %s, want %s", c.RepayAmount, want)
+	}
+	// $8500 * 1.05 / $2000 = 4.4625 WETH
+	if want, _ := new(big.Int).SetString("4462500000000000000", 10); c.Seized.Cmp(want) != 0 {
+		t.Errorf("seized = %s, want %s", c.Seized, want)
+	}
+	if c.Profit.Sign() <= 0 {
+		t.Errorf("expected positive profit, got %s", c.Profit)
+	}
+}
+
+func TestScanSkipsUnpricedPositions(t *testing.T) {
+	scanner := loadTestScanner(t)
+	scanner.snapshot.Positions = append(scanner.snapshot.Positions, &Position{
+		Borrower:   "0x000000000000000000000000000000000000a004",
+		Protocol:   ProtocolAaveV3,
+		Collateral: map[string]*big.Int{"WBTC": big.NewInt(1e8)},
+		Debt:       map[string]*big.Int{"USDC": big.NewInt(1000e6)},
+	})
+	candidates, err := scanner.Scan()
+	var scanErr *ScanError
+	if !errors.As(err, &scanErr) || len(scanErr.Skipped) != 1 || scanErr.Skipped[0].Borrower != "0x000000000000000000000000000000000000a004" {
+		t.Fatalf("expected the WBTC position to be reported as skipped, got %v", err)
+	}
+	if len(candidates) != 1 || candidates[0].Borrower != under {
+		t.Errorf("the other positions must still be scanned, got %+v", candidates)
+	}
+}
+
+func TestOnOracleUpdatePushesUnder(t *testing.T) {
+	scanner := loadTestScanner(t)
+	// compound position: 10 WETH * $1900 * 90% = $17100 < $17500 debt
+	pushed, err := scanner.OnOracleUpdate(&PriceUpdate{Hash: "0xoracle", Asset: "WETH", Price: big.NewInt(1900e8)})
+	if err != nil {
+		t.Fatalf("OnOracleUpdate: %v", err)
+	}
+	if len(pushed) != 1 || pushed[0].Borrower != edge {
+		t.Fatalf("expected the edge borrower to be pushed under, got %+v", pushed)
+	}
+	if len(pushed[0].DependsOn) != 1 || pushed[0].DependsOn[0] != "0xoracle" {
+		t.Errorf("candidate must depend on the oracle update, got %v", pushed[0].DependsOn)
+	}
+	// absorb takes the whole position; buyCollateral then buys all 10
+	// absorbed WETH at a 7% discount: 10 * $1900 * 93% = $17670, not the debt
+	if want := big.NewInt(17670e6); pushed[0].RepayAmount.Cmp(want) != 0 {
+		t.Errorf("buyCollateral base = %s, want %s", pushed[0].RepayAmount, want)
+	}
+	if want := mevhypersuper.EthToWei(10); pushed[0].Seized.Cmp(want) != 0 {
+		t.Errorf("bought = %s, want all %s absorbed", pushed[0].Seized, want)
+	}
+	if want := big.NewInt(1330e8); pushed[0].Bonus.Cmp(want) != 0 {
+		t.Errorf("discount = %s, want %s", pushed[0].Bonus, want)
+	}
+	if want := big.NewInt(30e9 * (DefaultLiquidationGas + DefaultAbsorbGas)); pushed[0].GasCost.Cmp(want) != 0 {
+		t.Errorf("gas cost = %s, want both calls %s", pushed[0].GasCost, want)
+	}
+
+	txs, err := scanner.EventTxs(pushed, liquidator)
+	if err != nil {
+		t.Fatalf("EventTxs: %v", err)
+	}
+	// Compound V3: absorb once the oracle lands, then buy the collateral
+	if len(txs) != 2 {
+		t.Fatalf("expected absorb and buyCollateral, got %d txs", len(txs))
+	}
+	absorb, buy := txs[0], txs[1]
+	if absorb.DependsOn[0] != "0xoracle" || absorb.Receiver != comet || absorb.Value.Sign() != 0 {
+		t.Errorf("unexpected absorb tx %+v", absorb)
+	}
+	if want, _ := mevhypersuper.EncodeCall(sigAbsorb, liquidator, []string{edge}); !bytes.Equal(absorb.Calldata, want) {
+		t.Errorf("absorb calldata = %x, want %x", absorb.Calldata, want)
+	}
+	if buy.DependsOn[0] != absorb.Hash || buy.Receiver != comet || buy.Profit.Cmp(pushed[0].Profit) != 0 {
+		t.Errorf("unexpected buyCollateral tx %+v", buy)
+	}
+	if buy.Asset != "USDC" || buy.Value.Cmp(pushed[0].RepayAmount) != 0 {
+		t.Errorf("buyCollateral must borrow the repay amount in USDC, got %s %s", buy.Value, buy.Asset)
+	}
+	if want, _ := mevhypersuper.EncodeCall(sigBuyCollateral, weth, pushed[0].Seized, pushed[0].RepayAmount, liquidator); !bytes.Equal(buy.Calldata, want) {
+		t.Errorf("buyCollateral calldata = %x, want %x", buy.Calldata, want)
+	}
+	// 1 USDC unit at $2000/ETH is worth 5e8 wei
+	if want := big.NewInt(5e8); new(big.Int).Quo(scanner.WeiPrices()["USDC"], WAD).Cmp(want) != 0 {
+		t.Errorf("USDC wei price = %s, want %s * 1e18", scanner.WeiPrices()["USDC"], want)
+	}
+}
+
+func TestLiquidationExecutes(t *testing.T) {
+	scanner := loadTestScanner(t)
+	candidates, err := scanner.Scan()
+	if err != nil {
+		t.Fatalf("Scan: %v", err)
+	}
+	txs, err := scanner.EventTxs(candidates, liquidator)
+	if err != nil {
+		t.Fatalf("EventTxs: %v", err)
+	}
+	if len(txs) != 1 || txs[0].Receiver != aavePool {
+		t.Fatalf("expected one liquidationCall on the Aave pool, got %+v", txs)
+	}
+	want, _ := mevhypersuper.EncodeCall(sigLiquidationCall, weth, usdc, under, candidates[0].RepayAmount, false)
+	if !bytes.Equal(txs[0].Calldata, want) {
+		t.Errorf("liquidationCall calldata = %x, want %x", txs[0].Calldata, want)
+	}
+
+	// the call compiles into a signed executor tx
+	eh := mevhypersuper.NewEventHorizon(5, mevhypersuper.EthToWei(1000))
+	eh.AddFlashloanProvider(mevhypersuper.NewAaveV3Flashloan(aavePool, "USDC", big.NewInt(50_000_000e6)))
+	for asset, price := range scanner.WeiPrices() {
+		eh.SetAssetPrice(asset, price)
+	}
+	key := make([]byte, 32)
+	key[31] = 1
+	ex, err := mevhypersuper.NewExecutor(liquidator, big.NewInt(1), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ex.Tokens["USDC"] = usdc
+	eh.SetExecutor(ex)
+	eh.AddTransaction(txs[0])
+	if _, err := eh.ExecuteBundle(eh.GenerateBundlePlan()); err != nil {
+		t.Errorf("ExecuteBundle: %v", err)
+	}
+
+	scanner.snapshot.Markets = nil
+	if _, err := scanner.EventTxs(candidates, liquidator); err == nil {
+		t.Error("EventTxs should fail without a market address")
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"container/heap"
 	"fmt"
 	"sync"
+	"time"
 )
 
 // tasty profitable ETH transaction
@@ -14,6 +15,10 @@ type Transaction struct {
 	Value      uint64
 	GasFee     uint64
 	Profit     int64
+	Gas        uint64    // gas limit, 0 if unknown
+	GasTipCap  uint64    // max priority fee per gas
+	GasFeeCap  uint64    // max fee per gas, 0 for legacy txs
+	Received   time.Time // set when added if zero
 	priority   int64
 	index      int
 }
@@ -48,15 +53,21 @@ func (pq *PriorityQueue) Pop() interface{} {
 
 // manages and optimizes extraction via prioritized tx handling.
 type MEVMempool struct {
-	pq   PriorityQueue
-	lock sync.Mutex
+	pq     PriorityQueue
+	scorer Scorer
+	env    Env
+	lock   sync.Mutex
 }
 
-// initializes a new MEV maximizing transaction pool.
-func NewMEVMempool() *MEVMempool {
+// initializes a new MEV maximizing transaction pool ranked by scorer, or by
+// FeePlusProfit if scorer is nil.
+func NewMEVMempool(scorer Scorer) *MEVMempool {
+	if scorer == nil {
+		scorer = FeePlusProfit{}
+	}
 	pq := make(PriorityQueue, 0)
 	heap.Init(&pq)
-	return &MEVMempool{pq: pq}
+	return &MEVMempool{pq: pq, scorer: scorer}
 }
 
 // evaluates transaction profitability for MEV optimization.
@@ -64,38 +75,73 @@ func CalculatePriority(tx *Transaction) int64 {
 	return int64(tx.GasFee) + tx.Profit
 }
 
-// adds a transaction to the mempool prioritized by profitability.
+// Priority returns the score the transaction was last ranked by.
+func (tx *Transaction) Priority() int64 {
+	return tx.priority
+}
+
+// adds a transaction to the mempool prioritized by the scorer.
 func (m *MEVMempool) AddTransaction(tx *Transaction) {
 	m.lock.Lock()
 	defer m.lock.Unlock()
-	tx.priority = CalculatePriority(tx)
+	m.env.Now = time.Now()
+	if tx.Received.IsZero() {
+		tx.Received = m.env.Now
+	}
+	tx.priority = m.scorer.Score(tx, m.env)
 	heap.Push(&m.pq, tx)
 }
 
-// returns the most profitable bundle for block inclusion.
+// SetBaseFee updates the base fee and re-scores every pending tx.
+func (m *MEVMempool) SetBaseFee(baseFee uint64) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.env.BaseFee = baseFee
+	m.rescore()
+}
+
+// Rescore re-scores every pending tx, for scorers whose inputs changed
+// outside the mempool.
+func (m *MEVMempool) Rescore() {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.rescore()
+}
+
+// rescore re-scores the heap at the current time. Caller holds the lock.
+func (m *MEVMempool) rescore() {
+	m.env.Now = time.Now()
+	for _, tx := range m.pq {
+		tx.priority = m.scorer.Score(tx, m.env)
+	}
+	heap.Init(&m.pq)
+}
+
+// returns the most profitable bundle for block inclusion. Txs that cannot be
+// included at the current base fee stay pending for a later block. Scores
+// that age are refreshed first.
 func (m *MEVMempool) GetOptimalBundle(maxTx int) []*Transaction {
 	m.lock.Lock()
 	defer m.lock.Unlock()
 
-	bundleSize := maxTx
-	if bundleSize > len(m.pq) {
-		bundleSize = len(m.pq)
+	if a, ok := m.scorer.(Aging); ok && a.Ages() {
+		m.rescore()
 	}
-	bundle := make([]*Transaction, bundleSize)
-	for i := 0; i < bundleSize; i++ {
-		bundle[i] = heap.Pop(&m.pq).(*Transaction)
+	var bundle []*Transaction
+	for len(bundle) < maxTx && len(m.pq) > 0 && m.pq[0].priority != Unincludable {
+		bundle = append(bundle, heap.Pop(&m.pq).(*Transaction))
 	}
 	return bundle
 }
 
 // Example demonstrates optimal extraction via transaction prioritization.
 func Example() {
-	mempool := NewMEVMempool()
+	mempool := NewMEVMempool(NetProfit{})
 
 	// Simulate adding profitable transactions
-	mempool.AddTransaction(&Transaction{"0xTx1", "Alice", "DEX", 100, 50, 200, 0, 0})
-	mempool.AddTransaction(&Transaction{"0xTx2", "Bob", "DEX", 200, 40, 250, 0, 0})
-	mempool.AddTransaction(&Transaction{"0xTx3", "Carol", "DEX", 150, 60, 300, 0, 0})
+	mempool.AddTransaction(&Transaction{Hash: "0xTx1", From: "Alice", To: "DEX", Value: 100, GasFee: 50, Profit: 200})
+	mempool.AddTransaction(&Transaction{Hash: "0xTx2", From: "Bob", To: "DEX", Value: 200, GasFee: 40, Profit: 250})
+	mempool.AddTransaction(&Transaction{Hash: "0xTx3", From: "Carol", To: "DEX", Value: 150, GasFee: 60, Profit: 300})
 
 	// Fetch optimal transaction bundle
 	optimalBundle := mempool.GetOptimalBundle(2)
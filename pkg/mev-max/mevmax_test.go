@@ -0,0 +1,141 @@
+// This file contains tests for the MEVMempool's pluggable scorers,
+// re-scoring on base fee changes and at extraction, and keeping unincludable
+// txs pending.
+
+package mevmax
+
+import (
+	"container/heap"
+	"strings"
+	"testing"
+	"time"
+)
+
+func hashes(txs []*Transaction) string {
+	var h []string
+	for _, tx := range txs {
+		h = append(h, tx.Hash)
+	}
+	return strings.Join(h, ",")
+}
+
+func TestDefaultScorerMatchesCalculatePriority(t *testing.T) {
+	mempool := NewMEVMempool(nil)
+	txs := []*Transaction{
+		{Hash: "a", GasFee: 50, Profit: 200},
+		{Hash: "b", GasFee: 40, Profit: 250},
+		{Hash: "c", GasFee: 60, Profit: 300},
+	}
+	for _, tx := range txs {
+		mempool.AddTransaction(tx)
+	}
+	bundle := mempool.GetOptimalBundle(3)
+	if got := hashes(bundle); got != "c,b,a" {
+		t.Fatalf("expected c,b,a, got %s", got)
+	}
+	for _, tx := range bundle {
+		if tx.Priority() != CalculatePriority(tx) {
+			t.Errorf("%s scored %d, expected %d", tx.Hash, tx.Priority(), CalculatePriority(tx))
+		}
+	}
+}
+
+func TestTipPerGasRescoresOnBaseFee(t *testing.T) {
+	mempool := NewMEVMempool(TipPerGas{})
+	mempool.SetBaseFee(10)
+	// a: high tip but a tight fee cap; b: modest tip with headroom
+	mempool.AddTransaction(&Transaction{Hash: "a", GasTipCap: 8, GasFeeCap: 20})
+	mempool.AddTransaction(&Transaction{Hash: "b", GasTipCap: 5, GasFeeCap: 100})
+	mempool.AddTransaction(&Transaction{Hash: "legacy", GasTipCap: 16})
+
+	// at base fee 10: a tips 8, legacy 6, b 5
+	if got := hashes(mempool.GetOptimalBundle(1)); got != "a" {
+		t.Fatalf("expected a first at base fee 10, got %s", got)
+	}
+	mempool.AddTransaction(&Transaction{Hash: "a", GasTipCap: 8, GasFeeCap: 20})
+
+	// at base fee 25 neither a nor legacy can be included; they stay pending
+	mempool.SetBaseFee(25)
+	if got := hashes(mempool.GetOptimalBundle(3)); got != "b" {
+		t.Fatalf("expected only b at base fee 25, got %s", got)
+	}
+	if got := hashes(mempool.GetOptimalBundle(3)); got != "" {
+		t.Fatalf("expected nothing includable at base fee 25, got %s", got)
+	}
+
+	// once the base fee falls they are extracted again
+	mempool.SetBaseFee(10)
+	if got := hashes(mempool.GetOptimalBundle(3)); got != "a,legacy" {
+		t.Errorf("expected a,legacy at base fee 10, got %s", got)
+	}
+}
+
+func TestProfitAndNetProfitScorers(t *testing.T) {
+	heavy := &Transaction{Hash: "heavy", Profit: 1000000, Gas: 500000, GasTipCap: 1, GasFeeCap: 100}
+	lean := &Transaction{Hash: "lean", Profit: 300000, Gas: 50000, GasTipCap: 1, GasFeeCap: 100}
+	env := Env{BaseFee: 1}
+
+	if s := (ProfitPerGas{}).Score(heavy, env); s != 2 {
+		t.Errorf("heavy profit per gas = %d, expected 2", s)
+	}
+	if s := (ProfitPerGas{}).Score(lean, env); s != 6 {
+		t.Errorf("lean profit per gas = %d, expected 6", s)
+	}
+	// gas costs 2 per unit at base fee 1
+	if s := (NetProfit{}).Score(heavy, env); s != 0 {
+		t.Errorf("heavy net profit = %d, expected 0", s)
+	}
+	if s := (NetProfit{}).Score(lean, env); s != 200000 {
+		t.Errorf("lean net profit = %d, expected 200000", s)
+	}
+	if s := (NetProfit{}).Score(&Transaction{Profit: 10, GasFee: 4}, env); s != 6 {
+		t.Errorf("net profit without a gas limit = %d, expected 6", s)
+	}
+	if s := (NetProfit{}).Score(heavy, Env{BaseFee: 101}); s != Unincludable {
+		t.Errorf("expected heavy to be unincludable above its fee cap, got %d", s)
+	}
+}
+
+func TestAgeDecayedAndCustomScorers(t *testing.T) {
+	now := time.Now()
+	decayed := AgeDecayed{Base: ScorerFunc(func(tx *Transaction, env Env) int64 { return tx.Profit }), HalfLife: time.Minute}
+	fresh := &Transaction{Profit: 1000, Received: now}
+	old := &Transaction{Profit: 1000, Received: now.Add(-2 * time.Minute)}
+	if s := decayed.Score(fresh, Env{Now: now}); s != 1000 {
+		t.Errorf("fresh tx scored %d, expected 1000", s)
+	}
+	if s := decayed.Score(old, Env{Now: now}); s != 250 {
+		t.Errorf("two half-lives old tx scored %d, expected 250", s)
+	}
+
+	// a losing tx does not climb toward zero as it waits
+	loser := &Transaction{Profit: -1000, Received: now.Add(-2 * time.Minute)}
+	if s := decayed.Score(loser, Env{Now: now}); s != -4000 {
+		t.Errorf("two half-lives old losing tx scored %d, expected -4000", s)
+	}
+
+	// aging scores are refreshed at extraction, not kept from when they were added
+	aging := NewMEVMempool(decayed)
+	aging.AddTransaction(&Transaction{Hash: "stale", Profit: 1000, Received: now.Add(-10 * time.Minute)})
+	aging.AddTransaction(&Transaction{Hash: "new", Profit: 500})
+	aging.lock.Lock()
+	for _, tx := range aging.pq {
+		// pretend stale still holds the lead it had when both were scored
+		if tx.Hash == "stale" {
+			tx.priority = 1 << 40
+		}
+	}
+	heap.Init(&aging.pq)
+	aging.lock.Unlock()
+	if got := hashes(aging.GetOptimalBundle(1)); got != "new" {
+		t.Errorf("expected new first after rescoring, got %s", got)
+	}
+
+	// a custom scorer ranks by value
+	mempool := NewMEVMempool(ScorerFunc(func(tx *Transaction, env Env) int64 { return int64(tx.Value) }))
+	mempool.AddTransaction(&Transaction{Hash: "low", Value: 1, Profit: 100})
+	mempool.AddTransaction(&Transaction{Hash: "high", Value: 9})
+	if got := hashes(mempool.GetOptimalBundle(2)); got != "high,low" {
+		t.Errorf("expected high,low, got %s", got)
+	}
+}
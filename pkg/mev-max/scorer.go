@@ -0,0 +1,160 @@
+package mevmax
+
+import (
+	"math"
+	"time"
+)
+
+// Env = the chain state a score may depend on.
+type Env struct {
+	BaseFee uint64    // wei per gas
+	Now     time.Time // when the score is taken
+}
+
+// Scorer ranks transactions; the highest score is extracted first.
+type Scorer interface {
+	Score(tx *Transaction, env Env) int64
+}
+
+// ScorerFunc lets a plain function be used as a Scorer.
+type ScorerFunc func(tx *Transaction, env Env) int64
+
+// Score calls f.
+func (f ScorerFunc) Score(tx *Transaction, env Env) int64 {
+	return f(tx, env)
+}
+
+// Aging is implemented by scorers whose score changes as time passes; the
+// mempool re-scores pending txs before every extraction when its scorer ages.
+type Aging interface {
+	Ages() bool
+}
+
+// Unincludable is the score of a tx whose fee cap is below the base fee.
+const Unincludable = math.MinInt64
+
+// FeePlusProfit = the original ranking: total gas fee plus profit.
+type FeePlusProfit struct{}
+
+// Score returns GasFee + Profit.
+func (FeePlusProfit) Score(tx *Transaction, env Env) int64 {
+	return CalculatePriority(tx)
+}
+
+// TipPerGas ranks by what the builder keeps per gas after the base fee is
+// burned: min(GasTipCap, GasFeeCap - BaseFee).
+type TipPerGas struct{}
+
+// Score returns the effective tip per gas.
+func (TipPerGas) Score(tx *Transaction, env Env) int64 {
+	tip, ok := tx.EffectiveTip(env.BaseFee)
+	if !ok {
+		return Unincludable
+	}
+	return saturate(tip)
+}
+
+// ProfitPerGas ranks by profit per unit of gas, so cheap opportunities are
+// not crowded out by large but gas-hungry ones.
+type ProfitPerGas struct{}
+
+// Score returns Profit / Gas, or Profit if Gas is unknown.
+func (ProfitPerGas) Score(tx *Transaction, env Env) int64 {
+	if tx.Gas == 0 {
+		return tx.Profit
+	}
+	return tx.Profit / int64(min(tx.Gas, math.MaxInt64))
+}
+
+// NetProfit ranks by profit after paying for gas at the current base fee.
+type NetProfit struct{}
+
+// Score returns Profit minus the tx's gas cost.
+func (NetProfit) Score(tx *Transaction, env Env) int64 {
+	cost, ok := tx.GasCost(env.BaseFee)
+	if !ok {
+		return Unincludable
+	}
+	if cost > math.MaxInt64 {
+		return math.MinInt64 + 1
+	}
+	net := tx.Profit - int64(cost)
+	if net > tx.Profit {
+		// wrapped around
+		return math.MinInt64 + 1
+	}
+	return net
+}
+
+// AgeDecayed halves another scorer's positive score every HalfLife a tx
+// waits and doubles a negative one, so stale opportunities sink either way.
+// Unincludable txs stay unincludable.
+type AgeDecayed struct {
+	Base     Scorer
+	HalfLife time.Duration
+}
+
+// Ages reports whether the score depends on Env.Now.
+func (s AgeDecayed) Ages() bool {
+	return s.HalfLife > 0
+}
+
+// Score returns the decayed base score.
+func (s AgeDecayed) Score(tx *Transaction, env Env) int64 {
+	score := s.Base.Score(tx, env)
+	age := env.Now.Sub(tx.Received)
+	if score == Unincludable || s.HalfLife <= 0 || age <= 0 {
+		return score
+	}
+	factor := math.Exp2(-float64(age) / float64(s.HalfLife))
+	if score < 0 {
+		factor = 1 / factor
+	}
+	decayed := float64(score) * factor
+	switch {
+	case decayed >= math.MaxInt64:
+		return math.MaxInt64
+	case decayed <= math.MinInt64+1:
+		return math.MinInt64 + 1
+	}
+	return int64(decayed)
+}
+
+// EffectiveTip returns the tip per gas paid at baseFee, and false if the fee
+// cap does not cover the base fee. A tx without a fee cap is a legacy tx
+// paying GasTipCap per gas in total.
+func (tx *Transaction) EffectiveTip(baseFee uint64) (uint64, bool) {
+	feeCap := tx.GasFeeCap
+	if feeCap == 0 {
+		feeCap = tx.GasTipCap
+	}
+	if feeCap < baseFee {
+		return 0, false
+	}
+	return min(tx.GasTipCap, feeCap-baseFee), true
+}
+
+// GasCost returns what the tx pays for gas at baseFee. Without a gas limit it
+// falls back to GasFee.
+func (tx *Transaction) GasCost(baseFee uint64) (uint64, bool) {
+	if tx.Gas == 0 {
+		return tx.GasFee, true
+	}
+	tip, ok := tx.EffectiveTip(baseFee)
+	if !ok {
+		return 0, false
+	}
+	price := baseFee + tip
+	if price != 0 && tx.Gas > math.MaxUint64/price {
+		return math.MaxUint64, true
+	}
+	return tx.Gas * price, true
+}
+
+// saturate converts v to int64, clamping at the maximum.
+func saturate(v uint64) int64 {
+	if v > math.MaxInt64 {
+		return math.MaxInt64
+	}
+	return int64(v)
+}
@@ -4,7 +4,6 @@ import (
 	"fmt"
 	"math/big"
 	"sync"
-	"time"
 )
 
 // Transaction = ETH transactions with advanced analytics
@@ -0,0 +1,447 @@
+package mevwal
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Record layout: length (uint32, type + data) || crc32c(type || data) || type || data.
+const (
+	headerSize    = 8
+	MaxRecordSize = 16 << 20
+)
+
+// Defaults for fsync batching.
+const (
+	DefaultSyncEvery    = 64
+	DefaultSyncInterval = 10 * time.Millisecond
+)
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// ErrClosed is returned by operations on a closed log.
+var ErrClosed = errors.New("wal is closed")
+
+// ErrCorrupt means a damaged record is followed by intact ones, which a crash
+// mid-append cannot leave behind. Open refuses such a log rather than drop
+// the records after the damage.
+var ErrCorrupt = errors.New("wal is corrupt")
+
+// Record = one log entry. Type is defined by the caller.
+type Record struct {
+	Type byte
+	Data []byte
+}
+
+// Options control fsync batching. A record is durable once Sync returns or
+// once SyncEvery records or SyncInterval have passed since it was appended.
+type Options struct {
+	SyncEvery    int           // fsync after this many pending records
+	SyncInterval time.Duration // fsync pending records at least this often
+}
+
+// WAL = an append-only, checksummed log file.
+type WAL struct {
+	path      string
+	opts      Options
+	file      *os.File
+	writer    *bufio.Writer
+	pending   int
+	closed    bool
+	err       error // first failed flush or fsync; later writes return it
+	stop      chan struct{}
+	done      chan struct{}
+	mutex     sync.Mutex
+	TornBytes int64 // bytes dropped from the tail during recovery
+}
+
+// Open opens or creates the log at path and returns the records it holds.
+// Replay stops at the first torn or corrupt record. If nothing valid follows
+// it, it is the torn final record a crash mid-write leaves behind, and the
+// file is truncated there so appends continue from the last good record.
+// Otherwise Open returns ErrCorrupt and leaves the file as it is.
+func Open(path string, opts Options) (*WAL, []Record, error) {
+	if opts.SyncEvery <= 0 {
+		opts.SyncEvery = DefaultSyncEvery
+	}
+	if opts.SyncInterval <= 0 {
+		opts.SyncInterval = DefaultSyncInterval
+	}
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	records, good, err := replay(file)
+	if err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+	size, err := file.Seek(0, io.SeekEnd)
+	if err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+	if size > good {
+		if err := checkTail(file, good, size); err != nil {
+			file.Close()
+			return nil, nil, err
+		}
+		if err := file.Truncate(good); err != nil {
+			file.Close()
+			return nil, nil, err
+		}
+		if err := file.Sync(); err != nil {
+			file.Close()
+			return nil, nil, err
+		}
+	}
+	if _, err := file.Seek(good, io.SeekStart); err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+
+	w := &WAL{
+		path:      path,
+		opts:      opts,
+		file:      file,
+		writer:    bufio.NewWriter(file),
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+		TornBytes: size - good,
+	}
+	go w.syncLoop()
+	return w, records, nil
+}
+
+// replay reads records from the start of file and returns them with the
+// offset just past the last good one.
+func replay(file *os.File) ([]Record, int64, error) {
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, 0, err
+	}
+	r := bufio.NewReader(file)
+	var records []Record
+	var good int64
+	header := make([]byte, headerSize)
+	for {
+		if _, err := io.ReadFull(r, header); err != nil {
+			// clean EOF or a torn header
+			return records, good, nil
+		}
+		length := binary.BigEndian.Uint32(header[0:4])
+		sum := binary.BigEndian.Uint32(header[4:8])
+		if length == 0 || length > MaxRecordSize {
+			return records, good, nil
+		}
+		body := make([]byte, length)
+		if _, err := io.ReadFull(r, body); err != nil {
+			return records, good, nil
+		}
+		if crc32.Checksum(body, crcTable) != sum {
+			return records, good, nil
+		}
+		records = append(records, Record{Type: body[0], Data: body[1:]})
+		good += headerSize + int64(length)
+	}
+}
+
+// Read returns the records in the log at path without opening it for
+// writing, for tools that inspect a log another process appends to. Like
+// Open it stops at a torn final record and returns ErrCorrupt if intact
+// records follow a damaged one; unlike Open it never truncates the file.
+func Read(path string) ([]Record, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	records, good, err := replay(file)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() > good {
+		if err := checkTail(file, good, info.Size()); err != nil {
+			return nil, err
+		}
+	}
+	return records, nil
+}
+
+// checkTail returns ErrCorrupt if a valid record starts anywhere in the bytes
+// after the bad record at good.
+func checkTail(file *os.File, good, size int64) error {
+	tail := make([]byte, size-good)
+	if _, err := file.ReadAt(tail, good); err != nil {
+		return err
+	}
+	for i := 1; i+headerSize < len(tail); i++ {
+		if validFrame(tail[i:]) {
+			return fmt.Errorf("%w: record at offset %d is damaged but a valid record follows at %d", ErrCorrupt, good, good+int64(i))
+		}
+	}
+	return nil
+}
+
+// validFrame reports whether b starts with a complete record whose checksum matches.
+func validFrame(b []byte) bool {
+	length := binary.BigEndian.Uint32(b[0:4])
+	if length == 0 || length > MaxRecordSize || int64(len(b)) < headerSize+int64(length) {
+		return false
+	}
+	return crc32.Checksum(b[headerSize:headerSize+int(length)], crcTable) == binary.BigEndian.Uint32(b[4:8])
+}
+
+func encode(rec Record) ([]byte, error) {
+	length := 1 + len(rec.Data)
+	if length > MaxRecordSize {
+		return nil, fmt.Errorf("record of %d bytes exceeds %d", length, MaxRecordSize)
+	}
+	buf := make([]byte, headerSize+length)
+	buf[headerSize] = rec.Type
+	copy(buf[headerSize+1:], rec.Data)
+	binary.BigEndian.PutUint32(buf[0:4], uint32(length))
+	binary.BigEndian.PutUint32(buf[4:8], crc32.Checksum(buf[headerSize:], crcTable))
+	return buf, nil
+}
+
+// Append adds a record. It is fsynced with the next batch; call Sync to wait
+// for it.
+func (w *WAL) Append(rec Record) error {
+	buf, err := encode(rec)
+	if err != nil {
+		return err
+	}
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.closed {
+		return ErrClosed
+	}
+	if w.err != nil {
+		return w.err
+	}
+	if _, err := w.writer.Write(buf); err != nil {
+		w.err = err
+		return err
+	}
+	w.pending++
+	if w.pending >= w.opts.SyncEvery {
+		return w.sync()
+	}
+	return nil
+}
+
+// Sync flushes and fsyncs every appended record.
+func (w *WAL) Sync() error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.closed {
+		return ErrClosed
+	}
+	return w.sync()
+}
+
+// sync flushes the buffer and fsyncs. A failure is kept: after a failed
+// fsync the kernel may have dropped the dirty pages, so nothing written since
+// the last good sync can be trusted to be on disk. Caller holds the lock.
+func (w *WAL) sync() error {
+	if w.err != nil {
+		return w.err
+	}
+	if err := w.writer.Flush(); err != nil {
+		w.err = err
+		return err
+	}
+	if err := w.file.Sync(); err != nil {
+		w.err = err
+		return err
+	}
+	w.pending = 0
+	return nil
+}
+
+// Err returns the first flush or fsync failure, including one hit by the
+// background sync, or nil. Once set, every write returns it.
+func (w *WAL) Err() error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return w.err
+}
+
+// syncLoop fsyncs pending records every SyncInterval. A failure is kept in
+// w.err and returned by the next Append, Sync, Compact or Close.
+func (w *WAL) syncLoop() {
+	defer close(w.done)
+	ticker := time.NewTicker(w.opts.SyncInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-ticker.C:
+			w.mutex.Lock()
+			if !w.closed && w.pending > 0 {
+				w.sync()
+			}
+			w.mutex.Unlock()
+		}
+	}
+}
+
+// Compact replaces the log with live, dropping everything else. The new log
+// is written and fsynced beside the old one and renamed over it, so a crash
+// leaves either the old or the new log intact.
+func (w *WAL) Compact(live []Record) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.closed {
+		return ErrClosed
+	}
+	if err := w.sync(); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(w.path), filepath.Base(w.path)+".compact-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	bw := bufio.NewWriter(tmp)
+	for _, rec := range live {
+		buf, err := encode(rec)
+		if err != nil {
+			tmp.Close()
+			return err
+		}
+		if _, err := bw.Write(buf); err != nil {
+			tmp.Close()
+			return err
+		}
+	}
+	if err := bw.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := os.Rename(tmp.Name(), w.path); err != nil {
+		tmp.Close()
+		return err
+	}
+	syncDir(filepath.Dir(w.path))
+
+	w.file.Close()
+	w.file = tmp
+	if _, err := w.file.Seek(0, io.SeekEnd); err != nil {
+		return err
+	}
+	w.writer = bufio.NewWriter(w.file)
+	return nil
+}
+
+// WriteFileAtomic replaces path with data, readable only by the owner. It is
+// written and fsynced beside the old file and renamed over it, so a crash
+// leaves either the old or the new contents.
+func WriteFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err := tmp.Chmod(0600); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+	syncDir(filepath.Dir(path))
+	return nil
+}
+
+// syncDir fsyncs a directory so a rename in it is durable. Not every
+// platform supports this; errors are ignored.
+func syncDir(dir string) {
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+}
+
+// Close syncs pending records and closes the file.
+func (w *WAL) Close() error {
+	w.mutex.Lock()
+	if w.closed {
+		w.mutex.Unlock()
+		return nil
+	}
+	err := w.sync()
+	w.closed = true
+	w.mutex.Unlock()
+
+	close(w.stop)
+	<-w.done
+	if cerr := w.file.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// Example usage
+func Example() {
+	dir, err := os.MkdirTemp("", "mev-wal")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "pool.wal")
+
+	w, _, err := Open(path, Options{})
+	if err != nil {
+		panic(err)
+	}
+	w.Append(Record{Type: 1, Data: []byte("tx-1")})
+	w.Append(Record{Type: 1, Data: []byte("tx-2")})
+	w.Append(Record{Type: 2, Data: []byte("tx-1")}) // consumed
+	w.Close()
+
+	w, records, err := Open(path, Options{})
+	if err != nil {
+		panic(err)
+	}
+	fmt.Printf("Recovered %d records\n", len(records))
+	w.Compact([]Record{{Type: 1, Data: []byte("tx-2")}})
+	w.Close()
+
+	w, records, err = Open(path, Options{})
+	if err != nil {
+		panic(err)
+	}
+	defer w.Close()
+	fmt.Printf("After compaction: %d records\n", len(records))
+}
@@ -0,0 +1,200 @@
+// This file contains tests for WAL replay, torn tail recovery, corruption
+// and sync error reporting, compaction, read-only replay and atomic file
+// replacement.
+
+package mevwal
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeRecords(t *testing.T, path string, recs ...Record) {
+	t.Helper()
+	w, _, err := Open(path, Options{})
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	for _, r := range recs {
+		if err := w.Append(r); err != nil {
+			t.Fatalf("Append: %v", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+}
+
+func TestReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pool.wal")
+	writeRecords(t, path, Record{Type: 1, Data: []byte("a")}, Record{Type: 2, Data: nil}, Record{Type: 1, Data: []byte("ccc")})
+
+	w, recs, err := Open(path, Options{})
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer w.Close()
+	if len(recs) != 3 || string(recs[0].Data) != "a" || recs[1].Type != 2 || len(recs[1].Data) != 0 || string(recs[2].Data) != "ccc" {
+		t.Errorf("unexpected records %+v", recs)
+	}
+	if w.TornBytes != 0 {
+		t.Errorf("TornBytes = %d on a clean log", w.TornBytes)
+	}
+}
+
+func TestTornTailIsTruncated(t *testing.T) {
+	for name, damage := range map[string]func([]byte) []byte{
+		"partial header":  func(b []byte) []byte { return append(b, 0, 0, 0) },
+		"partial payload": func(b []byte) []byte { return b[:len(b)-2] },
+		"bad checksum":    func(b []byte) []byte { b[len(b)-1] ^= 0xff; return b },
+	} {
+		path := filepath.Join(t.TempDir(), "pool.wal")
+		writeRecords(t, path, Record{Type: 1, Data: []byte("first")}, Record{Type: 1, Data: []byte("second")})
+		b, _ := os.ReadFile(path)
+		os.WriteFile(path, damage(b), 0600)
+
+		w, recs, err := Open(path, Options{})
+		if err != nil {
+			t.Fatalf("%s: Open: %v", name, err)
+		}
+		want := 1
+		if name == "partial header" {
+			want = 2
+		}
+		if len(recs) != want || string(recs[0].Data) != "first" || w.TornBytes == 0 {
+			t.Errorf("%s: recovered %d records, torn %d bytes", name, len(recs), w.TornBytes)
+		}
+
+		// appends continue after the last good record
+		w.Append(Record{Type: 1, Data: []byte("third")})
+		w.Close()
+		_, recs, _ = Open(path, Options{})
+		if len(recs) != want+1 || string(recs[want].Data) != "third" {
+			t.Errorf("%s: append after recovery lost, got %+v", name, recs)
+		}
+	}
+}
+
+func TestCorruptionBeforeValidRecordsIsAnError(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pool.wal")
+	writeRecords(t, path, Record{Type: 1, Data: []byte("first")}, Record{Type: 1, Data: []byte("second")}, Record{Type: 1, Data: []byte("third")})
+	b, _ := os.ReadFile(path)
+	b[headerSize+1] ^= 0xff // inside the first record
+	os.WriteFile(path, b, 0600)
+
+	if _, _, err := Open(path, Options{}); !errors.Is(err, ErrCorrupt) {
+		t.Fatalf("Open = %v, want ErrCorrupt", err)
+	}
+	if after, _ := os.ReadFile(path); !bytes.Equal(after, b) {
+		t.Errorf("Open changed a corrupt log")
+	}
+}
+
+func TestReadLeavesLogAlone(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pool.wal")
+	writeRecords(t, path, Record{Type: 1, Data: []byte("first")}, Record{Type: 1, Data: []byte("second")})
+	b, _ := os.ReadFile(path)
+	torn := b[:len(b)-2]
+	os.WriteFile(path, torn, 0600)
+
+	recs, err := Read(path)
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	if len(recs) != 1 || string(recs[0].Data) != "first" {
+		t.Errorf("unexpected records %+v", recs)
+	}
+	if after, _ := os.ReadFile(path); !bytes.Equal(after, torn) {
+		t.Errorf("Read truncated the torn tail")
+	}
+
+	b[headerSize+1] ^= 0xff // inside the first record
+	os.WriteFile(path, b, 0600)
+	if _, err := Read(path); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("Read = %v, want ErrCorrupt", err)
+	}
+	if _, err := Read(filepath.Join(t.TempDir(), "missing.wal")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Read of a missing log = %v, want ErrNotExist", err)
+	}
+}
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "state.json")
+	for _, data := range []string{"old", "new"} {
+		if err := WriteFileAtomic(path, []byte(data)); err != nil {
+			t.Fatalf("WriteFileAtomic: %v", err)
+		}
+	}
+	if got, _ := os.ReadFile(path); string(got) != "new" {
+		t.Errorf("file holds %q, want %q", got, "new")
+	}
+	if info, _ := os.Stat(path); info.Mode().Perm() != 0600 {
+		t.Errorf("file mode %v, want 0600", info.Mode().Perm())
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("temporary files left behind: %v", entries)
+	}
+}
+
+func TestSyncFailureIsKept(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pool.wal")
+	w, _, err := Open(path, Options{SyncEvery: 1000, SyncInterval: time.Millisecond})
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	w.mutex.Lock()
+	w.file.Close() // the next background fsync fails
+	w.mutex.Unlock()
+	if err := w.Append(Record{Type: 1, Data: []byte("lost")}); err != nil {
+		t.Fatalf("Append: %v", err)
+	}
+	deadline := time.Now().Add(time.Second)
+	for w.Err() == nil && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if w.Err() == nil {
+		t.Fatalf("background fsync failure was not recorded")
+	}
+	if err := w.Append(Record{Type: 1, Data: []byte("next")}); err == nil {
+		t.Errorf("Append after a failed fsync should fail")
+	}
+	if err := w.Sync(); err == nil {
+		t.Errorf("Sync after a failed fsync should fail")
+	}
+	if err := w.Close(); err == nil {
+		t.Errorf("Close after a failed fsync should fail")
+	}
+}
+
+func TestCompact(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pool.wal")
+	w, _, _ := Open(path, Options{SyncEvery: 1})
+	for i := 0; i < 10; i++ {
+		w.Append(Record{Type: 1, Data: []byte{byte(i)}})
+	}
+	if err := w.Compact([]Record{{Type: 1, Data: []byte{9}}}); err != nil {
+		t.Fatalf("Compact: %v", err)
+	}
+	w.Append(Record{Type: 2, Data: []byte{10}})
+	w.Close()
+
+	w, recs, err := Open(path, Options{})
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer w.Close()
+	if len(recs) != 2 || recs[0].Data[0] != 9 || recs[1].Type != 2 {
+		t.Errorf("unexpected records after compaction %+v", recs)
+	}
+	if err := w.Close(); err != nil {
+		t.Errorf("Close: %v", err)
+	}
+	if err := w.Append(Record{Type: 1}); err != ErrClosed {
+		t.Errorf("Append after Close = %v, want ErrClosed", err)
+	}
+}